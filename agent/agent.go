@@ -0,0 +1,92 @@
+// Package agent serves a REST API over the Task Scheduler, for managing scheduled
+// tasks from systems that cannot use COM.
+//
+// The API is served by NewHandler from a Backend: NewServiceBackend on Windows,
+// which drives a taskmaster.TaskService, or NewFakeBackend, an in-memory backend
+// that runs anywhere, so the API can be exercised end to end without Windows.
+// Every request except GET /v1/openapi.json must carry one of the configured
+// bearer tokens.
+//
+// Task and folder paths are given in the URL with forward slashes, so the task
+// \Backups\Nightly is at /v1/tasks/Backups/Nightly. Request and response bodies
+// are JSON; task definitions use the encoding of taskmaster.Definition.MarshalJSON.
+// The full API is described by the OpenAPI document served at /v1/openapi.json.
+package agent
+
+import (
+	"errors"
+
+	"github.com/giert/taskmaster"
+)
+
+var (
+	ErrFolderNotEmpty = errors.New("the folder is not empty")
+	ErrTaskDisabled   = errors.New("the task is disabled")
+	ErrClosed         = errors.New("the backend is closed")
+)
+
+// Backend performs the operations of the API. Paths are Task Scheduler paths,
+// starting with the root folder "\". Backends report missing tasks and folders
+// with errors matching fs.ErrNotExist, existing ones with fs.ErrExist, and invalid
+// requests with fs.ErrInvalid. Methods may be called concurrently.
+type Backend interface {
+	GetFolder(path string) (Folder, error)
+	CreateFolder(path string) error
+	DeleteFolder(path string, recursive bool) error // returns ErrFolderNotEmpty if the folder is not empty and recursive is not set
+
+	GetTask(path string) (Task, error)
+	RegisterTask(path string, req RegisterRequest, createOnly bool) (Task, bool, error) // also reports whether the task was created
+	DeleteTask(path string) error
+	SetTaskEnabled(path string, enabled bool) (Task, error)
+
+	RunTask(path string, req RunRequest) (Instance, error) // returns ErrTaskDisabled if the task is disabled
+	StopTask(path string) error
+	GetInstances(path string) ([]Instance, error) // the instances of every task if path is "\"
+	GetHistory(path string) ([]taskmaster.TaskRun, error)
+}
+
+// Folder is a task folder with its subfolders and tasks.
+type Folder struct {
+	Path    string
+	Folders []string                 // the paths of the subfolders
+	Tasks   []taskmaster.TaskSummary // the tasks of the folder, without their subfolders' tasks
+}
+
+// Task is a registered task with its definition.
+type Task struct {
+	taskmaster.TaskSummary
+	Definition taskmaster.Definition
+}
+
+// Instance is a running instance of a task.
+type Instance struct {
+	InstanceGUID  string               // the GUID identifier for this instance of the task
+	Path          string               // the path of the task
+	Name          string               // the name of the task
+	State         taskmaster.TaskState // the state of the instance
+	CurrentAction string               // the name of the action that the instance is performing
+	EnginePID     uint                 // the process ID of the engine running the instance
+}
+
+// RegisterRequest is the body of a request to register a task.
+type RegisterRequest struct {
+	Definition taskmaster.Definition
+	Username   string `json:",omitempty"` // the user the task runs as, instead of its principal's UserID
+	Password   string `json:",omitempty"` // the password of Username, for TASK_LOGON_PASSWORD tasks
+}
+
+// RunRequest is the body of a request to run a task.
+type RunRequest struct {
+	Args              []string `json:",omitempty"` // the values of the $(ArgX) parameters of the task's actions
+	IgnoreConstraints bool     `json:",omitempty"` // run the task regardless of its conditions, such as running only when idle
+}
+
+// EnabledRequest is the body of a request to enable or disable a task.
+type EnabledRequest struct {
+	Enabled *bool
+}
+
+// ErrorResponse is the body of every error response.
+type ErrorResponse struct {
+	Error string
+}
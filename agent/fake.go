@@ -0,0 +1,394 @@
+package agent
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giert/taskmaster"
+)
+
+// FakeBackend is an in-memory Backend that needs no Task Scheduler. Paths are
+// case-insensitive like in the Task Scheduler. A run of a task starts an instance
+// that keeps running until the task is stopped, and is recorded in the task's run
+// history; task triggers never fire.
+type FakeBackend struct {
+	mu      sync.Mutex
+	folders map[string]string // folder paths by their lowercase form
+	tasks   map[string]*fakeTask
+	runs    []*taskmaster.TaskRun
+	nextPID uint
+}
+
+var _ Backend = (*FakeBackend)(nil)
+
+type fakeTask struct {
+	path       string
+	definition taskmaster.Definition
+	lastRun    time.Time
+	lastResult taskmaster.TaskResult
+}
+
+// NewFakeBackend returns a FakeBackend with an empty root folder.
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{
+		folders: map[string]string{`\`: `\`},
+		tasks:   make(map[string]*fakeTask),
+		nextPID: 1000,
+	}
+}
+
+func parentPath(path string) string {
+	i := strings.LastIndex(path, `\`)
+	if i <= 0 {
+		return `\`
+	}
+
+	return path[:i]
+}
+
+func notExist(kind, path string) error {
+	return fmt.Errorf("%s %s: %w", kind, path, fs.ErrNotExist)
+}
+
+func (b *FakeBackend) GetFolder(path string) (Folder, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	folderPath, ok := b.folders[strings.ToLower(path)]
+	if !ok {
+		return Folder{}, notExist("folder", path)
+	}
+
+	folder := Folder{Path: folderPath}
+	for key, subFolderPath := range b.folders {
+		if key != `\` && strings.EqualFold(parentPath(subFolderPath), folderPath) {
+			folder.Folders = append(folder.Folders, subFolderPath)
+		}
+	}
+	for _, task := range b.tasks {
+		if strings.EqualFold(parentPath(task.path), folderPath) {
+			folder.Tasks = append(folder.Tasks, b.summary(task))
+		}
+	}
+	slices.Sort(folder.Folders)
+	slices.SortFunc(folder.Tasks, func(a, b taskmaster.TaskSummary) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return folder, nil
+}
+
+func (b *FakeBackend) CreateFolder(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.folders[strings.ToLower(path)]; ok {
+		return fmt.Errorf("folder %s: %w", path, fs.ErrExist)
+	}
+	if _, ok := b.tasks[strings.ToLower(path)]; ok {
+		return fmt.Errorf("%s is a task: %w", path, fs.ErrExist)
+	}
+	b.createFolders(path)
+
+	return nil
+}
+
+// createFolders creates the folder at path and its missing parents.
+func (b *FakeBackend) createFolders(path string) {
+	for ; path != `\`; path = parentPath(path) {
+		if _, ok := b.folders[strings.ToLower(path)]; ok {
+			return
+		}
+		b.folders[strings.ToLower(path)] = path
+	}
+}
+
+func (b *FakeBackend) DeleteFolder(path string, recursive bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := strings.ToLower(path)
+	if key == `\` {
+		return fmt.Errorf("the root folder cannot be deleted: %w", fs.ErrInvalid)
+	} else if _, ok := b.folders[key]; !ok {
+		return notExist("folder", path)
+	}
+
+	prefix := key + `\`
+	var subFolders, tasks []string
+	for k := range b.folders {
+		if strings.HasPrefix(k, prefix) {
+			subFolders = append(subFolders, k)
+		}
+	}
+	for k := range b.tasks {
+		if strings.HasPrefix(k, prefix) {
+			tasks = append(tasks, k)
+		}
+	}
+	if !recursive && len(subFolders)+len(tasks) > 0 {
+		return fmt.Errorf("error deleting folder %s: %w", path, ErrFolderNotEmpty)
+	}
+
+	for _, k := range subFolders {
+		delete(b.folders, k)
+	}
+	for _, k := range tasks {
+		b.deleteTask(k)
+	}
+	delete(b.folders, key)
+
+	return nil
+}
+
+func (b *FakeBackend) GetTask(path string) (Task, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	task, ok := b.tasks[strings.ToLower(path)]
+	if !ok {
+		return Task{}, notExist("task", path)
+	}
+
+	return b.task(task), nil
+}
+
+func (b *FakeBackend) RegisterTask(path string, req RegisterRequest, createOnly bool) (Task, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(req.Definition.Actions) == 0 {
+		return Task{}, false, fmt.Errorf("error registering task %s: definition must have at least one action: %w", path, fs.ErrInvalid)
+	}
+	if req.Definition.Principal.UserID != "" && req.Definition.Principal.GroupID != "" {
+		return Task{}, false, fmt.Errorf("error registering task %s: both UserId and GroupId are defined for the principal: %w", path, fs.ErrInvalid)
+	}
+
+	key := strings.ToLower(path)
+	if _, ok := b.folders[key]; ok {
+		return Task{}, false, fmt.Errorf("error registering task %s: it is a folder: %w", path, fs.ErrExist)
+	}
+	task, exists := b.tasks[key]
+	if exists && createOnly {
+		return Task{}, false, fmt.Errorf("error registering task %s: %w", path, fs.ErrExist)
+	}
+	if !exists {
+		task = &fakeTask{path: path, lastResult: taskmaster.SCHED_S_TASK_HAS_NOT_RUN}
+		b.tasks[key] = task
+		b.createFolders(parentPath(path))
+	}
+
+	def := req.Definition
+	def.RegistrationInfo.URI = task.path
+	if req.Username != "" {
+		def.Principal.UserID = req.Username
+	}
+	task.definition = def
+
+	return b.task(task), !exists, nil
+}
+
+func (b *FakeBackend) DeleteTask(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := strings.ToLower(path)
+	if _, ok := b.tasks[key]; !ok {
+		return notExist("task", path)
+	}
+	b.deleteTask(key)
+
+	return nil
+}
+
+// deleteTask deletes a task and terminates its running instances.
+func (b *FakeBackend) deleteTask(key string) {
+	b.stopTask(b.tasks[key])
+	delete(b.tasks, key)
+}
+
+func (b *FakeBackend) SetTaskEnabled(path string, enabled bool) (Task, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	task, ok := b.tasks[strings.ToLower(path)]
+	if !ok {
+		return Task{}, notExist("task", path)
+	}
+	task.definition.Settings.Enabled = enabled
+
+	return b.task(task), nil
+}
+
+func (b *FakeBackend) RunTask(path string, req RunRequest) (Instance, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	task, ok := b.tasks[strings.ToLower(path)]
+	if !ok {
+		return Instance{}, notExist("task", path)
+	} else if !task.definition.Settings.Enabled {
+		return Instance{}, fmt.Errorf("error running task %s: %w", path, ErrTaskDisabled)
+	}
+
+	guid, err := newGUID()
+	if err != nil {
+		return Instance{}, fmt.Errorf("error running task %s: %w", path, err)
+	}
+	now := time.Now()
+	run := &taskmaster.TaskRun{
+		InstanceGUID:  guid,
+		Path:          task.path,
+		Trigger:       taskmaster.RunTriggerUser,
+		UserContext:   task.definition.Principal.UserID,
+		Started:       now,
+		ActionName:    actionName(task.definition),
+		ActionStarted: now,
+		ProcessID:     b.nextPID,
+		EventIDs:      []int{110, 100, 200},
+	}
+	b.nextPID++
+	b.runs = append(b.runs, run)
+	task.lastRun = now
+	task.lastResult = taskmaster.SCHED_S_TASK_RUNNING
+
+	return instance(task, run), nil
+}
+
+func (b *FakeBackend) StopTask(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	task, ok := b.tasks[strings.ToLower(path)]
+	if !ok {
+		return notExist("task", path)
+	}
+	b.stopTask(task)
+
+	return nil
+}
+
+// stopTask terminates the running instances of a task.
+func (b *FakeBackend) stopTask(task *fakeTask) {
+	stopped := false
+	for _, run := range b.runs {
+		if run.Path == task.path && run.Completed.IsZero() {
+			run.Completed = time.Now()
+			run.Terminated = true
+			run.ResultCode = taskmaster.SCHED_S_TASK_TERMINATED
+			run.EventIDs = append(run.EventIDs, 111, 201, 102)
+			stopped = true
+		}
+	}
+	if stopped {
+		task.lastResult = taskmaster.SCHED_S_TASK_TERMINATED
+	}
+}
+
+func (b *FakeBackend) GetInstances(path string) ([]Instance, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	all := path == `\`
+	if _, ok := b.tasks[strings.ToLower(path)]; !ok && !all {
+		return nil, notExist("task", path)
+	}
+
+	var instances []Instance
+	for _, run := range b.runs {
+		if run.Completed.IsZero() && (all || strings.EqualFold(run.Path, path)) {
+			instances = append(instances, instance(b.tasks[strings.ToLower(run.Path)], run))
+		}
+	}
+
+	return instances, nil
+}
+
+func (b *FakeBackend) GetHistory(path string) ([]taskmaster.TaskRun, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.tasks[strings.ToLower(path)]; !ok {
+		return nil, notExist("task", path)
+	}
+
+	var runs []taskmaster.TaskRun
+	for _, run := range b.runs {
+		if strings.EqualFold(run.Path, path) {
+			r := *run
+			r.EventIDs = slices.Clone(run.EventIDs)
+			runs = append(runs, r)
+		}
+	}
+
+	return runs, nil
+}
+
+func (b *FakeBackend) summary(task *fakeTask) taskmaster.TaskSummary {
+	state := taskmaster.TASK_STATE_READY
+	if !task.definition.Settings.Enabled {
+		state = taskmaster.TASK_STATE_DISABLED
+	}
+	for _, run := range b.runs {
+		if run.Path == task.path && run.Completed.IsZero() {
+			state = taskmaster.TASK_STATE_RUNNING
+		}
+	}
+
+	return taskmaster.TaskSummary{
+		Name:           task.path[strings.LastIndex(task.path, `\`)+1:],
+		Path:           task.path,
+		Enabled:        task.definition.Settings.Enabled,
+		State:          state,
+		LastRunTime:    task.lastRun,
+		LastTaskResult: task.lastResult,
+	}
+}
+
+func (b *FakeBackend) task(task *fakeTask) Task {
+	return Task{TaskSummary: b.summary(task), Definition: task.definition}
+}
+
+func instance(task *fakeTask, run *taskmaster.TaskRun) Instance {
+	return Instance{
+		InstanceGUID:  run.InstanceGUID,
+		Path:          task.path,
+		Name:          task.path[strings.LastIndex(task.path, `\`)+1:],
+		State:         taskmaster.TASK_STATE_RUNNING,
+		CurrentAction: run.ActionName,
+		EnginePID:     run.ProcessID,
+	}
+}
+
+// actionName returns the name the Task Scheduler gives the first action of a
+// definition in its run history.
+func actionName(def taskmaster.Definition) string {
+	if len(def.Actions) == 0 {
+		return ""
+	}
+	switch action := def.Actions[0].(type) {
+	case taskmaster.ExecAction:
+		return action.Path
+	case taskmaster.ComHandlerAction:
+		return action.ClassID
+	default:
+		return ""
+	}
+}
+
+// newGUID returns a random GUID in the format of taskmaster.RunningTask.InstanceGUID.
+func newGUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("{%X-%X-%X-%X-%X}", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
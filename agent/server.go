@@ -0,0 +1,431 @@
+package agent
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/giert/taskmaster"
+)
+
+// maxBodySize is the largest request body the API accepts.
+const maxBodySize = 1 << 20
+
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// Options configures NewHandler.
+type Options struct {
+	Tokens []string     // the accepted bearer tokens; every request is refused if there are none
+	Logger *slog.Logger // logs every request if set
+}
+
+// endpoint handles an API request for the task or folder at path, and returns the
+// status and the body of the response. A nil body means an empty response.
+type endpoint func(s *server, r *http.Request, path string) (int, any, error)
+
+type route struct {
+	method  string
+	pattern string
+	handle  endpoint
+}
+
+var routes = []route{
+	{http.MethodGet, "/v1/folders/{path...}", getFolder},
+	{http.MethodPut, "/v1/folders/{path...}", putFolder},
+	{http.MethodDelete, "/v1/folders/{path...}", deleteFolder},
+	{http.MethodGet, "/v1/tasks/{path...}", getTask},
+	{http.MethodPut, "/v1/tasks/{path...}", putTask},
+	{http.MethodPatch, "/v1/tasks/{path...}", patchTask},
+	{http.MethodDelete, "/v1/tasks/{path...}", deleteTask},
+	{http.MethodPost, "/v1/run/{path...}", runTask},
+	{http.MethodPost, "/v1/stop/{path...}", stopTask},
+	{http.MethodGet, "/v1/instances/{path...}", getInstances},
+	{http.MethodGet, "/v1/history/{path...}", getHistory},
+}
+
+type server struct {
+	backend Backend
+	tokens  [][]byte
+}
+
+// requestError is an error in a request, which is answered with status.
+type requestError struct {
+	status int
+	msg    string
+}
+
+func (e requestError) Error() string {
+	return e.msg
+}
+
+func badRequest(format string, args ...any) error {
+	return requestError{status: http.StatusBadRequest, msg: fmt.Sprintf(format, args...)}
+}
+
+// NewHandler returns a handler serving the API over backend.
+func NewHandler(backend Backend, opts Options) http.Handler {
+	s := &server{backend: backend}
+	for _, token := range opts.Tokens {
+		if token != "" {
+			s.tokens = append(s.tokens, []byte(token))
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPIDocument)
+	})
+	for _, route := range routes {
+		mux.HandleFunc(route.method+" "+route.pattern, s.serve(route.handle))
+	}
+
+	if opts.Logger == nil {
+		return mux
+	}
+	return logRequests(mux, opts.Logger)
+}
+
+// serve returns the handler of an endpoint, which authorizes the request and
+// encodes the response.
+func (s *server) serve(handle endpoint) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="taskmaster"`)
+			writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "missing or invalid bearer token"})
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+		status, body, err := s.handleRequest(handle, r)
+		if err != nil {
+			status, body = errorStatus(err), ErrorResponse{Error: err.Error()}
+		}
+		writeJSON(w, status, body)
+	}
+}
+
+func (s *server) handleRequest(handle endpoint, r *http.Request) (int, any, error) {
+	path, err := taskPath(r.PathValue("path"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return handle(s, r, path)
+}
+
+func (s *server) authorized(r *http.Request) bool {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+
+	authorized := false
+	for _, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), t) == 1 {
+			authorized = true
+		}
+	}
+
+	return authorized
+}
+
+// taskPath converts the path of a URL, such as Backups/Nightly, to the Task
+// Scheduler path \Backups\Nightly.
+func taskPath(urlPath string) (string, error) {
+	urlPath = strings.Trim(urlPath, "/")
+	if urlPath == "" {
+		return `\`, nil
+	}
+
+	segments := strings.Split(urlPath, "/")
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." || strings.ContainsAny(segment, `\:*?"<>|`) {
+			return "", badRequest("invalid path %q", urlPath)
+		}
+	}
+
+	return `\` + strings.Join(segments, `\`), nil
+}
+
+func requireTaskPath(path string) error {
+	if path == `\` {
+		return badRequest("a task path is required")
+	}
+
+	return nil
+}
+
+// decodeBody decodes the JSON body of a request into v. An empty body is an error
+// unless optional is set.
+func decodeBody(r *http.Request, v any, optional bool) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, io.EOF) && optional:
+		return nil
+	case errors.Is(err, io.EOF):
+		return badRequest("the request body is empty")
+	case errors.As(err, &maxBytesErr):
+		return requestError{status: http.StatusRequestEntityTooLarge, msg: fmt.Sprintf("the request body is larger than %d bytes", maxBytesErr.Limit)}
+	default:
+		return badRequest("error decoding request body: %v", err)
+	}
+}
+
+func errorStatus(err error) int {
+	var reqErr requestError
+	switch {
+	case errors.As(err, &reqErr):
+		return reqErr.status
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, fs.ErrExist), errors.Is(err, ErrFolderNotEmpty), errors.Is(err, ErrTaskDisabled):
+		return http.StatusConflict
+	case errors.Is(err, fs.ErrInvalid):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(ErrorResponse{Error: fmt.Sprintf("error encoding response: %v", err)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+func getFolder(s *server, r *http.Request, path string) (int, any, error) {
+	folder, err := s.backend.GetFolder(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	if folder.Folders == nil {
+		folder.Folders = []string{}
+	}
+	if folder.Tasks == nil {
+		folder.Tasks = []taskmaster.TaskSummary{}
+	}
+
+	return http.StatusOK, folder, nil
+}
+
+func putFolder(s *server, r *http.Request, path string) (int, any, error) {
+	status := http.StatusOK
+	if path != `\` {
+		err := s.backend.CreateFolder(path)
+		if err == nil {
+			status = http.StatusCreated
+		} else if !errors.Is(err, fs.ErrExist) {
+			return 0, nil, err
+		}
+	}
+
+	_, folder, err := getFolder(s, r, path)
+	return status, folder, err
+}
+
+func deleteFolder(s *server, r *http.Request, path string) (int, any, error) {
+	if path == `\` {
+		return 0, nil, badRequest("the root folder cannot be deleted")
+	}
+	recursive := false
+	if value := r.URL.Query().Get("recursive"); value != "" {
+		var err error
+		if recursive, err = strconv.ParseBool(value); err != nil {
+			return 0, nil, badRequest("invalid recursive parameter %q", value)
+		}
+	}
+
+	if err := s.backend.DeleteFolder(path, recursive); err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
+
+func getTask(s *server, r *http.Request, path string) (int, any, error) {
+	if err := requireTaskPath(path); err != nil {
+		return 0, nil, err
+	}
+	task, err := s.backend.GetTask(path)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, task, nil
+}
+
+// putTask registers a task, or only creates it if the request has an
+// "If-None-Match: *" header.
+func putTask(s *server, r *http.Request, path string) (int, any, error) {
+	if err := requireTaskPath(path); err != nil {
+		return 0, nil, err
+	}
+	var req RegisterRequest
+	if err := decodeBody(r, &req, false); err != nil {
+		return 0, nil, err
+	}
+	createOnly := strings.TrimSpace(r.Header.Get("If-None-Match")) == "*"
+
+	task, created, err := s.backend.RegisterTask(path, req, createOnly)
+	if createOnly && errors.Is(err, fs.ErrExist) {
+		return 0, nil, requestError{status: http.StatusPreconditionFailed, msg: err.Error()}
+	} else if err != nil {
+		return 0, nil, err
+	}
+
+	if created {
+		return http.StatusCreated, task, nil
+	}
+	return http.StatusOK, task, nil
+}
+
+func patchTask(s *server, r *http.Request, path string) (int, any, error) {
+	if err := requireTaskPath(path); err != nil {
+		return 0, nil, err
+	}
+	var req EnabledRequest
+	if err := decodeBody(r, &req, false); err != nil {
+		return 0, nil, err
+	}
+	if req.Enabled == nil {
+		return 0, nil, badRequest("the request does not set Enabled")
+	}
+
+	task, err := s.backend.SetTaskEnabled(path, *req.Enabled)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, task, nil
+}
+
+func deleteTask(s *server, r *http.Request, path string) (int, any, error) {
+	if err := requireTaskPath(path); err != nil {
+		return 0, nil, err
+	}
+	if err := s.backend.DeleteTask(path); err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
+
+func runTask(s *server, r *http.Request, path string) (int, any, error) {
+	if err := requireTaskPath(path); err != nil {
+		return 0, nil, err
+	}
+	var req RunRequest
+	if err := decodeBody(r, &req, true); err != nil {
+		return 0, nil, err
+	}
+
+	instance, err := s.backend.RunTask(path, req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusAccepted, instance, nil
+}
+
+func stopTask(s *server, r *http.Request, path string) (int, any, error) {
+	if err := requireTaskPath(path); err != nil {
+		return 0, nil, err
+	}
+	if err := s.backend.StopTask(path); err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusNoContent, nil, nil
+}
+
+func getInstances(s *server, r *http.Request, path string) (int, any, error) {
+	instances, err := s.backend.GetInstances(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	if instances == nil {
+		instances = []Instance{}
+	}
+
+	return http.StatusOK, instances, nil
+}
+
+func getHistory(s *server, r *http.Request, path string) (int, any, error) {
+	if err := requireTaskPath(path); err != nil {
+		return 0, nil, err
+	}
+	runs, err := s.backend.GetHistory(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	if runs == nil {
+		runs = []taskmaster.TaskRun{}
+	}
+
+	return http.StatusOK, runs, nil
+}
+
+// statusRecorder records the status and size of a response for logging.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(data)
+	r.size += n
+
+	return n, err
+}
+
+// logRequests logs every request to next, failed ones at the error level.
+func logRequests(next http.Handler, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int("bytes", rec.size),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote", r.RemoteAddr),
+		)
+	})
+}
@@ -0,0 +1,294 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/giert/taskmaster"
+)
+
+const testToken = "s3cret"
+
+type testClient struct {
+	t      *testing.T
+	server *httptest.Server
+	token  string
+}
+
+func newTestClient(t *testing.T, opts Options) *testClient {
+	t.Helper()
+	if opts.Tokens == nil {
+		opts.Tokens = []string{testToken}
+	}
+	server := httptest.NewServer(NewHandler(NewFakeBackend(), opts))
+	t.Cleanup(server.Close)
+
+	return &testClient{t: t, server: server, token: testToken}
+}
+
+// do sends a request and decodes the response body into out, if it is not nil.
+func (c *testClient) do(method, path string, body any, header http.Header, out any) int {
+	c.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.server.URL+path, reader)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			c.t.Fatalf("error decoding response of %s %s: %v", method, path, err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+func (c *testClient) expect(wantStatus int, method, path string, body any, out any) {
+	c.t.Helper()
+	if status := c.do(method, path, body, nil, out); status != wantStatus {
+		c.t.Fatalf("%s %s returned %d, want %d", method, path, status, wantStatus)
+	}
+}
+
+func testDefinition() taskmaster.Definition {
+	def := taskmaster.DefaultDefinition()
+	def.Principal.UserID = "SYSTEM"
+	def.Principal.LogonType = taskmaster.TASK_LOGON_SERVICE_ACCOUNT
+	def.AddAction(taskmaster.ExecAction{Path: `C:\Tools\backup.exe`, Args: "$(Arg0)"})
+	def.AddTrigger(taskmaster.DailyTrigger{TaskTrigger: taskmaster.TaskTrigger{Enabled: true}, DayInterval: taskmaster.EveryDay})
+
+	return def
+}
+
+func TestAgentTasks(t *testing.T) {
+	c := newTestClient(t, Options{})
+	def := testDefinition()
+
+	var task Task
+	c.expect(http.StatusCreated, http.MethodPut, "/v1/tasks/Backups/Nightly", RegisterRequest{Definition: def}, &task)
+	if task.Path != `\Backups\Nightly` || task.Name != "Nightly" || !task.Enabled || task.State != taskmaster.TASK_STATE_READY {
+		t.Errorf("registered task %+v", task.TaskSummary)
+	}
+	def.RegistrationInfo.URI = task.Path
+	if changes := taskmaster.DiffDefinitions(def, task.Definition); len(changes) != 0 {
+		t.Errorf("registered definition differs: %v", changes)
+	}
+
+	// the folder was created along with the task
+	var folder Folder
+	c.expect(http.StatusOK, http.MethodGet, "/v1/folders/", nil, &folder)
+	if folder.Path != `\` || len(folder.Folders) != 1 || folder.Folders[0] != `\Backups` || len(folder.Tasks) != 0 {
+		t.Errorf("root folder %+v", folder)
+	}
+	c.expect(http.StatusOK, http.MethodGet, "/v1/folders/backups", nil, &folder)
+	if len(folder.Tasks) != 1 || folder.Tasks[0].Path != `\Backups\Nightly` {
+		t.Errorf("backups folder %+v", folder)
+	}
+
+	// updating keeps the task; creating only fails
+	def.RegistrationInfo.Description = "nightly backup"
+	c.expect(http.StatusOK, http.MethodPut, "/v1/tasks/Backups/Nightly", RegisterRequest{Definition: def}, &task)
+	if task.Definition.RegistrationInfo.Description != "nightly backup" {
+		t.Errorf("updated description %q", task.Definition.RegistrationInfo.Description)
+	}
+	header := http.Header{"If-None-Match": {"*"}}
+	if status := c.do(http.MethodPut, "/v1/tasks/Backups/Nightly", RegisterRequest{Definition: def}, header, nil); status != http.StatusPreconditionFailed {
+		t.Errorf("creating an existing task returned %d", status)
+	}
+	if status := c.do(http.MethodPut, "/v1/tasks/Backups/Weekly", RegisterRequest{Definition: def}, header, nil); status != http.StatusCreated {
+		t.Errorf("creating a new task returned %d", status)
+	}
+
+	c.expect(http.StatusOK, http.MethodGet, "/v1/tasks/Backups/Nightly", nil, &task)
+	if len(task.Definition.Actions) != 1 || len(task.Definition.Triggers) != 1 {
+		t.Errorf("task definition %+v", task.Definition)
+	}
+
+	// disable, fail to run, enable and run
+	disabled := false
+	c.expect(http.StatusOK, http.MethodPatch, "/v1/tasks/Backups/Nightly", EnabledRequest{Enabled: &disabled}, &task)
+	if task.Enabled || task.State != taskmaster.TASK_STATE_DISABLED {
+		t.Errorf("disabled task %+v", task.TaskSummary)
+	}
+	c.expect(http.StatusConflict, http.MethodPost, "/v1/run/Backups/Nightly", nil, nil)
+	enabled := true
+	c.expect(http.StatusOK, http.MethodPatch, "/v1/tasks/Backups/Nightly", EnabledRequest{Enabled: &enabled}, &task)
+
+	var instance Instance
+	c.expect(http.StatusAccepted, http.MethodPost, "/v1/run/Backups/Nightly", RunRequest{Args: []string{"--full"}}, &instance)
+	if instance.Path != `\Backups\Nightly` || instance.State != taskmaster.TASK_STATE_RUNNING || instance.CurrentAction != `C:\Tools\backup.exe` {
+		t.Errorf("started instance %+v", instance)
+	}
+	var instances []Instance
+	c.expect(http.StatusOK, http.MethodGet, "/v1/instances/", nil, &instances)
+	if len(instances) != 1 || instances[0].InstanceGUID != instance.InstanceGUID {
+		t.Errorf("running instances %+v", instances)
+	}
+	c.expect(http.StatusOK, http.MethodGet, "/v1/tasks/Backups/Nightly", nil, &task)
+	if task.State != taskmaster.TASK_STATE_RUNNING || task.LastRunTime.IsZero() {
+		t.Errorf("running task %+v", task.TaskSummary)
+	}
+
+	c.expect(http.StatusNoContent, http.MethodPost, "/v1/stop/Backups/Nightly", nil, nil)
+	c.expect(http.StatusOK, http.MethodGet, "/v1/instances/Backups/Nightly", nil, &instances)
+	if len(instances) != 0 {
+		t.Errorf("instances after stop %+v", instances)
+	}
+	var runs []taskmaster.TaskRun
+	c.expect(http.StatusOK, http.MethodGet, "/v1/history/Backups/Nightly", nil, &runs)
+	if len(runs) != 1 || runs[0].InstanceGUID != instance.InstanceGUID || !runs[0].Terminated || runs[0].Trigger != taskmaster.RunTriggerUser {
+		t.Errorf("run history %+v", runs)
+	}
+
+	c.expect(http.StatusNoContent, http.MethodDelete, "/v1/tasks/Backups/Nightly", nil, nil)
+	c.expect(http.StatusNotFound, http.MethodGet, "/v1/tasks/Backups/Nightly", nil, nil)
+	c.expect(http.StatusNotFound, http.MethodDelete, "/v1/tasks/Backups/Nightly", nil, nil)
+}
+
+func TestAgentFolders(t *testing.T) {
+	c := newTestClient(t, Options{})
+
+	var folder Folder
+	c.expect(http.StatusCreated, http.MethodPut, "/v1/folders/A/B", nil, &folder)
+	if folder.Path != `\A\B` || folder.Folders == nil || folder.Tasks == nil {
+		t.Errorf("created folder %+v", folder)
+	}
+	c.expect(http.StatusOK, http.MethodPut, "/v1/folders/a/b", nil, nil)
+	c.expect(http.StatusNotFound, http.MethodGet, "/v1/folders/C", nil, nil)
+
+	c.expect(http.StatusConflict, http.MethodDelete, "/v1/folders/A", nil, nil)
+	c.expect(http.StatusBadRequest, http.MethodDelete, "/v1/folders/A?recursive=maybe", nil, nil)
+	c.expect(http.StatusBadRequest, http.MethodDelete, "/v1/folders/", nil, nil)
+	c.expect(http.StatusNoContent, http.MethodDelete, "/v1/folders/A?recursive=true", nil, nil)
+	c.expect(http.StatusOK, http.MethodGet, "/v1/folders/", nil, &folder)
+	if len(folder.Folders) != 0 {
+		t.Errorf("folders after delete %v", folder.Folders)
+	}
+}
+
+func TestAgentErrors(t *testing.T) {
+	c := newTestClient(t, Options{})
+
+	noActions := taskmaster.DefaultDefinition()
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		status int
+	}{
+		{"task at root", http.MethodGet, "/v1/tasks/", nil, http.StatusBadRequest},
+		{"backslash", http.MethodGet, "/v1/tasks/a%5Cb", nil, http.StatusBadRequest},
+		{"invalid character", http.MethodGet, "/v1/tasks/a:b", nil, http.StatusBadRequest},
+		{"missing body", http.MethodPut, "/v1/tasks/a", nil, http.StatusBadRequest},
+		{"malformed body", http.MethodPut, "/v1/tasks/a", "{", http.StatusBadRequest},
+		{"no actions", http.MethodPut, "/v1/tasks/a", RegisterRequest{Definition: noActions}, http.StatusBadRequest},
+		{"unknown action", http.MethodPut, "/v1/tasks/a", map[string]any{"Definition": map[string]any{"Actions": []any{map[string]any{"Type": "Send Email"}}}}, http.StatusBadRequest},
+		{"missing enabled", http.MethodPatch, "/v1/tasks/a", map[string]any{}, http.StatusBadRequest},
+		{"missing task", http.MethodPost, "/v1/run/a", nil, http.StatusNotFound},
+		{"missing instances", http.MethodGet, "/v1/instances/a", nil, http.StatusNotFound},
+		{"wrong method", http.MethodPost, "/v1/tasks/a", nil, http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var resp ErrorResponse
+			var out any = &resp
+			if test.status == http.StatusMethodNotAllowed {
+				out = nil
+			}
+			if status := c.do(test.method, test.path, test.body, nil, out); status != test.status {
+				t.Errorf("%s %s returned %d, want %d", test.method, test.path, status, test.status)
+			} else if out != nil && resp.Error == "" {
+				t.Errorf("%s %s returned no error message", test.method, test.path)
+			}
+		})
+	}
+
+	// a body larger than the limit is refused
+	large := RegisterRequest{Definition: testDefinition()}
+	large.Definition.Data = strings.Repeat("x", maxBodySize)
+	if status := c.do(http.MethodPut, "/v1/tasks/a", large, nil, nil); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body returned %d", status)
+	}
+}
+
+func TestAgentAuthorization(t *testing.T) {
+	c := newTestClient(t, Options{Tokens: []string{"first", "second"}})
+
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "first": http.StatusOK, "second": http.StatusOK} {
+		c.token = token
+		if status := c.do(http.MethodGet, "/v1/folders/", nil, nil, nil); status != want {
+			t.Errorf("token %q returned %d, want %d", token, status, want)
+		}
+	}
+
+	// the OpenAPI document needs no token
+	c.token = ""
+	var doc map[string]any
+	c.expect(http.StatusOK, http.MethodGet, "/v1/openapi.json", nil, &doc)
+
+	// a handler without tokens refuses every request
+	c = newTestClient(t, Options{Tokens: []string{}})
+	c.token = ""
+	if status := c.do(http.MethodGet, "/v1/folders/", nil, nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("handler without tokens returned %d", status)
+	}
+}
+
+func TestAgentLogging(t *testing.T) {
+	var buf bytes.Buffer
+	c := newTestClient(t, Options{Logger: slog.New(slog.NewTextHandler(&buf, nil))})
+	c.expect(http.StatusNotFound, http.MethodGet, "/v1/tasks/missing", nil, nil)
+
+	log := buf.String()
+	for _, want := range []string{"method=GET", "path=/v1/tasks/missing", "status=404"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log does not contain %s: %s", want, log)
+		}
+	}
+	if strings.Contains(log, testToken) {
+		t.Errorf("log contains the token: %s", log)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	var doc struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPIDocument, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range routes {
+		path := strings.Replace(route.pattern, "{path...}", "{path}", 1)
+		if _, ok := doc.Paths[path][strings.ToLower(route.method)]; !ok {
+			t.Errorf("the OpenAPI document does not describe %s %s", route.method, path)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+//go:build windows
+// +build windows
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/giert/taskmaster"
+)
+
+// ServiceBackend is a Backend over a connection to the Task Scheduler service.
+// Because a TaskService must be used on the goroutine that connected it, the
+// connection is owned by a goroutine of its own that performs one call at a time.
+// A call that fails with taskmaster.ErrDisconnected, as when the service is
+// restarted, drops the connection, and the next call connects again.
+type ServiceBackend struct {
+	calls     chan func(*taskmaster.TaskService, error)
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+var _ Backend = (*ServiceBackend)(nil)
+
+// NewServiceBackend connects to the Task Scheduler service with the parameters of
+// taskmaster.ConnectWithOptions. Close must be called once the backend is no
+// longer used.
+func NewServiceBackend(serverName, domain, username, password string) (*ServiceBackend, error) {
+	b := &ServiceBackend{
+		calls:  make(chan func(*taskmaster.TaskService, error)),
+		closed: make(chan struct{}),
+	}
+
+	connected := make(chan error, 1)
+	go func() {
+		service, err := taskmaster.ConnectWithOptions(serverName, domain, username, password)
+		connected <- err
+		if err != nil {
+			return
+		}
+		defer func() { service.Disconnect() }()
+
+		for {
+			select {
+			case <-b.closed:
+				return
+			case call := <-b.calls:
+				var err error
+				if !service.IsConnected() {
+					service, err = taskmaster.ConnectWithOptions(serverName, domain, username, password)
+				}
+				call(&service, err)
+			}
+		}
+	}()
+	if err := <-connected; err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Close disconnects from the Task Scheduler service once the call in progress, if
+// any, returns. Calls made after Close fail with ErrClosed.
+func (b *ServiceBackend) Close() {
+	b.closeOnce.Do(func() { close(b.closed) })
+}
+
+// call runs fn on the goroutine of the connection and returns its results.
+func call[T any](b *ServiceBackend, fn func(*taskmaster.TaskService) (T, error)) (T, error) {
+	var v T
+	var err error
+	done := make(chan struct{})
+	run := func(service *taskmaster.TaskService, connectErr error) {
+		defer close(done)
+		if connectErr != nil {
+			err = connectErr
+			return
+		}
+		v, err = fn(service)
+		if errors.Is(err, taskmaster.ErrDisconnected) {
+			service.Disconnect()
+		}
+	}
+
+	select {
+	case b.calls <- run:
+	case <-b.closed:
+		return v, ErrClosed
+	}
+	<-done
+
+	return v, err
+}
+
+// invalidError is an error of the library that is caused by an invalid request.
+type invalidError struct {
+	error
+}
+
+func (e invalidError) Is(target error) bool {
+	return target == fs.ErrInvalid
+}
+
+func (e invalidError) Unwrap() error {
+	return e.error
+}
+
+// invalid marks the errors of the library that are caused by an invalid request.
+func invalid(err error) error {
+	if errors.Is(err, taskmaster.ErrInvalidPath) || errors.Is(err, taskmaster.ErrNoActions) || errors.Is(err, taskmaster.ErrInvalidPrincipal) {
+		return invalidError{err}
+	}
+
+	return err
+}
+
+func (b *ServiceBackend) GetFolder(path string) (Folder, error) {
+	return call(b, func(service *taskmaster.TaskService) (Folder, error) {
+		folders, err := service.GetSubFolders(path)
+		if err != nil {
+			return Folder{}, invalid(err)
+		}
+		tasks, err := service.GetTaskSummaries(path, false)
+		if err != nil {
+			return Folder{}, invalid(err)
+		}
+
+		return Folder{Path: path, Folders: folders, Tasks: tasks}, nil
+	})
+}
+
+func (b *ServiceBackend) CreateFolder(path string) error {
+	_, err := call(b, func(service *taskmaster.TaskService) (struct{}, error) {
+		return struct{}{}, invalid(service.CreateFolder(path, ""))
+	})
+
+	return err
+}
+
+func (b *ServiceBackend) DeleteFolder(path string, recursive bool) error {
+	_, err := call(b, func(service *taskmaster.TaskService) (struct{}, error) {
+		deleted, err := service.DeleteFolder(path, recursive)
+		if err != nil {
+			return struct{}{}, invalid(err)
+		} else if !deleted {
+			return struct{}{}, fmt.Errorf("error deleting folder %s: %w", path, ErrFolderNotEmpty)
+		}
+
+		return struct{}{}, nil
+	})
+
+	return err
+}
+
+// withTask calls fn with the registered task at path.
+func withTask[T any](b *ServiceBackend, path string, fn func(*taskmaster.TaskService, *taskmaster.RegisteredTask) (T, error)) (T, error) {
+	return call(b, func(service *taskmaster.TaskService) (T, error) {
+		task, err := service.GetRegisteredTask(path)
+		if err != nil {
+			var zero T
+			return zero, invalid(err)
+		}
+		defer task.Release()
+
+		return fn(service, &task)
+	})
+}
+
+func serviceTask(task *taskmaster.RegisteredTask) Task {
+	return Task{
+		TaskSummary: taskmaster.TaskSummary{
+			Name:           task.Name,
+			Path:           task.Path,
+			Enabled:        task.Enabled,
+			State:          task.State,
+			MissedRuns:     task.MissedRuns,
+			NextRunTime:    task.NextRunTime,
+			LastRunTime:    task.LastRunTime,
+			LastTaskResult: task.LastTaskResult,
+		},
+		Definition: task.Definition,
+	}
+}
+
+func serviceInstance(task taskmaster.RunningTask) Instance {
+	return Instance{
+		InstanceGUID:  task.InstanceGUID,
+		Path:          task.Path,
+		Name:          task.Name,
+		State:         task.State,
+		CurrentAction: task.CurrentAction,
+		EnginePID:     task.EnginePID,
+	}
+}
+
+func (b *ServiceBackend) GetTask(path string) (Task, error) {
+	return withTask(b, path, func(_ *taskmaster.TaskService, task *taskmaster.RegisteredTask) (Task, error) {
+		return serviceTask(task), nil
+	})
+}
+
+func (b *ServiceBackend) RegisterTask(path string, req RegisterRequest, createOnly bool) (Task, bool, error) {
+	type result struct {
+		task    Task
+		created bool
+	}
+	res, err := call(b, func(service *taskmaster.TaskService) (result, error) {
+		existing, err := service.GetRegisteredTask(path)
+		if err == nil {
+			existing.Release()
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return result{}, invalid(err)
+		}
+		created := err != nil
+
+		opts := []taskmaster.RegisterOption{taskmaster.WithCreationFlags(taskmaster.TASK_CREATE_OR_UPDATE)}
+		if createOnly {
+			opts[0] = taskmaster.WithCreationFlags(taskmaster.TASK_CREATE)
+		}
+		if req.Username != "" {
+			opts = append(opts, taskmaster.WithCredentials(req.Username, req.Password))
+		}
+		task, err := service.RegisterTask(path, req.Definition, opts...)
+		if err != nil {
+			return result{}, invalid(err)
+		}
+		defer task.Release()
+
+		return result{task: serviceTask(&task), created: created}, nil
+	})
+
+	return res.task, res.created, err
+}
+
+func (b *ServiceBackend) DeleteTask(path string) error {
+	_, err := call(b, func(service *taskmaster.TaskService) (struct{}, error) {
+		return struct{}{}, invalid(service.DeleteTask(path))
+	})
+
+	return err
+}
+
+func (b *ServiceBackend) SetTaskEnabled(path string, enabled bool) (Task, error) {
+	return withTask(b, path, func(_ *taskmaster.TaskService, task *taskmaster.RegisteredTask) (Task, error) {
+		if err := task.SetEnabled(enabled); err != nil {
+			return Task{}, err
+		}
+
+		return serviceTask(task), nil
+	})
+}
+
+func (b *ServiceBackend) RunTask(path string, req RunRequest) (Instance, error) {
+	return withTask(b, path, func(_ *taskmaster.TaskService, task *taskmaster.RegisteredTask) (Instance, error) {
+		if !task.Enabled {
+			return Instance{}, fmt.Errorf("error running task %s: %w", path, ErrTaskDisabled)
+		}
+		flags := taskmaster.TASK_RUN_NO_FLAGS
+		if req.IgnoreConstraints {
+			flags = taskmaster.TASK_RUN_IGNORE_CONSTRAINTS
+		}
+
+		running, err := task.RunEx(req.Args, flags, 0, "")
+		if err != nil {
+			return Instance{}, err
+		}
+		defer running.Release()
+
+		return serviceInstance(running), nil
+	})
+}
+
+func (b *ServiceBackend) StopTask(path string) error {
+	_, err := withTask(b, path, func(_ *taskmaster.TaskService, task *taskmaster.RegisteredTask) (struct{}, error) {
+		return struct{}{}, task.Stop()
+	})
+
+	return err
+}
+
+func (b *ServiceBackend) GetInstances(path string) ([]Instance, error) {
+	collect := func(running taskmaster.RunningTaskCollection) []Instance {
+		defer running.Release()
+
+		instances := make([]Instance, 0, len(running))
+		for _, task := range running {
+			instances = append(instances, serviceInstance(task))
+		}
+		return instances
+	}
+
+	if path == `\` {
+		return call(b, func(service *taskmaster.TaskService) ([]Instance, error) {
+			running, err := service.GetRunningTasks()
+			if err != nil {
+				return nil, err
+			}
+			return collect(running), nil
+		})
+	}
+
+	return withTask(b, path, func(_ *taskmaster.TaskService, task *taskmaster.RegisteredTask) ([]Instance, error) {
+		running, err := task.GetInstances()
+		if err != nil {
+			return nil, err
+		}
+		return collect(running), nil
+	})
+}
+
+func (b *ServiceBackend) GetHistory(path string) ([]taskmaster.TaskRun, error) {
+	return withTask(b, path, func(service *taskmaster.TaskService, _ *taskmaster.RegisteredTask) ([]taskmaster.TaskRun, error) {
+		return service.GetRunHistory(path)
+	})
+}
@@ -0,0 +1,80 @@
+//go:build windows
+// +build windows
+
+package agent
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/giert/taskmaster"
+)
+
+const testFolder = `\TaskmasterAgentTests`
+
+func TestServiceBackend(t *testing.T) {
+	backend, err := NewServiceBackend("", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	backend.DeleteFolder(testFolder, true)
+	defer backend.DeleteFolder(testFolder, true)
+
+	def := testDefinition()
+	def.Principal = taskmaster.DefaultDefinition().Principal
+	task, created, err := backend.RegisterTask(testFolder+`\Task`, RegisterRequest{Definition: def}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || task.Path != testFolder+`\Task` || len(task.Definition.Actions) != 1 {
+		t.Errorf("registered task %+v, created %t", task.TaskSummary, created)
+	}
+	if _, _, err := backend.RegisterTask(testFolder+`\Task`, RegisterRequest{Definition: def}, true); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("creating an existing task returned %v, want fs.ErrExist", err)
+	}
+
+	folder, err := backend.GetFolder(testFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(folder.Tasks) != 1 || folder.Tasks[0].Path != task.Path {
+		t.Errorf("folder %+v", folder)
+	}
+
+	if task, err = backend.SetTaskEnabled(task.Path, false); err != nil {
+		t.Fatal(err)
+	} else if task.Enabled {
+		t.Error("the task is still enabled")
+	}
+	if _, err := backend.RunTask(task.Path, RunRequest{}); !errors.Is(err, ErrTaskDisabled) {
+		t.Errorf("running a disabled task returned %v, want ErrTaskDisabled", err)
+	}
+
+	if err := backend.DeleteFolder(testFolder, false); !errors.Is(err, ErrFolderNotEmpty) {
+		t.Errorf("deleting a folder with a task returned %v, want ErrFolderNotEmpty", err)
+	}
+	if err := backend.DeleteTask(task.Path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.GetTask(task.Path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("getting a deleted task returned %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestServiceBackendClose(t *testing.T) {
+	backend, err := NewServiceBackend("", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.GetFolder(`\`); err != nil {
+		t.Fatal(err)
+	}
+
+	backend.Close()
+	backend.Close()
+	if _, err := backend.GetFolder(`\`); !errors.Is(err, ErrClosed) {
+		t.Errorf("calling a closed backend returned %v, want ErrClosed", err)
+	}
+}
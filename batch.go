@@ -0,0 +1,261 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// BatchOp is the kind of change a BatchChange makes.
+type BatchOp uint
+
+const (
+	BatchCreate BatchOp = iota // create the task, replacing it if it already exists
+	BatchUpdate                // update an existing task
+	BatchDelete                // delete an existing task
+)
+
+func (o BatchOp) String() string {
+	switch o {
+	case BatchCreate:
+		return "Create"
+	case BatchUpdate:
+		return "Update"
+	case BatchDelete:
+		return "Delete"
+	default:
+		return ""
+	}
+}
+
+// BatchOutcome is what happened to a single BatchChange.
+type BatchOutcome uint
+
+const (
+	BatchNotAttempted   BatchOutcome = iota // the change was not applied because an earlier change failed
+	BatchApplied                            // the change was applied and kept
+	BatchFailed                             // the change failed validation or could not be applied
+	BatchRolledBack                         // the change was applied and then undone
+	BatchRollbackFailed                     // the change was applied but could not be undone
+)
+
+func (o BatchOutcome) String() string {
+	switch o {
+	case BatchNotAttempted:
+		return "Not Attempted"
+	case BatchApplied:
+		return "Applied"
+	case BatchFailed:
+		return "Failed"
+	case BatchRolledBack:
+		return "Rolled Back"
+	case BatchRollbackFailed:
+		return "Rollback Failed"
+	default:
+		return ""
+	}
+}
+
+// BatchChange is a single change applied by ApplyBatch. Username, Password and
+// LogonType have the same meaning as in CreateTaskEx and UpdateTaskEx, and are
+// ignored for BatchDelete.
+type BatchChange struct {
+	Op         BatchOp
+	Path       string
+	Definition Definition
+	Username   string
+	Password   string
+	LogonType  TaskLogonType
+}
+
+// BatchResult is the outcome of a single BatchChange.
+type BatchResult struct {
+	Op      BatchOp
+	Path    string
+	Outcome BatchOutcome
+	Err     error // why the change failed, or why it could not be rolled back
+}
+
+// taskBackup is the state of a task before a batch change touched it.
+type taskBackup struct {
+	existed   bool
+	enabled   bool
+	userID    string
+	logonType TaskLogonType
+	xmlText   string
+}
+
+// ApplyBatch applies changes in order as a single unit. Before anything is changed,
+// every definition is checked with validateDefinition and sent to Task Scheduler with
+// TASK_VALIDATE_ONLY, and every task to be updated or deleted must exist or be created
+// by an earlier change. Validation does not track deletions, so a change to a task
+// deleted earlier in the batch only fails when it is applied. A task that BatchCreate
+// replaces is registered over in place, so it is kept if registration fails. If a
+// change then fails, the changes already applied are undone in reverse order:
+// replaced, updated and deleted tasks are re-registered from their previous XML, and
+// newly created tasks are deleted. Folders created along the way are left in place.
+//
+// ApplyBatch returns one BatchResult per change. The returned error is the error of
+// the change that failed, or nil if every change was applied.
+//
+// Rolling back a TASK_LOGON_PASSWORD task requires its password, so it only succeeds
+// if the failing batch supplied the password for that user; otherwise the change is
+// reported as BatchRollbackFailed.
+func (t *TaskService) ApplyBatch(changes []BatchChange) ([]BatchResult, error) {
+	results := make([]BatchResult, len(changes))
+	for i, change := range changes {
+		results[i] = BatchResult{Op: change.Op, Path: change.Path}
+	}
+
+	created := map[string]bool{}
+	for i, change := range changes {
+		if err := t.validateBatchChange(change, created); err != nil {
+			results[i].Outcome = BatchFailed
+			results[i].Err = err
+			return results, fmt.Errorf("error validating batch change %d (%s %s): %w", i, change.Op, change.Path, err)
+		}
+	}
+
+	backups := make([]taskBackup, len(changes))
+	for i, change := range changes {
+		backup, err := t.backupTask(change.Path)
+		if err == nil {
+			backups[i] = backup
+			err = t.applyBatchChange(change, backup)
+		}
+		if err == nil {
+			results[i].Outcome = BatchApplied
+			continue
+		}
+
+		results[i].Outcome = BatchFailed
+		results[i].Err = err
+		for j := i - 1; j >= 0; j-- {
+			if rollbackErr := t.rollbackBatchChange(changes[j], backups[j], changes); rollbackErr != nil {
+				results[j].Outcome = BatchRollbackFailed
+				results[j].Err = rollbackErr
+			} else {
+				results[j].Outcome = BatchRolledBack
+			}
+		}
+
+		return results, fmt.Errorf("error applying batch change %d (%s %s): %w", i, change.Op, change.Path, err)
+	}
+
+	return results, nil
+}
+
+// validateBatchChange validates change against the connected service. created
+// holds the lowercased paths of the tasks created by earlier changes of the batch,
+// which count as existing; change is added to it if it creates a task.
+func (t *TaskService) validateBatchChange(change BatchChange, created map[string]bool) error {
+	if len(change.Path) == 0 || change.Path[0] != '\\' {
+		return ErrInvalidPath
+	}
+	key := strings.ToLower(change.Path)
+
+	switch change.Op {
+	case BatchCreate:
+		created[key] = true
+		return t.ValidateTaskEx(change.Path, change.Definition, change.Username, change.Password, change.LogonType)
+	case BatchUpdate:
+		if !created[key] && !t.registeredTaskExist(change.Path) {
+			return fmt.Errorf("error updating task %s: %w", change.Path, os.ErrNotExist)
+		}
+		return t.ValidateTaskEx(change.Path, change.Definition, change.Username, change.Password, change.LogonType)
+	case BatchDelete:
+		if !created[key] && !t.registeredTaskExist(change.Path) {
+			return fmt.Errorf("error deleting task %s: %w", change.Path, os.ErrNotExist)
+		}
+		return nil
+	default:
+		return errors.New("invalid batch operation")
+	}
+}
+
+func (t *TaskService) applyBatchChange(change BatchChange, backup taskBackup) error {
+	var task RegisteredTask
+	var err error
+
+	switch change.Op {
+	case BatchCreate:
+		if backup.existed {
+			// replace the task in place rather than deleting it first, so that it is
+			// left untouched if registration fails
+			taskObj, err := t.modifyTask(change.Path, change.Definition, change.Username, change.Password, change.LogonType, TASK_CREATE_OR_UPDATE, "")
+			if err != nil {
+				return fmt.Errorf("error replacing registered task %s: %w", change.Path, err)
+			}
+			taskObj.Release()
+			return nil
+		}
+		task, _, err = t.CreateTaskEx(change.Path, change.Definition, change.Username, change.Password, change.LogonType, true)
+	case BatchUpdate:
+		task, err = t.UpdateTaskEx(change.Path, change.Definition, change.Username, change.Password, change.LogonType)
+	case BatchDelete:
+		return t.DeleteTask(change.Path)
+	}
+	task.Release()
+
+	return err
+}
+
+// backupTask records the current state of the task at path, which may not exist.
+func (t *TaskService) backupTask(path string) (taskBackup, error) {
+	task, err := t.GetRegisteredTask(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return taskBackup{}, nil
+	} else if err != nil {
+		return taskBackup{}, err
+	}
+	defer task.Release()
+
+	return taskBackup{
+		existed:   true,
+		enabled:   task.Enabled,
+		userID:    task.Definition.Principal.UserID,
+		logonType: task.Definition.Principal.LogonType,
+		xmlText:   task.Definition.XMLText,
+	}, nil
+}
+
+// rollbackBatchChange restores the task touched by change to its backed up state.
+// The batch's changes are searched for a password for the task's user.
+func (t *TaskService) rollbackBatchChange(change BatchChange, backup taskBackup, changes []BatchChange) error {
+	if !backup.existed {
+		if change.Op == BatchDelete {
+			return nil
+		}
+		return t.DeleteTask(change.Path)
+	}
+
+	var username, password string
+	if backup.logonType == TASK_LOGON_PASSWORD || backup.logonType == TASK_LOGON_INTERACTIVE_TOKEN_OR_PASSWORD {
+		found := false
+		for _, c := range changes {
+			if c.Password != "" && strings.EqualFold(c.Username, backup.userID) {
+				username, password, found = c.Username, c.Password, true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("error restoring task %s: no password available for %s", change.Path, backup.userID)
+		}
+	}
+
+	flags := TASK_CREATE_OR_UPDATE
+	if !backup.enabled {
+		flags |= TASK_DISABLE
+	}
+	taskObj, err := t.registerTaskXML(change.Path, backup.xmlText, "", username, password, backup.logonType, flags, "")
+	if err != nil {
+		return fmt.Errorf("error restoring task %s: %w", change.Path, err)
+	}
+	taskObj.Release()
+
+	return nil
+}
@@ -0,0 +1,133 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"testing"
+)
+
+func TestApplyBatch(t *testing.T) {
+	taskService := setupTaskService(t)
+	createTestTask(taskService)
+
+	newDef := func(path string) Definition {
+		def := taskService.NewTaskDefinition()
+		def.AddAction(ExecAction{Path: path})
+		return def
+	}
+
+	results, err := taskService.ApplyBatch([]BatchChange{
+		{Op: BatchCreate, Path: testTaskPath("Batch", "One"), Definition: newDef("calc.exe")},
+		{Op: BatchCreate, Path: testTaskPath("Batch", "Two"), Definition: newDef("calc.exe")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Outcome != BatchApplied {
+			t.Fatalf("expected %s to be applied, got %s: %v", result.Path, result.Outcome, result.Err)
+		}
+	}
+
+	t.Run("validation failure changes nothing", func(t *testing.T) {
+		results, err := taskService.ApplyBatch([]BatchChange{
+			{Op: BatchDelete, Path: testTaskPath("Batch", "One")},
+			{Op: BatchCreate, Path: testTaskPath("Batch", "Invalid"), Definition: Definition{}},
+		})
+		if err == nil {
+			t.Fatal("expected batch to fail validation")
+		}
+		if results[0].Outcome != BatchNotAttempted || results[1].Outcome != BatchFailed {
+			t.Fatalf("unexpected outcomes: %+v", results)
+		}
+		if !taskService.registeredTaskExist(testTaskPath("Batch", "One")) {
+			t.Fatal("task should not have been deleted")
+		}
+	})
+
+	t.Run("apply failure rolls back", func(t *testing.T) {
+		updated := newDef("notepad.exe")
+		results, err := taskService.ApplyBatch([]BatchChange{
+			{Op: BatchUpdate, Path: testTaskPath("Batch", "One"), Definition: updated},
+			{Op: BatchDelete, Path: testTaskPath("Batch", "Two")},
+			{Op: BatchCreate, Path: testTaskPath("Batch", "Three"), Definition: newDef("calc.exe")},
+			// passes validation, but is gone by the time it is applied
+			{Op: BatchDelete, Path: testTaskPath("Batch", "Two")},
+		})
+		if err == nil {
+			t.Fatal("expected batch to fail")
+		}
+		for i, want := range []BatchOutcome{BatchRolledBack, BatchRolledBack, BatchRolledBack, BatchFailed} {
+			if results[i].Outcome != want {
+				t.Fatalf("change %d: expected %s, got %s (%v)", i, want, results[i].Outcome, results[i].Err)
+			}
+		}
+
+		withRegisteredTask(t, taskService, testTaskPath("Batch", "One"), func(task RegisteredTask) {
+			action := requireActionAt[ExecAction](t, task, 0)
+			if action.Path != "calc.exe" {
+				t.Fatalf("expected update to be rolled back, got action path %s", action.Path)
+			}
+		})
+		if !taskService.registeredTaskExist(testTaskPath("Batch", "Two")) {
+			t.Fatal("deleted task should have been restored")
+		}
+		if taskService.registeredTaskExist(testTaskPath("Batch", "Three")) {
+			t.Fatal("created task should have been removed")
+		}
+	})
+	t.Run("replaced task is restored", func(t *testing.T) {
+		results, err := taskService.ApplyBatch([]BatchChange{
+			{Op: BatchCreate, Path: testTaskPath("Batch", "One"), Definition: newDef("notepad.exe")},
+			{Op: BatchDelete, Path: testTaskPath("Batch", "Two")},
+			// passes validation, but is gone by the time it is applied
+			{Op: BatchDelete, Path: testTaskPath("Batch", "Two")},
+		})
+		if err == nil {
+			t.Fatal("expected batch to fail")
+		}
+		for i, want := range []BatchOutcome{BatchRolledBack, BatchRolledBack, BatchFailed} {
+			if results[i].Outcome != want {
+				t.Fatalf("change %d: expected %s, got %s (%v)", i, want, results[i].Outcome, results[i].Err)
+			}
+		}
+
+		withRegisteredTask(t, taskService, testTaskPath("Batch", "One"), func(task RegisteredTask) {
+			action := requireActionAt[ExecAction](t, task, 0)
+			if action.Path != "calc.exe" {
+				t.Fatalf("expected the replaced task to be restored, got action path %s", action.Path)
+			}
+		})
+		if !taskService.registeredTaskExist(testTaskPath("Batch", "Two")) {
+			t.Fatal("deleted task should have been restored")
+		}
+	})
+
+	t.Run("tasks created by the batch can be changed by it", func(t *testing.T) {
+		results, err := taskService.ApplyBatch([]BatchChange{
+			{Op: BatchCreate, Path: testTaskPath("Batch", "Four"), Definition: newDef("calc.exe")},
+			{Op: BatchUpdate, Path: testTaskPath("Batch", "Four"), Definition: newDef("notepad.exe")},
+			{Op: BatchCreate, Path: testTaskPath("Batch", "Five"), Definition: newDef("calc.exe")},
+			{Op: BatchDelete, Path: testTaskPath("Batch", "Five")},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, result := range results {
+			if result.Outcome != BatchApplied {
+				t.Fatalf("change %d: expected %s, got %s (%v)", i, BatchApplied, result.Outcome, result.Err)
+			}
+		}
+
+		withRegisteredTask(t, taskService, testTaskPath("Batch", "Four"), func(task RegisteredTask) {
+			action := requireActionAt[ExecAction](t, task, 0)
+			if action.Path != "notepad.exe" {
+				t.Fatalf("expected the created task to be updated, got action path %s", action.Path)
+			}
+		})
+		if taskService.registeredTaskExist(testTaskPath("Batch", "Five")) {
+			t.Fatal("created task should have been deleted")
+		}
+	})
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "errors"
+
+func (c connection) backend() (closingBackend, error) {
+	return nil, errors.New("the Task Scheduler is only available on Windows; use -fake to serve a fake one")
+}
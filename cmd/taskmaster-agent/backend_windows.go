@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "github.com/giert/taskmaster/agent"
+
+// backend connects to the Task Scheduler service.
+func (c connection) backend() (closingBackend, error) {
+	return agent.NewServiceBackend(c.host, c.domain, c.user, c.password)
+}
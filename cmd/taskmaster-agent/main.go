@@ -0,0 +1,169 @@
+// Command taskmaster-agent serves a REST API over the Task Scheduler of a local or
+// remote computer, for managing scheduled tasks from systems that cannot use COM.
+//
+// Usage:
+//
+//	taskmaster-agent [flags]
+//
+// The flags are:
+//
+//	-addr        the address to listen on; 127.0.0.1:8470 by default
+//	-token-file  a file with the accepted bearer tokens, one per line
+//	-fake        serve an in-memory fake Task Scheduler, which works on any platform
+//	-host        the computer to connect to; the local computer if empty
+//	-domain      the domain of -user
+//	-user        the user to connect as; the current user if empty
+//	-password    the password of -user; read from TASKMASTER_PASSWORD if empty
+//
+// If -token-file is not set, the token is read from TASKMASTER_AGENT_TOKEN. The
+// agent refuses to start without a token. Requests are logged to standard error.
+// The API is described by the OpenAPI document served at /v1/openapi.json; see
+// package github.com/giert/taskmaster/agent.
+//
+// taskmaster-agent exits with 0 once it is interrupted, 1 if it fails and 2 if the
+// command line is invalid.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/giert/taskmaster/agent"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stderr))
+}
+
+// run serves the agent until ctx is done and returns its exit code.
+func run(ctx context.Context, args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("taskmaster-agent", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	addr := flags.String("addr", "127.0.0.1:8470", "the address to listen on")
+	tokenFile := flags.String("token-file", "", "a file with the accepted bearer tokens, one per line; read from TASKMASTER_AGENT_TOKEN if empty")
+	fake := flags.Bool("fake", false, "serve an in-memory fake Task Scheduler")
+	var conn connection
+	flags.StringVar(&conn.host, "host", "", "the computer to connect to; the local computer if empty")
+	flags.StringVar(&conn.domain, "domain", "", "the domain of -user")
+	flags.StringVar(&conn.user, "user", "", "the user to connect as; the current user if empty")
+	flags.StringVar(&conn.password, "password", "", "the password of -user; read from TASKMASTER_PASSWORD if empty")
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	} else if err != nil {
+		return exitUsage
+	} else if flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "taskmaster-agent: unexpected arguments %q\n", flags.Args())
+		return exitUsage
+	}
+	if conn.password == "" {
+		conn.password = os.Getenv("TASKMASTER_PASSWORD")
+	}
+
+	tokens, err := readTokens(*tokenFile, os.Getenv("TASKMASTER_AGENT_TOKEN"))
+	if err != nil {
+		fmt.Fprintf(stderr, "taskmaster-agent: %v\n", err)
+		return exitUsage
+	}
+
+	var backend agent.Backend = agent.NewFakeBackend()
+	if !*fake {
+		service, err := conn.backend()
+		if err != nil {
+			fmt.Fprintf(stderr, "taskmaster-agent: %v\n", err)
+			return exitError
+		}
+		defer service.Close()
+		backend = service
+	}
+
+	logger := slog.New(slog.NewTextHandler(stderr, nil))
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           agent.NewHandler(backend, agent.Options{Tokens: tokens, Logger: logger}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	served := make(chan error, 1)
+	logger.Info("listening", slog.String("addr", *addr), slog.Bool("fake", *fake))
+	go func() {
+		served <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-served:
+		fmt.Fprintf(stderr, "taskmaster-agent: %v\n", err)
+		return exitError
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(stderr, "taskmaster-agent: %v\n", err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// connection holds the flags of the connection to the Task Scheduler service.
+type connection struct {
+	host, domain, user, password string
+}
+
+// closingBackend is a Backend that must be closed.
+type closingBackend interface {
+	agent.Backend
+	Close()
+}
+
+// readTokens returns the non-empty lines of the file at path, or envToken if path
+// is empty. It fails if there is no token.
+func readTokens(path, envToken string) ([]string, error) {
+	if path == "" {
+		if envToken = strings.TrimSpace(envToken); envToken == "" {
+			return nil, errors.New("no bearer token; use -token-file or set TASKMASTER_AGENT_TOKEN")
+		}
+		return []string{envToken}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var tokens []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if token := strings.TrimSpace(scanner.Text()); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s has no bearer token", path)
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReadTokens(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens")
+	if err := os.WriteFile(path, []byte("first\r\n\n  second  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := readTokens(path, "ignored")
+	if err != nil || !slices.Equal(tokens, []string{"first", "second"}) {
+		t.Errorf("readTokens(file) = %q, %v", tokens, err)
+	}
+	tokens, err = readTokens("", " env ")
+	if err != nil || !slices.Equal(tokens, []string{"env"}) {
+		t.Errorf("readTokens(env) = %q, %v", tokens, err)
+	}
+	for _, path := range []string{"", empty, filepath.Join(dir, "missing")} {
+		if _, err := readTokens(path, ""); err == nil {
+			t.Errorf("readTokens(%q) did not fail", path)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Setenv("TASKMASTER_AGENT_TOKEN", "")
+	var stderr bytes.Buffer
+	if code := run(context.Background(), []string{"-fake"}, &stderr); code != exitUsage {
+		t.Errorf("run without a token exited with %d: %s", code, stderr.String())
+	}
+	if code := run(context.Background(), []string{"-fake", "extra"}, &stderr); code != exitUsage {
+		t.Errorf("run with arguments exited with %d", code)
+	}
+
+	t.Setenv("TASKMASTER_AGENT_TOKEN", "token")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	stderr.Reset()
+	if code := run(ctx, []string{"-fake", "-addr", "127.0.0.1:0"}, &stderr); code != exitOK {
+		t.Errorf("interrupted run exited with %d: %s", code, stderr.String())
+	}
+	if !bytes.Contains(stderr.Bytes(), []byte("listening")) {
+		t.Errorf("run did not log that it is listening: %s", stderr.String())
+	}
+}
@@ -0,0 +1,190 @@
+// Command taskmaster-exporter exports the health of the scheduled tasks of a local
+// or remote computer as Prometheus metrics.
+//
+// Usage:
+//
+//	taskmaster-exporter [flags]
+//
+// The flags are:
+//
+//	-addr      the address to serve /metrics on; :9470 by default
+//	-textfile  write the metrics to this file instead of serving them, for the
+//	           textfile collector of the node exporter
+//	-once      collect and write -textfile once, then exit
+//	-interval  the interval between collections; 1m by default
+//	-folder    the folder whose task tree is exported; the root folder by default
+//	-include   export only the tasks whose path matches this glob; repeatable
+//	-exclude   do not export the tasks whose path matches this glob; repeatable
+//	-host      the computer to connect to; the local computer if empty
+//	-domain    the domain of -user
+//	-user      the user to connect as; the current user if empty
+//	-password  the password of -user; read from TASKMASTER_PASSWORD if empty
+//
+// Globs match task paths case-insensitively: * matches within a folder and **
+// across folders, as in \Microsoft\**. The metrics are described in package
+// github.com/giert/taskmaster/exporter. Failed collections are logged to
+// standard error.
+//
+// taskmaster-exporter exits with 0 once it is interrupted or has written the
+// textfile with -once, 1 if it fails and 2 if the command line is invalid.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/giert/taskmaster/exporter"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stderr))
+}
+
+// run exports the metrics until ctx is done and returns its exit code.
+func run(ctx context.Context, args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("taskmaster-exporter", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	addr := flags.String("addr", ":9470", "the address to serve /metrics on")
+	textfile := flags.String("textfile", "", "write the metrics to this file instead of serving them")
+	once := flags.Bool("once", false, "collect and write -textfile once, then exit")
+	interval := flags.Duration("interval", time.Minute, "the interval between collections")
+	folder := flags.String("folder", `\`, "the folder whose task tree is exported")
+	var opts exporter.Options
+	flags.Var((*globList)(&opts.Include), "include", "export only the tasks whose path matches this glob; repeatable")
+	flags.Var((*globList)(&opts.Exclude), "exclude", "do not export the tasks whose path matches this glob; repeatable")
+	var conn connection
+	flags.StringVar(&conn.host, "host", "", "the computer to connect to; the local computer if empty")
+	flags.StringVar(&conn.domain, "domain", "", "the domain of -user")
+	flags.StringVar(&conn.user, "user", "", "the user to connect as; the current user if empty")
+	flags.StringVar(&conn.password, "password", "", "the password of -user; read from TASKMASTER_PASSWORD if empty")
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	} else if err != nil {
+		return exitUsage
+	} else if flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "taskmaster-exporter: unexpected arguments %q\n", flags.Args())
+		return exitUsage
+	}
+	if *interval <= 0 {
+		fmt.Fprintln(stderr, "taskmaster-exporter: -interval must be positive")
+		return exitUsage
+	}
+	if *once && *textfile == "" {
+		fmt.Fprintln(stderr, "taskmaster-exporter: -once requires -textfile")
+		return exitUsage
+	}
+	if conn.password == "" {
+		conn.password = os.Getenv("TASKMASTER_PASSWORD")
+	}
+
+	source, err := conn.source(*folder)
+	if err != nil {
+		fmt.Fprintf(stderr, "taskmaster-exporter: %v\n", err)
+		return exitError
+	}
+	return export(ctx, source, opts, *addr, *textfile, *once, *interval, stderr)
+}
+
+// export collects from source and serves the metrics on addr, or writes them to
+// textfile if it is not empty.
+func export(ctx context.Context, source exporter.Source, opts exporter.Options, addr, textfile string, once bool, interval time.Duration, stderr io.Writer) int {
+	e, err := exporter.New(source, opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "taskmaster-exporter: %v\n", err)
+		return exitUsage
+	}
+	logger := slog.New(slog.NewTextHandler(stderr, nil))
+
+	if textfile != "" {
+		write := func(err error) {
+			if err != nil {
+				logger.Error("collection failed", slog.Any("error", err))
+			}
+			if err := e.WriteTextfile(textfile); err != nil {
+				logger.Error("writing the textfile failed", slog.Any("error", err))
+			}
+		}
+		err := e.Collect()
+		write(err)
+		if once {
+			if err != nil {
+				return exitError
+			}
+			return exitOK
+		}
+		e.Run(ctx, interval, write)
+		return exitOK
+	}
+
+	onCollect := func(err error) {
+		if err != nil {
+			logger.Error("collection failed", slog.Any("error", err))
+		}
+	}
+	onCollect(e.Collect())
+	go e.Run(ctx, interval, onCollect)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", e)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	served := make(chan error, 1)
+	logger.Info("listening", slog.String("addr", addr))
+	go func() {
+		served <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-served:
+		fmt.Fprintf(stderr, "taskmaster-exporter: %v\n", err)
+		return exitError
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(stderr, "taskmaster-exporter: %v\n", err)
+		return exitError
+	}
+
+	return exitOK
+}
+
+// connection holds the flags of the connection to the Task Scheduler service.
+type connection struct {
+	host, domain, user, password string
+}
+
+// globList is a flag.Value that collects the globs of a repeatable flag.
+type globList []string
+
+func (l *globList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *globList) Set(glob string) error {
+	*l = append(*l, glob)
+	return nil
+}
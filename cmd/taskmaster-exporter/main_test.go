@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giert/taskmaster"
+	"github.com/giert/taskmaster/exporter"
+)
+
+func testSource() ([]taskmaster.TaskSummary, error) {
+	return []taskmaster.TaskSummary{
+		{Name: "Nightly", Path: `\Backups\Nightly`, Enabled: true, State: taskmaster.TASK_STATE_READY},
+		{Name: "Defrag", Path: `\Microsoft\Windows\Defrag`, State: taskmaster.TASK_STATE_DISABLED},
+	}, nil
+}
+
+func TestGlobList(t *testing.T) {
+	var globs globList
+	for _, glob := range []string{`\Backups\**`, `\Microsoft\*`} {
+		if err := globs.Set(glob); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(globs, globList{`\Backups\**`, `\Microsoft\*`}) || globs.String() != `\Backups\**,\Microsoft\*` {
+		t.Errorf("globs = %q", globs)
+	}
+}
+
+func TestRun(t *testing.T) {
+	for _, args := range [][]string{
+		{"extra"},
+		{"-interval", "0s"},
+		{"-once"},
+		{"-unknown"},
+	} {
+		var stderr bytes.Buffer
+		if code := run(context.Background(), args, &stderr); code != exitUsage {
+			t.Errorf("run(%q) exited with %d: %s", args, code, stderr.String())
+		}
+	}
+}
+
+func TestExportTextfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "taskmaster.prom")
+	var stderr bytes.Buffer
+	opts := exporter.Options{Exclude: []string{`\Microsoft\**`}}
+	if code := export(context.Background(), testSource, opts, "", path, true, time.Minute, &stderr); code != exitOK {
+		t.Fatalf("export exited with %d: %s", code, stderr.String())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `taskmaster_task_enabled{path="\\Backups\\Nightly"} 1`) || strings.Contains(string(data), "Defrag") {
+		t.Errorf("textfile:\n%s", data)
+	}
+
+	failing := func() ([]taskmaster.TaskSummary, error) { return nil, errors.New("unreachable") }
+	stderr.Reset()
+	if code := export(context.Background(), failing, exporter.Options{}, "", path, true, time.Minute, &stderr); code != exitError {
+		t.Errorf("failed export exited with %d", code)
+	}
+	if !strings.Contains(stderr.String(), "unreachable") {
+		t.Errorf("the failed collection was not logged: %s", stderr.String())
+	}
+}
+
+func TestExportHTTP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	var stderr bytes.Buffer
+	go func() {
+		done <- export(ctx, testSource, exporter.Options{}, addr, "", false, time.Minute, &stderr)
+	}()
+
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = http.Get("http://" + addr + "/metrics"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "taskmaster_exporter_tasks 2\n") {
+		t.Errorf("/metrics served:\n%s", body)
+	}
+
+	cancel()
+	if code := <-done; code != exitOK {
+		t.Errorf("interrupted export exited with %d: %s", code, stderr.String())
+	}
+}
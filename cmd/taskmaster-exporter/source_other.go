@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+
+	"github.com/giert/taskmaster/exporter"
+)
+
+func (c connection) source(folder string) (exporter.Source, error) {
+	return nil, errors.New("the Task Scheduler is only available on Windows")
+}
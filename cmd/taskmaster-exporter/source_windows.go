@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "github.com/giert/taskmaster/exporter"
+
+// source returns a Source that summarizes the task tree under folder.
+func (c connection) source(folder string) (exporter.Source, error) {
+	return exporter.ServiceSource(folder, c.host, c.domain, c.user, c.password), nil
+}
@@ -0,0 +1,323 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/giert/taskmaster"
+)
+
+func runLs(a *app, cmd command, args []string) error {
+	flags := a.flagSet(cmd)
+	recursive := flags.Bool("r", false, "list the tasks of subfolders too")
+	filterExpr := flags.String("filter", "", "list only the tasks that match a filter expression")
+	if err := a.parseFlags(flags, args, 0, 1); err != nil {
+		return err
+	}
+	path := `\`
+	if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+	filter, err := taskmaster.ParseFilter(*filterExpr)
+	if err != nil {
+		return usageError{msg: err.Error()}
+	}
+
+	service, err := a.connect()
+	if err != nil {
+		return err
+	}
+	filtered := filter.String() != ""
+	var summaries []taskmaster.TaskSummary
+	if filtered {
+		// only filters need the definitions of the tasks
+		summaries, err = matchingSummaries(service.RegisteredTasks(path), path, filter, *recursive)
+	} else {
+		summaries, err = service.GetTaskSummaries(path, *recursive)
+	}
+	if err != nil {
+		return err
+	}
+	folders, err := listSubFolders(service, path, *recursive)
+	if err != nil {
+		return err
+	}
+
+	doc := newFolderDocument(path, folders, summaries, filtered, *recursive)
+	switch {
+	case a.out.quiet:
+		for _, taskPath := range doc.taskPaths() {
+			fmt.Fprintln(a.out.w, taskPath)
+		}
+		return nil
+	case a.out.format == formatTable:
+		return writeTree(a.out.w, doc)
+	default:
+		return a.out.document(doc)
+	}
+}
+
+// listSubFolders returns the paths of the subfolders of the folder at path, and
+// of all their subfolders if recursive is set.
+func listSubFolders(service *taskmaster.TaskService, path string, recursive bool) ([]string, error) {
+	folders, err := service.GetSubFolders(path)
+	if err != nil || !recursive {
+		return folders, err
+	}
+	for _, folder := range folders {
+		subFolders, err := listSubFolders(service, folder, true)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, subFolders...)
+	}
+
+	return folders, nil
+}
+
+func runShow(a *app, cmd command, args []string) error {
+	flags := a.flagSet(cmd)
+	if err := a.parseFlags(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	return a.withTask(flags.Arg(0), func(task *taskmaster.RegisteredTask) error {
+		switch {
+		case a.out.quiet:
+			return nil
+		case a.out.format == formatTable:
+			return writeTaskTable(a.out.w, *task)
+		default:
+			doc, err := newTaskDocument(*task, false)
+			if err != nil {
+				return err
+			}
+			return a.out.document(doc)
+		}
+	})
+}
+
+func runExport(a *app, cmd command, args []string) error {
+	flags := a.flagSet(cmd)
+	formatName := flags.String("format", string(formatXML), "the export format: xml, json or yaml")
+	outPath := flags.String("out", "", "the file to write to; standard output if empty")
+	if err := a.parseFlags(flags, args, 1, 1); err != nil {
+		return err
+	}
+	format, err := parseOutputFormat(*formatName, formatXML, formatJSON, formatYAML)
+	if err != nil {
+		return err
+	}
+
+	return a.withTask(flags.Arg(0), func(task *taskmaster.RegisteredTask) error {
+		var w io.Writer = a.out.w
+		if *outPath != "" {
+			file, err := os.Create(*outPath)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			w = file
+		}
+
+		if format == formatXML {
+			data := []byte(task.Definition.XMLText)
+			if *outPath != "" {
+				// files are written the way the Task Scheduler exports them
+				data = encodeTaskXML(task.Definition.XMLText)
+			}
+			_, err := w.Write(data)
+			return err
+		}
+
+		doc, err := newTaskDocument(*task, true)
+		if err != nil {
+			return err
+		}
+		return writeDocument(w, format, doc)
+	})
+}
+
+func runImport(a *app, cmd command, args []string) error {
+	flags := a.flagSet(cmd)
+	update := flags.Bool("update", false, "replace the task if it exists")
+	disabled := flags.Bool("disabled", false, "register the task disabled")
+	taskUser := flags.String("task-user", "", "the user the task runs as, instead of the one in the file")
+	taskPassword := flags.String("task-password", "", "the password of -task-user")
+	if err := a.parseFlags(flags, args, 2, 2); err != nil {
+		return err
+	}
+
+	var data []byte
+	var err error
+	if name := flags.Arg(1); name == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return err
+	}
+	xmlText, err := importedTaskXML(data)
+	if err != nil {
+		return err
+	}
+
+	opts := []taskmaster.RegisterOption{taskmaster.WithCreationFlags(taskmaster.TASK_CREATE)}
+	if *update {
+		opts[0] = taskmaster.WithCreationFlags(taskmaster.TASK_CREATE_OR_UPDATE)
+	}
+	if *disabled {
+		opts = append(opts, taskmaster.WithDisabled())
+	}
+	if *taskUser != "" {
+		opts = append(opts, taskmaster.WithCredentials(*taskUser, *taskPassword))
+	}
+
+	service, err := a.connect()
+	if err != nil {
+		return err
+	}
+	task, err := service.RegisterTaskXML(flags.Arg(0), xmlText, opts...)
+	if err != nil {
+		return err
+	}
+	defer task.Release()
+
+	a.out.printf("imported %s\n", task.Path)
+	return nil
+}
+
+func runRun(a *app, cmd command, args []string) error {
+	flags := a.flagSet(cmd)
+	ignoreConstraints := flags.Bool("ignore-constraints", false, "run the task regardless of its conditions, such as running only when idle")
+	if err := a.parseFlags(flags, args, 1, -1); err != nil {
+		return err
+	}
+	runFlags := taskmaster.TASK_RUN_NO_FLAGS
+	if *ignoreConstraints {
+		runFlags = taskmaster.TASK_RUN_IGNORE_CONSTRAINTS
+	}
+
+	return a.withTask(flags.Arg(0), func(task *taskmaster.RegisteredTask) error {
+		instance, err := task.RunEx(flags.Args()[1:], runFlags, 0, "")
+		if err != nil {
+			return err
+		}
+		defer instance.Release()
+
+		switch {
+		case a.out.quiet:
+			fmt.Fprintln(a.out.w, instance.InstanceGUID)
+		case a.out.format == formatTable:
+			fmt.Fprintf(a.out.w, "started %s as %s\n", task.Path, instance.InstanceGUID)
+		default:
+			return a.out.document(map[string]any{"Path": task.Path, "InstanceGUID": instance.InstanceGUID})
+		}
+		return nil
+	})
+}
+
+func runStop(a *app, cmd command, args []string) error {
+	flags := a.flagSet(cmd)
+	if err := a.parseFlags(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	return a.withTask(flags.Arg(0), func(task *taskmaster.RegisteredTask) error {
+		if err := task.Stop(); err != nil {
+			return err
+		}
+		a.out.printf("stopped %s\n", task.Path)
+		return nil
+	})
+}
+
+func runEnable(a *app, cmd command, args []string) error {
+	return setEnabled(a, cmd, args, true)
+}
+
+func runDisable(a *app, cmd command, args []string) error {
+	return setEnabled(a, cmd, args, false)
+}
+
+func setEnabled(a *app, cmd command, args []string, enabled bool) error {
+	flags := a.flagSet(cmd)
+	if err := a.parseFlags(flags, args, 1, -1); err != nil {
+		return err
+	}
+
+	for _, path := range flags.Args() {
+		err := a.withTask(path, func(task *taskmaster.RegisteredTask) error {
+			return task.SetEnabled(enabled)
+		})
+		if err != nil {
+			return err
+		}
+		a.out.printf("%sd %s\n", cmd.name, path)
+	}
+
+	return nil
+}
+
+func runRm(a *app, cmd command, args []string) error {
+	flags := a.flagSet(cmd)
+	if err := a.parseFlags(flags, args, 1, -1); err != nil {
+		return err
+	}
+	service, err := a.connect()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range flags.Args() {
+		if err := service.DeleteTask(path); err != nil {
+			return err
+		}
+		a.out.printf("deleted %s\n", path)
+	}
+
+	return nil
+}
+
+func runRmdir(a *app, cmd command, args []string) error {
+	flags := a.flagSet(cmd)
+	recursive := flags.Bool("r", false, "delete the tasks and subfolders of the folder too")
+	if err := a.parseFlags(flags, args, 1, 1); err != nil {
+		return err
+	}
+	service, err := a.connect()
+	if err != nil {
+		return err
+	}
+
+	path := flags.Arg(0)
+	deleted, err := service.DeleteFolder(path, *recursive)
+	if err != nil {
+		return err
+	} else if !deleted {
+		return fmt.Errorf("folder %s is not empty; use -r to delete its contents", path)
+	}
+	a.out.printf("deleted %s\n", path)
+
+	return nil
+}
+
+// withTask connects and calls fn with the registered task at path.
+func (a *app) withTask(path string, fn func(task *taskmaster.RegisteredTask) error) error {
+	service, err := a.connect()
+	if err != nil {
+		return err
+	}
+	task, err := service.GetRegisteredTask(path)
+	if err != nil {
+		return err
+	}
+	defer task.Release()
+
+	return fn(&task)
+}
@@ -0,0 +1,35 @@
+// Command taskmaster manages the scheduled tasks of a local or remote computer
+// through the Windows Task Scheduler.
+//
+// Usage:
+//
+//	taskmaster [flags] <command> [arguments]
+//
+// The commands are:
+//
+//	ls [-r] [-filter expr] [folder]      list the tasks of a folder as a tree
+//	show <task>                          show the details of a task
+//	export [-format f] [-out file] <task> export a task as XML, JSON or YAML
+//	import [-update] <task> <file>       register a task from an exported file
+//	run [-ignore-constraints] <task> [args...]
+//	                                     run a task
+//	stop <task>                          stop all running instances of a task
+//	enable <task>...                     enable tasks
+//	disable <task>...                    disable tasks
+//	rm <task>...                         delete tasks
+//	rmdir [-r] <folder>                  delete a folder
+//
+// The flags are:
+//
+//	-host       the computer to connect to; the local computer if empty
+//	-domain     the domain of -user
+//	-user       the user to connect as; the current user if empty
+//	-password   the password of -user; read from TASKMASTER_PASSWORD if empty
+//	-o          the output format: table, json or yaml
+//	-q          print only task paths or identifiers
+//
+// Filter expressions are described in the documentation of taskmaster.Filter.
+//
+// taskmaster exits with 0 on success, 1 if a command fails, 2 if the command line
+// is invalid and 3 if a task or folder does not exist.
+package main
@@ -0,0 +1,159 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/giert/taskmaster"
+)
+
+// app holds the global flags and the connection of a taskmaster invocation.
+type app struct {
+	out    output
+	stderr io.Writer
+
+	host, domain, user, password string
+	service                      *taskmaster.TaskService
+}
+
+// connect connects to the Task Scheduler service on first use.
+func (a *app) connect() (*taskmaster.TaskService, error) {
+	if a.service == nil {
+		service, err := taskmaster.ConnectWithOptions(a.host, a.domain, a.user, a.password)
+		if err != nil {
+			return nil, err
+		}
+		a.service = &service
+	}
+
+	return a.service, nil
+}
+
+func (a *app) disconnect() {
+	if a.service != nil {
+		a.service.Disconnect()
+		a.service = nil
+	}
+}
+
+// flagSet returns the flag set of a command, which reports errors as usage errors.
+func (a *app) flagSet(cmd command) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(a.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(a.stderr, "usage: taskmaster %s %s\n", cmd.name, cmd.args)
+		flags.PrintDefaults()
+	}
+
+	return flags
+}
+
+// parseFlags parses the arguments of a command and checks the number of positional
+// arguments, where max < 0 means no limit.
+func (a *app) parseFlags(flags *flag.FlagSet, args []string, min, max int) error {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{msg: err.Error()}
+	}
+	if n := flags.NArg(); n < min || (max >= 0 && n > max) {
+		flags.Usage()
+		return usagef("wrong number of arguments")
+	}
+
+	return nil
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(a *app, cmd command, args []string) error
+}
+
+var commands = []command{
+	{name: "ls", args: "[-r] [-filter expr] [folder]", summary: "list the tasks of a folder as a tree", run: runLs},
+	{name: "show", args: "<task>", summary: "show the details of a task", run: runShow},
+	{name: "export", args: "[-format xml|json|yaml] [-out file] <task>", summary: "export a task", run: runExport},
+	{name: "import", args: "[-update] [-disabled] [-task-user user] [-task-password password] <task> <file|->", summary: "register a task from an exported file", run: runImport},
+	{name: "run", args: "[-ignore-constraints] <task> [args...]", summary: "run a task", run: runRun},
+	{name: "stop", args: "<task>", summary: "stop all running instances of a task", run: runStop},
+	{name: "enable", args: "<task>...", summary: "enable tasks", run: runEnable},
+	{name: "disable", args: "<task>...", summary: "disable tasks", run: runDisable},
+	{name: "rm", args: "<task>...", summary: "delete tasks", run: runRm},
+	{name: "rmdir", args: "[-r] <folder>", summary: "delete a folder", run: runRmdir},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs taskmaster with the given arguments and returns its exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	a := &app{stderr: stderr}
+
+	flags := flag.NewFlagSet("taskmaster", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&a.host, "host", "", "the computer to connect to; the local computer if empty")
+	flags.StringVar(&a.domain, "domain", "", "the domain of -user")
+	flags.StringVar(&a.user, "user", "", "the user to connect as; the current user if empty")
+	flags.StringVar(&a.password, "password", "", "the password of -user; read from TASKMASTER_PASSWORD if empty")
+	format := flags.String("o", string(formatTable), "the output format: table, json or yaml")
+	quiet := flags.Bool("q", false, "print only task paths or identifiers")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: taskmaster [flags] <command> [arguments]\n\ncommands:")
+		for _, cmd := range commands {
+			fmt.Fprintf(stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+		}
+		fmt.Fprintln(stderr, "\nflags:")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	outputFormat, err := parseOutputFormat(*format, formatTable, formatJSON, formatYAML)
+	if err != nil {
+		fmt.Fprintf(stderr, "taskmaster: %v\n", err)
+		return exitUsage
+	}
+	a.out = output{w: stdout, format: outputFormat, quiet: *quiet}
+	if a.password == "" {
+		a.password = os.Getenv("TASKMASTER_PASSWORD")
+	}
+
+	name := flags.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		err := cmd.run(a, cmd, flags.Args()[1:])
+		a.disconnect()
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		} else if err != nil {
+			fmt.Fprintf(stderr, "taskmaster %s: %v\n", cmd.name, err)
+		}
+		return exitCode(err)
+	}
+
+	fmt.Fprintf(stderr, "taskmaster: unknown command %q; run taskmaster -h for a list of commands\n", strings.TrimSpace(name))
+	return exitUsage
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, "taskmaster: the Task Scheduler is only available on Windows")
+	os.Exit(exitError)
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf16"
+
+	"github.com/giert/taskmaster"
+	"gopkg.in/yaml.v3"
+)
+
+// exit codes
+const (
+	exitOK       = 0 // the command succeeded
+	exitError    = 1 // the command failed
+	exitUsage    = 2 // the command line is invalid
+	exitNotFound = 3 // a task or folder does not exist
+)
+
+// usageError is an invalid command line.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...any) error {
+	return usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// exitCode returns the exit code for the error a command returned.
+func exitCode(err error) int {
+	var usageErr usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.Is(err, os.ErrNotExist):
+		return exitNotFound
+	default:
+		return exitError
+	}
+}
+
+// outputFormat is how commands print their results.
+type outputFormat string
+
+const (
+	formatTable outputFormat = "table"
+	formatJSON  outputFormat = "json"
+	formatYAML  outputFormat = "yaml"
+	formatXML   outputFormat = "xml" // only for export
+)
+
+func parseOutputFormat(s string, allowed ...outputFormat) (outputFormat, error) {
+	for _, format := range allowed {
+		if strings.EqualFold(s, string(format)) {
+			return format, nil
+		}
+	}
+
+	names := make([]string, len(allowed))
+	for i, format := range allowed {
+		names[i] = string(format)
+	}
+	return "", usagef("invalid output format %q, must be one of %s", s, strings.Join(names, ", "))
+}
+
+// output prints the results of a command.
+type output struct {
+	w      io.Writer
+	format outputFormat
+	quiet  bool // print only the essentials, such as task paths
+}
+
+// printf prints a message in table format, unless the output is quiet.
+func (o output) printf(format string, args ...any) {
+	if !o.quiet && o.format == formatTable {
+		fmt.Fprintf(o.w, format, args...)
+	}
+}
+
+// document prints v as JSON or YAML.
+func (o output) document(v any) error {
+	return writeDocument(o.w, o.format, v)
+}
+
+func writeDocument(w io.Writer, format outputFormat, v any) error {
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case formatYAML:
+		// go through JSON so that both formats have the same keys
+		generic, err := toGeneric(v)
+		if err != nil {
+			return err
+		}
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(generic); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("cannot write a document as %s", format)
+	}
+}
+
+func toGeneric(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+
+	return generic, nil
+}
+
+// taskDocument is a registered task as printed by show and export.
+type taskDocument struct {
+	Path           string
+	Name           string
+	Enabled        bool
+	State          string
+	MissedRuns     uint
+	NextRunTime    *time.Time `json:",omitempty"`
+	LastRunTime    *time.Time `json:",omitempty"`
+	LastTaskResult uint32
+	LastResultText string         `json:",omitempty"`
+	Definition     map[string]any `json:",omitempty"`
+	XML            string         `json:",omitempty"` // the XML definition, which import reads back
+}
+
+func newTaskDocument(task taskmaster.RegisteredTask, withXML bool) (taskDocument, error) {
+	doc := taskDocument{
+		Path:           task.Path,
+		Name:           task.Name,
+		Enabled:        task.Enabled,
+		State:          task.State.String(),
+		MissedRuns:     task.MissedRuns,
+		NextRunTime:    optionalTime(task.NextRunTime),
+		LastRunTime:    optionalTime(task.LastRunTime),
+		LastTaskResult: uint32(task.LastTaskResult),
+		LastResultText: task.LastTaskResult.String(),
+	}
+	if withXML {
+		doc.XML = task.Definition.XMLText
+	}
+
+	var err error
+	doc.Definition, err = definitionDocument(task.Definition)
+	return doc, err
+}
+
+// definitionDocument returns a task definition as generic JSON, in the encoding of
+// Definition.MarshalJSON.
+func definitionDocument(def taskmaster.Definition) (map[string]any, error) {
+	def.XMLText = ""
+	generic, err := toGeneric(def)
+	if err != nil {
+		return nil, err
+	}
+
+	return generic.(map[string]any), nil
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// encodeTaskXML encodes the XML definition of a task in UTF-16 with a byte order
+// mark, as the Task Scheduler exports tasks.
+func encodeTaskXML(xmlText string) []byte {
+	units := utf16.Encode([]rune(xmlText))
+	data := make([]byte, 2+2*len(units))
+	data[0], data[1] = 0xFF, 0xFE
+	for i, unit := range units {
+		binary.LittleEndian.PutUint16(data[2+2*i:], unit)
+	}
+
+	return data
+}
+
+// importedTaskXML returns the XML definition of a task from a file written by
+// export, in any of its formats, or by the Task Scheduler.
+func importedTaskXML(data []byte) (string, error) {
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF}), " \t\r\n")
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) || bytes.HasPrefix(trimmed, []byte("<")) {
+		def, err := taskmaster.ReadTaskXML(bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+		return def.XMLText, nil
+	}
+
+	// JSON is YAML, so one decoder reads both formats
+	var doc struct {
+		XML string `yaml:"XML"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("error parsing exported task: %w", err)
+	}
+	if doc.XML == "" {
+		return "", errors.New("error parsing exported task: it has no XML definition")
+	}
+
+	return doc.XML, nil
+}
+
+// folderDocument is a task folder as printed by ls.
+type folderDocument struct {
+	Path    string
+	Folders []folderDocument  `json:",omitempty"`
+	Tasks   []summaryDocument `json:",omitempty"`
+}
+
+type summaryDocument struct {
+	Path           string
+	Name           string
+	Enabled        bool
+	State          string
+	NextRunTime    *time.Time `json:",omitempty"`
+	LastRunTime    *time.Time `json:",omitempty"`
+	LastTaskResult uint32
+}
+
+// newFolderDocument returns the folder tree at path from the paths of its folders
+// and the summaries of its tasks. If filtered is set, the summaries are those of the
+// tasks that matched a filter, and only the folders that contain them are kept.
+// Unless recursive is set, folders and summaries only hold the direct contents of
+// path, and subfolders are listed without their contents, and not at all if
+// filtered.
+func newFolderDocument(path string, folders []string, summaries []taskmaster.TaskSummary, filtered, recursive bool) folderDocument {
+	subFolders := map[string][]string{}
+	for _, folder := range folders {
+		parent := strings.ToLower(parentFolder(folder))
+		subFolders[parent] = append(subFolders[parent], folder)
+	}
+	tasks := map[string][]summaryDocument{}
+	for _, task := range summaries {
+		parent := strings.ToLower(parentFolder(task.Path))
+		tasks[parent] = append(tasks[parent], summaryDocument{
+			Path:           task.Path,
+			Name:           task.Name,
+			Enabled:        task.Enabled,
+			State:          task.State.String(),
+			NextRunTime:    optionalTime(task.NextRunTime),
+			LastRunTime:    optionalTime(task.LastRunTime),
+			LastTaskResult: uint32(task.LastTaskResult),
+		})
+	}
+
+	var build func(path string) folderDocument
+	build = func(path string) folderDocument {
+		// paths are case insensitive
+		key := strings.ToLower(path)
+		doc := folderDocument{Path: path, Tasks: tasks[key]}
+		for _, subFolder := range subFolders[key] {
+			if !recursive {
+				if !filtered {
+					doc.Folders = append(doc.Folders, folderDocument{Path: subFolder})
+				}
+				continue
+			}
+			subDoc := build(subFolder)
+			if !filtered || !subDoc.empty() {
+				doc.Folders = append(doc.Folders, subDoc)
+			}
+		}
+		return doc
+	}
+
+	return build(trimFolderPath(path))
+}
+
+// matchingSummaries returns the summaries of the tasks of seq, an enumeration of
+// the folder at path and its subfolders such as TaskService.RegisteredTasks, that
+// match filter. Unless recursive is set, only the tasks directly in path are
+// matched; as a folder's tasks are enumerated before its subfolders, the
+// enumeration stops at the first task of a subfolder.
+func matchingSummaries(seq iter.Seq2[taskmaster.RegisteredTask, error], path string, filter taskmaster.Filter, recursive bool) ([]taskmaster.TaskSummary, error) {
+	folder := trimFolderPath(path)
+	var summaries []taskmaster.TaskSummary
+	for task, err := range seq {
+		if err != nil {
+			return nil, err
+		}
+		if !recursive && !strings.EqualFold(parentFolder(task.Path), folder) {
+			break
+		}
+		if filter.Match(task) {
+			summaries = append(summaries, taskmaster.TaskSummary{
+				Name:           task.Name,
+				Path:           task.Path,
+				Enabled:        task.Enabled,
+				State:          task.State,
+				MissedRuns:     task.MissedRuns,
+				NextRunTime:    task.NextRunTime,
+				LastRunTime:    task.LastRunTime,
+				LastTaskResult: task.LastTaskResult,
+			})
+		}
+	}
+
+	return summaries, nil
+}
+
+// trimFolderPath returns the path of a folder without a trailing backslash, unless
+// it is the root folder.
+func trimFolderPath(path string) string {
+	if path != `\` {
+		path = strings.TrimSuffix(path, `\`)
+	}
+	return path
+}
+
+// parentFolder returns the path of the folder that holds the task or folder at
+// path.
+func parentFolder(path string) string {
+	parent := path[:strings.LastIndex(path, `\`)]
+	if parent == "" {
+		return `\`
+	}
+	return parent
+}
+
+func (d folderDocument) empty() bool {
+	return len(d.Tasks) == 0 && len(d.Folders) == 0
+}
+
+// taskPaths returns the paths of all tasks in the tree, folders first.
+func (d folderDocument) taskPaths() []string {
+	var paths []string
+	for _, task := range d.Tasks {
+		paths = append(paths, task.Path)
+	}
+	for _, folder := range d.Folders {
+		paths = append(paths, folder.taskPaths()...)
+	}
+
+	return paths
+}
+
+// writeTree prints a folder tree as an indented table.
+func writeTree(w io.Writer, doc folderDocument) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATE\tNEXT RUN\tLAST RUN\tLAST RESULT")
+	writeTreeRows(tw, doc, 0)
+	return tw.Flush()
+}
+
+func writeTreeRows(w io.Writer, doc folderDocument, depth int) {
+	indent := strings.Repeat("  ", depth)
+	name := doc.Path
+	if depth > 0 {
+		name = name[strings.LastIndex(name, `\`)+1:]
+	}
+	if !strings.HasSuffix(name, `\`) {
+		name += `\`
+	}
+	fmt.Fprintf(w, "%s%s\t\t\t\t\n", indent, name)
+
+	for _, task := range doc.Tasks {
+		state := task.State
+		if !task.Enabled && state != taskmaster.TASK_STATE_DISABLED.String() {
+			state += " (disabled)"
+		}
+		fmt.Fprintf(w, "%s  %s\t%s\t%s\t%s\t%s\n", indent, task.Name, state, formatTime(task.NextRunTime), formatTime(task.LastRunTime), formatResult(task.LastTaskResult))
+	}
+	for _, folder := range doc.Folders {
+		writeTreeRows(w, folder, depth+1)
+	}
+}
+
+// writeTaskTable prints the details of a task as a two-column table.
+func writeTaskTable(w io.Writer, task taskmaster.RegisteredTask) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	row := func(name string, value any) {
+		fmt.Fprintf(tw, "%s:\t%v\n", name, value)
+	}
+
+	def := task.Definition
+	row("Path", task.Path)
+	row("Enabled", task.Enabled)
+	row("State", task.State)
+	row("Next Run", formatTime(optionalTime(task.NextRunTime)))
+	row("Last Run", formatTime(optionalTime(task.LastRunTime)))
+	row("Last Result", fmt.Sprintf("%s (%s)", formatResult(uint32(task.LastTaskResult)), task.LastTaskResult))
+	row("Missed Runs", task.MissedRuns)
+	row("Author", def.RegistrationInfo.Author)
+	row("Description", def.RegistrationInfo.Description)
+	user := def.Principal.UserID
+	if user == "" {
+		user = def.Principal.GroupID
+	}
+	row("Run As", fmt.Sprintf("%s (%s, %s)", user, def.Principal.LogonType, def.Principal.RunLevel))
+	for i, trigger := range def.Triggers {
+		row(fmt.Sprintf("Trigger %d", i+1), describeTrigger(trigger))
+	}
+	for i, action := range def.Actions {
+		row(fmt.Sprintf("Action %d", i+1), describeAction(action))
+	}
+
+	return tw.Flush()
+}
+
+func describeTrigger(trigger taskmaster.Trigger) string {
+	s := trigger.GetType().String()
+	if start := trigger.GetStartBoundary(); !start.IsZero() {
+		s += ", starting " + start.Format(time.DateTime)
+	}
+	if !trigger.GetEnabled() {
+		s += " (disabled)"
+	}
+
+	return s
+}
+
+func describeAction(action taskmaster.Action) string {
+	switch action := action.(type) {
+	case taskmaster.ExecAction:
+		return strings.TrimSpace(action.Path + " " + action.Args)
+	case taskmaster.ComHandlerAction:
+		return "COM handler " + action.ClassID
+	default:
+		return action.GetType().String()
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+
+	return t.Format(time.DateTime)
+}
+
+func formatResult(result uint32) string {
+	return fmt.Sprintf("0x%X", result)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/giert/taskmaster"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{err: nil, want: exitOK},
+		{err: usagef("bad"), want: exitUsage},
+		{err: fmt.Errorf("error getting task: %w", os.ErrNotExist), want: exitNotFound},
+		{err: fmt.Errorf("access denied"), want: exitError},
+	}
+
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v): want %d, got %d", tt.err, tt.want, got)
+		}
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	if format, err := parseOutputFormat("JSON", formatTable, formatJSON); err != nil || format != formatJSON {
+		t.Errorf("want json, got %q, %v", format, err)
+	}
+	if _, err := parseOutputFormat("xml", formatTable, formatJSON); exitCode(err) != exitUsage {
+		t.Errorf("want a usage error, got %v", err)
+	}
+}
+
+// testFolderDocument returns the tree of a folder with a task, a subfolder with a
+// disabled task and an empty subfolder, matching the tasks against filter.
+func testFolderDocument(t *testing.T, filter taskmaster.Filter, recursive bool) folderDocument {
+	t.Helper()
+	folders := []string{`\Vendor`, `\Empty`}
+	def := taskmaster.DefaultDefinition()
+	def.AddAction(taskmaster.ExecAction{Path: "cmd.exe"})
+	tasks := []taskmaster.RegisteredTask{
+		{Name: "Root", Path: `\Root`, Enabled: true, State: taskmaster.TASK_STATE_READY, Definition: def},
+		{Name: "Nightly", Path: `\Vendor\Nightly`, Enabled: false, State: taskmaster.TASK_STATE_DISABLED, LastTaskResult: 1, Definition: def},
+	}
+
+	seq := func(yield func(taskmaster.RegisteredTask, error) bool) {
+		for _, task := range tasks {
+			if !yield(task, nil) {
+				return
+			}
+		}
+	}
+
+	filtered := filter.String() != ""
+	summaries, err := matchingSummaries(seq, `\`, filter, recursive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newFolderDocument(`\`, folders, summaries, filtered, recursive)
+}
+
+func TestFolderDocument(t *testing.T) {
+	doc := testFolderDocument(t, taskmaster.Filter{}, true)
+	if got, want := doc.taskPaths(), []string{`\Root`, `\Vendor\Nightly`}; !slices.Equal(got, want) {
+		t.Errorf("want tasks %v, got %v", want, got)
+	}
+	if len(doc.Folders) != 2 {
+		t.Errorf("want 2 subfolders, got %d", len(doc.Folders))
+	}
+
+	doc = testFolderDocument(t, taskmaster.Filter{}, false)
+	if got, want := doc.taskPaths(), []string{`\Root`}; !slices.Equal(got, want) {
+		t.Errorf("want tasks %v, got %v", want, got)
+	}
+	if len(doc.Folders) != 2 || len(doc.Folders[0].Tasks) != 0 {
+		t.Errorf("want 2 subfolders without tasks, got %+v", doc.Folders)
+	}
+
+	doc = testFolderDocument(t, taskmaster.MustParseFilter(`!enabled`), true)
+	if got, want := doc.taskPaths(), []string{`\Vendor\Nightly`}; !slices.Equal(got, want) {
+		t.Errorf("want tasks %v, got %v", want, got)
+	}
+	if len(doc.Folders) != 1 {
+		t.Errorf("want only the folder with matching tasks, got %+v", doc.Folders)
+	}
+
+	doc = testFolderDocument(t, taskmaster.MustParseFilter(`!enabled`), false)
+	if !doc.empty() {
+		t.Errorf("want no tasks of subfolders, got %+v", doc)
+	}
+
+	doc = newFolderDocument(`\vendor\`, nil, []taskmaster.TaskSummary{{Name: "Nightly", Path: `\Vendor\Nightly`}}, false, false)
+	if got, want := doc.taskPaths(), []string{`\Vendor\Nightly`}; doc.Path != `\vendor` || !slices.Equal(got, want) {
+		t.Errorf("want tasks %v in \\vendor, got %+v", want, doc)
+	}
+}
+
+func TestWriteTree(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeTree(&buf, testFolderDocument(t, taskmaster.Filter{}, true)); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	want := []string{"NAME", `\`, "Root", `Vendor\`, "Nightly", `Empty\`}
+	if len(lines) != len(want) {
+		t.Fatalf("want %d lines, got %q", len(want), buf.String())
+	}
+	for i, line := range lines {
+		if fields := strings.Fields(line); fields[0] != want[i] {
+			t.Errorf("line %d: want %q first, got %q", i, want[i], line)
+		}
+	}
+	if !strings.Contains(lines[4], "Disabled") || !strings.Contains(lines[4], "0x1") {
+		t.Errorf("unexpected task line %q", lines[4])
+	}
+}
+
+func TestDefinitionDocument(t *testing.T) {
+	def := taskmaster.DefaultDefinition()
+	def.AddAction(taskmaster.ExecAction{Path: "cmd.exe"})
+	def.AddTrigger(taskmaster.DailyTrigger{DayInterval: taskmaster.EveryDay})
+	def.XMLText = "<Task />"
+
+	doc, err := definitionDocument(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc["XMLText"] != "" {
+		t.Errorf("want XMLText left out, got %v", doc["XMLText"])
+	}
+	action := doc["Actions"].([]any)[0].(map[string]any)
+	if action["Type"] != "Exec" || action["Path"] != "cmd.exe" {
+		t.Errorf("unexpected action %v", action)
+	}
+	trigger := doc["Triggers"].([]any)[0].(map[string]any)
+	if trigger["Type"] != "Daily" || trigger["DayInterval"] != float64(1) {
+		t.Errorf("unexpected trigger %v", trigger)
+	}
+}
+
+func TestImportedTaskXML(t *testing.T) {
+	const xmlText = `<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task"><Actions><Exec><Command>cmd.exe</Command></Exec></Actions></Task>`
+	doc := taskDocument{Path: `\Task`, XML: xmlText}
+
+	var jsonDoc, yamlDoc bytes.Buffer
+	if err := writeDocument(&jsonDoc, formatJSON, doc); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDocument(&yamlDoc, formatYAML, doc); err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := map[string][]byte{
+		"xml":   []byte(xmlText),
+		"utf16": encodeTaskXML(xmlText),
+		"json":  jsonDoc.Bytes(),
+		"yaml":  yamlDoc.Bytes(),
+	}
+	for name, data := range inputs {
+		got, err := importedTaskXML(data)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if got != xmlText {
+			t.Errorf("%s: want %q, got %q", name, xmlText, got)
+		}
+	}
+
+	if _, err := importedTaskXML([]byte("Path: \\Task\n")); err == nil {
+		t.Error("want an error for a document without XML")
+	}
+}
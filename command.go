@@ -0,0 +1,247 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultScratchFolder is the task folder RunCommand registers its temporary tasks in.
+const DefaultScratchFolder = `\Taskmaster\Scratch`
+
+// commandTaskExpiry is how long a temporary task outlives its registration before
+// the Task Scheduler deletes it, should RunCommand fail to clean it up.
+const commandTaskExpiry = 24 * time.Hour
+
+// Command is a one-shot command for RunCommand.
+type Command struct {
+	Path       string        // the path of the executable
+	Args       string        // the command-line arguments of the executable
+	WorkingDir string        // the working directory of the executable
+	UserID     string        // the user the command runs as; SYSTEM if empty
+	Password   string        // the password of UserID, if it logs on with TASK_LOGON_PASSWORD
+	LogonType  TaskLogonType // how UserID logs on; if TASK_LOGON_NONE, derived from UserID and Password
+	RunLevel   TaskRunLevel  // the privilege level the command runs with
+	Folder     string        // the task folder of the temporary task; DefaultScratchFolder if empty
+	OutputDir  string        // the directory the output files are written to; a new temporary directory if empty
+}
+
+// CommandResult is the outcome of a command run by RunCommand.
+type CommandResult struct {
+	Stdout    []byte        // what the command wrote to standard output
+	Stderr    []byte        // what the command wrote to standard error
+	ExitCode  int           // the exit code of the command, or -1 if it did not exit
+	Result    TaskResult    // the result of the temporary task's run
+	Started   time.Time     // when the command was first seen running
+	Duration  time.Duration // how long the command ran, accurate to the polling interval
+	EnginePID uint          // the process ID the command ran under
+}
+
+// Success reports whether the command exited with exit code 0.
+func (r CommandResult) Success() bool {
+	return r.ExitCode == 0
+}
+
+// RunCommand runs a command on the connected computer through a temporary task,
+// waits for it to exit and returns its output and exit code. The command runs
+// through a batch file that redirects its standard output and standard error and
+// records its exit code in files in cmd.OutputDir, which is removed afterwards if
+// RunCommand created it.
+//
+// The temporary task is registered in cmd.Folder and deleted when RunCommand
+// returns. Its trigger expires a day after registration, and the Task Scheduler
+// deletes expired tasks, so the task does not outlive a crashed caller for long.
+//
+// The output files are read by the caller, so for a remote computer, or a user
+// other than SYSTEM, cmd.OutputDir must be a directory that both the command and
+// the caller can reach, such as a UNC path.
+//
+// If ctx is done before the command exits, the command is stopped and RunCommand
+// returns the context's error. A non-zero exit code is not an error.
+func (t *TaskService) RunCommand(ctx context.Context, cmd Command) (CommandResult, error) {
+	result := CommandResult{ExitCode: -1}
+	if cmd.Path == "" {
+		return result, errors.New("error running command: Path is required")
+	} else if strings.ContainsAny(cmd.Path+cmd.Args, "\r\n") {
+		return result, errors.New("error running command: Path and Args must not contain line breaks")
+	}
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return result, err
+	}
+	name := "run-" + hex.EncodeToString(id[:])
+
+	outputDir := cmd.OutputDir
+	if outputDir == "" {
+		dir, err := os.MkdirTemp("", "taskmaster-")
+		if err != nil {
+			return result, fmt.Errorf("error creating output directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		outputDir = dir
+	}
+	files := commandFiles{
+		script: filepath.Join(outputDir, name+".cmd"),
+		stdout: filepath.Join(outputDir, name+".out"),
+		stderr: filepath.Join(outputDir, name+".err"),
+		code:   filepath.Join(outputDir, name+".code"),
+	}
+	defer files.remove()
+	if err := os.WriteFile(files.script, []byte(files.batch(cmd)), 0o644); err != nil {
+		return result, fmt.Errorf("error writing command script: %w", err)
+	}
+
+	folder := cmd.Folder
+	if folder == "" {
+		folder = DefaultScratchFolder
+	}
+	path := strings.TrimRight(folder, `\`) + `\` + name
+
+	task, err := t.RegisterTask(path, commandDefinition(cmd, files.script), commandRegisterOptions(cmd)...)
+	if err != nil {
+		return result, fmt.Errorf("error running command: %w", err)
+	}
+	defer func() {
+		task.Release()
+		t.DeleteTask(path)
+	}()
+
+	instance, err := task.Run()
+	if err != nil {
+		return result, fmt.Errorf("error running command: %w", err)
+	}
+	defer instance.Release()
+
+	run, err := task.Wait(ctx, instance)
+	result.Result = run.Result
+	result.Started = run.Started
+	result.Duration = run.Duration
+	result.EnginePID = run.EnginePID
+	if err != nil {
+		if stopErr := instance.Stop(); stopErr != nil {
+			err = errors.Join(err, stopErr)
+		}
+		return result, err
+	}
+
+	if result.Stdout, err = os.ReadFile(files.stdout); err != nil {
+		return result, fmt.Errorf("error reading command output: %w", err)
+	}
+	if result.Stderr, err = os.ReadFile(files.stderr); err != nil {
+		return result, fmt.Errorf("error reading command output: %w", err)
+	}
+	code, err := os.ReadFile(files.code)
+	if err != nil {
+		return result, fmt.Errorf("error reading command exit code: %w", err)
+	}
+	if result.ExitCode, err = strconv.Atoi(strings.TrimSpace(string(code))); err != nil {
+		return result, fmt.Errorf("error parsing command exit code %q: %w", code, err)
+	}
+
+	return result, nil
+}
+
+// commandFiles are the files RunCommand runs a command through.
+type commandFiles struct {
+	script, stdout, stderr, code string
+}
+
+// batch returns the batch file that runs cmd, with its arguments escaped so that
+// the executable receives them as they are.
+func (f commandFiles) batch(cmd Command) string {
+	var b strings.Builder
+	b.WriteString("@echo off\r\n")
+	fmt.Fprintf(&b, "\"%s\" %s >\"%s\" 2>\"%s\"\r\n", strings.ReplaceAll(cmd.Path, "%", "%%"), escapeBatchArgs(cmd.Args), f.stdout, f.stderr)
+	b.WriteString("set taskmaster_exit=%ERRORLEVEL%\r\n")
+	fmt.Fprintf(&b, ">\"%s\" echo %%taskmaster_exit%%\r\n", f.code)
+	b.WriteString("exit /b %taskmaster_exit%\r\n")
+	return b.String()
+}
+
+// escapeBatchArgs escapes command-line arguments for a line of a batch file. Percent
+// signs are doubled, and outside double quotes the characters cmd.exe treats as
+// operators are escaped with a caret.
+func escapeBatchArgs(args string) string {
+	var b strings.Builder
+	inQuotes := false
+	for _, r := range args {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == '%':
+			b.WriteRune('%')
+		case !inQuotes && strings.ContainsRune("&|<>^()", r):
+			b.WriteRune('^')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func (f commandFiles) remove() {
+	for _, name := range []string{f.script, f.stdout, f.stderr, f.code} {
+		os.Remove(name)
+	}
+}
+
+func commandDefinition(cmd Command, script string) Definition {
+	def := DefaultDefinition()
+	def.AddAction(ExecAction{
+		Path:       "cmd.exe",
+		Args:       `/d /c "` + script + `"`,
+		WorkingDir: cmd.WorkingDir,
+	})
+
+	// a trigger that never fires but lets the task expire
+	now := time.Now()
+	def.AddTrigger(TimeTrigger{
+		TaskTrigger: TaskTrigger{
+			Enabled:       true,
+			StartBoundary: now.Add(-time.Minute),
+			EndBoundary:   now.Add(commandTaskExpiry),
+		},
+	})
+	def.Settings.DeleteExpiredTaskAfter = "PT0S"
+	def.Settings.MultipleInstances = TASK_INSTANCES_PARALLEL
+	def.Settings.DontStartOnBatteries = false
+	def.Settings.StopIfGoingOnBatteries = false
+	def.Settings.Hidden = true
+	def.RegistrationInfo.Description = "temporary task of taskmaster.RunCommand"
+
+	def.Principal.RunLevel = cmd.RunLevel
+	def.Principal.UserID = cmd.UserID
+	def.Principal.LogonType = cmd.LogonType
+	if cmd.UserID == "" {
+		def.Principal.UserID = "SYSTEM"
+		def.Principal.LogonType = TASK_LOGON_SERVICE_ACCOUNT
+	} else if cmd.LogonType == TASK_LOGON_NONE {
+		if cmd.Password != "" {
+			def.Principal.LogonType = TASK_LOGON_PASSWORD
+		} else {
+			def.Principal.LogonType = TASK_LOGON_S4U
+		}
+	}
+
+	return def
+}
+
+func commandRegisterOptions(cmd Command) []RegisterOption {
+	opts := []RegisterOption{WithCreationFlags(TASK_CREATE)}
+	if cmd.Password != "" {
+		opts = append(opts, WithCredentials(cmd.UserID, cmd.Password))
+	}
+
+	return opts
+}
@@ -0,0 +1,77 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCommand(t *testing.T) {
+	taskService := setupTaskService(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	result, err := taskService.RunCommand(ctx, Command{
+		Path:   "cmd.exe",
+		Args:   "/c echo 100% done& echo oops 1>&2& exit 7",
+		Folder: testTaskPath("Scratch"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 7 || result.Success() {
+		t.Fatalf("expected exit code 7, got %d", result.ExitCode)
+	}
+	if got := strings.TrimSpace(string(result.Stdout)); got != "100% done" {
+		t.Fatalf("unexpected stdout %q", got)
+	}
+	if got := strings.TrimSpace(string(result.Stderr)); got != "oops" {
+		t.Fatalf("unexpected stderr %q", got)
+	}
+
+	tasks, err := taskService.GetTasksInFolder(testTaskPath("Scratch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tasks.Release()
+	if len(tasks) != 0 {
+		t.Fatalf("expected the temporary task to be deleted, found %d tasks", len(tasks))
+	}
+}
+
+func TestEscapeBatchArgs(t *testing.T) {
+	tests := []struct {
+		args string
+		want string
+	}{
+		{args: "", want: ""},
+		{args: "-n 3 127.0.0.1", want: "-n 3 127.0.0.1"},
+		{args: "/c echo 100% done& exit 7", want: "/c echo 100%% done^& exit 7"},
+		{args: `/c "a & b" | (c)`, want: `/c "a & b" ^| ^(c^)`},
+	}
+	for _, tt := range tests {
+		if got := escapeBatchArgs(tt.args); got != tt.want {
+			t.Fatalf("escapeBatchArgs(%q): want %q, got %q", tt.args, tt.want, got)
+		}
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	taskService := setupTaskService(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err := taskService.RunCommand(ctx, Command{
+		Path:   "ping.exe",
+		Args:   "-n 30 127.0.0.1",
+		Folder: testTaskPath("Scratch"),
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded, got %v", err)
+	}
+}
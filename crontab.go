@@ -0,0 +1,630 @@
+package taskmaster
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rickb777/period"
+)
+
+// maxTriggers is the number of triggers a task can have at most.
+const maxTriggers = 48
+
+// CrontabOptions configures ParseCrontab.
+type CrontabOptions struct {
+	Start     time.Time // the day the schedules start on, in the time zone of the triggers; today if zero
+	UserField bool      // lines have a user field after the schedule, as in /etc/crontab
+	Author    string    // the RegistrationInfo.Author of the definitions
+}
+
+// CrontabJob is a crontab line converted to a task definition.
+type CrontabJob struct {
+	Line       int    // the line number in the crontab, starting at 1
+	Text       string // the line as written
+	Name       string // a task name derived from the command and the line number
+	Definition Definition
+}
+
+// CrontabIssue is a crontab line that could not be converted exactly.
+type CrontabIssue struct {
+	Line    int
+	Text    string
+	Skipped bool   // no job was created; otherwise the job of the line approximates it
+	Reason  string // what is lost or why the line was skipped
+}
+
+func (i CrontabIssue) String() string {
+	verb := "approximated"
+	if i.Skipped {
+		verb = "skipped"
+	}
+
+	return fmt.Sprintf("line %d: %s: %s\n\t%s", i.Line, verb, i.Reason, i.Text)
+}
+
+// CrontabImport is the outcome of ParseCrontab.
+type CrontabImport struct {
+	Jobs   []CrontabJob
+	Issues []CrontabIssue
+}
+
+// Report returns a migration report listing the lines that could not be
+// converted exactly, one issue per paragraph.
+func (i CrontabImport) Report() string {
+	var b strings.Builder
+	skipped := 0
+	for _, issue := range i.Issues {
+		if issue.Skipped {
+			skipped++
+		}
+	}
+	fmt.Fprintf(&b, "%d jobs converted (%d approximately), %d lines skipped\n", len(i.Jobs), len(i.Issues)-skipped, skipped)
+	for _, issue := range i.Issues {
+		b.WriteString(issue.String())
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+// ParseCrontab converts the jobs of a crontab to task definitions. Comments and
+// blank lines are ignored, and environment assignments apply to the jobs that
+// follow them. Every job becomes a definition with an ExecAction that runs its
+// command with cmd.exe, after setting the environment and piping in the text
+// after the first unescaped %, one line per further %, as cron does.
+//
+// Schedules become calendar triggers at the times of the minute and hour fields,
+// using repetition patterns where the times are evenly spaced, so most schedules
+// convert exactly; @reboot becomes a BootTrigger. As in cron, a job whose day of
+// month and day of week fields are both restricted runs on the days matching
+// either one. The definitions allow parallel instances and running on batteries,
+// like cron, but keep the default time limit of DefaultDefinition.
+//
+// Commands are still written for /bin/sh, so they usually need to be reviewed;
+// ParseCrontab only reports what it cannot translate, in CrontabImport.Issues.
+// It fails only if r cannot be read.
+func ParseCrontab(r io.Reader, opts CrontabOptions) (CrontabImport, error) {
+	if opts.Start.IsZero() {
+		opts.Start = time.Now()
+	}
+
+	var result CrontabImport
+	var env []cronVariable
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+
+		issue := CrontabIssue{Line: line, Text: text}
+		if name, value, ok := parseCronVariable(trimmed); ok {
+			if reason, unsupported := cronUnsupportedVariables[name]; unsupported {
+				issue.Skipped = true
+				issue.Reason = reason
+				result.Issues = append(result.Issues, issue)
+				continue
+			}
+			env = setCronVariable(env, name, value)
+			continue
+		}
+
+		job := CrontabJob{Line: line, Text: text}
+		notes, err := opts.convert(&job, trimmed, env)
+		if err != nil {
+			issue.Skipped = true
+			issue.Reason = err.Error()
+			result.Issues = append(result.Issues, issue)
+			continue
+		}
+		result.Jobs = append(result.Jobs, job)
+		if len(notes) > 0 {
+			issue.Reason = strings.Join(notes, "; ")
+			result.Issues = append(result.Issues, issue)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return CrontabImport{}, fmt.Errorf("error reading crontab: %w", err)
+	}
+
+	return result, nil
+}
+
+// cronUnsupportedVariables are the variables that configure cron itself, with the
+// reason they are not converted.
+var cronUnsupportedVariables = map[string]string{
+	"SHELL":    "SHELL is not supported; commands run with cmd.exe",
+	"MAILTO":   "MAILTO is not supported; the output of commands is discarded",
+	"MAILFROM": "MAILFROM is not supported; the output of commands is discarded",
+	"CRON_TZ":  "CRON_TZ is not supported; schedules use the time zone of the Task Scheduler",
+	"TZ":       "TZ is not supported; schedules use the time zone of the Task Scheduler",
+}
+
+type cronVariable struct {
+	name, value string
+}
+
+var cronVariablePattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*=\s*(.*)$`)
+
+// parseCronVariable parses an environment assignment such as NAME = "value".
+func parseCronVariable(line string) (name, value string, ok bool) {
+	match := cronVariablePattern.FindStringSubmatch(line)
+	if match == nil {
+		return "", "", false
+	}
+	value = strings.TrimSpace(match[2])
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+
+	return match[1], value, true
+}
+
+// setCronVariable sets a variable, keeping the order the variables were first set in.
+func setCronVariable(env []cronVariable, name, value string) []cronVariable {
+	for i := range env {
+		if env[i].name == name {
+			env = append(env[:i:i], env[i+1:]...)
+			break
+		}
+	}
+
+	return append(env, cronVariable{name, value})
+}
+
+// cronShortcuts are the schedules of the @ shortcuts, except for @reboot.
+var cronShortcuts = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// convert converts a job line to a definition, returning what is approximated.
+func (opts CrontabOptions) convert(job *CrontabJob, line string, env []cronVariable) ([]string, error) {
+	var schedule []string
+	var rest string
+	if line[0] == '@' {
+		var shortcut string
+		shortcut, rest = cutCronFields(line, 1)
+		shortcut = strings.ToLower(shortcut)
+		if expanded, ok := cronShortcuts[shortcut]; ok {
+			schedule = strings.Fields(expanded)
+		} else if shortcut != "@reboot" {
+			return nil, fmt.Errorf("unknown schedule %s", shortcut)
+		}
+	} else {
+		var fields string
+		fields, rest = cutCronFields(line, 5)
+		schedule = strings.Fields(fields)
+		if len(schedule) < 5 {
+			return nil, fmt.Errorf("%d schedule fields, want 5", len(schedule))
+		}
+	}
+
+	var notes []string
+	if opts.UserField {
+		var user string
+		user, rest = cutCronFields(rest, 1)
+		if user != "" {
+			notes = append(notes, fmt.Sprintf("runs as %s in cron; the task runs as the user it is registered for", user))
+		}
+	}
+	if rest == "" {
+		return nil, errors.New("no command")
+	}
+
+	def := DefaultDefinition()
+	def.RegistrationInfo.Author = opts.Author
+	def.RegistrationInfo.Source = "crontab"
+	def.RegistrationInfo.Description = fmt.Sprintf("Imported from crontab line %d: %s", job.Line, strings.TrimSpace(job.Text))
+	def.Settings.MultipleInstances = TASK_INSTANCES_PARALLEL
+	def.Settings.DontStartOnBatteries = false
+	def.Settings.StopIfGoingOnBatteries = false
+
+	if schedule == nil {
+		def.AddTrigger(BootTrigger{TaskTrigger: TaskTrigger{Enabled: true}})
+	} else {
+		triggers, scheduleNotes, err := opts.cronTriggers(schedule)
+		if err != nil {
+			return nil, err
+		}
+		for _, trigger := range triggers {
+			def.AddTrigger(trigger)
+		}
+		notes = append(notes, scheduleNotes...)
+	}
+
+	command, stdin := splitCronCommand(rest)
+	script, scriptNotes := cronScript(env, command, stdin)
+	notes = append(notes, scriptNotes...)
+	def.AddAction(ExecAction{Path: "cmd.exe", Args: `/d /s /c "` + script + `"`})
+
+	job.Name = cronJobName(command, job.Line)
+	job.Definition = def
+
+	return notes, nil
+}
+
+// cutCronFields returns the first n whitespace-separated fields of s and the rest
+// of s after them, with its inner whitespace intact.
+func cutCronFields(s string, n int) (fields, rest string) {
+	i := 0
+	for ; n > 0; n-- {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+			i++
+		}
+		for i < len(s) && s[i] != ' ' && s[i] != '\t' {
+			i++
+		}
+	}
+
+	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i:])
+}
+
+// splitCronCommand splits a command at the first unescaped %. The text after it
+// is the standard input of the command, with every further unescaped % standing
+// for a newline. \% is a literal %.
+func splitCronCommand(s string) (command string, stdin []string) {
+	var b strings.Builder
+	inStdin := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '%':
+			b.WriteByte('%')
+			i++
+		case s[i] == '%' && !inStdin:
+			command = b.String()
+			b.Reset()
+			inStdin = true
+		case s[i] == '%':
+			stdin = append(stdin, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	if !inStdin {
+		return b.String(), nil
+	}
+
+	return strings.TrimSpace(command), append(stdin, b.String())
+}
+
+// cronScript returns the cmd.exe command line that sets env and runs command with
+// stdin piped in.
+func cronScript(env []cronVariable, command string, stdin []string) (string, []string) {
+	var notes []string
+	var b strings.Builder
+	for _, v := range env {
+		if strings.ContainsAny(v.value, `"%`) {
+			notes = append(notes, fmt.Sprintf("the value of %s contains \" or %%, which cmd.exe may interpret", v.name))
+		}
+		fmt.Fprintf(&b, `set "%s=%s"&& `, v.name, v.value)
+	}
+
+	if stdin != nil {
+		// the left side of a pipe is parsed twice, by this cmd.exe and by the one
+		// running the block, so special characters are escaped twice
+		b.WriteByte('(')
+		for i, line := range stdin {
+			if i > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString("echo(")
+			for _, c := range line {
+				if strings.ContainsRune(`^&|<>()`, c) {
+					b.WriteString("^^^")
+				}
+				b.WriteRune(c)
+			}
+		}
+		b.WriteString(")| ")
+		notes = append(notes, "the standard input is piped with echo, which ends every line with CRLF")
+		if strings.ContainsAny(strings.Join(stdin, ""), `"%`) {
+			notes = append(notes, "the standard input contains \" or %, which cmd.exe may interpret")
+		}
+	}
+
+	b.WriteString(command)
+	if strings.Contains(command, "%") {
+		notes = append(notes, "the command contains %, which cmd.exe expands in %NAME% references")
+	}
+
+	return b.String(), notes
+}
+
+var invalidTaskNameChars = strings.NewReplacer(`\`, "_", "/", "_", ":", "_", "*", "_", "?", "_", `"`, "_", "<", "_", ">", "_", "|", "_")
+
+// cronJobName derives a task name from the program of command, such as
+// "backup (line 3)" for /usr/local/bin/backup.sh.
+func cronJobName(command string, line int) string {
+	program, _ := cutCronFields(command, 1)
+	program = strings.Trim(program, `"'`)
+	if i := strings.LastIndexAny(program, `/\`); i >= 0 {
+		program = program[i+1:]
+	}
+	if i := strings.LastIndexByte(program, '.'); i > 0 {
+		program = program[:i]
+	}
+	program = invalidTaskNameChars.Replace(program)
+	if program == "" {
+		program = "job"
+	}
+
+	return fmt.Sprintf("%s (line %d)", program, line)
+}
+
+// cronField describes a schedule field.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string // the names of the values from min, if any
+}
+
+var cronFields = [5]cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// parse returns the values of a field as a bit set.
+func (f cronField) parse(s string) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		rangeText, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s field %q", stepText, f.name, s)
+			}
+		}
+
+		low, high := f.min, f.max
+		if rangeText != "*" {
+			lowText, highText, isRange := strings.Cut(rangeText, "-")
+			var err error
+			if low, err = f.value(lowText); err != nil {
+				return 0, fmt.Errorf("invalid %s field %q: %w", f.name, s, err)
+			}
+			high = low
+			if isRange {
+				if high, err = f.value(highText); err != nil {
+					return 0, fmt.Errorf("invalid %s field %q: %w", f.name, s, err)
+				}
+			} else if hasStep {
+				high = f.max
+			}
+			if high < low {
+				return 0, fmt.Errorf("invalid %s field %q: range %s is reversed", f.name, s, rangeText)
+			}
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << v
+		}
+	}
+
+	return set, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	} else if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%d is out of range %d-%d", v, f.min, f.max)
+	}
+
+	return v, nil
+}
+
+// cronTime is the start of a trigger, in minutes after midnight, and the
+// repetition pattern that adds the other times of the schedule.
+type cronTime struct {
+	start, interval, count int
+}
+
+// cronTriggers converts the five fields of a schedule to triggers.
+func (opts CrontabOptions) cronTriggers(schedule []string) ([]Trigger, []string, error) {
+	var sets [5]uint64
+	for i, field := range cronFields {
+		var err error
+		if sets[i], err = field.parse(schedule[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	minutes, hours, days, months, weekdays := sets[0], sets[1], sets[2]>>1, sets[3]>>1, sets[4]
+	if weekdays&(1<<7) != 0 {
+		weekdays = weekdays&^(1<<7) | 1 // 7 is Sunday too
+	}
+
+	var notes []string
+	allDays := days == uint64(AllDaysOfMonth)
+	allWeekdays := weekdays == uint64(AllDays)
+	var patterns []Trigger
+	switch {
+	case allDays && allWeekdays:
+		patterns = append(patterns, cronDailyPattern(Month(months)))
+	case strings.HasPrefix(schedule[2], "*") || strings.HasPrefix(schedule[4], "*"):
+		// cron runs on the days matching both fields if either starts with *
+		if !allDays && !allWeekdays {
+			notes = append(notes, "cron runs the job on the days matching both the day of month and the day of week; the task runs on every matching day of the week")
+		}
+		if allWeekdays {
+			patterns = append(patterns, MonthlyTrigger{DaysOfMonth: DayOfMonth(days), MonthsOfYear: Month(months)})
+		} else {
+			patterns = append(patterns, cronWeeklyPattern(DayOfWeek(weekdays), Month(months)))
+		}
+	case allDays || allWeekdays:
+		patterns = append(patterns, cronDailyPattern(Month(months)))
+	default:
+		patterns = append(patterns,
+			MonthlyTrigger{DaysOfMonth: DayOfMonth(days), MonthsOfYear: Month(months)},
+			cronWeeklyPattern(DayOfWeek(weekdays), Month(months)))
+	}
+
+	times := cronTimes(minutes, hours)
+	if n := len(patterns) * len(times); n > maxTriggers {
+		return nil, nil, fmt.Errorf("the schedule needs %d triggers, more than the %d a task can have", n, maxTriggers)
+	}
+
+	var triggers []Trigger
+	for _, pattern := range patterns {
+		for _, t := range times {
+			triggers = append(triggers, withTaskTrigger(pattern, t.taskTrigger(opts.Start, 0)))
+		}
+	}
+
+	return triggers, notes, nil
+}
+
+// taskTrigger returns an enabled TaskTrigger that starts at the time on day, plus
+// second seconds, and repeats as the time says.
+func (t cronTime) taskTrigger(day time.Time, second int) TaskTrigger {
+	year, month, date := day.Date()
+	taskTrigger := TaskTrigger{
+		Enabled:       true,
+		StartBoundary: time.Date(year, month, date, t.start/60, t.start%60, second, 0, day.Location()),
+	}
+	if t.count > 1 {
+		// the duration ends a minute after the last run, so that no run is added
+		// at its end
+		taskTrigger.RepetitionInterval = minutesPeriod(t.interval)
+		taskTrigger.RepetitionDuration = minutesPeriod(t.interval*(t.count-1) + 1)
+	}
+
+	return taskTrigger
+}
+
+func cronDailyPattern(months Month) Trigger {
+	if months == AllMonths {
+		return DailyTrigger{DayInterval: EveryDay}
+	}
+
+	return MonthlyTrigger{DaysOfMonth: AllDaysOfMonth, MonthsOfYear: months}
+}
+
+func cronWeeklyPattern(weekdays DayOfWeek, months Month) Trigger {
+	if months == AllMonths {
+		return WeeklyTrigger{DaysOfWeek: weekdays, WeekInterval: EveryWeek}
+	}
+
+	return MonthlyDOWTrigger{DaysOfWeek: weekdays, MonthsOfYear: months, WeeksOfMonth: AllWeeks}
+}
+
+// withTaskTrigger returns pattern with its TaskTrigger set.
+func withTaskTrigger(pattern Trigger, taskTrigger TaskTrigger) Trigger {
+	switch t := pattern.(type) {
+	case DailyTrigger:
+		t.TaskTrigger = taskTrigger
+		return t
+	case WeeklyTrigger:
+		t.TaskTrigger = taskTrigger
+		return t
+	case MonthlyTrigger:
+		t.TaskTrigger = taskTrigger
+		return t
+	case MonthlyDOWTrigger:
+		t.TaskTrigger = taskTrigger
+		return t
+	case TimeTrigger:
+		t.TaskTrigger = taskTrigger
+		return t
+	case BootTrigger:
+		t.TaskTrigger = taskTrigger
+		return t
+	case RegistrationTrigger:
+		t.TaskTrigger = taskTrigger
+		return t
+	default:
+		panic(fmt.Sprintf("unexpected trigger type %T", pattern))
+	}
+}
+
+func minutesPeriod(minutes int) period.Period {
+	return period.NewHMS(minutes/60, minutes%60, 0)
+}
+
+// cronTimes covers the times of day in minutes × hours with as few repeating
+// triggers as possible: one if all times are evenly spaced, otherwise one per
+// hour or one per minute, whichever is fewer.
+func cronTimes(minutes, hours uint64) []cronTime {
+	ms, hs := setValues(minutes), setValues(hours)
+	var all []int
+	for _, h := range hs {
+		for _, m := range ms {
+			all = append(all, h*60+m)
+		}
+	}
+	if interval, ok := evenlySpaced(all); ok {
+		return []cronTime{{start: all[0], interval: interval, count: len(all)}}
+	}
+
+	best := make([]cronTime, len(all))
+	for i, t := range all {
+		best[i] = cronTime{start: t, count: 1}
+	}
+	if interval, ok := evenlySpaced(ms); ok && len(hs) < len(best) {
+		best = best[:0:0]
+		for _, h := range hs {
+			best = append(best, cronTime{start: h*60 + ms[0], interval: interval, count: len(ms)})
+		}
+	}
+	if interval, ok := evenlySpaced(hs); ok && len(ms) < len(best) {
+		best = best[:0:0]
+		for _, m := range ms {
+			best = append(best, cronTime{start: hs[0]*60 + m, interval: interval * 60, count: len(hs)})
+		}
+	}
+	sort.Slice(best, func(i, j int) bool { return best[i].start < best[j].start })
+
+	return best
+}
+
+// evenlySpaced returns the difference between consecutive values, if there are at
+// least two and it is the same for all of them.
+func evenlySpaced(values []int) (int, bool) {
+	if len(values) < 2 {
+		return 0, false
+	}
+	interval := values[1] - values[0]
+	for i := 2; i < len(values); i++ {
+		if values[i]-values[i-1] != interval {
+			return 0, false
+		}
+	}
+
+	return interval, true
+}
+
+// setValues returns the values in a bit set in increasing order.
+func setValues(set uint64) []int {
+	var values []int
+	for set != 0 {
+		v := bits.TrailingZeros64(set)
+		values = append(values, v)
+		set &^= 1 << v
+	}
+
+	return values
+}
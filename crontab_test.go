@@ -0,0 +1,188 @@
+package taskmaster
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/period"
+)
+
+const testCrontab = `# backups
+MAILTO=ops@example.com
+BACKUP_DIR = "D:\Backups"
+
+@reboot C:\Tools\warmup.exe
+*/15 9-17 * * 1-5 C:\Tools\poll.cmd --quiet
+30 2 1,15 * mon  /usr/local/bin/backup.sh full
+0 0,12 * jan-mar *	report.exe
+5 4 * * * mail.exe -s "hello" ops%Dear ops,%disk & cpu ok%
+0 0 */2 * 1 odd-mondays.exe
+@often nope.exe
+61 * * * * late.exe
+0,1,3,6,10,15,21 0,1,3,6,10,15,21 * * * busy.exe
+`
+
+func TestParseCrontab(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour, minute int) time.Time { return time.Date(2024, 5, 1, hour, minute, 0, 0, time.UTC) }
+
+	result, err := ParseCrontab(strings.NewReader(testCrontab), CrontabOptions{Start: start, Author: "ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, job := range result.Jobs {
+		names = append(names, job.Name)
+	}
+	wantNames := []string{"warmup (line 5)", "poll (line 6)", "backup (line 7)", "report (line 8)", "mail (line 9)", "odd-mondays (line 10)"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("jobs %q, want %q", names, wantNames)
+	}
+
+	reboot := result.Jobs[0].Definition
+	if len(reboot.Triggers) != 1 || reboot.Triggers[0].GetType() != TASK_TRIGGER_BOOT {
+		t.Errorf("@reboot triggers = %#v", reboot.Triggers)
+	}
+	if got := reboot.Actions[0].(ExecAction); got.Path != "cmd.exe" || got.Args != `/d /s /c "set "BACKUP_DIR=D:\Backups"&& C:\Tools\warmup.exe"` {
+		t.Errorf("@reboot action = %#v", got)
+	}
+	if reboot.RegistrationInfo.Author != "ops" || reboot.RegistrationInfo.Description != `Imported from crontab line 5: @reboot C:\Tools\warmup.exe` {
+		t.Errorf("@reboot registration info = %#v", reboot.RegistrationInfo)
+	}
+	if reboot.Settings.MultipleInstances != TASK_INSTANCES_PARALLEL || reboot.Settings.DontStartOnBatteries {
+		t.Errorf("@reboot settings = %#v", reboot.Settings)
+	}
+
+	poll := WeeklyTrigger{
+		TaskTrigger: TaskTrigger{
+			Enabled:       true,
+			StartBoundary: at(9, 0),
+			RepetitionPattern: RepetitionPattern{
+				RepetitionDuration: period.NewHMS(8, 46, 0),
+				RepetitionInterval: period.NewHMS(0, 15, 0),
+			},
+		},
+		DaysOfWeek:   Monday | Tuesday | Wednesday | Thursday | Friday,
+		WeekInterval: EveryWeek,
+	}
+	if triggers := result.Jobs[1].Definition.Triggers; !reflect.DeepEqual(triggers, []Trigger{poll}) {
+		t.Errorf("*/15 9-17 * * 1-5 triggers = %#v", triggers)
+	}
+
+	// both day fields are restricted, so the job runs on either
+	backup := []Trigger{
+		MonthlyTrigger{TaskTrigger: TaskTrigger{Enabled: true, StartBoundary: at(2, 30)}, DaysOfMonth: One | Fifteen, MonthsOfYear: AllMonths},
+		WeeklyTrigger{TaskTrigger: TaskTrigger{Enabled: true, StartBoundary: at(2, 30)}, DaysOfWeek: Monday, WeekInterval: EveryWeek},
+	}
+	if triggers := result.Jobs[2].Definition.Triggers; !reflect.DeepEqual(triggers, backup) {
+		t.Errorf("30 2 1,15 * mon triggers = %#v", triggers)
+	}
+
+	report := MonthlyTrigger{
+		TaskTrigger: TaskTrigger{
+			Enabled:       true,
+			StartBoundary: at(0, 0),
+			RepetitionPattern: RepetitionPattern{
+				RepetitionDuration: period.NewHMS(12, 1, 0),
+				RepetitionInterval: period.NewHMS(12, 0, 0),
+			},
+		},
+		DaysOfMonth:  AllDaysOfMonth,
+		MonthsOfYear: January | February | March,
+	}
+	if triggers := result.Jobs[3].Definition.Triggers; !reflect.DeepEqual(triggers, []Trigger{report}) {
+		t.Errorf("0 0,12 * jan-mar * triggers = %#v", triggers)
+	}
+
+	if got := result.Jobs[4].Definition.Actions[0].(ExecAction).Args; got != `/d /s /c "set "BACKUP_DIR=D:\Backups"&& (echo(Dear ops,&echo(disk ^^^& cpu ok&echo()| mail.exe -s "hello" ops"` {
+		t.Errorf("stdin action arguments = %s", got)
+	}
+
+	var issues []string
+	for _, issue := range result.Issues {
+		issues = append(issues, issue.String())
+	}
+	for i, want := range []struct {
+		line    int
+		skipped bool
+		reason  string
+	}{
+		{2, true, "MAILTO is not supported"},
+		{9, false, "piped with echo"},
+		{10, false, "days matching both"},
+		{11, true, "unknown schedule @often"},
+		{12, true, "61 is out of range 0-59"},
+		{13, true, "needs 49 triggers"},
+	} {
+		if i >= len(result.Issues) {
+			t.Errorf("missing issue for line %d", want.line)
+			continue
+		}
+		issue := result.Issues[i]
+		if issue.Line != want.line || issue.Skipped != want.skipped || !strings.Contains(issue.Reason, want.reason) {
+			t.Errorf("issue %d = %s, want line %d skipped %t with %q", i, issue, want.line, want.skipped, want.reason)
+		}
+	}
+	if len(result.Issues) != 6 {
+		t.Errorf("issues:\n%s", strings.Join(issues, "\n"))
+	}
+
+	if report := result.Report(); !strings.HasPrefix(report, "6 jobs converted (2 approximately), 4 lines skipped\n") || !strings.Contains(report, "line 12: skipped:") {
+		t.Errorf("report:\n%s", report)
+	}
+}
+
+func TestParseCrontabUserField(t *testing.T) {
+	result, err := ParseCrontab(strings.NewReader("17 * * * * root cd / && run-parts /etc/cron.hourly\n"), CrontabOptions{UserField: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Jobs) != 1 || len(result.Issues) != 1 || !strings.Contains(result.Issues[0].Reason, "runs as root") {
+		t.Fatalf("jobs %#v, issues %#v", result.Jobs, result.Issues)
+	}
+	if got := result.Jobs[0].Definition.Actions[0].(ExecAction).Args; got != `/d /s /c "cd / && run-parts /etc/cron.hourly"` {
+		t.Errorf("action arguments = %s", got)
+	}
+}
+
+func TestCronTimes(t *testing.T) {
+	tests := []struct {
+		minutes, hours string
+		want           []cronTime
+	}{
+		{"30", "2", []cronTime{{150, 0, 1}}},
+		{"*", "*", []cronTime{{0, 1, 1440}}},
+		{"0", "*/6", []cronTime{{0, 360, 4}}},
+		{"0,30", "8,17", []cronTime{{480, 30, 2}, {1020, 30, 2}}},
+		{"0,10", "1-3", []cronTime{{60, 60, 3}, {70, 60, 3}}},
+		{"5,7,20", "4,9", []cronTime{{245, 300, 2}, {247, 300, 2}, {260, 300, 2}}},
+		{"5,7,20", "1,2,4", []cronTime{{65, 0, 1}, {67, 0, 1}, {80, 0, 1}, {125, 0, 1}, {127, 0, 1}, {140, 0, 1}, {245, 0, 1}, {247, 0, 1}, {260, 0, 1}}},
+	}
+	for _, test := range tests {
+		minutes, err := cronFields[0].parse(test.minutes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hours, err := cronFields[1].parse(test.hours)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cronTimes(minutes, hours); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("cronTimes(%s, %s) = %v, want %v", test.minutes, test.hours, got, test.want)
+		}
+	}
+}
+
+func TestCronFieldErrors(t *testing.T) {
+	for _, field := range []string{"", "x", "5-1", "*/0", "1-", "60"} {
+		if _, err := cronFields[0].parse(field); err == nil {
+			t.Errorf("parsing minute field %q did not fail", field)
+		}
+	}
+	if set, err := cronFields[4].parse("Sat-7"); err != nil || set != 1<<6|1<<7 {
+		t.Errorf("parsing Sat-7 = %b, %v", set, err)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import "strings"
+
+// CreateCrontabTasks registers the jobs of a crontab imported with ParseCrontab as
+// tasks in folder, named after CrontabJob.Name, replacing tasks of the same name.
+// The tasks are created with ApplyBatch, so either all of them are created or, if
+// one fails, none are kept. username, password and logonType have the same meaning
+// as in CreateTaskEx.
+func (t *TaskService) CreateCrontabTasks(folder string, jobs []CrontabJob, username, password string, logonType TaskLogonType) ([]BatchResult, error) {
+	folder = strings.TrimSuffix(folder, `\`)
+	changes := make([]BatchChange, len(jobs))
+	for i, job := range jobs {
+		changes[i] = BatchChange{
+			Op:         BatchCreate,
+			Path:       folder + `\` + job.Name,
+			Definition: job.Definition,
+			Username:   username,
+			Password:   password,
+			LogonType:  logonType,
+		}
+	}
+
+	return t.ApplyBatch(changes)
+}
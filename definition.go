@@ -0,0 +1,221 @@
+package taskmaster
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rickb777/period"
+)
+
+func (d *Definition) AddAction(action Action) {
+	d.Actions = append(d.Actions, action)
+}
+
+func (d *Definition) AddTrigger(trigger Trigger) {
+	d.Triggers = append(d.Triggers, trigger)
+}
+
+// DefaultDefinition returns a task definition pre-populated with the Task
+// Scheduler default settings. Unlike TaskService.NewTaskDefinition it does not
+// require a connection and does not set RegistrationInfo.Author (which is derived
+// from the connected user), so callers can build definitions without a connected
+// TaskService or when supplying their own RegistrationInfo.
+func DefaultDefinition() Definition {
+	var newDef Definition
+
+	newDef.Principal.LogonType = TASK_LOGON_INTERACTIVE_TOKEN
+	newDef.Principal.RunLevel = TASK_RUNLEVEL_LUA
+
+	newDef.RegistrationInfo.Date = time.Now()
+
+	newDef.Settings.AllowDemandStart = true
+	newDef.Settings.AllowHardTerminate = true
+	newDef.Settings.Compatibility = TASK_COMPATIBILITY_V2
+	newDef.Settings.DontStartOnBatteries = true
+	newDef.Settings.Enabled = true
+	newDef.Settings.Hidden = false
+	newDef.Settings.IdleSettings.IdleDuration = period.NewHMS(0, 10, 0) // PT10M
+	newDef.Settings.IdleSettings.WaitTimeout = period.NewHMS(1, 0, 0)   // PT1H
+	newDef.Settings.MultipleInstances = TASK_INSTANCES_IGNORE_NEW
+	newDef.Settings.Priority = 7
+	newDef.Settings.RestartCount = 0
+	newDef.Settings.RestartOnIdle = false
+	newDef.Settings.RunOnlyIfIdle = false
+	newDef.Settings.RunOnlyIfNetworkAvailable = false
+	newDef.Settings.StartWhenAvailable = false
+	newDef.Settings.StopIfGoingOnBatteries = true
+	newDef.Settings.StopOnIdleEnd = true
+	newDef.Settings.TimeLimit = period.NewHMS(72, 0, 0) // PT72H
+	newDef.Settings.WakeToRun = false
+
+	return newDef
+}
+
+// MarshalJSON encodes the definition as JSON. Every action and trigger gets a Type
+// field holding the String of its GetType, so that UnmarshalJSON can tell them apart.
+func (d Definition) MarshalJSON() ([]byte, error) {
+	type definition Definition // drops the methods to not recurse
+	doc := struct {
+		definition
+		Actions  []json.RawMessage
+		Triggers []json.RawMessage
+	}{definition: definition(d)}
+
+	for _, action := range d.Actions {
+		data, err := marshalTypedJSON(action, action.GetType().String())
+		if err != nil {
+			return nil, err
+		}
+		doc.Actions = append(doc.Actions, data)
+	}
+	for _, trigger := range d.Triggers {
+		data, err := marshalTypedJSON(trigger, trigger.GetType().String())
+		if err != nil {
+			return nil, err
+		}
+		doc.Triggers = append(doc.Triggers, data)
+	}
+
+	return json.Marshal(doc)
+}
+
+// hashDefinition returns the hex encoded SHA-256 of the JSON encoding of def. JSON
+// is used rather than the Go syntax representation so that the hash does not depend
+// on the internals of time.Time and period.Period.
+func hashDefinition(def Definition) string {
+	data, err := json.Marshal(def)
+	if err != nil {
+		// only times that cannot be represented in RFC 3339 fail to encode
+		data = []byte(fmt.Sprintf("%#v", def))
+	}
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// UnmarshalJSON decodes a definition encoded by MarshalJSON. The Type of actions and
+// triggers is matched case-insensitively.
+func (d *Definition) UnmarshalJSON(data []byte) error {
+	type definition Definition
+	var doc struct {
+		definition
+		Actions  []json.RawMessage
+		Triggers []json.RawMessage
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	def := Definition(doc.definition)
+	for i, data := range doc.Actions {
+		action, err := unmarshalAction(data)
+		if err != nil {
+			return fmt.Errorf("error decoding action %d: %w", i, err)
+		}
+		def.AddAction(action)
+	}
+	for i, data := range doc.Triggers {
+		trigger, err := unmarshalTrigger(data)
+		if err != nil {
+			return fmt.Errorf("error decoding trigger %d: %w", i, err)
+		}
+		def.AddTrigger(trigger)
+	}
+	*d = def
+
+	return nil
+}
+
+// marshalTypedJSON encodes v, which must encode to a JSON object, with a leading
+// Type field.
+func marshalTypedJSON(v any, typeName string) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	typeField, err := json.Marshal(typeName)
+	if err != nil {
+		return nil, err
+	}
+
+	typed := append([]byte(`{"Type":`), typeField...)
+	if len(data) > 2 {
+		typed = append(typed, ',')
+	}
+
+	return append(typed, data[1:]...), nil
+}
+
+func typeOfJSON(data []byte) (string, error) {
+	var typed struct {
+		Type string
+	}
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return "", err
+	}
+
+	return typed.Type, nil
+}
+
+func unmarshalJSONAs[T any](data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+
+	return v, err
+}
+
+func unmarshalAction(data []byte) (Action, error) {
+	typeName, err := typeOfJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.EqualFold(typeName, TASK_ACTION_EXEC.String()):
+		return unmarshalJSONAs[ExecAction](data)
+	case strings.EqualFold(typeName, TASK_ACTION_COM_HANDLER.String()):
+		return unmarshalJSONAs[ComHandlerAction](data)
+	default:
+		return nil, fmt.Errorf("unsupported action type %q", typeName)
+	}
+}
+
+func unmarshalTrigger(data []byte) (Trigger, error) {
+	typeName, err := typeOfJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.EqualFold(typeName, TASK_TRIGGER_BOOT.String()):
+		return unmarshalJSONAs[BootTrigger](data)
+	case strings.EqualFold(typeName, TASK_TRIGGER_DAILY.String()):
+		return unmarshalJSONAs[DailyTrigger](data)
+	case strings.EqualFold(typeName, TASK_TRIGGER_EVENT.String()):
+		return unmarshalJSONAs[EventTrigger](data)
+	case strings.EqualFold(typeName, TASK_TRIGGER_IDLE.String()):
+		return unmarshalJSONAs[IdleTrigger](data)
+	case strings.EqualFold(typeName, TASK_TRIGGER_LOGON.String()):
+		return unmarshalJSONAs[LogonTrigger](data)
+	case strings.EqualFold(typeName, TASK_TRIGGER_MONTHLYDOW.String()):
+		return unmarshalJSONAs[MonthlyDOWTrigger](data)
+	case strings.EqualFold(typeName, TASK_TRIGGER_MONTHLY.String()):
+		return unmarshalJSONAs[MonthlyTrigger](data)
+	case strings.EqualFold(typeName, TASK_TRIGGER_REGISTRATION.String()):
+		return unmarshalJSONAs[RegistrationTrigger](data)
+	case strings.EqualFold(typeName, TASK_TRIGGER_SESSION_STATE_CHANGE.String()):
+		return unmarshalJSONAs[SessionStateChangeTrigger](data)
+	case strings.EqualFold(typeName, TASK_TRIGGER_TIME.String()):
+		return unmarshalJSONAs[TimeTrigger](data)
+	case strings.EqualFold(typeName, TASK_TRIGGER_WEEKLY.String()):
+		return unmarshalJSONAs[WeeklyTrigger](data)
+	case strings.EqualFold(typeName, TASK_TRIGGER_CUSTOM_TRIGGER_01.String()):
+		return unmarshalJSONAs[CustomTrigger](data)
+	default:
+		return nil, fmt.Errorf("unsupported trigger type %q", typeName)
+	}
+}
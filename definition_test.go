@@ -0,0 +1,71 @@
+package taskmaster
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/period"
+)
+
+func TestDefinitionJSON(t *testing.T) {
+	def := DefaultDefinition()
+	def.RegistrationInfo.Date = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	def.AddAction(ExecAction{ID: "main", Path: `C:\Tools\backup.exe`, Args: "--all"})
+	def.AddAction(ComHandlerAction{ClassID: "{F0001111-0000-0000-0000-0000FEEDACDC}", Data: "payload"})
+	def.AddTrigger(DailyTrigger{
+		TaskTrigger: TaskTrigger{Enabled: true, StartBoundary: time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)},
+		DayInterval: EveryOtherDay,
+		RandomDelay: period.NewHMS(0, 30, 0),
+	})
+	def.AddTrigger(RegistrationTrigger{TaskTrigger: TaskTrigger{Enabled: true}})
+	def.AddTrigger(EventTrigger{Subscription: "<QueryList/>", ValueQueries: map[string]string{"id": "Event/System/EventID"}})
+
+	data, err := json.Marshal(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`{"Type":"Exec","ID":"main"`, `{"Type":"COM Handler"`, `{"Type":"Daily"`, `"RandomDelay":"PT30M"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("encoding does not contain %s:\n%s", want, data)
+		}
+	}
+
+	var decoded Definition
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if changes := DiffDefinitions(def, decoded); len(changes) != 0 {
+		t.Errorf("decoded definition differs: %v", changes)
+	}
+	if hashDefinition(decoded) != hashDefinition(def) {
+		t.Error("the decoded definition hashes differently")
+	}
+
+	// types are matched case-insensitively
+	if err := json.Unmarshal([]byte(`{"Actions":[{"Type":"exec","Path":"a.exe"}],"Triggers":[{"Type":"BOOT"}]}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decoded.Actions[0].(ExecAction); !ok || len(decoded.Triggers) != 1 || decoded.Triggers[0].GetType() != TASK_TRIGGER_BOOT {
+		t.Errorf("got actions %#v and triggers %#v", decoded.Actions, decoded.Triggers)
+	}
+}
+
+func TestDefinitionJSONErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown action type":  `{"Actions":[{"Type":"Send Email"}]}`,
+		"missing action type":  `{"Actions":[{"Path":"a.exe"}]}`,
+		"unknown trigger type": `{"Triggers":[{"Type":"Sometimes"}]}`,
+		"malformed trigger":    `{"Triggers":[{"Type":"Daily","DayInterval":"often"}]}`,
+		"malformed period":     `{"Settings":{"TimeLimit":"forever"}}`,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			var def Definition
+			if err := json.Unmarshal([]byte(data), &def); err == nil {
+				t.Errorf("decoding %s did not fail", data)
+			}
+		})
+	}
+}
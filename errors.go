@@ -17,10 +17,22 @@ var (
 	ErrNoActions            = errors.New("definition must have at least one action")
 	ErrInvalidPrincipal     = errors.New("both UserId and GroupId are defined for the principal; they are mutually exclusive")
 	ErrRunningTaskCompleted = errors.New("the running task completed while it was getting parsed")
+	ErrInvalidManagerID     = errors.New("manager ID must be non-empty and must not contain ';' or '='")
+	ErrTaskNotOwned         = errors.New("the task is not owned by this manager")
+	ErrDisconnected         = errors.New("the connection to the Task Scheduler service was lost")
 )
 
 func getTaskSchedulerError(err error) error {
 	errCode, parseErr := getOLEErrorCode(err)
+	// a lost connection fails the call itself, usually without exception info
+	switch errCode {
+	case 1722, 0x800706BA, // RPC_S_SERVER_UNAVAILABLE
+		1726, 0x800706BE, // RPC_S_CALL_FAILED
+		0x80010007, // RPC_E_SERVER_DIED
+		0x80010012, // RPC_E_SERVER_DIED_DNE
+		0x80010108: // RPC_E_DISCONNECTED
+		return ErrDisconnected
+	}
 	if parseErr != nil {
 		return parseErr
 	}
@@ -33,6 +45,8 @@ func getTaskSchedulerError(err error) error {
 		return syscall.ERROR_FILE_NOT_FOUND // matches errors.Is(err, os.ErrNotExist)
 	case 3, 0x80070003: // ERROR_PATH_NOT_FOUND: the task folder does not exist
 		return syscall.ERROR_PATH_NOT_FOUND // matches errors.Is(err, os.ErrNotExist)
+	case 183, 0x800700B7: // ERROR_ALREADY_EXISTS: the task or folder already exists
+		return syscall.ERROR_ALREADY_EXISTS // matches errors.Is(err, os.ErrExist)
 	case 50: // ERROR_NOT_SUPPORTED: target is an unsupported OS (e.g. XP / Server 2003)
 		return ErrTargetUnsupported
 	case 53, // ERROR_BAD_NETPATH (raw)
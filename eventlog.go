@@ -0,0 +1,179 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// taskSchedulerChannel is the event log channel the Task Scheduler logs task runs to.
+const taskSchedulerChannel = "Microsoft-Windows-TaskScheduler/Operational"
+
+var (
+	modwevtapi = syscall.NewLazyDLL("wevtapi.dll")
+
+	procEvtOpenSession = modwevtapi.NewProc("EvtOpenSession")
+	procEvtQuery       = modwevtapi.NewProc("EvtQuery")
+	procEvtNext        = modwevtapi.NewProc("EvtNext")
+	procEvtRender      = modwevtapi.NewProc("EvtRender")
+	procEvtClose       = modwevtapi.NewProc("EvtClose")
+)
+
+const (
+	evtRPCLogin              = 1
+	evtQueryChannelPath      = 0x1
+	evtQueryForwardDirection = 0x100
+	evtRenderEventXML        = 1
+	infinite                 = 0xFFFFFFFF
+
+	errorInsufficientBuffer = 122
+	errorNoMoreItems        = 259
+)
+
+// evtRPCLoginInfo is the EVT_RPC_LOGIN structure.
+type evtRPCLoginInfo struct {
+	Server   *uint16
+	User     *uint16
+	Domain   *uint16
+	Password *uint16
+	Flags    uint32
+}
+
+// GetRunHistory returns the runs of the task at path that are recorded in the
+// Microsoft-Windows-TaskScheduler/Operational event log of the connected computer,
+// oldest first. The log only has entries if the task history is enabled. The log
+// of a remote computer is read with the credentials the TaskService connected with.
+// See ParseRunHistory for how events are correlated into runs.
+func (t *TaskService) GetRunHistory(path string) ([]TaskRun, error) {
+	if len(path) == 0 || path[0] != '\\' {
+		return nil, ErrInvalidPath
+	}
+
+	session, err := t.openEventLogSession()
+	if err != nil {
+		return nil, err
+	}
+	if session != 0 {
+		defer evtClose(session)
+	}
+
+	// XPath 1.0 has no escape sequences, so quote the path with whichever quote it does not contain
+	quote := "'"
+	if strings.Contains(path, quote) {
+		quote = `"`
+	}
+	query := fmt.Sprintf("*[EventData[Data[@Name='TaskName']=%s%s%s]]", quote, path, quote)
+
+	var events strings.Builder
+	if err := queryEvents(session, taskSchedulerChannel, query, &events); err != nil {
+		return nil, fmt.Errorf("error querying run history of task %s: %w", path, err)
+	}
+
+	return ParseRunHistory(strings.NewReader(events.String()))
+}
+
+// openEventLogSession opens a session to the event log of the connected computer,
+// or returns a zero handle for the local computer.
+func (t *TaskService) openEventLogSession() (uintptr, error) {
+	hostname, _ := os.Hostname()
+	if t.connectedComputerName == "" || strings.EqualFold(t.connectedComputerName, hostname) {
+		return 0, nil
+	}
+
+	// the session logs on with the credentials of the Task Scheduler connection;
+	// empty ones stand for the current user
+	var login evtRPCLoginInfo
+	for _, field := range []struct {
+		ptr   **uint16
+		value string
+	}{
+		{&login.Server, t.connectedComputerName},
+		{&login.User, t.loginUser},
+		{&login.Domain, t.loginDomain},
+		{&login.Password, t.loginPassword},
+	} {
+		if field.value == "" {
+			continue
+		}
+		ptr, err := syscall.UTF16PtrFromString(field.value)
+		if err != nil {
+			return 0, err
+		}
+		*field.ptr = ptr
+	}
+	session, _, err := procEvtOpenSession.Call(evtRPCLogin, uintptr(unsafe.Pointer(&login)), 0, 0)
+	if session == 0 {
+		return 0, fmt.Errorf("error opening event log session to %s: %w", t.connectedComputerName, err)
+	}
+
+	return session, nil
+}
+
+// queryEvents writes the XML of every event in channel that matches query to w.
+func queryEvents(session uintptr, channel, query string, w *strings.Builder) error {
+	channelPtr, err := syscall.UTF16PtrFromString(channel)
+	if err != nil {
+		return err
+	}
+	queryPtr, err := syscall.UTF16PtrFromString(query)
+	if err != nil {
+		return err
+	}
+
+	results, _, err := procEvtQuery.Call(session, uintptr(unsafe.Pointer(channelPtr)), uintptr(unsafe.Pointer(queryPtr)), evtQueryChannelPath|evtQueryForwardDirection)
+	if results == 0 {
+		return err
+	}
+	defer evtClose(results)
+
+	handles := make([]uintptr, 64)
+	buf := make([]uint16, 4096)
+	for {
+		var returned uint32
+		ok, _, err := procEvtNext.Call(results, uintptr(len(handles)), uintptr(unsafe.Pointer(&handles[0])), infinite, 0, uintptr(unsafe.Pointer(&returned)))
+		if ok == 0 {
+			if errors.Is(err, syscall.Errno(errorNoMoreItems)) {
+				return nil
+			}
+			return err
+		}
+
+		for i, handle := range handles[:returned] {
+			var xmlText string
+			xmlText, buf, err = renderEventXML(handle, buf)
+			if err != nil {
+				for _, h := range handles[i:returned] {
+					evtClose(h)
+				}
+				return err
+			}
+			evtClose(handle)
+			w.WriteString(xmlText)
+		}
+	}
+}
+
+// renderEventXML renders an event as XML, growing buf if it is too small.
+func renderEventXML(event uintptr, buf []uint16) (string, []uint16, error) {
+	for {
+		var used, propertyCount uint32
+		ok, _, err := procEvtRender.Call(0, event, evtRenderEventXML, uintptr(len(buf)*2), uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&used)), uintptr(unsafe.Pointer(&propertyCount)))
+		if ok != 0 {
+			return syscall.UTF16ToString(buf[:used/2]), buf, nil
+		}
+		if !errors.Is(err, syscall.Errno(errorInsufficientBuffer)) {
+			return "", buf, fmt.Errorf("error rendering event: %w", err)
+		}
+		buf = make([]uint16, used/2+1)
+	}
+}
+
+func evtClose(handle uintptr) {
+	procEvtClose.Call(handle)
+}
@@ -0,0 +1,34 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"testing"
+)
+
+func TestGetRunHistory(t *testing.T) {
+	taskService := setupTaskService(t)
+	testTask := createTestTask(taskService)
+
+	runningTask, err := testTask.Run("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runningTask.Release()
+
+	// the task history may be disabled, so only the query itself is checked
+	runs, err := taskService.GetRunHistory(testTask.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, run := range runs {
+		if run.Path != testTask.Path {
+			t.Fatalf("expected runs of %s, got a run of %s", testTask.Path, run.Path)
+		}
+	}
+
+	if _, err := taskService.GetRunHistory("bad path"); err != ErrInvalidPath {
+		t.Fatalf("want ErrInvalidPath, got %v", err)
+	}
+}
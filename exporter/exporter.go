@@ -0,0 +1,417 @@
+// Package exporter exposes the health of scheduled tasks as Prometheus metrics.
+//
+// An Exporter periodically collects the summaries of the tasks in a folder tree
+// and renders the latest collection in the Prometheus text format or OpenMetrics,
+// either over HTTP or as a file for the textfile collector of the node exporter.
+// Every task gets these metrics, labeled with its path:
+//
+//	taskmaster_task_last_result                the LastTaskResult of the task, labeled with its class
+//	taskmaster_task_missed_runs                the number of missed runs
+//	taskmaster_task_state                      1 for the current state of the task, labeled with the state, 0 for the others
+//	taskmaster_task_enabled                    1 if the task is enabled, 0 otherwise
+//	taskmaster_task_last_run_age_seconds       the seconds since the last run, if the task has run
+//	taskmaster_task_next_run_in_seconds        the seconds until the next run, if one is scheduled
+//
+// The class label of taskmaster_task_last_result classifies the result with
+// ClassifyResult, so that alerts can select failures without knowing every
+// result code. The exporter itself is described by the taskmaster_exporter_*
+// metrics.
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/giert/taskmaster"
+)
+
+// Source collects the summaries of the tasks to export.
+type Source func() ([]taskmaster.TaskSummary, error)
+
+// Options configures an Exporter.
+type Options struct {
+	Include []string // globs of the task paths to export, as in taskmaster.ParsePathGlob; every task if empty
+	Exclude []string // globs of the task paths not to export, even if they are included
+}
+
+// Exporter collects task summaries from a Source and renders them as metrics. It
+// is safe for concurrent use.
+type Exporter struct {
+	source  Source
+	include []taskmaster.PathGlob
+	exclude []taskmaster.PathGlob
+	now     func() time.Time
+
+	mu         sync.Mutex
+	collection collection
+}
+
+// collection is the outcome of a collection.
+type collection struct {
+	tasks    []taskmaster.TaskSummary
+	time     time.Time
+	duration time.Duration
+	err      error
+}
+
+// New returns an Exporter that collects from source. It fails if a glob of opts
+// cannot be parsed.
+func New(source Source, opts Options) (*Exporter, error) {
+	e := &Exporter{source: source, now: time.Now}
+
+	var err error
+	if e.include, err = parseGlobs(opts.Include); err != nil {
+		return nil, err
+	}
+	if e.exclude, err = parseGlobs(opts.Exclude); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func parseGlobs(patterns []string) ([]taskmaster.PathGlob, error) {
+	globs := make([]taskmaster.PathGlob, 0, len(patterns))
+	for _, pattern := range patterns {
+		glob, err := taskmaster.ParsePathGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		globs = append(globs, glob)
+	}
+
+	return globs, nil
+}
+
+func matchAny(globs []taskmaster.PathGlob, path string) bool {
+	for _, glob := range globs {
+		if glob.Match(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// exported reports whether the task at path passes the include and exclude globs.
+func (e *Exporter) exported(path string) bool {
+	return (len(e.include) == 0 || matchAny(e.include, path)) && !matchAny(e.exclude, path)
+}
+
+// Collect collects the tasks from the source. If the collection fails, the error is
+// returned and the metrics of the previous collection are kept, with
+// taskmaster_exporter_collect_success set to 0.
+func (e *Exporter) Collect() error {
+	start := e.now()
+	tasks, err := e.source()
+	duration := e.now().Sub(start)
+
+	var exported []taskmaster.TaskSummary
+	for _, task := range tasks {
+		if e.exported(task.Path) {
+			exported = append(exported, task)
+		}
+	}
+	sort.Slice(exported, func(i, j int) bool {
+		return exported[i].Path < exported[j].Path
+	})
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.collection.err = err
+		e.collection.duration = duration
+		return err
+	}
+	e.collection = collection{tasks: exported, time: start, duration: duration}
+
+	return nil
+}
+
+// Run collects every interval until ctx is done, calling onCollect, if it is not
+// nil, after every collection. Run does not collect right away; call Collect first
+// to export metrics before the first interval has passed.
+func (e *Exporter) Run(ctx context.Context, interval time.Duration, onCollect func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := e.Collect()
+		if onCollect != nil {
+			onCollect(err)
+		}
+	}
+}
+
+// Format is an exposition format of metrics.
+type Format int
+
+const (
+	FormatPrometheus  Format = iota // the Prometheus text format, version 0.0.4
+	FormatOpenMetrics               // the OpenMetrics text format, version 1.0.0
+)
+
+// ContentType returns the media type of the format.
+func (f Format) ContentType() string {
+	if f == FormatOpenMetrics {
+		return "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	}
+
+	return "text/plain; version=0.0.4; charset=utf-8"
+}
+
+// negotiateFormat returns the format requested by the Accept header of a scrape.
+func negotiateFormat(accept string) Format {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mediaType == "application/openmetrics-text" {
+			return FormatOpenMetrics
+		}
+	}
+
+	return FormatPrometheus
+}
+
+// ServeHTTP serves the metrics of the latest collection, in OpenMetrics if the
+// scraper accepts it.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format := negotiateFormat(r.Header.Get("Accept"))
+	var buf bytes.Buffer
+	if err := e.WriteMetrics(&buf, format); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Write(buf.Bytes())
+}
+
+// WriteTextfile writes the metrics of the latest collection in the Prometheus
+// text format to the file at path, for the textfile collector of the node
+// exporter. The file is replaced atomically, so that the collector never reads
+// a partial file.
+func (e *Exporter) WriteTextfile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := e.WriteMetrics(tmp, FormatPrometheus); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// WriteMetrics writes the metrics of the latest collection in format.
+func (e *Exporter) WriteMetrics(w io.Writer, format Format) error {
+	e.mu.Lock()
+	c := e.collection
+	e.mu.Unlock()
+
+	m := metricWriter{w: bufio.NewWriter(w)}
+	writeTaskMetrics(&m, c.tasks, e.now())
+
+	success := 0.0
+	if c.err == nil && !c.time.IsZero() {
+		success = 1
+	}
+	m.family("taskmaster_exporter_collect_success", "Whether the last collection of tasks succeeded.")
+	m.sample("taskmaster_exporter_collect_success", nil, success)
+	m.family("taskmaster_exporter_collect_duration_seconds", "How long the last collection of tasks took.")
+	m.sample("taskmaster_exporter_collect_duration_seconds", nil, c.duration.Seconds())
+	if !c.time.IsZero() {
+		m.family("taskmaster_exporter_last_collect_timestamp_seconds", "When the last successful collection of tasks started, in seconds since the epoch.")
+		m.sample("taskmaster_exporter_last_collect_timestamp_seconds", nil, float64(c.time.UnixNano())/1e9)
+	}
+	m.family("taskmaster_exporter_tasks", "The number of exported tasks.")
+	m.sample("taskmaster_exporter_tasks", nil, float64(len(c.tasks)))
+
+	if format == FormatOpenMetrics {
+		m.printf("# EOF\n")
+	}
+	if m.err != nil {
+		return m.err
+	}
+
+	return m.w.Flush()
+}
+
+var taskStates = []taskmaster.TaskState{
+	taskmaster.TASK_STATE_UNKNOWN,
+	taskmaster.TASK_STATE_DISABLED,
+	taskmaster.TASK_STATE_QUEUED,
+	taskmaster.TASK_STATE_READY,
+	taskmaster.TASK_STATE_RUNNING,
+}
+
+func writeTaskMetrics(m *metricWriter, tasks []taskmaster.TaskSummary, now time.Time) {
+	m.family("taskmaster_task_last_result", "The result of the last run of the task, labeled with its class.")
+	for _, task := range tasks {
+		m.sample("taskmaster_task_last_result", []string{"path", task.Path, "class", string(ClassifyResult(task.LastTaskResult))}, float64(task.LastTaskResult))
+	}
+
+	m.family("taskmaster_task_missed_runs", "The number of times the task missed a scheduled run.")
+	for _, task := range tasks {
+		m.sample("taskmaster_task_missed_runs", []string{"path", task.Path}, float64(task.MissedRuns))
+	}
+
+	m.family("taskmaster_task_state", "The state of the task; 1 for the current state, 0 for the others.")
+	for _, task := range tasks {
+		for _, state := range taskStates {
+			value := 0.0
+			if task.State == state {
+				value = 1
+			}
+			m.sample("taskmaster_task_state", []string{"path", task.Path, "state", strings.ToLower(state.String())}, value)
+		}
+	}
+
+	m.family("taskmaster_task_enabled", "Whether the task is enabled.")
+	for _, task := range tasks {
+		value := 0.0
+		if task.Enabled {
+			value = 1
+		}
+		m.sample("taskmaster_task_enabled", []string{"path", task.Path}, value)
+	}
+
+	m.family("taskmaster_task_last_run_age_seconds", "The seconds since the task last ran; absent if it never ran.")
+	for _, task := range tasks {
+		if !task.LastRunTime.IsZero() {
+			m.sample("taskmaster_task_last_run_age_seconds", []string{"path", task.Path}, now.Sub(task.LastRunTime).Seconds())
+		}
+	}
+
+	m.family("taskmaster_task_next_run_in_seconds", "The seconds until the next scheduled run of the task, negative if it is overdue; absent if no run is scheduled.")
+	for _, task := range tasks {
+		if !task.NextRunTime.IsZero() {
+			m.sample("taskmaster_task_next_run_in_seconds", []string{"path", task.Path}, task.NextRunTime.Sub(now).Seconds())
+		}
+	}
+}
+
+// metricWriter writes metrics in the text format shared by Prometheus and
+// OpenMetrics, keeping the first error.
+type metricWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (m *metricWriter) printf(format string, args ...any) {
+	if m.err == nil {
+		_, m.err = fmt.Fprintf(m.w, format, args...)
+	}
+}
+
+// family writes the metadata of a gauge.
+func (m *metricWriter) family(name, help string) {
+	m.printf("# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// sample writes a sample with labels, given as name and value pairs.
+func (m *metricWriter) sample(name string, labels []string, value float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, "%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	m.printf("%s %s\n", b.String(), formatValue(value))
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// ResultClass classifies the result of the last run of a task.
+type ResultClass string
+
+const (
+	ResultSuccess        ResultClass = "success"         // the run completed successfully
+	ResultRunning        ResultClass = "running"         // the task is running
+	ResultNotRun         ResultClass = "not_run"         // the task has not run yet
+	ResultInfo           ResultClass = "info"            // a Task Scheduler status that is not a failure, such as SCHED_S_TASK_QUEUED
+	ResultTerminated     ResultClass = "terminated"      // the run was terminated by a user or a time limit
+	ResultExitCode       ResultClass = "exit_code"       // the action exited with a non-zero exit code
+	ResultSchedulerError ResultClass = "scheduler_error" // the Task Scheduler failed to run the task, such as SCHED_E_SERVICE_NOT_RUNNING
+	ResultSystemError    ResultClass = "system_error"    // the run failed with a Windows error, such as E_ACCESSDENIED or a crash
+)
+
+// statusControlCExit is STATUS_CONTROL_C_EXIT, the result of a run whose process
+// was stopped with Ctrl+C or by the Task Scheduler.
+const statusControlCExit taskmaster.TaskResult = 0xC000013A
+
+// ClassifyResult classifies the LastTaskResult of a task. Results with the
+// severity bit set are errors of the Task Scheduler (facility ITF) or of the
+// system; other non-zero results are exit codes of the task's action, except for
+// the SCHED_S_* statuses of the Task Scheduler.
+func ClassifyResult(result taskmaster.TaskResult) ResultClass {
+	switch {
+	case result == taskmaster.SCHED_S_SUCCESS:
+		return ResultSuccess
+	case result == taskmaster.SCHED_S_TASK_RUNNING:
+		return ResultRunning
+	case result == taskmaster.SCHED_S_TASK_HAS_NOT_RUN:
+		return ResultNotRun
+	case result == taskmaster.SCHED_S_TASK_TERMINATED, result == statusControlCExit:
+		return ResultTerminated
+	case result&0xFFFFFF00 == 0x00041300:
+		return ResultInfo
+	case result&0x80000000 != 0 && result&0x1FFF0000 == 0x00040000:
+		return ResultSchedulerError
+	case result&0x80000000 != 0:
+		return ResultSystemError
+	default:
+		return ResultExitCode
+	}
+}
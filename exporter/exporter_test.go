@@ -0,0 +1,242 @@
+package exporter
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giert/taskmaster"
+)
+
+var testNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func testTasks() []taskmaster.TaskSummary {
+	return []taskmaster.TaskSummary{
+		{
+			Name:           "Nightly",
+			Path:           `\Backups\Nightly`,
+			Enabled:        true,
+			State:          taskmaster.TASK_STATE_READY,
+			MissedRuns:     2,
+			LastRunTime:    testNow.Add(-90 * time.Minute),
+			NextRunTime:    testNow.Add(30 * time.Second),
+			LastTaskResult: 1,
+		},
+		{
+			Name:           "Defrag",
+			Path:           `\Microsoft\Windows\Defrag`,
+			Enabled:        false,
+			State:          taskmaster.TASK_STATE_DISABLED,
+			LastTaskResult: taskmaster.SCHED_S_TASK_HAS_NOT_RUN,
+		},
+		{
+			Name:           `Say "hi"`,
+			Path:           `\Say "hi"`,
+			Enabled:        true,
+			State:          taskmaster.TASK_STATE_RUNNING,
+			LastRunTime:    testNow.Add(-time.Second),
+			LastTaskResult: taskmaster.SCHED_S_TASK_RUNNING,
+		},
+	}
+}
+
+func newTestExporter(t *testing.T, source Source, opts Options) *Exporter {
+	t.Helper()
+	e, err := New(source, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.now = func() time.Time { return testNow }
+
+	return e
+}
+
+func TestWriteMetrics(t *testing.T) {
+	e := newTestExporter(t, func() ([]taskmaster.TaskSummary, error) { return testTasks(), nil }, Options{})
+	if err := e.Collect(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := e.WriteMetrics(&buf, FormatPrometheus); err != nil {
+		t.Fatal(err)
+	}
+	metrics := buf.String()
+	for _, want := range []string{
+		"# TYPE taskmaster_task_last_result gauge\n",
+		`taskmaster_task_last_result{path="\\Backups\\Nightly",class="exit_code"} 1` + "\n",
+		`taskmaster_task_last_result{path="\\Microsoft\\Windows\\Defrag",class="not_run"} 267011` + "\n",
+		`taskmaster_task_last_result{path="\\Say \"hi\"",class="running"} 267009` + "\n",
+		`taskmaster_task_missed_runs{path="\\Backups\\Nightly"} 2` + "\n",
+		`taskmaster_task_state{path="\\Backups\\Nightly",state="ready"} 1` + "\n",
+		`taskmaster_task_state{path="\\Backups\\Nightly",state="running"} 0` + "\n",
+		`taskmaster_task_state{path="\\Microsoft\\Windows\\Defrag",state="disabled"} 1` + "\n",
+		`taskmaster_task_enabled{path="\\Microsoft\\Windows\\Defrag"} 0` + "\n",
+		`taskmaster_task_last_run_age_seconds{path="\\Backups\\Nightly"} 5400` + "\n",
+		`taskmaster_task_next_run_in_seconds{path="\\Backups\\Nightly"} 30` + "\n",
+		"taskmaster_exporter_collect_success 1\n",
+		"taskmaster_exporter_tasks 3\n",
+		"taskmaster_exporter_last_collect_timestamp_seconds 1.7145648e+09\n",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics do not contain %s\n%s", want, metrics)
+		}
+	}
+	for _, unwanted := range []string{
+		`taskmaster_task_last_run_age_seconds{path="\\Microsoft\\Windows\\Defrag"}`,
+		`taskmaster_task_next_run_in_seconds{path="\\Microsoft\\Windows\\Defrag"}`,
+		"# EOF",
+	} {
+		if strings.Contains(metrics, unwanted) {
+			t.Errorf("metrics contain %s\n%s", unwanted, metrics)
+		}
+	}
+
+	buf.Reset()
+	if err := e.WriteMetrics(&buf, FormatOpenMetrics); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(buf.String(), "\n# EOF\n") {
+		t.Errorf("OpenMetrics output does not end with # EOF:\n%s", buf.String())
+	}
+}
+
+func TestExporterGlobs(t *testing.T) {
+	e := newTestExporter(t, func() ([]taskmaster.TaskSummary, error) { return testTasks(), nil }, Options{
+		Include: []string{`\Backups\**`, `\Microsoft\**`},
+		Exclude: []string{`\Microsoft\Windows\*`},
+	})
+	if err := e.Collect(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := e.WriteMetrics(&buf, FormatPrometheus); err != nil {
+		t.Fatal(err)
+	}
+	metrics := buf.String()
+	if !strings.Contains(metrics, `path="\\Backups\\Nightly"`) || strings.Contains(metrics, "Defrag") || strings.Contains(metrics, "Say") {
+		t.Errorf("globs selected the wrong tasks:\n%s", metrics)
+	}
+	if !strings.Contains(metrics, "taskmaster_exporter_tasks 1\n") {
+		t.Errorf("wrong task count:\n%s", metrics)
+	}
+}
+
+func TestExporterFailedCollection(t *testing.T) {
+	fail := false
+	e := newTestExporter(t, func() ([]taskmaster.TaskSummary, error) {
+		if fail {
+			return nil, errors.New("unreachable")
+		}
+		return testTasks(), nil
+	}, Options{})
+
+	var buf bytes.Buffer
+	e.WriteMetrics(&buf, FormatPrometheus)
+	if !strings.Contains(buf.String(), "taskmaster_exporter_collect_success 0\n") {
+		t.Errorf("metrics before the first collection:\n%s", buf.String())
+	}
+
+	if err := e.Collect(); err != nil {
+		t.Fatal(err)
+	}
+	fail = true
+	if err := e.Collect(); err == nil {
+		t.Fatal("the failed collection returned no error")
+	}
+
+	// the tasks of the last successful collection are kept
+	buf.Reset()
+	e.WriteMetrics(&buf, FormatPrometheus)
+	if !strings.Contains(buf.String(), "taskmaster_exporter_collect_success 0\n") || !strings.Contains(buf.String(), "taskmaster_exporter_tasks 3\n") {
+		t.Errorf("metrics after a failed collection:\n%s", buf.String())
+	}
+}
+
+func TestExporterHTTP(t *testing.T) {
+	e := newTestExporter(t, func() ([]taskmaster.TaskSummary, error) { return testTasks(), nil }, Options{})
+	if err := e.Collect(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"":                               FormatPrometheus.ContentType(),
+		"text/plain;version=0.0.4;q=0.9": FormatPrometheus.ContentType(),
+		"application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5": FormatOpenMetrics.ContentType(),
+	}
+	for accept, want := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("Content-Type"); got != want {
+			t.Errorf("Accept %q served %q, want %q", accept, got, want)
+		}
+		if !strings.Contains(rec.Body.String(), "taskmaster_task_enabled") {
+			t.Errorf("Accept %q served no task metrics", accept)
+		}
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	e := newTestExporter(t, func() ([]taskmaster.TaskSummary, error) { return testTasks(), nil }, Options{})
+	if err := e.Collect(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "taskmaster.prom")
+	for i := 0; i < 2; i++ {
+		if err := e.WriteTextfile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "taskmaster_exporter_tasks 3\n") {
+		t.Errorf("textfile:\n%s", data)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("the directory has %d entries, want only the textfile", len(entries))
+	}
+}
+
+func TestClassifyResult(t *testing.T) {
+	tests := map[taskmaster.TaskResult]ResultClass{
+		0:          ResultSuccess,
+		1:          ResultExitCode,
+		0xFF:       ResultExitCode,
+		0x41301:    ResultRunning,
+		0x41303:    ResultNotRun,
+		0x41306:    ResultTerminated,
+		0xC000013A: ResultTerminated,
+		0x41325:    ResultInfo,
+		0x41305:    ResultInfo,
+		0x8004131F: ResultSchedulerError,
+		0x80041326: ResultSchedulerError,
+		0x80070005: ResultSystemError,
+		0xC0000005: ResultSystemError,
+	}
+	for result, want := range tests {
+		if got := ClassifyResult(result); got != want {
+			t.Errorf("ClassifyResult(0x%X) = %s, want %s", uint32(result), got, want)
+		}
+	}
+}
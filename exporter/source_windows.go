@@ -0,0 +1,22 @@
+//go:build windows
+// +build windows
+
+package exporter
+
+import "github.com/giert/taskmaster"
+
+// ServiceSource returns a Source that summarizes the tasks in the folder at path
+// and all of its subfolders. Every collection connects to the Task Scheduler
+// service with the parameters of taskmaster.ConnectWithOptions, so the source can
+// be called from any goroutine and recovers once an unreachable computer is back.
+func ServiceSource(path, serverName, domain, username, password string) Source {
+	return func() ([]taskmaster.TaskSummary, error) {
+		service, err := taskmaster.ConnectWithOptions(serverName, domain, username, password)
+		if err != nil {
+			return nil, err
+		}
+		defer service.Disconnect()
+
+		return service.GetTaskSummaries(path, true)
+	}
+}
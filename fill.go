@@ -127,7 +127,31 @@ func fillPrincipalObj(principal Principal, principalObj *ole.IDispatch) error {
 	h.put(principalObj, "LogonType", uint(principal.LogonType))
 	h.put(principalObj, "RunLevel", uint(principal.RunLevel))
 	h.put(principalObj, "UserId", principal.UserID)
-	return h.err
+	if h.err != nil {
+		return h.err
+	}
+
+	// only touch IPrincipal2 when needed so tasks stay compatible with older schemas
+	if principal.ProcessTokenSidType == TASK_PROCESSTOKENSID_DEFAULT && len(principal.RequiredPrivileges) == 0 {
+		return nil
+	}
+	principal2Obj := h.query(principalObj, ole.NewGUID("{248919ae-e345-4a6d-8aeb-e0d3165c904e}"))
+	if h.err != nil {
+		return h.err
+	}
+	defer principal2Obj.Release()
+
+	h.put(principal2Obj, "ProcessTokenSidType", principal.ProcessTokenSidType.comValue())
+	if h.err != nil {
+		return h.err
+	}
+	for _, privilege := range principal.RequiredPrivileges {
+		if _, err := oleutil.CallMethod(principal2Obj, "AddRequiredPrivilege", string(privilege)); err != nil {
+			return fmt.Errorf("error adding required privilege %s: %w", privilege, err)
+		}
+	}
+
+	return nil
 }
 
 func fillRegistrationInfoObj(regInfo RegistrationInfo, regInfoObj *ole.IDispatch) error {
@@ -182,6 +206,36 @@ func fillTaskSettingsObj(settings TaskSettings, settingsObj *ole.IDispatch) erro
 	h.put(settingsObj, "StartWhenAvailable", settings.StartWhenAvailable)
 	h.put(settingsObj, "StopIfGoingOnBatteries", settings.StopIfGoingOnBatteries)
 	h.put(settingsObj, "WakeToRun", settings.WakeToRun)
+	if h.err != nil {
+		return h.err
+	}
+
+	// only touch ITaskSettings3 when needed so tasks stay compatible with older schemas
+	if !settings.DisallowStartOnRemoteAppSession && !settings.UseUnifiedSchedulingEngine && !settings.Volatile && settings.MaintenanceSettings.Period.IsZero() {
+		return nil
+	}
+	settings3Obj := h.query(settingsObj, ole.NewGUID("{0ad9d0d7-0c7f-4ebb-9a5f-d1c648dca528}"))
+	if h.err != nil {
+		return h.err
+	}
+	defer settings3Obj.Release()
+
+	h.put(settings3Obj, "DisallowStartOnRemoteAppSession", settings.DisallowStartOnRemoteAppSession)
+	h.put(settings3Obj, "UseUnifiedSchedulingEngine", settings.UseUnifiedSchedulingEngine)
+	h.put(settings3Obj, "Volatile", settings.Volatile)
+	if h.err != nil || settings.MaintenanceSettings.Period.IsZero() {
+		return h.err
+	}
+
+	res, err := oleutil.CallMethod(settings3Obj, "CreateMaintenanceSettings")
+	if err != nil {
+		return fmt.Errorf("error creating IMaintenanceSettings object: %w", getTaskSchedulerError(err))
+	}
+	maintenanceObj := res.ToIDispatch()
+	defer maintenanceObj.Release()
+	h.put(maintenanceObj, "Period", PeriodToString(settings.MaintenanceSettings.Period))
+	h.put(maintenanceObj, "Deadline", PeriodToString(settings.MaintenanceSettings.Deadline))
+	h.put(maintenanceObj, "Exclusive", settings.MaintenanceSettings.Exclusive)
 
 	return h.err
 }
@@ -0,0 +1,772 @@
+package taskmaster
+
+import (
+	"fmt"
+	"iter"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Filter is a compiled filter expression that selects tasks by the fields of
+// their RegisteredTask and Definition, such as
+//
+//	enabled && principal.user == "SYSTEM" && trigger.type == "Daily" && lastResult != 0
+//
+// An expression combines comparisons with && (or "and"), || (or "or"), ! (or
+// "not") and parentheses. A comparison is a field, an operator and a literal:
+//
+//	==, !=              equality; strings are compared case-insensitively
+//	<, <=, >, >=        ordering of numbers and times
+//	like                glob matching of strings, where * matches within a path
+//	                    segment, ** matches across segments and ? matches one character
+//	=~, !~              regular expression matching of strings, case-insensitively
+//
+// String literals are enclosed in double quotes, in which a backslash is literal
+// so that task paths can be written as they are, such as "\" or "\Vendor\", except
+// that \" is a quote when it does not end the literal, or in single quotes, which
+// have no escapes. Numbers are decimal or hexadecimal (0x41301), booleans
+// are true or false, and times are strings in RFC 3339 format or a date such as
+// "2024-01-31". A boolean field on its own, such as "enabled", is a comparison
+// with true.
+//
+// Enumerations such as state and trigger.type are compared with the names their
+// String methods return, ignoring case and spaces, so "ServiceAccount" matches
+// TASK_LOGON_SERVICE_ACCOUNT.
+//
+// The trigger.* and action.* fields have one value per trigger or action of the
+// task. A comparison with them is true if any trigger or action satisfies it,
+// except that != and !~ are true if none of them equals or matches the literal.
+// FilterFields lists all fields.
+//
+// The zero Filter matches every task.
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// ParseFilter compiles a filter expression. An empty expression matches every task.
+func ParseFilter(expr string) (Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return Filter{expr: expr}, nil
+	}
+
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return Filter{}, err
+	}
+	p := filterParser{expr: expr, tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return Filter{}, err
+	}
+	if tok := p.peek(); tok.kind != filterTokenEOF {
+		return Filter{}, p.errorf(tok, "unexpected %s", tok)
+	}
+
+	return Filter{expr: expr, root: root}, nil
+}
+
+// MustParseFilter is like ParseFilter but panics if the expression cannot be parsed.
+func MustParseFilter(expr string) Filter {
+	f, err := ParseFilter(expr)
+	if err != nil {
+		panic(err)
+	}
+
+	return f
+}
+
+// String returns the expression the filter was compiled from.
+func (f Filter) String() string {
+	return f.expr
+}
+
+// Match reports whether a registered task matches the filter.
+func (f Filter) Match(task RegisteredTask) bool {
+	return f.root == nil || f.root.eval(&task)
+}
+
+// MatchDefinition reports whether a task that is not registered, such as one
+// parsed with ParseTaskXML or read from a Snapshot, matches the filter. The task
+// is treated as a registered task at path that is enabled if def.Settings.Enabled
+// is set and has never run.
+func (f Filter) MatchDefinition(path string, def Definition) bool {
+	return f.Match(RegisteredTask{
+		Name:       path[strings.LastIndex(path, `\`)+1:],
+		Path:       path,
+		Definition: def,
+		Enabled:    def.Settings.Enabled,
+	})
+}
+
+// Select returns the tasks that match the filter, in their original order. The
+// returned tasks share their COM objects with tasks, so only one of the two
+// should be released.
+func (f Filter) Select(tasks []RegisteredTask) []RegisteredTask {
+	var selected []RegisteredTask
+	for _, task := range tasks {
+		if f.Match(task) {
+			selected = append(selected, task)
+		}
+	}
+
+	return selected
+}
+
+// Tasks returns an iterator over the tasks of seq that match the filter, such as
+//
+//	for task, err := range filter.Tasks(taskService.RegisteredTasks(`\`)) {
+//
+// Errors of seq are passed through.
+func (f Filter) Tasks(seq iter.Seq2[RegisteredTask, error]) iter.Seq2[RegisteredTask, error] {
+	return func(yield func(RegisteredTask, error) bool) {
+		for task, err := range seq {
+			if err != nil || f.Match(task) {
+				if !yield(task, err) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// FilterFields returns the names of the fields filter expressions can refer to,
+// sorted.
+func FilterFields() []string {
+	names := make([]string, 0, len(filterFields))
+	for _, field := range filterFields {
+		names = append(names, field.name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+type filterKind uint
+
+const (
+	filterString filterKind = iota
+	filterEnum
+	filterBool
+	filterNumber
+	filterTime
+)
+
+func (k filterKind) String() string {
+	switch k {
+	case filterString:
+		return "string"
+	case filterEnum:
+		return "enumeration"
+	case filterBool:
+		return "boolean"
+	case filterNumber:
+		return "number"
+	case filterTime:
+		return "time"
+	default:
+		return ""
+	}
+}
+
+type filterValue struct {
+	s string
+	b bool
+	n int64
+	t time.Time
+}
+
+type filterField struct {
+	name   string
+	kind   filterKind
+	values func(task *RegisteredTask) []filterValue
+}
+
+func stringField(name string, get func(task *RegisteredTask) string) filterField {
+	return filterField{name: name, kind: filterString, values: func(task *RegisteredTask) []filterValue {
+		return []filterValue{{s: get(task)}}
+	}}
+}
+
+func enumField(name string, get func(task *RegisteredTask) fmt.Stringer) filterField {
+	return filterField{name: name, kind: filterEnum, values: func(task *RegisteredTask) []filterValue {
+		return []filterValue{{s: get(task).String()}}
+	}}
+}
+
+func boolField(name string, get func(task *RegisteredTask) bool) filterField {
+	return filterField{name: name, kind: filterBool, values: func(task *RegisteredTask) []filterValue {
+		return []filterValue{{b: get(task)}}
+	}}
+}
+
+func numberField(name string, get func(task *RegisteredTask) int64) filterField {
+	return filterField{name: name, kind: filterNumber, values: func(task *RegisteredTask) []filterValue {
+		return []filterValue{{n: get(task)}}
+	}}
+}
+
+func timeField(name string, get func(task *RegisteredTask) time.Time) filterField {
+	return filterField{name: name, kind: filterTime, values: func(task *RegisteredTask) []filterValue {
+		return []filterValue{{t: get(task)}}
+	}}
+}
+
+func triggerField(name string, kind filterKind, get func(trigger Trigger) filterValue) filterField {
+	return filterField{name: name, kind: kind, values: func(task *RegisteredTask) []filterValue {
+		values := make([]filterValue, len(task.Definition.Triggers))
+		for i, trigger := range task.Definition.Triggers {
+			values[i] = get(trigger)
+		}
+		return values
+	}}
+}
+
+func actionField(name string, kind filterKind, get func(action Action) filterValue) filterField {
+	return filterField{name: name, kind: kind, values: func(task *RegisteredTask) []filterValue {
+		values := make([]filterValue, len(task.Definition.Actions))
+		for i, action := range task.Definition.Actions {
+			values[i] = get(action)
+		}
+		return values
+	}}
+}
+
+func execActionField(name string, get func(action ExecAction) string) filterField {
+	return actionField(name, filterString, func(action Action) filterValue {
+		if execAction, ok := action.(ExecAction); ok {
+			return filterValue{s: get(execAction)}
+		}
+		return filterValue{}
+	})
+}
+
+func comHandlerActionField(name string, get func(action ComHandlerAction) string) filterField {
+	return actionField(name, filterString, func(action Action) filterValue {
+		if comHandlerAction, ok := action.(ComHandlerAction); ok {
+			return filterValue{s: get(comHandlerAction)}
+		}
+		return filterValue{}
+	})
+}
+
+// filterFields are the fields of filter expressions, keyed by their lower-case name.
+var filterFields = func() map[string]filterField {
+	fields := []filterField{
+		stringField("name", func(task *RegisteredTask) string { return task.Name }),
+		stringField("path", func(task *RegisteredTask) string { return task.Path }),
+		stringField("folder", func(task *RegisteredTask) string {
+			if i := strings.LastIndex(task.Path, `\`); i > 0 {
+				return task.Path[:i]
+			}
+			return `\`
+		}),
+		boolField("enabled", func(task *RegisteredTask) bool { return task.Enabled }),
+		enumField("state", func(task *RegisteredTask) fmt.Stringer { return task.State }),
+		numberField("missedRuns", func(task *RegisteredTask) int64 { return int64(task.MissedRuns) }),
+		timeField("nextRun", func(task *RegisteredTask) time.Time { return task.NextRunTime }),
+		timeField("lastRun", func(task *RegisteredTask) time.Time { return task.LastRunTime }),
+		numberField("lastResult", func(task *RegisteredTask) int64 { return int64(task.LastTaskResult) }),
+		stringField("context", func(task *RegisteredTask) string { return task.Definition.Context }),
+		stringField("data", func(task *RegisteredTask) string { return task.Definition.Data }),
+		numberField("actionCount", func(task *RegisteredTask) int64 { return int64(len(task.Definition.Actions)) }),
+		numberField("triggerCount", func(task *RegisteredTask) int64 { return int64(len(task.Definition.Triggers)) }),
+
+		stringField("registration.author", func(task *RegisteredTask) string { return task.Definition.RegistrationInfo.Author }),
+		timeField("registration.date", func(task *RegisteredTask) time.Time { return task.Definition.RegistrationInfo.Date }),
+		stringField("registration.description", func(task *RegisteredTask) string { return task.Definition.RegistrationInfo.Description }),
+		stringField("registration.source", func(task *RegisteredTask) string { return task.Definition.RegistrationInfo.Source }),
+		stringField("registration.uri", func(task *RegisteredTask) string { return task.Definition.RegistrationInfo.URI }),
+		stringField("registration.version", func(task *RegisteredTask) string { return task.Definition.RegistrationInfo.Version }),
+
+		stringField("principal.user", func(task *RegisteredTask) string { return task.Definition.Principal.UserID }),
+		stringField("principal.group", func(task *RegisteredTask) string { return task.Definition.Principal.GroupID }),
+		enumField("principal.logonType", func(task *RegisteredTask) fmt.Stringer { return task.Definition.Principal.LogonType }),
+		enumField("principal.runLevel", func(task *RegisteredTask) fmt.Stringer { return task.Definition.Principal.RunLevel }),
+
+		boolField("settings.allowDemandStart", func(task *RegisteredTask) bool { return task.Definition.Settings.AllowDemandStart }),
+		enumField("settings.compatibility", func(task *RegisteredTask) fmt.Stringer { return task.Definition.Settings.Compatibility }),
+		boolField("settings.hidden", func(task *RegisteredTask) bool { return task.Definition.Settings.Hidden }),
+		enumField("settings.multipleInstances", func(task *RegisteredTask) fmt.Stringer { return task.Definition.Settings.MultipleInstances }),
+		numberField("settings.priority", func(task *RegisteredTask) int64 { return int64(task.Definition.Settings.Priority) }),
+		boolField("settings.runOnlyIfIdle", func(task *RegisteredTask) bool { return task.Definition.Settings.RunOnlyIfIdle }),
+		boolField("settings.runOnlyIfNetworkAvailable", func(task *RegisteredTask) bool { return task.Definition.Settings.RunOnlyIfNetworkAvailable }),
+		boolField("settings.startWhenAvailable", func(task *RegisteredTask) bool { return task.Definition.Settings.StartWhenAvailable }),
+		boolField("settings.wakeToRun", func(task *RegisteredTask) bool { return task.Definition.Settings.WakeToRun }),
+
+		triggerField("trigger.type", filterEnum, func(trigger Trigger) filterValue { return filterValue{s: trigger.GetType().String()} }),
+		triggerField("trigger.id", filterString, func(trigger Trigger) filterValue { return filterValue{s: trigger.GetID()} }),
+		triggerField("trigger.enabled", filterBool, func(trigger Trigger) filterValue { return filterValue{b: trigger.GetEnabled()} }),
+		triggerField("trigger.start", filterTime, func(trigger Trigger) filterValue { return filterValue{t: trigger.GetStartBoundary()} }),
+		triggerField("trigger.end", filterTime, func(trigger Trigger) filterValue { return filterValue{t: trigger.GetEndBoundary()} }),
+		triggerField("trigger.user", filterString, func(trigger Trigger) filterValue {
+			switch trigger := trigger.(type) {
+			case LogonTrigger:
+				return filterValue{s: trigger.UserID}
+			case SessionStateChangeTrigger:
+				return filterValue{s: trigger.UserId}
+			default:
+				return filterValue{}
+			}
+		}),
+		triggerField("trigger.subscription", filterString, func(trigger Trigger) filterValue {
+			if eventTrigger, ok := trigger.(EventTrigger); ok {
+				return filterValue{s: eventTrigger.Subscription}
+			}
+			return filterValue{}
+		}),
+
+		actionField("action.type", filterEnum, func(action Action) filterValue { return filterValue{s: action.GetType().String()} }),
+		actionField("action.id", filterString, func(action Action) filterValue { return filterValue{s: action.GetID()} }),
+		execActionField("action.path", func(action ExecAction) string { return action.Path }),
+		execActionField("action.args", func(action ExecAction) string { return action.Args }),
+		execActionField("action.workingDir", func(action ExecAction) string { return action.WorkingDir }),
+		comHandlerActionField("action.classId", func(action ComHandlerAction) string { return action.ClassID }),
+		comHandlerActionField("action.data", func(action ComHandlerAction) string { return action.Data }),
+	}
+
+	byName := make(map[string]filterField, len(fields))
+	for _, field := range fields {
+		byName[strings.ToLower(field.name)] = field
+	}
+	return byName
+}()
+
+type filterNode interface {
+	eval(task *RegisteredTask) bool
+}
+
+type filterAnd struct{ left, right filterNode }
+
+func (n filterAnd) eval(task *RegisteredTask) bool {
+	return n.left.eval(task) && n.right.eval(task)
+}
+
+type filterOr struct{ left, right filterNode }
+
+func (n filterOr) eval(task *RegisteredTask) bool {
+	return n.left.eval(task) || n.right.eval(task)
+}
+
+type filterNot struct{ operand filterNode }
+
+func (n filterNot) eval(task *RegisteredTask) bool {
+	return !n.operand.eval(task)
+}
+
+// filterCompare compares the values of a field with a literal. negate is set for
+// != and !~, which are true if no value satisfies == or =~.
+type filterCompare struct {
+	field   filterField
+	op      string
+	literal filterValue
+	re      *regexp.Regexp
+	negate  bool
+}
+
+func (n filterCompare) eval(task *RegisteredTask) bool {
+	for _, value := range n.field.values(task) {
+		if n.compare(value) {
+			return !n.negate
+		}
+	}
+
+	return n.negate
+}
+
+func (n filterCompare) compare(value filterValue) bool {
+	if n.re != nil {
+		return n.re.MatchString(value.s)
+	}
+
+	switch n.field.kind {
+	case filterString:
+		return strings.EqualFold(value.s, n.literal.s)
+	case filterEnum:
+		return normalizeFilterEnum(value.s) == n.literal.s
+	case filterBool:
+		return value.b == n.literal.b
+	case filterNumber:
+		return compareOrdered(n.op, value.n, n.literal.n)
+	case filterTime:
+		return compareOrdered(n.op, value.t.Compare(n.literal.t), 0)
+	default:
+		return false
+	}
+}
+
+func compareOrdered[T int | int64](op string, a, b T) bool {
+	switch op {
+	case "==", "!=":
+		return a == b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	default:
+		return false
+	}
+}
+
+// normalizeFilterEnum folds the name of an enumeration value for comparison.
+func normalizeFilterEnum(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '_' || r == '-' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+// PathGlob is a compiled glob pattern that matches task paths case-insensitively,
+// with the syntax of the like operator of a Filter: * matches within a path
+// segment, ** matches across segments and ? matches one character. For example,
+// \Microsoft\** matches every task under \Microsoft.
+type PathGlob struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// ParsePathGlob compiles a glob pattern.
+func ParsePathGlob(pattern string) (PathGlob, error) {
+	re, err := filterGlob(pattern)
+	if err != nil {
+		return PathGlob{}, fmt.Errorf("error parsing glob %q: %w", pattern, err)
+	}
+
+	return PathGlob{pattern: pattern, re: re}, nil
+}
+
+// Match reports whether path matches the glob.
+func (g PathGlob) Match(path string) bool {
+	return g.re != nil && g.re.MatchString(path)
+}
+
+// String returns the pattern of the glob.
+func (g PathGlob) String() string {
+	return g.pattern
+}
+
+// filterGlob compiles a glob pattern to a case-insensitive regular expression.
+func filterGlob(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString(`(?is)^`)
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(`.*`)
+				i++
+			} else {
+				b.WriteString(`[^\\]*`)
+			}
+		case '?':
+			b.WriteString(`[^\\]`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString(`$`)
+
+	return regexp.Compile(b.String())
+}
+
+var filterTimeFormats = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"}
+
+func parseFilterTime(s string) (time.Time, error) {
+	for _, format := range filterTimeFormats {
+		if t, err := time.ParseInLocation(format, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+type filterTokenKind uint
+
+const (
+	filterTokenEOF filterTokenKind = iota
+	filterTokenIdent
+	filterTokenString
+	filterTokenNumber
+	filterTokenOp
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string // the operator, identifier, number or unquoted string
+	pos  int
+}
+
+func (t filterToken) String() string {
+	if t.kind == filterTokenEOF {
+		return "end of expression"
+	}
+
+	return strconv.Quote(t.text)
+}
+
+var filterComparisonOperators = []string{"==", "!=", "=~", "!~", "<", "<=", ">", ">="}
+
+var filterOperators = []string{"&&", "||", "==", "!=", "=~", "!~", "<=", ">=", "<", ">", "!", "(", ")"}
+
+func lexFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '"' || c == '\'':
+			start := i
+			var b strings.Builder
+			for i++; ; i++ {
+				if i >= len(expr) {
+					return nil, fmt.Errorf("error parsing filter at offset %d: unterminated string", start)
+				}
+				if expr[i] == c {
+					i++
+					break
+				}
+				if c == '"' && expr[i] == '\\' && i+1 < len(expr) && expr[i+1] == '"' && !closesFilterString(expr[i+2:]) {
+					i++
+				}
+				b.WriteByte(expr[i])
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenString, text: b.String(), pos: start})
+		case c == '-' || (c >= '0' && c <= '9'):
+			start := i
+			for i++; i < len(expr) && isFilterIdentByte(expr[i]); i++ {
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenNumber, text: expr[start:i], pos: start})
+		case isFilterIdentByte(c):
+			start := i
+			for ; i < len(expr) && isFilterIdentByte(expr[i]); i++ {
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenIdent, text: expr[start:i], pos: start})
+		default:
+			op := ""
+			for _, candidate := range filterOperators {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("error parsing filter at offset %d: unexpected character %q", i, c)
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, filterToken{kind: filterTokenEOF, pos: len(expr)}), nil
+}
+
+// closesFilterString reports whether a double quote followed by rest ends a string
+// literal: rest is empty or continues the expression after the literal with an
+// operator. A backslash before such a quote is part of the string, as in "\".
+func closesFilterString(rest string) bool {
+	rest = strings.TrimLeft(rest, " \t\r\n")
+	if rest == "" || strings.HasPrefix(rest, "&&") || strings.HasPrefix(rest, "||") || strings.HasPrefix(rest, ")") {
+		return true
+	}
+	for _, keyword := range []string{"and", "or"} {
+		if len(rest) > len(keyword) && strings.EqualFold(rest[:len(keyword)], keyword) && !isFilterIdentByte(rest[len(keyword)]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isFilterIdentByte(c byte) bool {
+	return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+type filterParser struct {
+	expr   string
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != filterTokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is one of the given operators or keywords.
+func (p *filterParser) accept(ops ...string) bool {
+	tok := p.peek()
+	for _, op := range ops {
+		if (tok.kind == filterTokenOp && tok.text == op) || (tok.kind == filterTokenIdent && strings.EqualFold(tok.text, op)) {
+			p.pos++
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *filterParser) errorf(tok filterToken, format string, args ...any) error {
+	return fmt.Errorf("error parsing filter at offset %d: %s", tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||", "or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = filterOr{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&", "and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = filterAnd{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.accept("!", "not") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{operand}, nil
+	}
+
+	if p.accept("(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.peek(); !p.accept(")") {
+			return nil, p.errorf(tok, "expected \")\", got %s", tok)
+		}
+		return node, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	fieldTok := p.next()
+	if fieldTok.kind != filterTokenIdent {
+		return nil, p.errorf(fieldTok, "expected a field, got %s", fieldTok)
+	}
+	field, ok := filterFields[strings.ToLower(fieldTok.text)]
+	if !ok {
+		return nil, p.errorf(fieldTok, "unknown field %q", fieldTok.text)
+	}
+
+	opTok := p.peek()
+	op := ""
+	switch {
+	case opTok.kind == filterTokenOp && slices.Contains(filterComparisonOperators, opTok.text):
+		op = opTok.text
+	case opTok.kind == filterTokenIdent && strings.EqualFold(opTok.text, "like"):
+		op = "like"
+	}
+	if op == "" {
+		if field.kind != filterBool {
+			return nil, p.errorf(opTok, "expected an operator after %s field %s, got %s", field.kind, field.name, opTok)
+		}
+		return filterCompare{field: field, op: "==", literal: filterValue{b: true}}, nil
+	}
+	p.next()
+
+	litTok := p.next()
+	node := filterCompare{field: field, op: op, negate: op == "!=" || op == "!~"}
+	switch op {
+	case "=~", "!~", "like":
+		if field.kind != filterString && field.kind != filterEnum {
+			return nil, p.errorf(opTok, "operator %s does not apply to %s field %s", op, field.kind, field.name)
+		}
+		if litTok.kind != filterTokenString {
+			return nil, p.errorf(litTok, "expected a string, got %s", litTok)
+		}
+		var err error
+		if op == "like" {
+			node.re, err = filterGlob(litTok.text)
+		} else {
+			node.re, err = regexp.Compile("(?i)" + litTok.text)
+		}
+		if err != nil {
+			return nil, p.errorf(litTok, "%v", err)
+		}
+		return node, nil
+	case "<", "<=", ">", ">=":
+		if field.kind != filterNumber && field.kind != filterTime {
+			return nil, p.errorf(opTok, "operator %s does not apply to %s field %s", op, field.kind, field.name)
+		}
+	}
+
+	switch field.kind {
+	case filterString, filterEnum:
+		if litTok.kind != filterTokenString {
+			return nil, p.errorf(litTok, "expected a string, got %s", litTok)
+		}
+		node.literal.s = litTok.text
+		if field.kind == filterEnum {
+			node.literal.s = normalizeFilterEnum(litTok.text)
+		}
+	case filterBool:
+		b, err := strconv.ParseBool(litTok.text)
+		if litTok.kind != filterTokenIdent || err != nil {
+			return nil, p.errorf(litTok, "expected true or false, got %s", litTok)
+		}
+		node.literal.b = b
+	case filterNumber:
+		n, err := strconv.ParseInt(litTok.text, 0, 64)
+		if litTok.kind != filterTokenNumber || err != nil {
+			return nil, p.errorf(litTok, "expected a number, got %s", litTok)
+		}
+		node.literal.n = n
+	case filterTime:
+		if litTok.kind != filterTokenString {
+			return nil, p.errorf(litTok, "expected a time, got %s", litTok)
+		}
+		t, err := parseFilterTime(litTok.text)
+		if err != nil {
+			return nil, p.errorf(litTok, "%v", err)
+		}
+		node.literal.t = t
+	}
+
+	return node, nil
+}
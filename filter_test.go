@@ -0,0 +1,230 @@
+package taskmaster
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFilterTasks() []RegisteredTask {
+	nightly := DefaultDefinition()
+	nightly.Principal.UserID = "SYSTEM"
+	nightly.Principal.LogonType = TASK_LOGON_SERVICE_ACCOUNT
+	nightly.AddTrigger(DailyTrigger{TaskTrigger: TaskTrigger{Enabled: true}, DayInterval: EveryDay})
+	nightly.AddAction(ExecAction{Path: `C:\Vendor\nightly.exe`, Args: "--all"})
+
+	logon := DefaultDefinition()
+	logon.Principal.UserID = `CONTOSO\user`
+	logon.AddTrigger(LogonTrigger{TaskTrigger: TaskTrigger{Enabled: true}})
+	logon.AddTrigger(BootTrigger{TaskTrigger: TaskTrigger{Enabled: false}})
+	logon.AddAction(ComHandlerAction{ClassID: "{00000000-0000-0000-0000-000000000001}"})
+
+	return []RegisteredTask{
+		{
+			Name:           "Nightly",
+			Path:           `\Vendor\Nightly`,
+			Definition:     nightly,
+			Enabled:        true,
+			State:          TASK_STATE_READY,
+			LastRunTime:    time.Date(2024, 1, 2, 3, 0, 0, 0, time.Local),
+			LastTaskResult: 1,
+		},
+		{
+			Name:           "Logon",
+			Path:           `\Vendor\Sub\Logon`,
+			Definition:     logon,
+			Enabled:        false,
+			State:          TASK_STATE_DISABLED,
+			LastTaskResult: SCHED_S_TASK_HAS_NOT_RUN,
+		},
+		{
+			Name:       "Other",
+			Path:       `\Other`,
+			Definition: DefaultDefinition(),
+			Enabled:    true,
+			State:      TASK_STATE_RUNNING,
+		},
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: ``, want: []string{"Nightly", "Logon", "Other"}},
+		{expr: `enabled && principal.user == "SYSTEM" && trigger.type == "Daily" && lastResult != 0`, want: []string{"Nightly"}},
+		{expr: `enabled and not (name == "other")`, want: []string{"Nightly"}},
+		{expr: `!enabled || state == "running"`, want: []string{"Logon", "Other"}},
+		{expr: `enabled == false`, want: []string{"Logon"}},
+		{expr: `path like "\Vendor\*"`, want: []string{"Nightly"}},
+		{expr: `path like "\Vendor\**"`, want: []string{"Nightly", "Logon"}},
+		{expr: `path like "\vendor\sub\?ogon"`, want: []string{"Logon"}},
+		{expr: `folder == "\Vendor\Sub"`, want: []string{"Logon"}},
+		{expr: `folder == '\'`, want: []string{"Other"}},
+		{expr: `folder == "\"`, want: []string{"Other"}},
+		{expr: `folder == "\" || folder == "\Vendor"`, want: []string{"Nightly", "Other"}},
+		{expr: `(path like "\Vendor\**") and enabled == false`, want: []string{"Logon"}},
+		{expr: `action.args != "say \"hi\""`, want: []string{"Nightly", "Logon", "Other"}},
+		{expr: `name =~ "^n.*ly$"`, want: []string{"Nightly"}},
+		{expr: `name !~ 'ly$'`, want: []string{"Logon", "Other"}},
+		{expr: `lastResult == 0x41303`, want: []string{"Logon"}},
+		{expr: `lastResult >= 1 && lastResult < 2`, want: []string{"Nightly"}},
+		{expr: `lastRun > "2024-01-01" && lastRun <= "2024-01-02T03:00:00"`, want: []string{"Nightly"}},
+		{expr: `principal.logonType == "serviceaccount"`, want: []string{"Nightly"}},
+		{expr: `trigger.type == "Boot"`, want: []string{"Logon"}},
+		{expr: `trigger.type != "Boot"`, want: []string{"Nightly", "Other"}},
+		{expr: `trigger.enabled == false`, want: []string{"Logon"}},
+		{expr: `triggerCount == 0`, want: []string{"Other"}},
+		{expr: `action.type == "COM Handler"`, want: []string{"Logon"}},
+		{expr: `action.path like "**\nightly.exe" && action.args == "--ALL"`, want: []string{"Nightly"}},
+		{expr: `settings.priority == 7 && settings.compatibility == "V2.0"`, want: []string{"Nightly", "Logon", "Other"}},
+	}
+
+	tasks := testFilterTasks()
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			filter, err := ParseFilter(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, task := range filter.Select(tasks) {
+				got = append(got, task.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLexFilterStrings(t *testing.T) {
+	tests := map[string]string{
+		`"\"`:                    `\`,
+		`"\Vendor\" && enabled`:  `\Vendor\`,
+		`("\Vendor\Sub\")`:       `\Vendor\Sub\`,
+		`"C:\Tools\" or enabled`: `C:\Tools\`,
+		`"say \"hi\""`:           `say "hi"`,
+		`"a\\b"`:                 `a\\b`,
+		`'\'`:                    `\`,
+	}
+	for expr, want := range tests {
+		tokens, err := lexFilter(expr)
+		if err != nil {
+			t.Errorf("lexFilter(%s) failed: %v", expr, err)
+			continue
+		}
+		for _, tok := range tokens {
+			if tok.kind == filterTokenString && tok.text != want {
+				t.Errorf("lexFilter(%s) = %q, want %q", expr, tok.text, want)
+			}
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: `nope == 1`, wantErr: `unknown field "nope"`},
+		{expr: `name`, wantErr: "expected an operator"},
+		{expr: `name == 1`, wantErr: "expected a string"},
+		{expr: `lastResult == "x"`, wantErr: "expected a number"},
+		{expr: `enabled == "yes"`, wantErr: "expected true or false"},
+		{expr: `name < "a"`, wantErr: "does not apply"},
+		{expr: `lastResult like "1*"`, wantErr: "does not apply"},
+		{expr: `name =~ "("`, wantErr: "missing closing )"},
+		{expr: `lastRun < "yesterday"`, wantErr: "invalid time"},
+		{expr: `(enabled`, wantErr: `expected ")"`},
+		{expr: `enabled enabled`, wantErr: "unexpected"},
+		{expr: `name == "open`, wantErr: "unterminated string"},
+		{expr: `name # 1`, wantErr: "unexpected character"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseFilter(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("want error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFilterMatchDefinition(t *testing.T) {
+	def, err := ParseTaskXML(testTaskXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := MustParseFilter(`name == "Nightly" && folder == "\Vendor" && principal.logonType == "Service Account" && trigger.type == "Monthly"`)
+	if !filter.Match(RegisteredTask{Name: "Nightly", Path: `\Vendor\Nightly`, Definition: def}) {
+		t.Error("want the registered task to match")
+	}
+	if !filter.MatchDefinition(`\Vendor\Nightly`, def) {
+		t.Error("want the definition to match")
+	}
+	if filter.MatchDefinition(`\Vendor\Other`, def) {
+		t.Error("want the definition at another path not to match")
+	}
+}
+
+func TestFilterTasks(t *testing.T) {
+	tasks := testFilterTasks()
+	seq := func(yield func(RegisteredTask, error) bool) {
+		for _, task := range tasks {
+			if !yield(task, nil) {
+				return
+			}
+		}
+	}
+
+	var got []string
+	for task, err := range MustParseFilter(`enabled`).Tasks(seq) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, task.Name)
+		break
+	}
+	if !slices.Equal(got, []string{"Nightly"}) {
+		t.Errorf("want [Nightly], got %v", got)
+	}
+}
+
+func TestPathGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{`\Microsoft\**`, `\Microsoft\Windows\Defrag\ScheduledDefrag`, true},
+		{`\Microsoft\*`, `\Microsoft\Windows\Defrag\ScheduledDefrag`, false},
+		{`\Microsoft\*`, `\microsoft\Updater`, true},
+		{`\*\Nightly`, `\Backups\Nightly`, true},
+		{`\Backup?`, `\Backups`, true},
+		{`\Backup?`, `\Backup\s`, false},
+		{`**`, `\Anything\At\All`, true},
+		{`\Nightly (old)`, `\Nightly (old)`, true},
+	}
+	for _, test := range tests {
+		glob, err := ParsePathGlob(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := glob.Match(test.path); got != test.want {
+			t.Errorf("%s matching %s = %t, want %t", test.pattern, test.path, got, test.want)
+		}
+		if glob.String() != test.pattern {
+			t.Errorf("String() = %s, want %s", glob.String(), test.pattern)
+		}
+	}
+
+	if (PathGlob{}).Match(`\Task`) {
+		t.Error("the zero PathGlob matched a path")
+	}
+}
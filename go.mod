@@ -1,10 +1,11 @@
 module github.com/giert/taskmaster
 
-go 1.22.12
+go 1.23.0
 
 require (
 	github.com/go-ole/go-ole v1.3.0
 	github.com/rickb777/period v1.0.8
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
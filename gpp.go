@@ -0,0 +1,323 @@
+package taskmaster
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the class identifiers of the elements of ScheduledTasks.xml
+const (
+	gppScheduledTasksCLSID  = "{CC63F200-7309-4ba0-B154-A71CD118DBCC}"
+	gppTaskV2CLSID          = "{D8896631-B747-47a7-84A6-C155337F3BC8}"
+	gppImmediateTaskV2CLSID = "{9756B581-76EC-4169-9AFC-0CA8D43ADB5F}"
+)
+
+// gppImmediateBoundary is the start and end boundary of the trigger of an
+// immediate task, which the client replaces with the time the policy is applied.
+const gppImmediateBoundary = "%LocalTimeXmlEx%"
+
+const gppChangedLayout = "2006-01-02 15:04:05"
+
+// GPPAction specifies what Group Policy preferences do with a task on the
+// computers a policy applies to.
+type GPPAction uint
+
+const (
+	GPPCreate  GPPAction = iota // create the task if it does not exist
+	GPPReplace                  // delete the task and create it again
+	GPPUpdate                   // create the task, or change an existing one to match
+	GPPDelete                   // delete the task
+)
+
+// gppActionLetters are the values of the action attribute of the Properties of an
+// item, in the order of the GPPAction values.
+const gppActionLetters = "CRUD"
+
+func (a GPPAction) String() string {
+	switch a {
+	case GPPCreate:
+		return "Create"
+	case GPPReplace:
+		return "Replace"
+	case GPPUpdate:
+		return "Update"
+	case GPPDelete:
+		return "Delete"
+	default:
+		return ""
+	}
+}
+
+// GPPTask is a scheduled task item of Group Policy preferences.
+type GPPTask struct {
+	Name         string    // the name of the task, which is registered in the root folder
+	Action       GPPAction // what is done with the task
+	Immediate    bool      // whether the task runs once when the policy is applied rather than on its triggers, an ImmediateTaskV2 item
+	Definition   Definition
+	UID          string    // the identifier of the item, a GUID in braces; generated when written if empty
+	Changed      time.Time // when the item was last changed, in UTC; now when written if zero
+	Description  string    // the comment on the item
+	Disabled     bool      // whether the item is disabled, so the policy skips it
+	BypassErrors bool      // whether the policy continues with the other items if this one fails
+	UserContext  bool      // whether the item is applied in the security context of the logged-on user
+	RemovePolicy bool      // whether the task is removed when the item no longer applies
+	Filters      string    // the item-level targeting, the inner XML of the Filters element
+	CPassword    string    // the encrypted password of the principal, which anyone can decrypt
+}
+
+// GPPScheduledTasks is the content of a ScheduledTasks.xml file of Group Policy
+// preferences.
+type GPPScheduledTasks struct {
+	Tasks    []GPPTask
+	Warnings []string // the items that were left out, and the gotchas of the tasks
+}
+
+type gppScheduledTasksXML struct {
+	XMLName xml.Name  `xml:"ScheduledTasks"`
+	Items   []gppItem `xml:",any"`
+}
+
+type gppItem struct {
+	XMLName      xml.Name
+	Name         string        `xml:"name,attr"`
+	Changed      string        `xml:"changed,attr"`
+	UID          string        `xml:"uid,attr"`
+	Desc         string        `xml:"desc,attr"`
+	Disabled     string        `xml:"disabled,attr"`
+	BypassErrors string        `xml:"bypassErrors,attr"`
+	UserContext  string        `xml:"userContext,attr"`
+	RemovePolicy string        `xml:"removePolicy,attr"`
+	Properties   gppProperties `xml:"Properties"`
+	Filters      struct {
+		XML string `xml:",innerxml"`
+	} `xml:"Filters"`
+}
+
+type gppProperties struct {
+	Action    string   `xml:"action,attr"`
+	Name      string   `xml:"name,attr"`
+	RunAs     string   `xml:"runAs,attr"`
+	LogonType string   `xml:"logonType,attr"`
+	CPassword string   `xml:"cpassword,attr"`
+	Task      *xmlTask `xml:"Task"`
+}
+
+// ParseGPPScheduledTasks reads the ScheduledTasks.xml file of the scheduled task
+// preferences of a Group Policy object, found under Machine\Preferences or
+// User\Preferences in its folder in SYSVOL. TaskV2 and ImmediateTaskV2 items are
+// returned with their action and the task definition, which is parsed as by
+// ParseTaskXML; the placeholder trigger of an immediate task is left out.
+//
+// Items in the Windows XP task format, Task and ImmediateTask, are not supported
+// and are listed in GPPScheduledTasks.Warnings. So are the gotchas of the tasks:
+// an embedded cpassword, which anyone who can read SYSVOL can decrypt with the key
+// Microsoft published (MS14-025), a password logon without one, an immediate task
+// that is not applied once and so runs at every policy refresh, and a runAs
+// attribute that differs from the principal of the task.
+func ParseGPPScheduledTasks(r io.Reader) (GPPScheduledTasks, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return GPPScheduledTasks{}, fmt.Errorf("error reading ScheduledTasks.xml: %w", err)
+	}
+
+	var doc gppScheduledTasksXML
+	decoder := xml.NewDecoder(strings.NewReader(decodeTaskXML(data)))
+	// the text is already decoded, whatever the declaration says
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&doc); err != nil {
+		return GPPScheduledTasks{}, fmt.Errorf("error parsing ScheduledTasks.xml: %w", err)
+	}
+
+	var result GPPScheduledTasks
+	var warnings conversionWarnings
+	for _, item := range doc.Items {
+		switch item.XMLName.Local {
+		case "TaskV2", "ImmediateTaskV2":
+		case "Task", "ImmediateTask":
+			warnings.warnf("%s %q is in the Windows XP task format, which is not supported, and is left out", item.XMLName.Local, item.Name)
+			continue
+		default:
+			warnings.warnf("unknown item %s %q is left out", item.XMLName.Local, item.Name)
+			continue
+		}
+
+		task, err := item.task()
+		if err != nil {
+			return GPPScheduledTasks{}, fmt.Errorf("error parsing %s %q: %w", item.XMLName.Local, item.Name, err)
+		}
+		task.warn(&warnings, item.Properties.RunAs)
+		result.Tasks = append(result.Tasks, task)
+	}
+	result.Warnings = warnings
+
+	return result, nil
+}
+
+func (x gppItem) task() (GPPTask, error) {
+	task := GPPTask{
+		Name:         x.Properties.Name,
+		Immediate:    x.XMLName.Local == "ImmediateTaskV2",
+		UID:          x.UID,
+		Description:  x.Desc,
+		Disabled:     x.Disabled == "1",
+		BypassErrors: x.BypassErrors == "1",
+		UserContext:  x.UserContext == "1",
+		RemovePolicy: x.RemovePolicy == "1",
+		Filters:      strings.TrimSpace(x.Filters.XML),
+		CPassword:    x.Properties.CPassword,
+	}
+	if task.Name == "" {
+		task.Name = x.Name
+	}
+
+	switch action := x.Properties.Action; {
+	case action == "":
+		task.Action = GPPUpdate
+	case len(action) == 1 && strings.Contains(gppActionLetters, action):
+		task.Action = GPPAction(strings.Index(gppActionLetters, action))
+	default:
+		return GPPTask{}, fmt.Errorf("unknown action %q", action)
+	}
+
+	if x.Changed != "" {
+		changed, err := time.Parse(gppChangedLayout, x.Changed)
+		if err != nil {
+			return GPPTask{}, fmt.Errorf("error parsing changed attribute: %w", err)
+		}
+		task.Changed = changed
+	}
+
+	if x.Properties.Task == nil {
+		return GPPTask{}, errors.New("the item has no task")
+	}
+	xt := *x.Properties.Task
+	if task.Immediate {
+		var triggers []xmlTrigger
+		for _, trigger := range xt.Triggers.Triggers {
+			if trigger.XMLName.Local != "TimeTrigger" || !strings.Contains(trigger.StartBoundary, "%") {
+				triggers = append(triggers, trigger)
+			}
+		}
+		xt.Triggers.Triggers = triggers
+	}
+	def, err := xt.definition()
+	if err != nil {
+		return GPPTask{}, err
+	}
+	task.Definition = def
+
+	return task, nil
+}
+
+// warn adds the gotchas of a task to warnings.
+func (task GPPTask) warn(warnings *conversionWarnings, runAs string) {
+	p := task.Definition.Principal
+	if task.CPassword != "" {
+		warnings.warnf("%q has a cpassword, which anyone who can read SYSVOL can decrypt with the published key (MS14-025)", task.Name)
+	} else if task.Action != GPPDelete && (p.LogonType == TASK_LOGON_PASSWORD || p.LogonType == TASK_LOGON_INTERACTIVE_TOKEN_OR_PASSWORD) {
+		warnings.warnf("%q logs on with a password, which Group Policy preferences no longer store, so the task fails to register", task.Name)
+	}
+	if task.Immediate && task.Action != GPPDelete && !strings.Contains(task.Filters, "<FilterRunOnce") {
+		warnings.warnf("immediate task %q is not applied once, so it runs again at every policy refresh", task.Name)
+	}
+	if principal := p.UserID + p.GroupID; runAs != "" && !strings.EqualFold(runAs, principal) {
+		warnings.warnf("%q runs as %q according to its runAs attribute, but its principal is %q", task.Name, runAs, principal)
+	}
+}
+
+// ExportGPPScheduledTasks returns a ScheduledTasks.xml file for the scheduled task
+// preferences of a Group Policy object, the reverse of ParseGPPScheduledTasks.
+// Each task becomes a TaskV2 item, or an ImmediateTaskV2 item that runs when the
+// policy is applied, with the task definition laid out as by the Task Scheduler.
+//
+// ExportGPPScheduledTasks fails if a name is empty or contains a folder, an
+// immediate task has triggers, or a task has a cpassword, which Group Policy
+// preferences no longer accept.
+func ExportGPPScheduledTasks(tasks []GPPTask) (string, error) {
+	w := &xmlWriter{}
+	w.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	w.open("ScheduledTasks", "clsid", gppScheduledTasksCLSID)
+	for _, task := range tasks {
+		if err := w.gppTask(task); err != nil {
+			return "", fmt.Errorf("error writing task %q: %w", task.Name, err)
+		}
+	}
+	w.close("ScheduledTasks")
+
+	return w.String(), nil
+}
+
+func (w *xmlWriter) gppTask(task GPPTask) error {
+	switch {
+	case task.Name == "" || strings.ContainsAny(task.Name, `\/`):
+		return errors.New("invalid task name")
+	case task.Action > GPPDelete:
+		return fmt.Errorf("unknown action %d", task.Action)
+	case task.CPassword != "":
+		return errors.New("cpasswords are no longer accepted by Group Policy preferences")
+	case task.Immediate && len(task.Definition.Triggers) > 0:
+		return errors.New("immediate tasks have no triggers")
+	}
+
+	uid := task.UID
+	if uid == "" {
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return err
+		}
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		uid = fmt.Sprintf("{%X-%X-%X-%X-%X}", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	}
+	changed := task.Changed
+	if changed.IsZero() {
+		changed = time.Now().UTC()
+	}
+	logonType, err := xmlLogonType(task.Definition.Principal.LogonType)
+	if err != nil {
+		return err
+	}
+
+	element, clsid := "TaskV2", gppTaskV2CLSID
+	def := task.Definition
+	if task.Immediate {
+		element, clsid = "ImmediateTaskV2", gppImmediateTaskV2CLSID
+		def.Triggers = []Trigger{TimeTrigger{TaskTrigger: TaskTrigger{Enabled: true}}}
+		w.unsetBoundary = gppImmediateBoundary
+		defer func() { w.unsetBoundary = "" }()
+	}
+
+	w.open(element, "clsid", clsid, "name", task.Name, "image", strconv.Itoa(int(task.Action)),
+		"changed", changed.Format(gppChangedLayout), "uid", uid, "desc", task.Description, "disabled", gppFlag(task.Disabled),
+		"bypassErrors", gppFlag(task.BypassErrors), "userContext", gppFlag(task.UserContext), "removePolicy", gppFlag(task.RemovePolicy))
+	w.open("Properties", "action", gppActionLetters[task.Action:task.Action+1], "name", task.Name,
+		"runAs", def.Principal.UserID+def.Principal.GroupID, "logonType", logonType)
+	if err := w.task(def); err != nil {
+		return err
+	}
+	w.close("Properties")
+	if task.Filters != "" {
+		w.start("Filters", nil)
+		w.WriteString(">" + task.Filters + "</Filters>\n")
+	}
+	w.close(element)
+
+	return nil
+}
+
+// gppFlag returns the value of a boolean attribute of an item, which is omitted
+// when false.
+func gppFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return ""
+}
@@ -0,0 +1,216 @@
+package taskmaster
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/period"
+)
+
+const testGPPScheduledTasks = `<?xml version="1.0" encoding="utf-8"?>
+<ScheduledTasks clsid="{CC63F200-7309-4ba0-B154-A71CD118DBCC}">
+	<TaskV2 clsid="{D8896631-B747-47a7-84A6-C155337F3BC8}" name="Backup" image="2" changed="2024-05-01 10:11:12" uid="{5F4C6C3C-8C2B-4A8E-9F2A-6E2B1C3D4E5F}" desc="Nightly backup" bypassErrors="1">
+		<Properties action="U" name="Backup" runAs="CORP\svc-backup" logonType="Password" cpassword="j1Uyj3Vx8TY9LtLZil2uAuZkFQA/4latT76ZwgdHdhw">
+			<Task version="1.2">
+				<RegistrationInfo><Author>CORP\admin</Author><Description>Backs up the data</Description></RegistrationInfo>
+				<Principals><Principal id="Author"><UserId>CORP\svc-backup</UserId><LogonType>Password</LogonType><RunLevel>HighestAvailable</RunLevel></Principal></Principals>
+				<Settings><IdleSettings><Duration>PT10M</Duration><WaitTimeout>PT1H</WaitTimeout><StopOnIdleEnd>true</StopOnIdleEnd><RestartOnIdle>false</RestartOnIdle></IdleSettings><MultipleInstancesPolicy>IgnoreNew</MultipleInstancesPolicy><ExecutionTimeLimit>PT3H</ExecutionTimeLimit><Priority>7</Priority></Settings>
+				<Triggers><CalendarTrigger><StartBoundary>2024-05-01T02:30:00</StartBoundary><Enabled>true</Enabled><ScheduleByDay><DaysInterval>1</DaysInterval></ScheduleByDay></CalendarTrigger></Triggers>
+				<Actions Context="Author"><Exec><Command>C:\Tools\backup.exe</Command><Arguments>/all</Arguments></Exec></Actions>
+			</Task>
+		</Properties>
+	</TaskV2>
+	<ImmediateTaskV2 clsid="{9756B581-76EC-4169-9AFC-0CA8D43ADB5F}" name="Inventory" image="0" changed="2024-05-02 08:00:00" uid="{0A1B2C3D-4E5F-4061-8273-94A5B6C7D8E9}" userContext="0" removePolicy="0">
+		<Properties action="C" name="Inventory" runAs="NT AUTHORITY\System" logonType="S4U">
+			<Task version="1.3">
+				<RegistrationInfo><Author>CORP\admin</Author></RegistrationInfo>
+				<Principals><Principal id="Author"><UserId>NT AUTHORITY\System</UserId><LogonType>S4U</LogonType><RunLevel>HighestAvailable</RunLevel></Principal></Principals>
+				<Settings><DeleteExpiredTaskAfter>PT0S</DeleteExpiredTaskAfter><Priority>7</Priority></Settings>
+				<Triggers><TimeTrigger><StartBoundary>%LocalTimeXmlEx%</StartBoundary><EndBoundary>%LocalTimeXmlEx%</EndBoundary><Enabled>true</Enabled></TimeTrigger></Triggers>
+				<Actions Context="Author"><Exec><Command>powershell.exe</Command><Arguments>-File \\corp\netlogon\inventory.ps1</Arguments></Exec></Actions>
+			</Task>
+		</Properties>
+	</ImmediateTaskV2>
+	<ImmediateTaskV2 clsid="{9756B581-76EC-4169-9AFC-0CA8D43ADB5F}" name="Cleanup" image="3" changed="2024-05-03 08:00:00" uid="{1A1B2C3D-4E5F-4061-8273-94A5B6C7D8E9}">
+		<Properties action="D" name="Cleanup" runAs="NT AUTHORITY\System" logonType="S4U">
+			<Task version="1.3">
+				<Principals><Principal id="Author"><UserId>NT AUTHORITY\SYSTEM</UserId><LogonType>S4U</LogonType></Principal></Principals>
+				<Triggers><TimeTrigger><StartBoundary>%LocalTimeXmlEx%</StartBoundary><EndBoundary>%LocalTimeXmlEx%</EndBoundary></TimeTrigger></Triggers>
+				<Actions Context="Author"><Exec><Command>cleanmgr.exe</Command></Exec></Actions>
+			</Task>
+		</Properties>
+		<Filters><FilterRunOnce hidden="1" not="0" bool="AND" id="{7E3F0B8A-6D1C-4B2E-9A5F-3C4D5E6F7A8B}"/></Filters>
+	</ImmediateTaskV2>
+	<Task clsid="{2DEECB1C-261F-4e13-9B21-16FB83BC03BD}" name="Legacy" image="2" changed="2010-01-01 00:00:00" uid="{2A1B2C3D-4E5F-4061-8273-94A5B6C7D8E9}">
+		<Properties action="U" name="Legacy" appName="notepad.exe"/>
+	</Task>
+</ScheduledTasks>
+`
+
+func TestParseGPPScheduledTasks(t *testing.T) {
+	result, err := ParseGPPScheduledTasks(strings.NewReader(testGPPScheduledTasks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tasks) != 3 {
+		t.Fatalf("got %d tasks", len(result.Tasks))
+	}
+
+	backup := result.Tasks[0]
+	if backup.Name != "Backup" || backup.Action != GPPUpdate || backup.Immediate || backup.UID != "{5F4C6C3C-8C2B-4A8E-9F2A-6E2B1C3D4E5F}" ||
+		!backup.Changed.Equal(time.Date(2024, 5, 1, 10, 11, 12, 0, time.UTC)) || backup.Description != "Nightly backup" || !backup.BypassErrors ||
+		backup.CPassword == "" {
+		t.Errorf("backup = %+v", backup)
+	}
+	def := backup.Definition
+	if p := def.Principal; p.UserID != `CORP\svc-backup` || p.LogonType != TASK_LOGON_PASSWORD || p.RunLevel != TASK_RUNLEVEL_HIGHEST {
+		t.Errorf("principal = %#v", p)
+	}
+	wantTriggers := []Trigger{DailyTrigger{TaskTrigger: TaskTrigger{Enabled: true, StartBoundary: time.Date(2024, 5, 1, 2, 30, 0, 0, time.UTC)}, DayInterval: EveryDay}}
+	if !reflect.DeepEqual(def.Triggers, wantTriggers) || def.Settings.TimeLimit != period.NewHMS(3, 0, 0) {
+		t.Errorf("triggers = %#v, time limit = %v", def.Triggers, def.Settings.TimeLimit)
+	}
+
+	inventory := result.Tasks[1]
+	if inventory.Action != GPPCreate || !inventory.Immediate || len(inventory.Definition.Triggers) > 0 || inventory.Definition.Settings.DeleteExpiredTaskAfter != "PT0S" {
+		t.Errorf("inventory = %+v", inventory)
+	}
+	cleanup := result.Tasks[2]
+	if cleanup.Action != GPPDelete || !strings.HasPrefix(cleanup.Filters, "<FilterRunOnce") {
+		t.Errorf("cleanup = %+v", cleanup)
+	}
+
+	warnings := strings.Join(result.Warnings, "\n")
+	for _, want := range []string{`"Backup" has a cpassword`, `immediate task "Inventory" is not applied once`, `Task "Legacy" is in the Windows XP task format`} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("warnings do not contain %q:\n%s", want, warnings)
+		}
+	}
+	for _, unwanted := range []string{"Cleanup", "runs as"} {
+		if strings.Contains(warnings, unwanted) {
+			t.Errorf("warnings contain %q:\n%s", unwanted, warnings)
+		}
+	}
+}
+
+func TestParseGPPScheduledTasksWarnings(t *testing.T) {
+	doc := `<ScheduledTasks clsid="{CC63F200-7309-4ba0-B154-A71CD118DBCC}">
+	<TaskV2 clsid="{D8896631-B747-47a7-84A6-C155337F3BC8}" name="Report">
+		<Properties action="R" name="Report" runAs="CORP\jane" logonType="Password">
+			<Task version="1.2">
+				<Principals><Principal><UserId>CORP\reports</UserId><LogonType>Password</LogonType></Principal></Principals>
+				<Actions><Exec><Command>report.exe</Command></Exec></Actions>
+			</Task>
+		</Properties>
+	</TaskV2>
+</ScheduledTasks>`
+	result, err := ParseGPPScheduledTasks(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Tasks) != 1 || result.Tasks[0].Action != GPPReplace {
+		t.Fatalf("tasks = %+v", result.Tasks)
+	}
+	warnings := strings.Join(result.Warnings, "\n")
+	for _, want := range []string{"logs on with a password", `runs as "CORP\\jane"`} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("warnings do not contain %q:\n%s", want, warnings)
+		}
+	}
+}
+
+func TestParseGPPScheduledTasksErrors(t *testing.T) {
+	item := func(properties, task string) string {
+		return `<ScheduledTasks><TaskV2 name="Test" changed="2024-05-01 00:00:00"><Properties ` + properties + `>` + task + `</Properties></TaskV2></ScheduledTasks>`
+	}
+	task := `<Task version="1.2"><Actions><Exec><Command>a.exe</Command></Exec></Actions></Task>`
+	tests := map[string]string{
+		"not XML":         "ScheduledTasks",
+		"other root":      "<Groups></Groups>",
+		"unknown action":  item(`action="X"`, task),
+		"no task":         item(`action="C"`, ""),
+		"invalid task":    item(`action="C"`, `<Task version="9.9"></Task>`),
+		"invalid changed": strings.Replace(item(`action="C"`, task), "2024-05-01 00:00:00", "yesterday", 1),
+	}
+	for name, doc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseGPPScheduledTasks(strings.NewReader(doc)); err == nil {
+				t.Error("parsing did not fail")
+			}
+		})
+	}
+}
+
+func TestExportGPPScheduledTasks(t *testing.T) {
+	result, err := ParseGPPScheduledTasks(strings.NewReader(testGPPScheduledTasks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks := result.Tasks
+	tasks[0].CPassword = ""
+	tasks[0].Definition.Principal.LogonType = TASK_LOGON_S4U
+	full := GPPTask{Name: "Full", Action: GPPReplace, Definition: testFullDefinition(), Disabled: true, UserContext: true, RemovePolicy: true}
+	tasks = append(tasks, full)
+
+	text, err := ExportGPPScheduledTasks(tasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<ScheduledTasks clsid="{CC63F200-7309-4ba0-B154-A71CD118DBCC}">`,
+		`<ImmediateTaskV2 clsid="{9756B581-76EC-4169-9AFC-0CA8D43ADB5F}" name="Inventory" image="0" changed="2024-05-02 08:00:00"`,
+		`<Properties action="U" name="Backup" runAs="CORP\svc-backup" logonType="S4U">`,
+		`<StartBoundary>%LocalTimeXmlEx%</StartBoundary>`,
+		`<Task version="1.2">`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("ScheduledTasks.xml does not contain %q:\n%s", want, text)
+		}
+	}
+
+	back, err := ParseGPPScheduledTasks(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("%v\n%s", err, text)
+	}
+	if len(back.Tasks) != len(tasks) {
+		t.Fatalf("got %d tasks back, want %d", len(back.Tasks), len(tasks))
+	}
+	for i, task := range back.Tasks {
+		want := tasks[i]
+		if want.UID == "" && strings.HasPrefix(task.UID, "{") {
+			want.UID = task.UID
+		}
+		if want.Changed.IsZero() {
+			want.Changed = task.Changed
+		}
+		if diff := DiffDefinitions(want.Definition, task.Definition); len(diff) > 0 {
+			t.Errorf("%s: definition differs:\n%s", want.Name, strings.Join(diff, "\n"))
+		}
+		want.Definition, task.Definition = Definition{}, Definition{}
+		if !reflect.DeepEqual(task, want) {
+			t.Errorf("task = %+v, want %+v", task, want)
+		}
+	}
+}
+
+func TestExportGPPScheduledTasksErrors(t *testing.T) {
+	def := DefaultDefinition()
+	def.AddAction(ExecAction{Path: "a.exe"})
+	tests := map[string]GPPTask{
+		"no name":            {Definition: def},
+		"folder":             {Name: `Folder\Task`, Definition: def},
+		"unknown action":     {Name: "Task", Action: 4, Definition: def},
+		"cpassword":          {Name: "Task", Definition: def, CPassword: "secret"},
+		"immediate triggers": {Name: "Task", Immediate: true, Definition: testFullDefinition()},
+		"unknown logon type": {Name: "Task", Definition: Definition{Principal: Principal{LogonType: 42}}},
+	}
+	for name, task := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ExportGPPScheduledTasks([]GPPTask{task}); err == nil {
+				t.Error("exporting did not fail")
+			}
+		})
+	}
+}
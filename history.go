@@ -0,0 +1,275 @@
+package taskmaster
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunTrigger specifies what launched a run of a task.
+type RunTrigger uint
+
+const (
+	RunTriggerUnknown            RunTrigger = iota // no trigger event was recorded for the run
+	RunTriggerSchedule                             // a time-based trigger (event 107)
+	RunTriggerEvent                                // an event trigger (event 108)
+	RunTriggerRegistration                         // a registration trigger (event 109)
+	RunTriggerUser                                 // a user or program ran the task on demand (event 110)
+	RunTriggerIdle                                 // an idle trigger (event 117)
+	RunTriggerBoot                                 // a boot trigger (event 118)
+	RunTriggerLogon                                // a logon trigger (event 119)
+	RunTriggerSessionStateChange                   // a session state change trigger (events 120 to 125)
+)
+
+func (t RunTrigger) String() string {
+	switch t {
+	case RunTriggerUnknown:
+		return "Unknown"
+	case RunTriggerSchedule:
+		return "Schedule"
+	case RunTriggerEvent:
+		return "Event"
+	case RunTriggerRegistration:
+		return "Registration"
+	case RunTriggerUser:
+		return "User"
+	case RunTriggerIdle:
+		return "Idle"
+	case RunTriggerBoot:
+		return "Boot"
+	case RunTriggerLogon:
+		return "Logon"
+	case RunTriggerSessionStateChange:
+		return "Session State Change"
+	default:
+		return ""
+	}
+}
+
+// TaskRun is a single run of a task, assembled from the events the Task Scheduler
+// logs to the Microsoft-Windows-TaskScheduler/Operational channel.
+type TaskRun struct {
+	InstanceGUID  string     // the GUID identifier of the run, as in RunningTask.InstanceGUID
+	Path          string     // the path of the task
+	Trigger       RunTrigger // what launched the run
+	TriggeredBy   string     // the user who ran the task on demand or whose logon triggered it
+	UserContext   string     // the user the task ran as
+	Started       time.Time  // when the Task Scheduler started the run (event 100)
+	ActionName    string     // the last action that was started, usually the path of its executable
+	ActionStarted time.Time  // when the last action was started (event 200)
+	ProcessID     uint       // the process ID of the last action (event 129), or of its engine (event 201)
+	Completed     time.Time  // when the run completed (event 102) or was terminated (event 111)
+	Terminated    bool       // indicates that the run was terminated (event 111)
+	ResultCode    TaskResult // the last non-zero result code of the run, such as the exit code of an action
+	EventIDs      []int      // the IDs of the events of the run, in the order they were logged
+}
+
+// Duration returns how long the run took, or zero if the run has not completed.
+func (r TaskRun) Duration() time.Duration {
+	if r.Started.IsZero() || r.Completed.IsZero() {
+		return 0
+	}
+
+	return r.Completed.Sub(r.Started)
+}
+
+// taskEvent is the part of an event's XML the run history is built from.
+type taskEvent struct {
+	System struct {
+		EventID     int `xml:"EventID"`
+		TimeCreated struct {
+			SystemTime string `xml:"SystemTime,attr"`
+		} `xml:"TimeCreated"`
+		Correlation struct {
+			ActivityID string `xml:"ActivityID,attr"`
+		} `xml:"Correlation"`
+	} `xml:"System"`
+	Data []struct {
+		Name  string `xml:"Name,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"EventData>Data"`
+
+	time time.Time
+}
+
+func (e taskEvent) data(name string) string {
+	for _, d := range e.Data {
+		if d.Name == name {
+			return strings.TrimSpace(d.Value)
+		}
+	}
+
+	return ""
+}
+
+// instanceGUID returns the GUID of the run the event belongs to, normalized to the
+// format of RunningTask.InstanceGUID.
+func (e taskEvent) instanceGUID() string {
+	guid := e.data("InstanceId")
+	if guid == "" {
+		guid = e.data("TaskInstanceId")
+	}
+	if guid == "" {
+		guid = e.System.Correlation.ActivityID
+	}
+	if guid == "" {
+		return ""
+	}
+
+	return "{" + strings.ToUpper(strings.Trim(guid, "{}")) + "}"
+}
+
+var runTriggerEvents = map[int]RunTrigger{
+	107: RunTriggerSchedule,
+	108: RunTriggerEvent,
+	109: RunTriggerRegistration,
+	110: RunTriggerUser,
+	117: RunTriggerIdle,
+	118: RunTriggerBoot,
+	119: RunTriggerLogon,
+	120: RunTriggerSessionStateChange,
+	121: RunTriggerSessionStateChange,
+	122: RunTriggerSessionStateChange,
+	123: RunTriggerSessionStateChange,
+	124: RunTriggerSessionStateChange,
+	125: RunTriggerSessionStateChange,
+}
+
+// ParseRunHistory reads Task Scheduler events in XML form, as rendered by the
+// Windows Event Log or exported with "wevtutil qe /f:xml", and correlates them by
+// instance GUID into runs. The events can be bare <Event> elements or wrapped in a
+// root element. Events without an instance GUID, such as event 129, are attached
+// to the latest run of the same task that started before them. Runs are returned
+// in the order they started.
+func ParseRunHistory(r io.Reader) ([]TaskRun, error) {
+	var events []taskEvent
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading event XML: %w", err)
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Event" {
+			continue
+		}
+		var event taskEvent
+		if err := dec.DecodeElement(&event, &start); err != nil {
+			return nil, fmt.Errorf("error decoding event: %w", err)
+		}
+		event.time, err = time.Parse(time.RFC3339Nano, event.System.TimeCreated.SystemTime)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing time of event %d: %w", event.System.EventID, err)
+		}
+		events = append(events, event)
+	}
+
+	return correlateRunHistory(events), nil
+}
+
+func correlateRunHistory(events []taskEvent) []TaskRun {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].time.Before(events[j].time)
+	})
+
+	var runs []*TaskRun
+	byGUID := make(map[string]*TaskRun)
+	for _, event := range events {
+		path := event.data("TaskName")
+		guid := event.instanceGUID()
+
+		var run *TaskRun
+		if guid != "" {
+			run = byGUID[guid]
+			if run == nil {
+				run = &TaskRun{InstanceGUID: guid, Path: path}
+				byGUID[guid] = run
+				runs = append(runs, run)
+			}
+		} else {
+			for i := len(runs) - 1; i >= 0; i-- {
+				if strings.EqualFold(runs[i].Path, path) {
+					run = runs[i]
+					break
+				}
+			}
+			if run == nil {
+				continue
+			}
+		}
+
+		applyTaskEvent(run, event)
+	}
+
+	history := make([]TaskRun, len(runs))
+	for i, run := range runs {
+		history[i] = *run
+	}
+
+	return history
+}
+
+func applyTaskEvent(run *TaskRun, event taskEvent) {
+	id := event.System.EventID
+	run.EventIDs = append(run.EventIDs, id)
+
+	if trigger, ok := runTriggerEvents[id]; ok {
+		run.Trigger = trigger
+		if user := event.data("UserContext"); user != "" && trigger == RunTriggerUser {
+			run.TriggeredBy = user
+		} else if user := event.data("UserName"); user != "" {
+			run.TriggeredBy = user
+		}
+	}
+
+	switch id {
+	case 100:
+		run.Started = event.time
+		run.UserContext = event.data("UserContext")
+	case 102:
+		run.Completed = event.time
+	case 111:
+		run.Completed = event.time
+		run.Terminated = true
+	case 129:
+		if pid, err := strconv.ParseUint(event.data("ProcessID"), 10, 32); err == nil {
+			run.ProcessID = uint(pid)
+		}
+	case 200:
+		run.ActionStarted = event.time
+		run.ActionName = event.data("ActionName")
+	case 201:
+		if pid, err := strconv.ParseUint(event.data("EnginePID"), 10, 32); err == nil && run.ProcessID == 0 {
+			run.ProcessID = uint(pid)
+		}
+	}
+
+	if code := event.data("ResultCode"); code != "" {
+		if result, err := parseResultCode(code); err == nil && result != 0 {
+			run.ResultCode = result
+		}
+	}
+}
+
+// parseResultCode parses a result code, which the Task Scheduler logs either in
+// decimal or in hexadecimal.
+func parseResultCode(s string) (TaskResult, error) {
+	if v, err := strconv.ParseUint(s, 0, 32); err == nil {
+		return TaskResult(v), nil
+	}
+	v, err := strconv.ParseInt(s, 0, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return TaskResult(uint32(v)), nil
+}
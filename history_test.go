@@ -0,0 +1,99 @@
+package taskmaster
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEvent renders a Task Scheduler event the way wevtutil exports it.
+func testEvent(id int, systemTime, activityID string, data ...string) string {
+	var b strings.Builder
+	b.WriteString(`<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event"><System>`)
+	b.WriteString(`<Provider Name="Microsoft-Windows-TaskScheduler" Guid="{de7b24ea-73c8-4a09-985d-5bdadcfa9017}"/>`)
+	b.WriteString(`<EventID>` + strconv.Itoa(id) + `</EventID>`)
+	b.WriteString(`<TimeCreated SystemTime="` + systemTime + `"/>`)
+	if activityID != "" {
+		b.WriteString(`<Correlation ActivityID="` + activityID + `"/>`)
+	} else {
+		b.WriteString(`<Correlation/>`)
+	}
+	b.WriteString(`<Channel>Microsoft-Windows-TaskScheduler/Operational</Channel></System><EventData>`)
+	for i := 0; i+1 < len(data); i += 2 {
+		b.WriteString(`<Data Name="` + data[i] + `">` + data[i+1] + `</Data>`)
+	}
+	b.WriteString(`</EventData></Event>`)
+	return b.String()
+}
+
+func TestParseRunHistory(t *testing.T) {
+	const (
+		first  = "{5D4D4C2A-1F4E-4B9B-9E1E-2C0C9C6B5E01}"
+		second = "{9A1B7C3D-2E4F-4A5B-8C6D-7E8F9A0B1C02}"
+	)
+
+	input := "<Events>" +
+		// events are deliberately out of order
+		testEvent(102, "2024-05-01T10:00:05.5000000Z", first, "TaskName", `\Test\Task`, "UserContext", `HOST\user`, "InstanceId", "5d4d4c2a-1f4e-4b9b-9e1e-2c0c9c6b5e01") +
+		testEvent(107, "2024-05-01T10:00:00.0000000Z", first, "TaskName", `\Test\Task`, "InstanceId", first) +
+		testEvent(100, "2024-05-01T10:00:00.1000000Z", first, "TaskName", `\Test\Task`, "UserContext", `HOST\user`, "InstanceId", first) +
+		testEvent(129, "2024-05-01T10:00:00.2000000Z", "", "TaskName", `\Test\Task`, "Path", `C:\Windows\System32\cmd.exe`, "ProcessID", "4242", "Priority", "16384") +
+		testEvent(200, "2024-05-01T10:00:00.3000000Z", first, "TaskName", `\Test\Task`, "ActionName", `C:\Windows\System32\cmd.exe`, "TaskInstanceId", first) +
+		testEvent(201, "2024-05-01T10:00:05.4000000Z", first, "TaskName", `\Test\Task`, "TaskInstanceId", first, "ActionName", `C:\Windows\System32\cmd.exe`, "ResultCode", "2147942402", "EnginePID", "4242") +
+		testEvent(110, "2024-05-01T11:00:00.0000000Z", second, "TaskName", `\Test\Task`, "InstanceId", second, "UserContext", `HOST\admin`) +
+		testEvent(100, "2024-05-01T11:00:00.1000000Z", second, "TaskName", `\Test\Task`, "UserContext", `HOST\user`, "InstanceId", second) +
+		testEvent(111, "2024-05-01T11:00:30.1000000Z", second, "TaskName", `\Test\Task`, "InstanceId", second) +
+		"</Events>"
+
+	runs, err := ParseRunHistory(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %d: %+v", len(runs), runs)
+	}
+
+	run := runs[0]
+	if run.InstanceGUID != first || run.Path != `\Test\Task` {
+		t.Fatalf("unexpected first run: %+v", run)
+	}
+	if run.Trigger != RunTriggerSchedule || run.UserContext != `HOST\user` {
+		t.Fatalf("expected scheduled run as HOST\\user, got %s as %s", run.Trigger, run.UserContext)
+	}
+	if run.ProcessID != 4242 || run.ActionName != `C:\Windows\System32\cmd.exe` {
+		t.Fatalf("unexpected action of first run: %+v", run)
+	}
+	if run.ResultCode != 0x80070002 {
+		t.Fatalf("expected result code 0x80070002, got %#x", uint32(run.ResultCode))
+	}
+	if run.Duration() != 5400*time.Millisecond {
+		t.Fatalf("expected duration 5.4s, got %s", run.Duration())
+	}
+	if want := []int{107, 100, 129, 200, 201, 102}; !slices.Equal(run.EventIDs, want) {
+		t.Fatalf("expected events %v, got %v", want, run.EventIDs)
+	}
+
+	run = runs[1]
+	if run.Trigger != RunTriggerUser || run.TriggeredBy != `HOST\admin` {
+		t.Fatalf("expected run triggered by HOST\\admin, got %s by %q", run.Trigger, run.TriggeredBy)
+	}
+	if !run.Terminated || run.Duration() != 30*time.Second {
+		t.Fatalf("expected terminated run of 30s, got %+v", run)
+	}
+}
+
+func TestParseRunHistoryErrors(t *testing.T) {
+	if _, err := ParseRunHistory(strings.NewReader("<Event><System><EventID>100")); err == nil {
+		t.Fatal("expected error for truncated XML")
+	}
+	if _, err := ParseRunHistory(strings.NewReader(testEvent(100, "yesterday", "{A}"))); err == nil {
+		t.Fatal("expected error for invalid event time")
+	}
+
+	runs, err := ParseRunHistory(strings.NewReader(""))
+	if err != nil || len(runs) != 0 {
+		t.Fatalf("expected no runs and no error, got %v, %v", runs, err)
+	}
+}
@@ -0,0 +1,152 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+
+	ole "github.com/go-ole/go-ole"
+	"github.com/go-ole/go-ole/oleutil"
+)
+
+// errStopEnum stops a COM enumeration when the consumer of an iterator is done.
+var errStopEnum = errors.New("enumeration stopped")
+
+// RegisteredTasks returns an iterator over the registered tasks in the folder at
+// path and all of its subfolders, including hidden tasks. Tasks are enumerated and
+// parsed one at a time, each folder's tasks before its subfolders, so breaking out
+// of the loop stops the enumeration.
+//
+// Each task's COM object is released when the loop moves on to the next task, so
+// methods such as Run must be called within the loop body; the parsed fields stay
+// valid. Enumeration stops at the first error, which is yielded with a zero
+// RegisteredTask.
+//
+//	for task, err := range taskService.RegisteredTasks(`\`) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(task.Path)
+//	}
+func (t *TaskService) RegisteredTasks(path string) iter.Seq2[RegisteredTask, error] {
+	return t.enumRegisteredTasks(path, true, true)
+}
+
+// TaskSummaries returns an iterator over summaries of the registered tasks in the
+// folder at path and all of its subfolders, in the same order as RegisteredTasks.
+// Task definitions are not parsed; see GetTaskSummaries.
+func (t *TaskService) TaskSummaries(path string) iter.Seq2[TaskSummary, error] {
+	return t.enumTaskSummaries(path, true)
+}
+
+func (t *TaskService) enumTaskSummaries(path string, recursive bool) iter.Seq2[TaskSummary, error] {
+	return func(yield func(TaskSummary, error) bool) {
+		t.enumTasks(path, recursive, func(task *ole.IDispatch) (bool, error) {
+			defer task.Release()
+
+			summary, err := parseTaskSummary(task)
+			if err != nil {
+				return false, fmt.Errorf("error parsing registered task %s: %w", summary.Path, err)
+			}
+
+			return yield(summary, nil), nil
+		}, func(err error) {
+			yield(TaskSummary{}, err)
+		})
+	}
+}
+
+// enumRegisteredTasks iterates over the tasks in the folder at path, and if
+// recursive is set, its subfolders. If release is not set, the caller owns the COM
+// objects of the yielded tasks.
+func (t *TaskService) enumRegisteredTasks(path string, recursive, release bool) iter.Seq2[RegisteredTask, error] {
+	return func(yield func(RegisteredTask, error) bool) {
+		t.enumTasks(path, recursive, func(task *ole.IDispatch) (bool, error) {
+			registeredTask, taskPath, err := parseRegisteredTask(task)
+			if err != nil {
+				return false, fmt.Errorf("error parsing registered task %s: %w", taskPath, err)
+			}
+
+			more := yield(registeredTask, nil)
+			if release {
+				registeredTask.Release()
+			}
+			return more, nil
+		}, func(err error) {
+			yield(RegisteredTask{}, err)
+		})
+	}
+}
+
+// enumTasks calls visit with the IRegisteredTask object of every task in the folder
+// at path, and if recursive is set, its subfolders, until visit returns false or an
+// error. visit owns the object it is passed. Errors, including those of visit, are
+// passed to fail.
+func (t *TaskService) enumTasks(path string, recursive bool, visit func(*ole.IDispatch) (bool, error), fail func(error)) {
+	if len(path) == 0 || path[0] != '\\' {
+		fail(ErrInvalidPath)
+		return
+	}
+
+	folderObj := t.rootFolderObj
+	if path != `\` {
+		folder, err := oleutil.CallMethod(t.taskServiceObj, "GetFolder", path)
+		if err != nil {
+			fail(fmt.Errorf("error getting folder %s: %w", path, getTaskSchedulerError(err)))
+			return
+		}
+		folderObj = folder.ToIDispatch()
+		defer folderObj.Release()
+	}
+
+	err := enumFolderTasks(folderObj, path, recursive, visit)
+	if err != nil && !errors.Is(err, errStopEnum) {
+		fail(err)
+	}
+}
+
+func enumFolderTasks(folderObj *ole.IDispatch, path string, recursive bool, visit func(*ole.IDispatch) (bool, error)) error {
+	res, err := oleutil.CallMethod(folderObj, "GetTasks", int(TASK_ENUM_HIDDEN))
+	if err != nil {
+		return fmt.Errorf("error getting tasks of folder %s: %w", path, getTaskSchedulerError(err))
+	}
+	taskCollection := res.ToIDispatch()
+	defer taskCollection.Release()
+
+	err = oleutil.ForEach(taskCollection, func(v *ole.VARIANT) error {
+		more, err := visit(v.ToIDispatch())
+		if err != nil {
+			return err
+		} else if !more {
+			return errStopEnum
+		}
+
+		return nil
+	})
+	if err != nil || !recursive {
+		return err
+	}
+
+	res, err = oleutil.CallMethod(folderObj, "GetFolders", 0)
+	if err != nil {
+		return fmt.Errorf("error getting subfolders of folder %s: %w", path, getTaskSchedulerError(err))
+	}
+	folderCollection := res.ToIDispatch()
+	defer folderCollection.Release()
+
+	return oleutil.ForEach(folderCollection, func(v *ole.VARIANT) error {
+		subFolderObj := v.ToIDispatch()
+		defer subFolderObj.Release()
+
+		h := &oleHelper{}
+		subFolderPath := h.getString(subFolderObj, "Path")
+		if h.err != nil {
+			return fmt.Errorf("error getting path of subfolder of folder %s: %w", path, h.err)
+		}
+
+		return enumFolderTasks(subFolderObj, subFolderPath, recursive, visit)
+	})
+}
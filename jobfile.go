@@ -0,0 +1,368 @@
+package taskmaster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/rickb777/period"
+)
+
+// JobFile is a Task Scheduler 1.0 job read from a .job file, such as the files in
+// C:\Windows\Tasks.
+type JobFile struct {
+	Definition       Definition
+	UUID             string     // the identifier of the job, in the form {XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}
+	ProductVersion   uint16     // the version of Windows that wrote the file, such as 0x0501 for Windows XP
+	Status           TaskResult // the status of the job when the file was written
+	ExitCode         uint32     // the exit code of the most recent run
+	MostRecentRun    time.Time  // when the job last ran, as a wall-clock time in UTC like the triggers; zero if it never ran
+	RunningInstances int        // the number of instances that were running when the file was written
+	StartError       uint32     // the HRESULT of the most recent failure to start the job; 0 if none is recorded
+	UserData         []byte     // data an application stored with the job
+	Warnings         []string   // what the definition leaves out
+}
+
+// ParseJobFile decodes the fixed-length and variable-length sections of a
+// Task Scheduler 1.0 .job file, as specified in [MS-TSCH] section 2.4, into a
+// definition that is compatible with TASK_COMPATIBILITY_V1. The job signature
+// that may follow the triggers is not checked.
+//
+// The application, parameters and working directory become an ExecAction, the
+// author and comment the RegistrationInfo, and the job flags, idle minutes,
+// priority class and maximum run time the Settings. The legacy triggers map onto
+// TimeTrigger, DailyTrigger, WeeklyTrigger, MonthlyTrigger, MonthlyDOWTrigger,
+// IdleTrigger, BootTrigger and LogonTrigger; the file stores local times, which
+// are returned as wall-clock times in UTC as by TaskDateToTime, and an end date
+// ends at the end of its day.
+//
+// The account a job runs as is kept in the credential store of the Task
+// Scheduler, not in the file, so the principal has no UserID: it logs on with an
+// interactive token if the job only runs when the user is logged on, and with a
+// password otherwise.
+func ParseJobFile(data []byte) (JobFile, error) {
+	var fixed jobFixedSection
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &fixed); err != nil {
+		return JobFile{}, fmt.Errorf("error parsing .job file: %w", err)
+	}
+	if fixed.FileVersion != 1 {
+		return JobFile{}, fmt.Errorf("error parsing .job file: unsupported file version %d", fixed.FileVersion)
+	}
+
+	job := JobFile{
+		UUID:           jobGUID(fixed.UUID),
+		ProductVersion: fixed.ProductVersion,
+		Status:         TaskResult(fixed.Status),
+		ExitCode:       fixed.ExitCode,
+		MostRecentRun:  fixed.MostRecentRun.time(),
+		Definition:     DefaultDefinition(),
+	}
+	def := &job.Definition
+	def.RegistrationInfo.Date = time.Time{}
+	def.Settings.Compatibility = TASK_COMPATIBILITY_V1
+
+	r := jobReader{data: data, off: binary.Size(fixed)}
+	job.RunningInstances = int(r.uint16())
+	r.off = int(fixed.AppNameLenOffset)
+	action := ExecAction{Path: r.string(), Args: r.string(), WorkingDir: r.string()}
+	def.RegistrationInfo.Author = r.string()
+	def.RegistrationInfo.Description = r.string()
+	job.UserData = r.block()
+	if reserved := r.block(); len(reserved) >= 4 {
+		job.StartError = binary.LittleEndian.Uint32(reserved)
+	}
+	if r.err != nil {
+		return JobFile{}, fmt.Errorf("error parsing .job file: %w", r.err)
+	}
+	if action.Path != "" {
+		def.AddAction(action)
+	}
+
+	job.settings(fixed)
+
+	r.off = int(fixed.TriggerOffset)
+	count := int(r.uint16())
+	for i := 0; i < count && r.err == nil; i++ {
+		var raw jobTrigger
+		if b := r.next(binary.Size(raw)); b != nil {
+			_ = binary.Read(bytes.NewReader(b), binary.LittleEndian, &raw)
+		}
+		if r.err != nil {
+			break
+		}
+		trigger, err := raw.trigger()
+		if err != nil {
+			return JobFile{}, fmt.Errorf("error parsing trigger %d of .job file: %w", i, err)
+		}
+		def.AddTrigger(trigger)
+	}
+	if r.err != nil {
+		return JobFile{}, fmt.Errorf("error parsing triggers of .job file: %w", r.err)
+	}
+
+	return job, nil
+}
+
+// ReadJobFile reads and parses a Task Scheduler 1.0 .job file, as ParseJobFile
+// does.
+func ReadJobFile(r io.Reader) (JobFile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return JobFile{}, fmt.Errorf("error reading .job file: %w", err)
+	}
+
+	return ParseJobFile(data)
+}
+
+// the flags of a job
+const (
+	jobFlagInteractive             = 0x1
+	jobFlagDeleteWhenDone          = 0x2
+	jobFlagDisabled                = 0x4
+	jobFlagStartOnlyIfIdle         = 0x10
+	jobFlagKillOnIdleEnd           = 0x20
+	jobFlagDontStartIfOnBatteries  = 0x40
+	jobFlagKillIfGoingOnBatteries  = 0x80
+	jobFlagRunOnlyIfDocked         = 0x100
+	jobFlagHidden                  = 0x200
+	jobFlagRunIfConnectedToNetwork = 0x400
+	jobFlagRestartOnIdleResume     = 0x800
+	jobFlagSystemRequired          = 0x1000
+	jobFlagRunOnlyIfLoggedOn       = 0x2000
+)
+
+// the flags of a job trigger
+const (
+	jobTriggerFlagHasEndDate        = 0x1
+	jobTriggerFlagKillAtDurationEnd = 0x2
+	jobTriggerFlagDisabled          = 0x4
+)
+
+// jobFixedSection is the fixed-length section at the start of a .job file.
+type jobFixedSection struct {
+	ProductVersion     uint16
+	FileVersion        uint16
+	UUID               [16]byte
+	AppNameLenOffset   uint16
+	TriggerOffset      uint16
+	ErrorRetryCount    uint16
+	ErrorRetryInterval uint16 // minutes
+	IdleDeadline       uint16 // minutes
+	IdleWait           uint16 // minutes
+	Priority           uint32
+	MaximumRunTime     uint32 // milliseconds
+	ExitCode           uint32
+	Status             uint32
+	Flags              uint32
+	MostRecentRun      jobSystemTime
+}
+
+// jobSystemTime is a SYSTEMTIME.
+type jobSystemTime struct {
+	Year, Month, DayOfWeek, Day, Hour, Minute, Second, Milliseconds uint16
+}
+
+func (t jobSystemTime) time() time.Time {
+	if t.Year == 0 {
+		return time.Time{}
+	}
+	return time.Date(int(t.Year), time.Month(t.Month), int(t.Day), int(t.Hour), int(t.Minute), int(t.Second), int(t.Milliseconds)*int(time.Millisecond), time.UTC)
+}
+
+// jobTrigger is a trigger in the variable-length section of a .job file.
+type jobTrigger struct {
+	Size                             uint16
+	Reserved1                        uint16
+	BeginYear, BeginMonth, BeginDay  uint16
+	EndYear, EndMonth, EndDay        uint16
+	StartHour, StartMinute           uint16
+	MinutesDuration, MinutesInterval uint32
+	Flags                            uint32
+	Type                             uint32
+	Specific                         [3]uint16
+	Padding, Reserved2, Reserved3    uint16
+}
+
+func (t jobTrigger) trigger() (Trigger, error) {
+	if int(t.Size) != binary.Size(t) {
+		return nil, fmt.Errorf("invalid trigger size %d", t.Size)
+	}
+
+	tt := TaskTrigger{
+		Enabled:       t.Flags&jobTriggerFlagDisabled == 0,
+		StartBoundary: time.Date(int(t.BeginYear), time.Month(t.BeginMonth), int(t.BeginDay), int(t.StartHour), int(t.StartMinute), 0, 0, time.UTC),
+	}
+	if t.Flags&jobTriggerFlagHasEndDate != 0 {
+		tt.EndBoundary = time.Date(int(t.EndYear), time.Month(t.EndMonth), int(t.EndDay), 23, 59, 59, 0, time.UTC)
+	}
+	if t.MinutesInterval > 0 {
+		tt.RepetitionInterval = minutesPeriod(int(t.MinutesInterval))
+		tt.RepetitionDuration = minutesPeriod(int(t.MinutesDuration))
+		tt.StopAtDurationEnd = t.Flags&jobTriggerFlagKillAtDurationEnd != 0
+	}
+	// event triggers have a begin date, which the Task Scheduler 2.0 does not need
+	event := tt
+	event.StartBoundary = time.Time{}
+
+	switch t.Type {
+	case 0:
+		return TimeTrigger{TaskTrigger: tt}, nil
+	case 1:
+		if t.Specific[0] == 0 || t.Specific[0] > 255 {
+			return nil, fmt.Errorf("invalid day interval %d", t.Specific[0])
+		}
+		return DailyTrigger{TaskTrigger: tt, DayInterval: DayInterval(t.Specific[0])}, nil
+	case 2:
+		if t.Specific[0] == 0 || t.Specific[0] > 255 {
+			return nil, fmt.Errorf("invalid week interval %d", t.Specific[0])
+		}
+		return WeeklyTrigger{TaskTrigger: tt, WeekInterval: WeekInterval(t.Specific[0]), DaysOfWeek: DayOfWeek(t.Specific[1]) & AllDays}, nil
+	case 3:
+		days := DayOfMonth(uint32(t.Specific[0]) | uint32(t.Specific[1])<<16)
+		return MonthlyTrigger{
+			TaskTrigger:         tt,
+			DaysOfMonth:         days & AllDaysOfMonth,
+			MonthsOfYear:        Month(t.Specific[2]) & AllMonths,
+			RunOnLastDayOfMonth: days&LastDayOfMonth != 0,
+		}, nil
+	case 4:
+		monthly := MonthlyDOWTrigger{TaskTrigger: tt, DaysOfWeek: DayOfWeek(t.Specific[1]) & AllDays, MonthsOfYear: Month(t.Specific[2]) & AllMonths}
+		switch week := t.Specific[0]; {
+		case week >= 1 && week <= 4:
+			monthly.WeeksOfMonth = First << (week - 1)
+		case week == 5:
+			monthly.RunOnLastWeekOfMonth = true
+		default:
+			return nil, fmt.Errorf("invalid week of the month %d", week)
+		}
+		return monthly, nil
+	case 5:
+		return IdleTrigger{TaskTrigger: event}, nil
+	case 6:
+		return BootTrigger{TaskTrigger: event}, nil
+	case 7:
+		return LogonTrigger{TaskTrigger: event}, nil
+	default:
+		return nil, fmt.Errorf("unknown trigger type %d", t.Type)
+	}
+}
+
+// settings sets the settings and principal of the definition from the fixed-length
+// section.
+func (job *JobFile) settings(fixed jobFixedSection) {
+	s := &job.Definition.Settings
+	flag := func(f uint32) bool { return fixed.Flags&f != 0 }
+
+	s.Enabled = !flag(jobFlagDisabled)
+	s.Hidden = flag(jobFlagHidden)
+	if flag(jobFlagDeleteWhenDone) {
+		s.DeleteExpiredTaskAfter = "PT0S"
+	}
+	s.RunOnlyIfIdle = flag(jobFlagStartOnlyIfIdle)
+	s.StopOnIdleEnd = flag(jobFlagKillOnIdleEnd)
+	s.RestartOnIdle = flag(jobFlagRestartOnIdleResume)
+	s.DontStartOnBatteries = flag(jobFlagDontStartIfOnBatteries)
+	s.StopIfGoingOnBatteries = flag(jobFlagKillIfGoingOnBatteries)
+	s.RunOnlyIfNetworkAvailable = flag(jobFlagRunIfConnectedToNetwork)
+	s.WakeToRun = flag(jobFlagSystemRequired)
+	s.IdleDuration = minutesPeriod(int(fixed.IdleWait))
+	s.WaitTimeout = minutesPeriod(int(fixed.IdleDeadline))
+	s.RestartCount = uint(fixed.ErrorRetryCount)
+	s.RestartInterval = minutesPeriod(int(fixed.ErrorRetryInterval))
+
+	s.TimeLimit = period.Period{}
+	if fixed.MaximumRunTime != 0xFFFFFFFF {
+		seconds := int(fixed.MaximumRunTime / 1000)
+		s.TimeLimit = period.NewHMS(seconds/3600, seconds/60%60, seconds%60)
+	}
+
+	// the first priority of the class, as listed for ITaskSettings::Priority
+	switch fixed.Priority {
+	case 0x100: // REALTIME_PRIORITY_CLASS
+		s.Priority = 0
+	case 0x80: // HIGH_PRIORITY_CLASS
+		s.Priority = 1
+	case 0x20: // NORMAL_PRIORITY_CLASS
+		s.Priority = 4
+	case 0x40: // IDLE_PRIORITY_CLASS
+		s.Priority = 9
+	default:
+		job.Warnings = append(job.Warnings, fmt.Sprintf("unknown priority class 0x%X; the default priority is used", fixed.Priority))
+	}
+
+	if flag(jobFlagRunOnlyIfDocked) {
+		job.Warnings = append(job.Warnings, "the job only runs when the computer is docked, which tasks cannot express")
+	}
+	if flag(jobFlagInteractive) {
+		job.Warnings = append(job.Warnings, "the job interacts with the desktop, which tasks no longer can")
+	}
+
+	p := &job.Definition.Principal
+	if flag(jobFlagRunOnlyIfLoggedOn) {
+		p.LogonType = TASK_LOGON_INTERACTIVE_TOKEN
+	} else {
+		p.LogonType = TASK_LOGON_PASSWORD
+		job.Warnings = append(job.Warnings, "the account the job runs as is not stored in the file")
+	}
+}
+
+// jobGUID formats a GUID stored in little-endian byte order.
+func jobGUID(b [16]byte) string {
+	return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}",
+		binary.LittleEndian.Uint32(b[0:]), binary.LittleEndian.Uint16(b[4:]), binary.LittleEndian.Uint16(b[6:]), b[8:10], b[10:])
+}
+
+// jobReader reads the variable-length section of a .job file. The first read
+// past the end of the data sets err, after which all reads return zero values.
+type jobReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *jobReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.off < 0 || r.off+n > len(r.data) {
+		r.err = fmt.Errorf("unexpected end of data at offset %d", r.off)
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+
+	return b
+}
+
+func (r *jobReader) uint16() uint16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+// string reads a string that is prefixed with its length in UTF-16 code units,
+// including a terminating NUL.
+func (r *jobReader) string() string {
+	b := r.next(2 * int(r.uint16()))
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+}
+
+// block reads data that is prefixed with its length in bytes.
+func (r *jobReader) block() []byte {
+	b := r.next(int(r.uint16()))
+	if len(b) == 0 {
+		return nil
+	}
+	return bytes.Clone(b)
+}
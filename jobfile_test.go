@@ -0,0 +1,196 @@
+package taskmaster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/rickb777/period"
+)
+
+// testJobData encodes a .job file with the given fixed-length section, strings
+// (application, parameters, working directory, author and comment) and triggers.
+func testJobData(fixed jobFixedSection, texts [5]string, userData, reserved []byte, triggers []jobTrigger) []byte {
+	var variable bytes.Buffer
+	le := binary.LittleEndian
+	for _, text := range texts {
+		if text == "" {
+			_ = binary.Write(&variable, le, uint16(0))
+			continue
+		}
+		units := utf16.Encode([]rune(text + "\x00"))
+		_ = binary.Write(&variable, le, uint16(len(units)))
+		_ = binary.Write(&variable, le, units)
+	}
+	for _, block := range [][]byte{userData, reserved} {
+		_ = binary.Write(&variable, le, uint16(len(block)))
+		variable.Write(block)
+	}
+
+	size := binary.Size(fixed)
+	fixed.FileVersion = 1
+	fixed.AppNameLenOffset = uint16(size + 2)
+	fixed.TriggerOffset = uint16(size + 2 + variable.Len())
+
+	var b bytes.Buffer
+	_ = binary.Write(&b, le, fixed)
+	_ = binary.Write(&b, le, uint16(1)) // running instances
+	b.Write(variable.Bytes())
+	_ = binary.Write(&b, le, uint16(len(triggers)))
+	for _, t := range triggers {
+		t.Size = uint16(binary.Size(t))
+		_ = binary.Write(&b, le, t)
+	}
+	// a job signature, which is not checked
+	b.Write(make([]byte, 68))
+
+	return b.Bytes()
+}
+
+func TestParseJobFile(t *testing.T) {
+	fixed := jobFixedSection{
+		ProductVersion:     0x0501,
+		UUID:               [16]byte{0x33, 0x22, 0x11, 0x00, 0x55, 0x44, 0x77, 0x66, 0x88, 0x99, 0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF},
+		ErrorRetryCount:    3,
+		ErrorRetryInterval: 5,
+		IdleDeadline:       60,
+		IdleWait:           15,
+		Priority:           0x40,
+		MaximumRunTime:     5400000,
+		ExitCode:           2,
+		Status:             uint32(SCHED_S_TASK_READY),
+		Flags:              jobFlagHidden | jobFlagStartOnlyIfIdle | jobFlagDontStartIfOnBatteries | jobFlagSystemRequired | jobFlagRunOnlyIfLoggedOn,
+		MostRecentRun:      jobSystemTime{Year: 2009, Month: 3, DayOfWeek: 2, Day: 17, Hour: 22, Minute: 5, Second: 9, Milliseconds: 250},
+	}
+	begin := jobTrigger{BeginYear: 2009, BeginMonth: 1, BeginDay: 5, StartHour: 22}
+	at := TaskTrigger{Enabled: true, StartBoundary: time.Date(2009, 1, 5, 22, 0, 0, 0, time.UTC)}
+
+	triggers := []jobTrigger{begin, begin, begin, begin, begin, begin, begin, begin}
+	triggers[0].Flags = jobTriggerFlagHasEndDate | jobTriggerFlagKillAtDurationEnd
+	triggers[0].EndYear, triggers[0].EndMonth, triggers[0].EndDay = 2010, 12, 31
+	triggers[0].MinutesInterval, triggers[0].MinutesDuration = 30, 120
+	triggers[1].Type, triggers[1].Specific = 1, [3]uint16{2}
+	triggers[2].Type, triggers[2].Specific = 2, [3]uint16{1, uint16(Monday | Friday)}
+	triggers[3].Type, triggers[3].Specific = 3, [3]uint16{1 | 1<<14, 1 << 15, uint16(January | July)}
+	triggers[4].Type, triggers[4].Specific = 4, [3]uint16{5, uint16(Sunday), uint16(AllMonths)}
+	triggers[5].Type, triggers[5].Flags = 5, jobTriggerFlagDisabled
+	triggers[6].Type = 6
+	triggers[7].Type = 7
+
+	data := testJobData(fixed, [5]string{`C:\Program Files\Backup\backup.exe`, "/full /quiet", `C:\Backup`, `CORP\admin`, "Nightly backup"},
+		[]byte{1, 2, 3}, []byte{0x05, 0x00, 0x07, 0x80, 0, 0, 0, 0}, triggers)
+	job, err := ReadJobFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.UUID != "{00112233-4455-6677-8899-AABBCCDDEEFF}" || job.ProductVersion != 0x0501 || job.Status != SCHED_S_TASK_READY || job.ExitCode != 2 ||
+		job.RunningInstances != 1 || job.StartError != 0x80070005 || !bytes.Equal(job.UserData, []byte{1, 2, 3}) {
+		t.Errorf("job = %+v", job)
+	}
+	if want := time.Date(2009, 3, 17, 22, 5, 9, 250*int(time.Millisecond), time.UTC); !job.MostRecentRun.Equal(want) {
+		t.Errorf("MostRecentRun = %v, want %v", job.MostRecentRun, want)
+	}
+	if len(job.Warnings) > 0 {
+		t.Errorf("warnings = %q", job.Warnings)
+	}
+
+	def := job.Definition
+	wantActions := []Action{ExecAction{Path: `C:\Program Files\Backup\backup.exe`, Args: "/full /quiet", WorkingDir: `C:\Backup`}}
+	if !reflect.DeepEqual(def.Actions, wantActions) {
+		t.Errorf("actions = %#v", def.Actions)
+	}
+	if def.RegistrationInfo != (RegistrationInfo{Author: `CORP\admin`, Description: "Nightly backup"}) {
+		t.Errorf("registration info = %#v", def.RegistrationInfo)
+	}
+	if def.Principal.LogonType != TASK_LOGON_INTERACTIVE_TOKEN || def.Principal.UserID != "" {
+		t.Errorf("principal = %#v", def.Principal)
+	}
+
+	want := DefaultDefinition().Settings
+	want.Compatibility = TASK_COMPATIBILITY_V1
+	want.Hidden, want.RunOnlyIfIdle, want.WakeToRun = true, true, true
+	want.StopIfGoingOnBatteries, want.StopOnIdleEnd = false, false
+	want.IdleDuration, want.WaitTimeout = period.NewHMS(0, 15, 0), period.NewHMS(1, 0, 0)
+	want.RestartCount, want.RestartInterval = 3, period.NewHMS(0, 5, 0)
+	want.Priority = 9
+	want.TimeLimit = period.NewHMS(1, 30, 0)
+	if diff := DiffDefinitions(Definition{Settings: want}, Definition{Settings: def.Settings}); len(diff) > 0 {
+		t.Errorf("settings differ:\n%s", strings.Join(diff, "\n"))
+	}
+
+	repeating := at
+	repeating.EndBoundary = time.Date(2010, 12, 31, 23, 59, 59, 0, time.UTC)
+	repeating.RepetitionPattern = RepetitionPattern{RepetitionInterval: period.NewHMS(0, 30, 0), RepetitionDuration: period.NewHMS(2, 0, 0), StopAtDurationEnd: true}
+	wantTriggers := []Trigger{
+		TimeTrigger{TaskTrigger: repeating},
+		DailyTrigger{TaskTrigger: at, DayInterval: EveryOtherDay},
+		WeeklyTrigger{TaskTrigger: at, DaysOfWeek: Monday | Friday, WeekInterval: EveryWeek},
+		MonthlyTrigger{TaskTrigger: at, DaysOfMonth: One | Fifteen, MonthsOfYear: January | July, RunOnLastDayOfMonth: true},
+		MonthlyDOWTrigger{TaskTrigger: at, DaysOfWeek: Sunday, MonthsOfYear: AllMonths, RunOnLastWeekOfMonth: true},
+		IdleTrigger{},
+		BootTrigger{TaskTrigger: TaskTrigger{Enabled: true}},
+		LogonTrigger{TaskTrigger: TaskTrigger{Enabled: true}},
+	}
+	if !reflect.DeepEqual(def.Triggers, wantTriggers) {
+		t.Errorf("triggers = %#v", def.Triggers)
+	}
+}
+
+func TestParseJobFileWarnings(t *testing.T) {
+	fixed := jobFixedSection{Priority: 0x8000, MaximumRunTime: 0xFFFFFFFF, Flags: jobFlagRunOnlyIfDocked | jobFlagInteractive | jobFlagDeleteWhenDone | jobFlagDisabled}
+	job, err := ParseJobFile(testJobData(fixed, [5]string{"notepad.exe"}, nil, nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := job.Definition.Settings
+	if s.Enabled || s.DeleteExpiredTaskAfter != "PT0S" || !s.TimeLimit.IsZero() || s.Priority != 7 || job.Definition.Principal.LogonType != TASK_LOGON_PASSWORD {
+		t.Errorf("settings = %#v, principal = %#v", s, job.Definition.Principal)
+	}
+	if job.Status.String() != "Completed successfully" || !job.MostRecentRun.IsZero() || len(job.Definition.Triggers) > 0 {
+		t.Errorf("job = %+v", job)
+	}
+	warnings := strings.Join(job.Warnings, "\n")
+	for _, want := range []string{"priority class 0x8000", "docked", "desktop", "account"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("warnings do not contain %q:\n%s", want, warnings)
+		}
+	}
+}
+
+func TestParseJobFileErrors(t *testing.T) {
+	valid := testJobData(jobFixedSection{Priority: 0x20}, [5]string{"notepad.exe"}, nil, nil, []jobTrigger{{Type: 1, Specific: [3]uint16{1}}})
+	if _, err := ParseJobFile(valid); err != nil {
+		t.Fatalf("parsing a valid file failed: %v", err)
+	}
+
+	badVersion := bytes.Clone(valid)
+	badVersion[2] = 2
+	badTrigger := func(trigger jobTrigger) []byte {
+		return testJobData(jobFixedSection{}, [5]string{"notepad.exe"}, nil, nil, []jobTrigger{trigger})
+	}
+	triggerStart := len(valid) - 68 - 48
+
+	tests := map[string][]byte{
+		"empty":              nil,
+		"fixed section only": valid[:68],
+		"truncated strings":  valid[:80],
+		"truncated triggers": valid[:triggerStart+10],
+		"file version":       badVersion,
+		"trigger type":       badTrigger(jobTrigger{Type: 9}),
+		"day interval":       badTrigger(jobTrigger{Type: 1}),
+		"week of the month":  badTrigger(jobTrigger{Type: 4, Specific: [3]uint16{6}}),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseJobFile(data); err == nil {
+				t.Error("parsing did not fail")
+			}
+		})
+	}
+}
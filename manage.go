@@ -10,11 +10,9 @@ import (
 	"os/user"
 	"runtime"
 	"strings"
-	"time"
 
 	ole "github.com/go-ole/go-ole"
 	"github.com/go-ole/go-ole/oleutil"
-	"github.com/rickb777/period"
 )
 
 // S_FALSE is returned by CoInitialize if it was already called on this thread.
@@ -111,6 +109,7 @@ func ConnectWithOptions(serverName, domain, username, password string) (TaskServ
 		taskService.Disconnect()
 		return TaskService{}, fmt.Errorf("error connecting to Task Scheduler service: %w", getTaskSchedulerError(err))
 	}
+	taskService.loginDomain, taskService.loginUser, taskService.loginPassword = domain, username, password
 
 	if serverName == "" {
 		serverName, err = os.Hostname()
@@ -203,97 +202,23 @@ func (t *TaskService) GetRunningTasks() (RunningTaskCollection, error) {
 }
 
 // GetRegisteredTasks enumerates the Task Scheduler database for all currently registered tasks.
+// Use RegisteredTasks to enumerate them without keeping every task in memory.
 func (t *TaskService) GetRegisteredTasks() (RegisteredTaskCollection, error) {
-	var (
-		err             error
-		registeredTasks RegisteredTaskCollection
-	)
-
-	success := false
-	defer func() {
-		if !success {
-			registeredTasks.Release()
-		}
-	}()
-
-	// get tasks from root folder
-	res, err := oleutil.CallMethod(t.rootFolderObj, "GetTasks", int(TASK_ENUM_HIDDEN))
-	if err != nil {
-		return nil, fmt.Errorf("error getting tasks of root folder: %w", getTaskSchedulerError(err))
-	}
-	rootTaskCollection := res.ToIDispatch()
-	defer rootTaskCollection.Release()
-	err = oleutil.ForEach(rootTaskCollection, func(v *ole.VARIANT) error {
-		task := v.ToIDispatch()
+	return t.collectRegisteredTasks(`\`, true)
+}
 
-		registeredTask, path, err := parseRegisteredTask(task)
+// collectRegisteredTasks collects the tasks of enumRegisteredTasks into a
+// collection the caller must Release.
+func (t *TaskService) collectRegisteredTasks(path string, recursive bool) (RegisteredTaskCollection, error) {
+	var registeredTasks RegisteredTaskCollection
+	for registeredTask, err := range t.enumRegisteredTasks(path, recursive, false) {
 		if err != nil {
-			return fmt.Errorf("error parsing registered task %s: %w", path, err)
+			registeredTasks.Release()
+			return nil, err
 		}
 		registeredTasks = append(registeredTasks, registeredTask)
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
 	}
 
-	res, err = oleutil.CallMethod(t.rootFolderObj, "GetFolders", 0)
-	if err != nil {
-		return nil, fmt.Errorf("error getting task folders of root folder: %w", getTaskSchedulerError(err))
-	}
-	taskFolderList := res.ToIDispatch()
-	defer taskFolderList.Release()
-
-	// recursively enumerate folders and tasks
-	var enumTaskFolders func(*ole.VARIANT) error
-	enumTaskFolders = func(v *ole.VARIANT) error {
-		taskFolder := v.ToIDispatch()
-		defer taskFolder.Release()
-
-		res, err := oleutil.CallMethod(taskFolder, "GetTasks", int(TASK_ENUM_HIDDEN))
-		if err != nil {
-			return fmt.Errorf("error getting tasks of folder: %w", getTaskSchedulerError(err))
-		}
-		taskCollection := res.ToIDispatch()
-		defer taskCollection.Release()
-
-		err = oleutil.ForEach(taskCollection, func(v *ole.VARIANT) error {
-			task := v.ToIDispatch()
-
-			registeredTask, path, err := parseRegisteredTask(task)
-			if err != nil {
-				return fmt.Errorf("error parsing registered task %s: %w", path, err)
-			}
-			registeredTasks = append(registeredTasks, registeredTask)
-
-			return nil
-		})
-		if err != nil {
-			return err
-		}
-
-		res, err = oleutil.CallMethod(taskFolder, "GetFolders", 0)
-		if err != nil {
-			return fmt.Errorf("error getting subfolders of folder: %w", getTaskSchedulerError(err))
-		}
-		taskFolderList := res.ToIDispatch()
-		defer taskFolderList.Release()
-
-		err = oleutil.ForEach(taskFolderList, enumTaskFolders)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	}
-
-	err = oleutil.ForEach(taskFolderList, enumTaskFolders)
-	if err != nil {
-		return nil, err
-	}
-
-	success = true
 	return registeredTasks, nil
 }
 
@@ -318,50 +243,58 @@ func (t *TaskService) GetRegisteredTask(path string) (RegisteredTask, error) {
 	return task, nil
 }
 
-// GetTasksInFolder returns the registered tasks located directly in the folder at
-// the given path, without recursing into subfolders. Unlike GetTaskFolder it does
-// not build the whole folder tree, so it is cheaper when only one folder's tasks
-// are needed. The caller must Release the returned collection.
-func (t TaskService) GetTasksInFolder(path string) (RegisteredTaskCollection, error) {
+// GetTaskDefinition returns the definition of the registered task at the given
+// path. Together with GetTaskSummaries it lets a caller list many tasks cheaply and
+// parse the definition of only the ones it needs.
+func (t *TaskService) GetTaskDefinition(path string) (Definition, error) {
 	if len(path) == 0 || path[0] != '\\' {
-		return nil, ErrInvalidPath
+		return Definition{}, ErrInvalidPath
 	}
 
-	folderObj := t.rootFolderObj
-	if path != `\` {
-		folder, err := oleutil.CallMethod(t.taskServiceObj, "GetFolder", path)
-		if err != nil {
-			return nil, fmt.Errorf("error getting folder %s: %w", path, getTaskSchedulerError(err))
-		}
-		folderObj = folder.ToIDispatch()
-		defer folderObj.Release()
+	taskObj, err := oleutil.CallMethod(t.rootFolderObj, "GetTask", path)
+	if err != nil {
+		return Definition{}, fmt.Errorf("error getting registered task %s: %w", path, getTaskSchedulerError(err))
 	}
+	task := taskObj.ToIDispatch()
+	defer task.Release()
 
-	res, err := oleutil.CallMethod(folderObj, "GetTasks", int(TASK_ENUM_HIDDEN))
+	h := &oleHelper{}
+	definition := h.getObject(task, "Definition")
+	if h.err != nil {
+		return Definition{}, fmt.Errorf("error getting definition of registered task %s: %w", path, h.err)
+	}
+	defer definition.Release()
+
+	def, err := parseDefinition(definition)
 	if err != nil {
-		return nil, fmt.Errorf("error getting tasks of folder %s: %w", path, getTaskSchedulerError(err))
+		return Definition{}, fmt.Errorf("error parsing definition of registered task %s: %w", path, err)
 	}
-	taskCollection := res.ToIDispatch()
-	defer taskCollection.Release()
 
-	var registeredTasks RegisteredTaskCollection
-	err = oleutil.ForEach(taskCollection, func(v *ole.VARIANT) error {
-		task := v.ToIDispatch()
+	return def, nil
+}
 
-		registeredTask, taskPath, err := parseRegisteredTask(task)
+// GetTaskSummaries returns summaries of the registered tasks in the folder at the
+// given path and, if recursive is set, all of its subfolders. Task definitions are
+// not parsed, which makes it much faster than GetTaskFolder on computers with many
+// tasks; use GetTaskDefinition to fetch the definition of a single task.
+func (t *TaskService) GetTaskSummaries(path string, recursive bool) ([]TaskSummary, error) {
+	var summaries []TaskSummary
+	for summary, err := range t.enumTaskSummaries(path, recursive) {
 		if err != nil {
-			return fmt.Errorf("error parsing registered task %s: %w", taskPath, err)
+			return nil, err
 		}
-		registeredTasks = append(registeredTasks, registeredTask)
-
-		return nil
-	})
-	if err != nil {
-		registeredTasks.Release()
-		return nil, err
+		summaries = append(summaries, summary)
 	}
 
-	return registeredTasks, nil
+	return summaries, nil
+}
+
+// GetTasksInFolder returns the registered tasks located directly in the folder at
+// the given path, without recursing into subfolders. Unlike GetTaskFolder it does
+// not build the whole folder tree, so it is cheaper when only one folder's tasks
+// are needed. The caller must Release the returned collection.
+func (t TaskService) GetTasksInFolder(path string) (RegisteredTaskCollection, error) {
+	return t.collectRegisteredTasks(path, false)
 }
 
 // GetTaskFolders enumerates the Task Schedule database for all task folders and currently
@@ -497,40 +430,46 @@ func (t TaskService) GetTaskFolder(path string) (TaskFolder, error) {
 	return topFolder, nil
 }
 
-// DefaultDefinition returns a task definition pre-populated with the Task
-// Scheduler default settings. Unlike TaskService.NewTaskDefinition it does not
-// require a connection and does not set RegistrationInfo.Author (which is derived
-// from the connected user), so callers can build definitions without a connected
-// TaskService or when supplying their own RegistrationInfo.
-func DefaultDefinition() Definition {
-	var newDef Definition
-
-	newDef.Principal.LogonType = TASK_LOGON_INTERACTIVE_TOKEN
-	newDef.Principal.RunLevel = TASK_RUNLEVEL_LUA
-
-	newDef.RegistrationInfo.Date = time.Now()
-
-	newDef.Settings.AllowDemandStart = true
-	newDef.Settings.AllowHardTerminate = true
-	newDef.Settings.Compatibility = TASK_COMPATIBILITY_V2
-	newDef.Settings.DontStartOnBatteries = true
-	newDef.Settings.Enabled = true
-	newDef.Settings.Hidden = false
-	newDef.Settings.IdleSettings.IdleDuration = period.NewHMS(0, 10, 0) // PT10M
-	newDef.Settings.IdleSettings.WaitTimeout = period.NewHMS(1, 0, 0)   // PT1H
-	newDef.Settings.MultipleInstances = TASK_INSTANCES_IGNORE_NEW
-	newDef.Settings.Priority = 7
-	newDef.Settings.RestartCount = 0
-	newDef.Settings.RestartOnIdle = false
-	newDef.Settings.RunOnlyIfIdle = false
-	newDef.Settings.RunOnlyIfNetworkAvailable = false
-	newDef.Settings.StartWhenAvailable = false
-	newDef.Settings.StopIfGoingOnBatteries = true
-	newDef.Settings.StopOnIdleEnd = true
-	newDef.Settings.TimeLimit = period.NewHMS(72, 0, 0) // PT72H
-	newDef.Settings.WakeToRun = false
+// GetSubFolders returns the paths of the immediate subfolders of the folder at
+// path, without enumerating their tasks.
+func (t *TaskService) GetSubFolders(path string) ([]string, error) {
+	if len(path) == 0 || path[0] != '\\' {
+		return nil, ErrInvalidPath
+	}
 
-	return newDef
+	res, err := oleutil.CallMethod(t.taskServiceObj, "GetFolder", path)
+	if err != nil {
+		return nil, fmt.Errorf("error getting folder %s: %w", path, getTaskSchedulerError(err))
+	}
+	folderObj := res.ToIDispatch()
+	defer folderObj.Release()
+
+	res, err = oleutil.CallMethod(folderObj, "GetFolders", 0)
+	if err != nil {
+		return nil, fmt.Errorf("error getting subfolders of folder %s: %w", path, getTaskSchedulerError(err))
+	}
+	folderList := res.ToIDispatch()
+	defer folderList.Release()
+
+	var paths []string
+	err = oleutil.ForEach(folderList, func(v *ole.VARIANT) error {
+		subFolderObj := v.ToIDispatch()
+		defer subFolderObj.Release()
+
+		h := &oleHelper{}
+		subFolderPath := h.getString(subFolderObj, "Path")
+		if h.err != nil {
+			return h.err
+		}
+		paths = append(paths, subFolderPath)
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error enumerating subfolders of folder %s: %w", path, err)
+	}
+
+	return paths, nil
 }
 
 // NewTaskDefinition returns a new task definition that can be used to register a
@@ -586,7 +525,7 @@ func (t *TaskService) CreateTaskEx(path string, newTaskDef Definition, username,
 		}
 	}
 
-	newTaskObj, err := t.modifyTask(path, newTaskDef, username, password, logonType, TASK_CREATE)
+	newTaskObj, err := t.modifyTask(path, newTaskDef, username, password, logonType, TASK_CREATE, "")
 	if err != nil {
 		return RegisteredTask{}, false, fmt.Errorf("error creating registered task %s: %w", path, err)
 	}
@@ -614,7 +553,7 @@ func (t *TaskService) UpdateTaskEx(path string, newTaskDef Definition, username,
 		return RegisteredTask{}, err
 	}
 
-	newTaskObj, err := t.modifyTask(path, newTaskDef, username, password, logonType, TASK_UPDATE)
+	newTaskObj, err := t.modifyTask(path, newTaskDef, username, password, logonType, TASK_UPDATE, "")
 	if err != nil {
 		return RegisteredTask{}, fmt.Errorf("error updating %s task: %w", path, err)
 	}
@@ -628,7 +567,7 @@ func (t *TaskService) UpdateTaskEx(path string, newTaskDef Definition, username,
 	return newTask, nil
 }
 
-func (t *TaskService) modifyTask(path string, newTaskDef Definition, username, password string, logonType TaskLogonType, flags TaskCreationFlags) (*ole.IDispatch, error) {
+func (t *TaskService) modifyTask(path string, newTaskDef Definition, username, password string, logonType TaskLogonType, flags TaskCreationFlags, sddl string) (*ole.IDispatch, error) {
 	// set default UserID if UserID and GroupID both aren't set
 	if newTaskDef.Principal.UserID == "" && newTaskDef.Principal.GroupID == "" {
 		newTaskDef.Principal.UserID = t.connectedDomain + `\` + t.connectedUser
@@ -646,7 +585,7 @@ func (t *TaskService) modifyTask(path string, newTaskDef Definition, username, p
 		return nil, fmt.Errorf("error filling ITaskDefinition: %w", err)
 	}
 
-	newTaskObj, err := oleutil.CallMethod(t.rootFolderObj, "RegisterTaskDefinition", path, newTaskDefObj, int(flags), username, password, int(logonType), "")
+	newTaskObj, err := oleutil.CallMethod(t.rootFolderObj, "RegisterTaskDefinition", path, newTaskDefObj, int(flags), username, password, int(logonType), sddl)
 	if err != nil {
 		return nil, fmt.Errorf("error registering task: %w", getTaskSchedulerError(err))
 	}
@@ -654,6 +593,57 @@ func (t *TaskService) modifyTask(path string, newTaskDef Definition, username, p
 	return newTaskObj.ToIDispatch(), nil
 }
 
+// ValidateTask checks whether a task definition would be accepted by the connected
+// Task Scheduler service, without registering anything. See ValidateTaskEx.
+func (t *TaskService) ValidateTask(path string, newTaskDef Definition) error {
+	return t.ValidateTaskEx(path, newTaskDef, "", "", newTaskDef.Principal.LogonType)
+}
+
+// ValidateTaskEx checks whether a task definition would be accepted by the connected
+// Task Scheduler service, without registering anything. The definition is first
+// checked locally, the same way CreateTaskEx and UpdateTaskEx check it, and is then
+// registered with TASK_VALIDATE_ONLY so the service validates it, including the
+// principal and credentials. The returned error is mapped the same way as the errors
+// of CreateTaskEx.
+func (t *TaskService) ValidateTaskEx(path string, newTaskDef Definition, username, password string, logonType TaskLogonType) error {
+	if len(path) == 0 || path[0] != '\\' {
+		return ErrInvalidPath
+	} else if err := validateDefinition(newTaskDef); err != nil {
+		return err
+	}
+
+	taskObj, err := t.modifyTask(path, newTaskDef, username, password, logonType, TASK_VALIDATE_ONLY, "")
+	if err != nil {
+		return fmt.Errorf("error validating task %s: %w", path, err)
+	}
+	if taskObj != nil {
+		taskObj.Release()
+	}
+
+	return nil
+}
+
+// CreateFolder creates a task folder on the connected computer, along with any
+// missing parent folders. The sddl parameter is the security descriptor of the
+// folder, and may be empty to inherit the security of its parent. If the folder
+// already exists, the returned error matches errors.Is(err, os.ErrExist).
+// https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nf-taskschd-itaskfolder-createfolder
+func (t *TaskService) CreateFolder(path, sddl string) error {
+	if len(path) < 2 || path[0] != '\\' {
+		return ErrInvalidPath
+	}
+
+	res, err := oleutil.CallMethod(t.rootFolderObj, "CreateFolder", path, sddl)
+	if err != nil {
+		return fmt.Errorf("error creating folder %s: %w", path, getTaskSchedulerError(err))
+	}
+	if folderObj := res.ToIDispatch(); folderObj != nil {
+		folderObj.Release()
+	}
+
+	return nil
+}
+
 // DeleteFolder removes a task folder from the connected computer. If the deleteRecursively parameter
 // is set to true, all tasks and subfolders will be removed recursively. If it's set to false, DeleteFolder
 // will return true if the folder was empty and deleted successfully, and false otherwise.
@@ -686,7 +676,7 @@ func (t *TaskService) DeleteFolder(path string, deleteRecursively bool) (bool, e
 		return false, nil
 	}
 
-	res, err = oleutil.CallMethod(taskFolderObj, "GetFolders", int(TASK_ENUM_HIDDEN))
+	res, err = oleutil.CallMethod(taskFolderObj, "GetFolders", 0)
 	if err != nil {
 		return false, fmt.Errorf("error getting the subfolders: %w", getTaskSchedulerError(err))
 	}
@@ -738,7 +728,7 @@ func (t *TaskService) DeleteFolder(path string, deleteRecursively bool) (bool, e
 				return err
 			}
 
-			res, err = oleutil.CallMethod(folderObj, "GetFolders", int(TASK_ENUM_HIDDEN))
+			res, err = oleutil.CallMethod(folderObj, "GetFolders", 0)
 			if err != nil {
 				return fmt.Errorf("error getting subfolders: %w", getTaskSchedulerError(err))
 			}
@@ -5,6 +5,8 @@ package taskmaster
 
 import (
 	"errors"
+	"os"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -341,6 +343,99 @@ func TestGetRegisteredTasks(t *testing.T) {
 	}
 }
 
+func TestRegisteredTasksIterator(t *testing.T) {
+	taskService := setupTaskService(t)
+	createTestTask(taskService)
+
+	def := taskService.NewTaskDefinition()
+	def.AddAction(ExecAction{Path: "cmd.exe"})
+	for _, name := range []string{"A", "B", "C"} {
+		if _, _, err := taskService.CreateTask(testTaskPath("Iter", name), def, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var paths []string
+	for task, err := range taskService.RegisteredTasks(testTaskRoot) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, task.Path)
+	}
+	want := []string{testTaskPath("TestTask"), testTaskPath("Iter", "A"), testTaskPath("Iter", "B"), testTaskPath("Iter", "C")}
+	if !slices.Equal(paths, want) {
+		t.Fatalf("want tasks %v, got %v", want, paths)
+	}
+
+	var count int
+	for _, err := range taskService.RegisteredTasks(testTaskRoot) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		count++
+		if count == 2 {
+			break
+		}
+	}
+	if count != 2 {
+		t.Fatalf("expected to stop after 2 tasks, got %d", count)
+	}
+
+	for _, err := range taskService.RegisteredTasks("bad path") {
+		if err != ErrInvalidPath {
+			t.Fatalf("want ErrInvalidPath, got %v", err)
+		}
+	}
+}
+
+func TestGetTaskSummaries(t *testing.T) {
+	taskService := setupTaskService(t)
+	createTestTask(taskService)
+
+	def := taskService.NewTaskDefinition()
+	def.AddAction(ExecAction{Path: "cmd.exe"})
+	def.Settings.Enabled = false
+	if _, _, err := taskService.CreateTask(testTaskPath("Summary", "Disabled"), def, true); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries, err := taskService.GetTaskSummaries(testTaskRoot, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, summary := range summaries {
+		paths = append(paths, summary.Path)
+	}
+	want := []string{testTaskPath("TestTask"), testTaskPath("Summary", "Disabled")}
+	if !slices.Equal(paths, want) {
+		t.Fatalf("want tasks %v, got %v", want, paths)
+	}
+	if summaries[1].Name != "Disabled" || summaries[1].Enabled || summaries[1].State != TASK_STATE_DISABLED {
+		t.Fatalf("unexpected summary %+v", summaries[1])
+	}
+
+	summaries, err = taskService.GetTaskSummaries(testTaskRoot, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || summaries[0].Path != testTaskPath("TestTask") {
+		t.Fatalf("want only %s, got %+v", testTaskPath("TestTask"), summaries)
+	}
+
+	taskDef, err := taskService.GetTaskDefinition(summaries[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(taskDef.Actions) != 1 || taskDef.Actions[0].(ExecAction).Args != "/c timeout $(Arg0)" {
+		t.Fatalf("unexpected actions %+v", taskDef.Actions)
+	}
+
+	if _, err := taskService.GetTaskDefinition("bad path"); err != ErrInvalidPath {
+		t.Fatalf("want ErrInvalidPath, got %v", err)
+	}
+}
+
 func TestGetTaskFolders(t *testing.T) {
 	taskService := setupTaskService(t)
 
@@ -456,6 +551,31 @@ func TestDeleteFolder(t *testing.T) {
 	}
 }
 
+func TestCreateFolder(t *testing.T) {
+	taskService := setupTaskService(t)
+
+	if err := taskService.CreateFolder(testTaskPath("a", "b"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := taskService.CreateFolder(testTaskPath("a"), ""); !errors.Is(err, os.ErrExist) {
+		t.Errorf("creating an existing folder returned %v, want os.ErrExist", err)
+	}
+	if err := taskService.CreateFolder(testTaskPath("c"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	folders, err := taskService.GetSubFolders(testTaskRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{testTaskPath("a"), testTaskPath("c")}; !slices.Equal(folders, want) {
+		t.Errorf("got subfolders %q, want %q", folders, want)
+	}
+	if _, err := taskService.GetSubFolders(testTaskPath("missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("getting the subfolders of a missing folder returned %v, want os.ErrNotExist", err)
+	}
+}
+
 func TestConnectWithOptionsInvalidTarget(t *testing.T) {
 	_, err := ConnectWithOptions("invalid-taskmaster-host", "", "", "")
 	if err == nil {
@@ -542,3 +662,90 @@ func TestPrincipalSettingsRoundTrip(t *testing.T) {
 		})
 	}
 }
+
+func TestPrincipal2RoundTrip(t *testing.T) {
+	taskService := setupTaskService(t)
+
+	def := taskService.NewTaskDefinition()
+	def.AddAction(ExecAction{Path: "cmd.exe", Args: "/c exit 0"})
+	def.Principal.UserID = "SYSTEM"
+	def.Principal.LogonType = TASK_LOGON_SERVICE_ACCOUNT
+	def.Principal.ProcessTokenSidType = TASK_PROCESSTOKENSID_UNRESTRICTED
+	def.Principal.RequiredPrivileges = []Privilege{SE_CHANGE_NOTIFY_NAME, SE_BACKUP_NAME}
+	def.Settings.Compatibility = TASK_COMPATIBILITY_V2_1
+
+	path := testTaskPath("Principal2")
+	if _, _, err := taskService.CreateTask(path, def, true); err != nil {
+		if strings.Contains(err.Error(), "Access is denied") {
+			t.Skipf("skipping Principal2 test due to insufficient privileges: %v", err)
+		}
+		t.Fatal(err)
+	}
+
+	withRegisteredTask(t, taskService, path, func(task RegisteredTask) {
+		got := task.Definition.Principal
+		if got.ProcessTokenSidType != TASK_PROCESSTOKENSID_UNRESTRICTED {
+			t.Fatalf("expected ProcessTokenSidType %s, got %s", TASK_PROCESSTOKENSID_UNRESTRICTED, got.ProcessTokenSidType)
+		}
+		if len(got.RequiredPrivileges) != 2 {
+			t.Fatalf("expected 2 required privileges, got %v", got.RequiredPrivileges)
+		}
+		for _, want := range def.Principal.RequiredPrivileges {
+			if !slices.Contains(got.RequiredPrivileges, want) {
+				t.Fatalf("expected required privilege %s in %v", want, got.RequiredPrivileges)
+			}
+		}
+	})
+}
+
+func TestTaskSettings3RoundTrip(t *testing.T) {
+	taskService := setupTaskService(t)
+
+	def := taskService.NewTaskDefinition()
+	def.AddAction(ExecAction{Path: "cmd.exe", Args: "/c exit 0"})
+	def.Settings.Compatibility = TASK_COMPATIBILITY_V2_4
+	def.Settings.DisallowStartOnRemoteAppSession = true
+	def.Settings.MaintenanceSettings = MaintenanceSettings{
+		Period:    period.NewYMD(0, 0, 1),
+		Deadline:  period.NewYMD(0, 0, 7),
+		Exclusive: true,
+	}
+
+	path := testTaskPath("Settings3")
+	if _, _, err := taskService.CreateTask(path, def, true); err != nil {
+		t.Fatal(err)
+	}
+
+	withRegisteredTask(t, taskService, path, func(task RegisteredTask) {
+		got := task.Definition.Settings
+		if !got.DisallowStartOnRemoteAppSession {
+			t.Fatal("expected DisallowStartOnRemoteAppSession to be set")
+		}
+		if got.MaintenanceSettings != def.Settings.MaintenanceSettings {
+			t.Fatalf("expected MaintenanceSettings %+v, got %+v", def.Settings.MaintenanceSettings, got.MaintenanceSettings)
+		}
+	})
+}
+
+func TestValidateTask(t *testing.T) {
+	taskService := setupTaskService(t)
+
+	def := taskService.NewTaskDefinition()
+	def.AddAction(ExecAction{Path: "calc.exe"})
+	if err := taskService.ValidateTask(testTaskPath("Validated"), def); err != nil {
+		t.Fatal(err)
+	}
+	if taskService.registeredTaskExist(testTaskPath("Validated")) {
+		t.Fatal("validating a task should not register it")
+	}
+
+	if err := taskService.ValidateTask(testTaskPath("Validated"), Definition{}); !errors.Is(err, ErrNoActions) {
+		t.Fatalf("want ErrNoActions, got %v", err)
+	}
+
+	def.Principal.UserID = "taskmaster-no-such-user"
+	def.Principal.LogonType = TASK_LOGON_S4U
+	if err := taskService.ValidateTask(testTaskPath("Validated"), def); err == nil {
+		t.Fatal("expected the service to reject an unknown principal")
+	}
+}
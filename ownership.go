@@ -0,0 +1,216 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ownershipMarkerPrefix prefixes the ownership marker stored in RegistrationInfo.Source.
+const ownershipMarkerPrefix = "taskmaster:"
+
+// Ownership identifies the manager that registered a task and the spec it was
+// registered from. It is stamped into RegistrationInfo.Source so a reconciler can
+// tell its own tasks apart from tasks created by other tools or by Windows.
+type Ownership struct {
+	ManagerID string // the identifier of the manager that owns the task
+	SpecHash  string // the SpecHash of the definition the task was registered from
+}
+
+// String returns the ownership marker as it is stored in RegistrationInfo.Source.
+func (o Ownership) String() string {
+	return ownershipMarkerPrefix + "manager=" + o.ManagerID + ";spec=" + o.SpecHash
+}
+
+// SpecHash returns a stable hash of the parts of a definition that describe what the
+// task does. Fields that Task Scheduler or taskmaster set on their own (the ownership
+// marker, RegistrationInfo.Author and Date, and XMLText) are excluded, so the hash of
+// a spec does not change between deployments. Note that StartBoundary is part of the
+// spec; a definition built with time.Now() will hash differently every time.
+func SpecHash(def Definition) string {
+	def.RegistrationInfo.Author = ""
+	def.RegistrationInfo.Date = time.Time{}
+	def.RegistrationInfo.Source = ""
+	def.XMLText = ""
+
+	return hashDefinition(def)
+}
+
+// SetOwnership stamps the definition as owned by managerID, recording the SpecHash
+// of the definition. Any existing RegistrationInfo.Source is overwritten.
+func (d *Definition) SetOwnership(managerID string) error {
+	if managerID == "" || strings.ContainsAny(managerID, ";=") {
+		return ErrInvalidManagerID
+	}
+
+	d.RegistrationInfo.Source = Ownership{
+		ManagerID: managerID,
+		SpecHash:  SpecHash(*d),
+	}.String()
+
+	return nil
+}
+
+// GetOwnership returns the ownership marker of the definition. If the definition
+// was not stamped by SetOwnership, GetOwnership returns false.
+func (d Definition) GetOwnership() (Ownership, bool) {
+	marker, ok := strings.CutPrefix(d.RegistrationInfo.Source, ownershipMarkerPrefix)
+	if !ok {
+		return Ownership{}, false
+	}
+
+	var o Ownership
+	for _, field := range strings.Split(marker, ";") {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "manager":
+			o.ManagerID = value
+		case "spec":
+			o.SpecHash = value
+		}
+	}
+	if o.ManagerID == "" {
+		return Ownership{}, false
+	}
+
+	return o, true
+}
+
+// IsOwnedBy reports whether the registered task was stamped as owned by managerID.
+func (r RegisteredTask) IsOwnedBy(managerID string) bool {
+	o, ok := r.Definition.GetOwnership()
+	return ok && o.ManagerID == managerID
+}
+
+// CreateOwnedTask stamps newTaskDef as owned by managerID and registers it at path.
+// If a task owned by managerID already exists at path and was registered from the
+// same spec, it is left untouched and CreateOwnedTask returns false. A task at path
+// that is not owned by managerID is only replaced if force is true; otherwise
+// ErrTaskNotOwned is returned.
+func (t *TaskService) CreateOwnedTask(path string, newTaskDef Definition, managerID string, force bool) (RegisteredTask, bool, error) {
+	if len(path) == 0 || path[0] != '\\' {
+		return RegisteredTask{}, false, ErrInvalidPath
+	}
+	if err := newTaskDef.SetOwnership(managerID); err != nil {
+		return RegisteredTask{}, false, err
+	}
+
+	if t.registeredTaskExist(path) {
+		existing, err := t.GetRegisteredTask(path)
+		if err != nil {
+			return RegisteredTask{}, false, err
+		}
+		o, owned := existing.Definition.GetOwnership()
+		owned = owned && o.ManagerID == managerID
+		if !owned && !force {
+			existing.Release()
+			return RegisteredTask{}, false, fmt.Errorf("error creating registered task %s: %w", path, ErrTaskNotOwned)
+		}
+		if owned && o.SpecHash == SpecHash(newTaskDef) {
+			return existing, false, nil
+		}
+		existing.Release()
+	}
+
+	return t.CreateTask(path, newTaskDef, true)
+}
+
+// GetOwnedTasks returns the registered tasks in the folder at path, and all of its
+// subfolders, that are owned by managerID. The caller must Release the returned
+// collection.
+func (t *TaskService) GetOwnedTasks(path, managerID string) (RegisteredTaskCollection, error) {
+	folder, err := t.GetTaskFolder(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var owned RegisteredTaskCollection
+	walkTaskFolder(&folder, func(task RegisteredTask) {
+		if task.IsOwnedBy(managerID) {
+			owned = append(owned, task)
+		} else {
+			task.Release()
+		}
+	})
+
+	return owned, nil
+}
+
+// GetOrphanedTasks returns the tasks under the folder at path that are owned by
+// managerID but whose path is not in specPaths, i.e. tasks whose spec has been
+// removed. Paths are compared case-insensitively, as Task Scheduler does. The
+// caller must Release the returned collection.
+func (t *TaskService) GetOrphanedTasks(path, managerID string, specPaths []string) (RegisteredTaskCollection, error) {
+	owned, err := t.GetOwnedTasks(path, managerID)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(specPaths))
+	for _, specPath := range specPaths {
+		wanted[strings.ToLower(specPath)] = true
+	}
+
+	var orphans RegisteredTaskCollection
+	for _, task := range owned {
+		if wanted[strings.ToLower(task.Path)] {
+			task.Release()
+			continue
+		}
+		orphans = append(orphans, task)
+	}
+
+	return orphans, nil
+}
+
+// PruneOrphanedTasks deletes the tasks returned by GetOrphanedTasks and returns the
+// paths of the tasks that were deleted. Tasks that are not owned by managerID are
+// never deleted.
+func (t *TaskService) PruneOrphanedTasks(path, managerID string, specPaths []string) ([]string, error) {
+	orphans, err := t.GetOrphanedTasks(path, managerID, specPaths)
+	if err != nil {
+		return nil, err
+	}
+	defer orphans.Release()
+
+	var pruned []string
+	for _, task := range orphans {
+		if err := t.DeleteTask(task.Path); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, task.Path)
+	}
+
+	return pruned, nil
+}
+
+// DeleteOwnedTask removes the registered task at path if it is owned by managerID.
+// A task that is not owned by managerID is only removed if force is true; otherwise
+// ErrTaskNotOwned is returned.
+func (t *TaskService) DeleteOwnedTask(path, managerID string, force bool) error {
+	task, err := t.GetRegisteredTask(path)
+	if err != nil {
+		return err
+	}
+	owned := task.IsOwnedBy(managerID)
+	task.Release()
+
+	if !owned && !force {
+		return fmt.Errorf("error deleting task %s: %w", path, ErrTaskNotOwned)
+	}
+
+	return t.DeleteTask(path)
+}
+
+// walkTaskFolder calls fn for every registered task in folder and its subfolders.
+func walkTaskFolder(folder *TaskFolder, fn func(RegisteredTask)) {
+	for _, task := range folder.RegisteredTasks {
+		fn(task)
+	}
+	for _, subFolder := range folder.SubFolders {
+		walkTaskFolder(subFolder, fn)
+	}
+}
@@ -0,0 +1,127 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOwnershipMarker(t *testing.T) {
+	def := DefaultDefinition()
+	def.AddAction(ExecAction{Path: "cmd.exe"})
+
+	if _, ok := def.GetOwnership(); ok {
+		t.Fatal("unstamped definition should not have an owner")
+	}
+
+	if err := def.SetOwnership("deployer"); err != nil {
+		t.Fatal(err)
+	}
+	o, ok := def.GetOwnership()
+	if !ok {
+		t.Fatal("expected stamped definition to have an owner")
+	}
+	if o.ManagerID != "deployer" {
+		t.Fatalf("expected manager ID deployer, got %s", o.ManagerID)
+	}
+	if o.SpecHash != SpecHash(def) {
+		t.Fatalf("expected spec hash %s, got %s", SpecHash(def), o.SpecHash)
+	}
+
+	for _, managerID := range []string{"", "a;b", "a=b"} {
+		if err := def.SetOwnership(managerID); !errors.Is(err, ErrInvalidManagerID) {
+			t.Fatalf("manager ID %q: want ErrInvalidManagerID, got %v", managerID, err)
+		}
+	}
+
+	def.RegistrationInfo.Source = "some other tool"
+	if _, ok := def.GetOwnership(); ok {
+		t.Fatal("foreign Source should not be treated as an ownership marker")
+	}
+}
+
+func TestSpecHash(t *testing.T) {
+	def := DefaultDefinition()
+	def.AddAction(ExecAction{Path: "cmd.exe"})
+	hash := SpecHash(def)
+
+	// fields that are not part of the spec must not change the hash
+	same := def
+	same.RegistrationInfo.Author = "someone"
+	same.RegistrationInfo.Date = time.Now().Add(time.Hour)
+	same.XMLText = "<Task/>"
+	if err := same.SetOwnership("deployer"); err != nil {
+		t.Fatal(err)
+	}
+	if got := SpecHash(same); got != hash {
+		t.Fatalf("expected unchanged hash %s, got %s", hash, got)
+	}
+
+	changed := def
+	changed.Actions = []Action{ExecAction{Path: "calc.exe"}}
+	if SpecHash(changed) == hash {
+		t.Fatal("changing an action should change the spec hash")
+	}
+}
+
+func TestOwnedTasks(t *testing.T) {
+	taskService := setupTaskService(t)
+
+	newDef := func() Definition {
+		def := taskService.NewTaskDefinition()
+		def.AddAction(ExecAction{Path: "calc.exe"})
+		return def
+	}
+
+	for _, name := range []string{"Kept", "Orphan"} {
+		if _, created, err := taskService.CreateOwnedTask(testTaskPath("Owned", name), newDef(), "deployer", false); err != nil {
+			t.Fatal(err)
+		} else if !created {
+			t.Fatalf("expected %s to be created", name)
+		}
+	}
+	if _, _, err := taskService.CreateTask(testTaskPath("Owned", "Foreign"), newDef(), true); err != nil {
+		t.Fatal(err)
+	}
+
+	// registering the same spec again is a no-op
+	task, created, err := taskService.CreateOwnedTask(testTaskPath("Owned", "Kept"), newDef(), "deployer", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.Release()
+	if created {
+		t.Fatal("unchanged spec should not be re-registered")
+	}
+
+	// unowned tasks are refused unless forced
+	if _, _, err := taskService.CreateOwnedTask(testTaskPath("Owned", "Foreign"), newDef(), "deployer", false); !errors.Is(err, ErrTaskNotOwned) {
+		t.Fatalf("want ErrTaskNotOwned, got %v", err)
+	}
+	if err := taskService.DeleteOwnedTask(testTaskPath("Owned", "Foreign"), "deployer", false); !errors.Is(err, ErrTaskNotOwned) {
+		t.Fatalf("want ErrTaskNotOwned, got %v", err)
+	}
+
+	owned, err := taskService.GetOwnedTasks(testTaskRoot, "deployer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owned.Release()
+	if len(owned) != 2 {
+		t.Fatalf("expected 2 owned tasks, got %d", len(owned))
+	}
+
+	pruned, err := taskService.PruneOrphanedTasks(testTaskRoot, "deployer", []string{testTaskPath("Owned", "Kept")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0] != testTaskPath("Owned", "Orphan") {
+		t.Fatalf("expected only %s to be pruned, got %v", testTaskPath("Owned", "Orphan"), pruned)
+	}
+	if !taskService.registeredTaskExist(testTaskPath("Owned", "Foreign")) {
+		t.Fatal("unowned task should not have been pruned")
+	}
+}
@@ -72,35 +72,76 @@ func parseRegisteredTask(task *ole.IDispatch) (RegisteredTask, string, error) {
 		}
 	}()
 
-	h := &oleHelper{}
-
-	name := h.getString(task, "Name")
-	path := h.getString(task, "Path")
-	enabled := h.getBool(task, "Enabled")
-	state := TaskState(h.getInt(task, "State"))
-	missedRuns := uint(h.getInt(task, "NumberOfMissedRuns"))
-	nextRunTime := variantTimeOrZero(h.getVariant(task, "NextRunTime"))
-	lastRunTime := variantTimeOrZero(h.getVariant(task, "LastRunTime"))
-	lastTaskResult := TaskResult(h.getInt(task, "LastTaskResult"))
-	if h.err != nil {
-		return RegisteredTask{}, path, h.err
+	summary, err := parseTaskSummary(task)
+	if err != nil {
+		return RegisteredTask{}, summary.Path, err
 	}
 
+	h := &oleHelper{}
 	definition := h.getObject(task, "Definition")
 	if h.err != nil {
-		return RegisteredTask{}, path, h.err
+		return RegisteredTask{}, summary.Path, h.err
 	}
 	defer definition.Release()
 
+	taskDef, err := parseDefinition(definition)
+	if err != nil {
+		return RegisteredTask{}, summary.Path, err
+	}
+
+	registeredTask := RegisteredTask{
+		taskObj:        task,
+		Name:           summary.Name,
+		Path:           summary.Path,
+		Definition:     taskDef,
+		Enabled:        summary.Enabled,
+		State:          summary.State,
+		MissedRuns:     summary.MissedRuns,
+		NextRunTime:    summary.NextRunTime,
+		LastRunTime:    summary.LastRunTime,
+		LastTaskResult: summary.LastTaskResult,
+	}
+
+	// Ownership of task now belongs to registeredTask; don't release it.
+	success = true
+	return registeredTask, summary.Path, nil
+}
+
+// parseTaskSummary parses the top-level properties of an IRegisteredTask object,
+// without its definition.
+func parseTaskSummary(task *ole.IDispatch) (TaskSummary, error) {
+	h := &oleHelper{}
+
+	summary := TaskSummary{
+		Name:           h.getString(task, "Name"),
+		Path:           h.getString(task, "Path"),
+		Enabled:        h.getBool(task, "Enabled"),
+		State:          TaskState(h.getInt(task, "State")),
+		MissedRuns:     uint(h.getInt(task, "NumberOfMissedRuns")),
+		NextRunTime:    variantTimeOrZero(h.getVariant(task, "NextRunTime")),
+		LastRunTime:    variantTimeOrZero(h.getVariant(task, "LastRunTime")),
+		LastTaskResult: TaskResult(h.getInt(task, "LastTaskResult")),
+	}
+	if h.err != nil {
+		return TaskSummary{Path: summary.Path}, h.err
+	}
+
+	return summary, nil
+}
+
+// parseDefinition parses an ITaskDefinition object.
+func parseDefinition(definition *ole.IDispatch) (Definition, error) {
+	h := &oleHelper{}
+
 	actions := h.getObject(definition, "Actions")
 	if h.err != nil {
-		return RegisteredTask{}, path, h.err
+		return Definition{}, h.err
 	}
 	defer actions.Release()
 
 	context := h.getString(actions, "Context")
 	if h.err != nil {
-		return RegisteredTask{}, path, h.err
+		return Definition{}, h.err
 	}
 
 	var taskActions []Action
@@ -118,47 +159,47 @@ func parseRegisteredTask(task *ole.IDispatch) (RegisteredTask, string, error) {
 		return nil
 	})
 	if err != nil {
-		return RegisteredTask{}, path, fmt.Errorf("error parsing IAction object: %w", err)
+		return Definition{}, fmt.Errorf("error parsing IAction object: %w", err)
 	}
 
 	principalObj := h.getObject(definition, "Principal")
 	if h.err != nil {
-		return RegisteredTask{}, path, h.err
+		return Definition{}, h.err
 	}
 	defer principalObj.Release()
 	taskPrincipal, err := parsePrincipal(principalObj)
 	if err != nil {
-		return RegisteredTask{}, path, fmt.Errorf("error parsing IPrincipal object: %w", err)
+		return Definition{}, fmt.Errorf("error parsing IPrincipal object: %w", err)
 	}
 
 	xmlText := h.getString(definition, "XmlText")
 	if h.err != nil {
-		return RegisteredTask{}, path, h.err
+		return Definition{}, h.err
 	}
 
 	regInfo := h.getObject(definition, "RegistrationInfo")
 	if h.err != nil {
-		return RegisteredTask{}, path, h.err
+		return Definition{}, h.err
 	}
 	defer regInfo.Release()
 	registrationInfo, err := parseRegistrationInfo(regInfo)
 	if err != nil {
-		return RegisteredTask{}, path, fmt.Errorf("error parsing IRegistrationInfo object: %w", err)
+		return Definition{}, fmt.Errorf("error parsing IRegistrationInfo object: %w", err)
 	}
 
 	settings := h.getObject(definition, "Settings")
 	if h.err != nil {
-		return RegisteredTask{}, path, h.err
+		return Definition{}, h.err
 	}
 	defer settings.Release()
 	taskSettings, err := parseTaskSettings(settings)
 	if err != nil {
-		return RegisteredTask{}, path, fmt.Errorf("error parsing ITaskSettings object: %w", err)
+		return Definition{}, fmt.Errorf("error parsing ITaskSettings object: %w", err)
 	}
 
 	triggers := h.getObject(definition, "Triggers")
 	if h.err != nil {
-		return RegisteredTask{}, path, h.err
+		return Definition{}, h.err
 	}
 	defer triggers.Release()
 
@@ -176,10 +217,10 @@ func parseRegisteredTask(task *ole.IDispatch) (RegisteredTask, string, error) {
 		return nil
 	})
 	if err != nil {
-		return RegisteredTask{}, path, fmt.Errorf("error parsing ITrigger object: %w", err)
+		return Definition{}, fmt.Errorf("error parsing ITrigger object: %w", err)
 	}
 
-	taskDef := Definition{
+	return Definition{
 		Actions:          taskActions,
 		Context:          context,
 		Principal:        taskPrincipal,
@@ -187,24 +228,7 @@ func parseRegisteredTask(task *ole.IDispatch) (RegisteredTask, string, error) {
 		RegistrationInfo: *registrationInfo,
 		Triggers:         taskTriggers,
 		XMLText:          xmlText,
-	}
-
-	registeredTask := RegisteredTask{
-		taskObj:        task,
-		Name:           name,
-		Path:           path,
-		Definition:     taskDef,
-		Enabled:        enabled,
-		State:          state,
-		MissedRuns:     missedRuns,
-		NextRunTime:    nextRunTime,
-		LastRunTime:    lastRunTime,
-		LastTaskResult: lastTaskResult,
-	}
-
-	// Ownership of task now belongs to registeredTask; don't release it.
-	success = true
-	return registeredTask, path, nil
+	}, nil
 }
 
 func parseTaskAction(action *ole.IDispatch) (Action, error) {
@@ -265,13 +289,37 @@ func parsePrincipal(principleObj *ole.IDispatch) (Principal, error) {
 		return Principal{}, h.err
 	}
 
+	// IPrincipal2 is not available before Windows 7
+	processTokenSidType := TASK_PROCESSTOKENSID_DEFAULT
+	var requiredPrivileges []Privilege
+	if principal2Obj, err := principleObj.QueryInterface(ole.NewGUID("{248919ae-e345-4a6d-8aeb-e0d3165c904e}")); err == nil {
+		defer principal2Obj.Release()
+
+		processTokenSidType = processTokenSidTypeFromCOM(h.getInt(principal2Obj, "ProcessTokenSidType"))
+		privilegeCount := int(h.getInt(principal2Obj, "RequiredPrivilegeCount"))
+		if h.err != nil {
+			return Principal{}, h.err
+		}
+
+		for i := 0; i < privilegeCount; i++ {
+			privilege, err := oleutil.GetProperty(principal2Obj, "RequiredPrivilege", i)
+			if err != nil {
+				return Principal{}, fmt.Errorf("error getting required privilege %d: %w", i, err)
+			}
+			requiredPrivileges = append(requiredPrivileges, Privilege(privilege.ToString()))
+			privilege.Clear()
+		}
+	}
+
 	principle := Principal{
-		Name:      name,
-		GroupID:   groupID,
-		ID:        id,
-		LogonType: logonType,
-		RunLevel:  runLevel,
-		UserID:    userID,
+		Name:                name,
+		GroupID:             groupID,
+		ID:                  id,
+		LogonType:           logonType,
+		RunLevel:            runLevel,
+		UserID:              userID,
+		ProcessTokenSidType: processTokenSidType,
+		RequiredPrivileges:  requiredPrivileges,
 	}
 
 	return principle, nil
@@ -377,6 +425,46 @@ func parseTaskSettings(settings *ole.IDispatch) (*TaskSettings, error) {
 		return nil, fmt.Errorf("error parsing RestartInterval field: %w", err)
 	}
 
+	// ITaskSettings2 is not available before Windows 7, and ITaskSettings3 not before
+	// Windows 8
+	var disallowStartOnRemoteAppSession, useUnifiedSchedulingEngine bool
+	if settings2, err := settings.QueryInterface(ole.NewGUID("{2c05c3f0-6eed-4c05-a15f-ed7d7a98a369}")); err == nil {
+		defer settings2.Release()
+
+		disallowStartOnRemoteAppSession = h.getBool(settings2, "DisallowStartOnRemoteAppSession")
+		useUnifiedSchedulingEngine = h.getBool(settings2, "UseUnifiedSchedulingEngine")
+		if h.err != nil {
+			return nil, h.err
+		}
+	}
+	var maintenanceSettings MaintenanceSettings
+	var volatile bool
+	if settings3, err := settings.QueryInterface(ole.NewGUID("{0ad9d0d7-0c7f-4ebb-9a5f-d1c648dca528}")); err == nil {
+		defer settings3.Release()
+
+		volatile = h.getBool(settings3, "Volatile")
+		maintenance := h.getVariant(settings3, "MaintenanceSettings")
+		if h.err != nil {
+			return nil, h.err
+		}
+		defer maintenance.Clear()
+
+		if maintenanceObj := maintenance.ToIDispatch(); maintenanceObj != nil {
+			periodStr := h.getString(maintenanceObj, "Period")
+			deadlineStr := h.getString(maintenanceObj, "Deadline")
+			maintenanceSettings.Exclusive = h.getBool(maintenanceObj, "Exclusive")
+			if h.err != nil {
+				return nil, h.err
+			}
+			if maintenanceSettings.Period, err = StringToPeriod(periodStr); err != nil {
+				return nil, fmt.Errorf("error parsing MaintenanceSettings.Period field: %w", err)
+			}
+			if maintenanceSettings.Deadline, err = StringToPeriod(deadlineStr); err != nil {
+				return nil, fmt.Errorf("error parsing MaintenanceSettings.Deadline field: %w", err)
+			}
+		}
+	}
+
 	idleTaskSettings := IdleSettings{
 		IdleDuration:  idleDuration,
 		RestartOnIdle: restartOnIdle,
@@ -409,6 +497,11 @@ func parseTaskSettings(settings *ole.IDispatch) (*TaskSettings, error) {
 		StartWhenAvailable:        startWhenAvailable,
 		StopIfGoingOnBatteries:    stopIfGoingOnBatteries,
 		WakeToRun:                 wakeToRun,
+
+		DisallowStartOnRemoteAppSession: disallowStartOnRemoteAppSession,
+		UseUnifiedSchedulingEngine:      useUnifiedSchedulingEngine,
+		Volatile:                        volatile,
+		MaintenanceSettings:             maintenanceSettings,
 	}
 
 	return taskSettings, nil
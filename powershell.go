@@ -0,0 +1,439 @@
+package taskmaster
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rickb777/period"
+)
+
+// ExportPowerShell returns a PowerShell script that registers def as the task at
+// path with the cmdlets of the ScheduledTasks module: New-ScheduledTaskAction,
+// New-ScheduledTaskTrigger, New-ScheduledTaskPrincipal, New-ScheduledTaskSettingsSet
+// and Register-ScheduledTask. The task is registered with -Force, so running the
+// script again replaces it with the same definition.
+//
+// The fields of def are set one by one, as parameters of the cmdlets or as
+// properties of the objects they return, so the script reads like a hand-written
+// one. Idle, registration, session state change and event triggers, which
+// New-ScheduledTaskTrigger has no parameters for, are created as instances of
+// their CIM classes. A definition that uses what the cmdlets cannot express, such
+// as monthly triggers, value queries of event triggers, COM handler actions or
+// task data, is registered from its XML with -Xml instead, and the script says
+// why. If the principal logs on with a password, the script has a mandatory
+// -Credential parameter for it.
+//
+// ExportPowerShell fails if path is not the full path of a task, if def has no
+// actions, or if def has a CustomTrigger.
+func ExportPowerShell(path string, def Definition) (string, error) {
+	i := strings.LastIndex(path, `\`)
+	if len(path) == 0 || path[0] != '\\' || i == len(path)-1 {
+		return "", fmt.Errorf("invalid task path %q", path)
+	}
+	if len(def.Actions) == 0 {
+		return "", errors.New("the definition has no actions")
+	}
+
+	// the statements that build the task are written first, as they decide
+	// whether the script needs the New-TaskInstance helper
+	body := &psWriter{}
+	register := "Register-ScheduledTask -TaskName $taskName -TaskPath $taskPath"
+	if reason := psUnsupported(def); reason != "" {
+		xmlText, err := taskXML(def)
+		if err != nil {
+			return "", err
+		}
+		body.printf("\n# The ScheduledTasks cmdlets cannot express %s,\n# so the task is registered from its XML.\n", reason)
+		body.printf("$xml = @'\n%s'@\n", xmlText)
+		register += " -Xml $xml"
+	} else {
+		body.cmdlets(def)
+		register += " -InputObject $task"
+	}
+
+	w := &psWriter{}
+	w.printf("# Registers the scheduled task %s, replacing it if it exists.\n", strings.ReplaceAll(path, "\n", " "))
+	w.printf("#Requires -Modules ScheduledTasks\n")
+	needsPassword := def.Principal.LogonType == TASK_LOGON_PASSWORD || def.Principal.LogonType == TASK_LOGON_INTERACTIVE_TOKEN_OR_PASSWORD
+	if needsPassword {
+		w.printf("param(\n    [Parameter(Mandatory)]\n    [pscredential]$Credential\n)\n")
+		register += " -User $Credential.UserName -Password $Credential.GetNetworkCredential().Password"
+	}
+	w.printf("\n$ErrorActionPreference = 'Stop'\n")
+	w.printf("$taskPath = %s\n", psQuote(path[:i+1]))
+	w.printf("$taskName = %s\n", psQuote(path[i+1:]))
+	if body.instances {
+		w.printf("\n# creates a client-side instance of a CIM class of the ScheduledTasks module\n")
+		w.printf("function New-TaskInstance([string]$ClassName, [hashtable]$Property = @{}) {\n")
+		w.printf("    $class = Get-CimClass -ClassName $ClassName -Namespace Root/Microsoft/Windows/TaskScheduler\n")
+		w.printf("    New-CimInstance -CimClass $class -Property $Property -ClientOnly\n")
+		w.printf("}\n")
+	}
+	w.WriteString(body.String())
+	w.printf("\n%s -Force | Out-Null\n", register)
+
+	return w.String(), nil
+}
+
+// psUnsupported returns what in def the ScheduledTasks cmdlets cannot express, or
+// "" if they can express all of it.
+func psUnsupported(def Definition) string {
+	switch {
+	case def.Settings.Compatibility > TASK_COMPATIBILITY_V2_2:
+		return "compatibility " + def.Settings.Compatibility.String()
+	case def.Data != "":
+		return "task data"
+	case def.Context != "" && def.Context != def.Principal.ID:
+		return "an action context other than the principal"
+	case def.Principal.UserID != "" && def.Principal.GroupID != "":
+		return "a principal with both a user and a group"
+	case def.Principal.UserID == "" && def.Principal.GroupID == "" && !psDefaultPrincipal(def.Principal):
+		return "a principal without a user or group"
+	}
+
+	for _, action := range def.Actions {
+		if _, ok := action.(ExecAction); !ok {
+			return fmt.Sprintf("%s actions", action.GetType())
+		}
+	}
+
+	for _, trigger := range def.Triggers {
+		switch t := trigger.(type) {
+		case MonthlyTrigger, MonthlyDOWTrigger, CustomTrigger:
+			return fmt.Sprintf("%s triggers", strings.ToLower(t.GetType().String()))
+		case EventTrigger:
+			if len(t.ValueQueries) > 0 {
+				return "value queries of event triggers"
+			}
+		case WeeklyTrigger:
+			if t.DaysOfWeek&AllDays == 0 {
+				return "weekly triggers without days of the week"
+			}
+		}
+		switch trigger.GetType() {
+		case TASK_TRIGGER_TIME, TASK_TRIGGER_DAILY, TASK_TRIGGER_WEEKLY:
+			if trigger.GetStartBoundary().IsZero() {
+				return fmt.Sprintf("%s triggers without a start boundary", strings.ToLower(trigger.GetType().String()))
+			}
+		}
+	}
+
+	return ""
+}
+
+// psDefaultPrincipal reports whether p, which has no user or group, can be left
+// to Register-ScheduledTask, which then registers the task to run as the current
+// user when they are logged on.
+func psDefaultPrincipal(p Principal) bool {
+	return p.Name == "" && p.ID == "" && (p.LogonType == TASK_LOGON_NONE || p.LogonType == TASK_LOGON_INTERACTIVE_TOKEN) &&
+		p.RunLevel == TASK_RUNLEVEL_LUA && p.ProcessTokenSidType == TASK_PROCESSTOKENSID_DEFAULT && len(p.RequiredPrivileges) == 0
+}
+
+// psWriter writes a PowerShell script.
+type psWriter struct {
+	strings.Builder
+	instances bool // whether New-TaskInstance is used
+}
+
+func (w *psWriter) printf(format string, args ...any) {
+	fmt.Fprintf(w, format, args...)
+}
+
+// set assigns value to a property of the object in variable, such as
+// $trigger.Delay. It writes nothing if value is "".
+func (w *psWriter) set(variable, property, value string) {
+	if value != "" {
+		w.printf("%s.%s = %s\n", variable, property, value)
+	}
+}
+
+// newInstance writes an assignment of a new instance of a CIM class of the
+// ScheduledTasks module to variable. properties are PowerShell hashtable entries.
+func (w *psWriter) newInstance(variable, class string, properties ...string) {
+	w.instances = true
+	w.printf("%s = New-TaskInstance %s @{%s}\n", variable, class, strings.Join(properties, "; "))
+}
+
+// cmdlets writes the statements that build the task in $task with the
+// ScheduledTasks cmdlets.
+func (w *psWriter) cmdlets(def Definition) {
+	w.printf("\n$actions = @(\n")
+	for _, action := range def.Actions {
+		a := action.(ExecAction)
+		cmd := "New-ScheduledTaskAction -Execute " + psQuote(a.Path)
+		if a.ID != "" {
+			cmd += " -Id " + psQuote(a.ID)
+		}
+		if a.Args != "" {
+			cmd += " -Argument " + psQuote(a.Args)
+		}
+		if a.WorkingDir != "" {
+			cmd += " -WorkingDirectory " + psQuote(a.WorkingDir)
+		}
+		w.printf("    %s\n", cmd)
+	}
+	w.printf(")\n")
+
+	if len(def.Triggers) > 0 {
+		w.printf("\n$triggers = @()\n")
+		for _, trigger := range def.Triggers {
+			w.trigger(trigger)
+			w.printf("$triggers += $trigger\n")
+		}
+	}
+
+	principal := def.Principal
+	if principal.UserID != "" || principal.GroupID != "" {
+		var cmd string
+		if principal.GroupID != "" {
+			cmd = "New-ScheduledTaskPrincipal -GroupId " + psQuote(principal.GroupID)
+		} else {
+			cmd = "New-ScheduledTaskPrincipal -UserId " + psQuote(principal.UserID) + " -LogonType " + psLogonType(principal.LogonType)
+		}
+		if principal.ID != "" {
+			cmd += " -Id " + psQuote(principal.ID)
+		}
+		if principal.RunLevel == TASK_RUNLEVEL_HIGHEST {
+			cmd += " -RunLevel Highest"
+		} else {
+			cmd += " -RunLevel Limited"
+		}
+		if principal.ProcessTokenSidType != TASK_PROCESSTOKENSID_DEFAULT {
+			cmd += " -ProcessTokenSidType " + principal.ProcessTokenSidType.String()
+		}
+		if len(principal.RequiredPrivileges) > 0 {
+			privileges := make([]string, len(principal.RequiredPrivileges))
+			for i, privilege := range principal.RequiredPrivileges {
+				privileges[i] = psQuote(string(privilege))
+			}
+			cmd += " -RequiredPrivilege " + strings.Join(privileges, ", ")
+		}
+		w.printf("\n$principal = %s\n", cmd)
+		w.set("$principal", "DisplayName", psOptional(principal.Name))
+	}
+
+	w.settings(def.Settings)
+
+	cmd := "New-ScheduledTask -Action $actions -Settings $settings"
+	if len(def.Triggers) > 0 {
+		cmd += " -Trigger $triggers"
+	}
+	if principal.UserID != "" || principal.GroupID != "" {
+		cmd += " -Principal $principal"
+	}
+	if def.RegistrationInfo.Description != "" {
+		cmd += " -Description " + psQuote(def.RegistrationInfo.Description)
+	}
+	w.printf("\n$task = %s\n", cmd)
+	info := def.RegistrationInfo
+	w.set("$task", "Author", psOptional(info.Author))
+	w.set("$task", "Date", psOptional(TimeToTaskDate(info.Date)))
+	w.set("$task", "Documentation", psOptional(info.Documentation))
+	w.set("$task", "SecurityDescriptor", psOptional(info.SecurityDescriptor))
+	w.set("$task", "Source", psOptional(info.Source))
+	w.set("$task", "URI", psOptional(info.URI))
+	w.set("$task", "Version", psOptional(info.Version))
+}
+
+// trigger writes the statements that create trigger in $trigger.
+func (w *psWriter) trigger(trigger Trigger) {
+	at := psQuote(TimeToTaskDate(trigger.GetStartBoundary()))
+	var randomDelay, delay period.Period
+	w.printf("\n")
+	switch t := trigger.(type) {
+	case TimeTrigger:
+		w.printf("$trigger = New-ScheduledTaskTrigger -Once -At %s\n", at)
+		randomDelay = t.RandomDelay
+	case DailyTrigger:
+		w.printf("$trigger = New-ScheduledTaskTrigger -Daily -At %s -DaysInterval %d\n", at, t.DayInterval)
+		randomDelay = t.RandomDelay
+	case WeeklyTrigger:
+		var days []string
+		for _, day := range setValues(uint64(t.DaysOfWeek & AllDays)) {
+			days = append(days, xmlDayNames[day])
+		}
+		w.printf("$trigger = New-ScheduledTaskTrigger -Weekly -At %s -DaysOfWeek %s -WeeksInterval %d\n", at, strings.Join(days, ", "), t.WeekInterval)
+		randomDelay = t.RandomDelay
+	case BootTrigger:
+		w.printf("$trigger = New-ScheduledTaskTrigger -AtStartup\n")
+		delay = t.Delay
+	case LogonTrigger:
+		if t.UserID != "" {
+			w.printf("$trigger = New-ScheduledTaskTrigger -AtLogOn -User %s\n", psQuote(t.UserID))
+		} else {
+			w.printf("$trigger = New-ScheduledTaskTrigger -AtLogOn\n")
+		}
+		delay = t.Delay
+	case IdleTrigger:
+		w.newInstance("$trigger", "MSFT_TaskIdleTrigger")
+	case RegistrationTrigger:
+		w.newInstance("$trigger", "MSFT_TaskRegistrationTrigger")
+		delay = t.Delay
+	case SessionStateChangeTrigger:
+		properties := []string{fmt.Sprintf("StateChange = %d", t.StateChange)}
+		if t.UserId != "" {
+			properties = append(properties, "UserId = "+psQuote(t.UserId))
+		}
+		w.newInstance("$trigger", "MSFT_TaskSessionStateChangeTrigger", properties...)
+		delay = t.Delay
+	case EventTrigger:
+		w.newInstance("$trigger", "MSFT_TaskEventTrigger", "Subscription = "+psQuote(t.Subscription))
+		delay = t.Delay
+	}
+
+	switch trigger.GetType() {
+	case TASK_TRIGGER_TIME, TASK_TRIGGER_DAILY, TASK_TRIGGER_WEEKLY:
+		// set by -At
+	default:
+		w.set("$trigger", "StartBoundary", psOptional(TimeToTaskDate(trigger.GetStartBoundary())))
+	}
+	w.set("$trigger", "EndBoundary", psOptional(TimeToTaskDate(trigger.GetEndBoundary())))
+	w.set("$trigger", "ExecutionTimeLimit", psPeriod(trigger.GetExecutionTimeLimit()))
+	w.set("$trigger", "Delay", psPeriod(delay))
+	w.set("$trigger", "RandomDelay", psPeriod(randomDelay))
+	w.set("$trigger", "Id", psOptional(trigger.GetID()))
+	if !trigger.GetEnabled() {
+		w.set("$trigger", "Enabled", "$false")
+	}
+	if interval := trigger.GetRepetitionInterval(); !interval.IsZero() {
+		properties := []string{"Interval = " + psQuote(interval.String())}
+		if duration := trigger.GetRepetitionDuration(); !duration.IsZero() {
+			properties = append(properties, "Duration = "+psQuote(duration.String()))
+		}
+		properties = append(properties, "StopAtDurationEnd = "+psBool(trigger.GetStopAtDurationEnd()))
+		w.newInstance("$trigger.Repetition", "MSFT_TaskRepetitionPattern", properties...)
+	}
+}
+
+// settings writes the statements that create the settings in $settings. The
+// properties of the settings are all set, so the script does not depend on the
+// defaults of New-ScheduledTaskSettingsSet.
+func (w *psWriter) settings(s TaskSettings) {
+	cmd := "New-ScheduledTaskSettingsSet -Compatibility " + psCompatibility(s.Compatibility)
+	if m := s.MaintenanceSettings; m != (MaintenanceSettings{}) {
+		cmd += " -MaintenancePeriod " + psTimeSpan(m.Period) + " -MaintenanceDeadline " + psTimeSpan(m.Deadline)
+		if m.Exclusive {
+			cmd += " -MaintenanceExclusive"
+		}
+	}
+	w.printf("\n$settings = %s\n", cmd)
+	// StopExisting is missing from the enumeration of the -MultipleInstances parameter
+	w.printf("$settings.CimInstanceProperties['MultipleInstances'].Value = %d\n", s.MultipleInstances)
+	w.set("$settings", "AllowDemandStart", psBool(s.AllowDemandStart))
+	w.set("$settings", "AllowHardTerminate", psBool(s.AllowHardTerminate))
+	w.set("$settings", "DeleteExpiredTaskAfter", psOptional(s.DeleteExpiredTaskAfter))
+	w.set("$settings", "DisallowStartIfOnBatteries", psBool(s.DontStartOnBatteries))
+	w.set("$settings", "Enabled", psBool(s.Enabled))
+	w.set("$settings", "ExecutionTimeLimit", psQuote(xmlDuration(s.TimeLimit)))
+	w.set("$settings", "Hidden", psBool(s.Hidden))
+	w.set("$settings.IdleSettings", "IdleDuration", psQuote(xmlDuration(s.IdleSettings.IdleDuration)))
+	w.set("$settings.IdleSettings", "RestartOnIdle", psBool(s.IdleSettings.RestartOnIdle))
+	w.set("$settings.IdleSettings", "StopOnIdleEnd", psBool(s.IdleSettings.StopOnIdleEnd))
+	w.set("$settings.IdleSettings", "WaitTimeout", psQuote(xmlDuration(s.IdleSettings.WaitTimeout)))
+	w.set("$settings", "Priority", strconv.FormatUint(uint64(s.Priority), 10))
+	w.set("$settings", "RestartCount", strconv.FormatUint(uint64(s.RestartCount), 10))
+	w.set("$settings", "RestartInterval", psPeriod(s.RestartInterval))
+	w.set("$settings", "RunOnlyIfIdle", psBool(s.RunOnlyIfIdle))
+	w.set("$settings", "RunOnlyIfNetworkAvailable", psBool(s.RunOnlyIfNetworkAvailable))
+	w.set("$settings", "StartWhenAvailable", psBool(s.StartWhenAvailable))
+	w.set("$settings", "StopIfGoingOnBatteries", psBool(s.StopIfGoingOnBatteries))
+	w.set("$settings", "WakeToRun", psBool(s.WakeToRun))
+	w.set("$settings.NetworkSettings", "Id", psOptional(s.NetworkSettings.ID))
+	w.set("$settings.NetworkSettings", "Name", psOptional(s.NetworkSettings.Name))
+	// these properties only exist on newer versions of Windows
+	if s.DisallowStartOnRemoteAppSession {
+		w.set("$settings", "DisallowStartOnRemoteAppSession", "$true")
+	}
+	if s.UseUnifiedSchedulingEngine {
+		w.set("$settings", "UseUnifiedSchedulingEngine", "$true")
+	}
+	if s.Volatile {
+		w.set("$settings", "Volatile", "$true")
+	}
+}
+
+// psQuote returns s as a single-quoted PowerShell string. PowerShell also ends
+// single-quoted strings at typographic single quotes, so those are doubled too.
+func psQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'', '‘', '’', '‚', '‛':
+			b.WriteRune(r)
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('\'')
+
+	return b.String()
+}
+
+// psOptional quotes s, or returns "" if s is empty.
+func psOptional(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	return psQuote(s)
+}
+
+// psPeriod returns p as a quoted ISO 8601 duration, the form the CIM properties
+// of the ScheduledTasks module take, or "" if p is zero.
+func psPeriod(p period.Period) string {
+	return psOptional(PeriodToString(p))
+}
+
+// psTimeSpan returns an expression that converts p to a TimeSpan, for the cmdlet
+// parameters that take one.
+func psTimeSpan(p period.Period) string {
+	return "([System.Xml.XmlConvert]::ToTimeSpan(" + psQuote(xmlDuration(p)) + "))"
+}
+
+func psBool(b bool) string {
+	if b {
+		return "$true"
+	}
+
+	return "$false"
+}
+
+// psLogonType returns the name of a logon type in the enumeration of the
+// -LogonType parameter of New-ScheduledTaskPrincipal.
+func psLogonType(t TaskLogonType) string {
+	switch t {
+	case TASK_LOGON_PASSWORD:
+		return "Password"
+	case TASK_LOGON_S4U:
+		return "S4U"
+	case TASK_LOGON_INTERACTIVE_TOKEN:
+		return "Interactive"
+	case TASK_LOGON_GROUP:
+		return "Group"
+	case TASK_LOGON_SERVICE_ACCOUNT:
+		return "ServiceAccount"
+	case TASK_LOGON_INTERACTIVE_TOKEN_OR_PASSWORD:
+		return "InteractiveOrPassword"
+	default:
+		return "None"
+	}
+}
+
+// psCompatibility returns the name of a compatibility in the enumeration of the
+// -Compatibility parameter of New-ScheduledTaskSettingsSet.
+func psCompatibility(c TaskCompatibility) string {
+	switch c {
+	case TASK_COMPATIBILITY_AT:
+		return "At"
+	case TASK_COMPATIBILITY_V1:
+		return "V1"
+	case TASK_COMPATIBILITY_V2_1:
+		return "Win7"
+	case TASK_COMPATIBILITY_V2_2:
+		return "Win8"
+	default:
+		return "Vista"
+	}
+}
@@ -0,0 +1,294 @@
+package taskmaster
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/period"
+)
+
+func TestExportPowerShell(t *testing.T) {
+	def := testFullDefinition()
+	var triggers []Trigger
+	for _, trigger := range def.Triggers {
+		switch t := trigger.(type) {
+		case MonthlyTrigger, MonthlyDOWTrigger:
+		case EventTrigger:
+			t.ValueQueries = nil
+			triggers = append(triggers, t)
+		default:
+			triggers = append(triggers, t)
+		}
+	}
+	def.Triggers = triggers
+
+	script, err := ExportPowerShell(`\Vendor\Nightly`, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# Registers the scheduled task \\Vendor\\Nightly, replacing it if it exists.\n#Requires -Modules ScheduledTasks\n\n$ErrorActionPreference = 'Stop'\n",
+		"$taskPath = '\\Vendor\\'\n$taskName = 'Nightly'\n",
+		"function New-TaskInstance(",
+		`    New-ScheduledTaskAction -Execute 'C:\Tools\backup.exe' -Id 'backup' -Argument '--target "D:\Backups" --tag 100%' -WorkingDirectory 'C:\Tools'` + "\n",
+		"$trigger = New-ScheduledTaskTrigger -Once -At '2024-05-01T03:00:00'\n$trigger.EndBoundary = '2024-05-01T23:00:00'\n$trigger.ExecutionTimeLimit = 'PT2H'\n$trigger.RandomDelay = 'PT15M'\n$trigger.Id = 'repeating'\n" +
+			"$trigger.Repetition = New-TaskInstance MSFT_TaskRepetitionPattern @{Interval = 'PT30M'; Duration = 'PT6H'; StopAtDurationEnd = $true}\n$triggers += $trigger\n",
+		"$trigger = New-ScheduledTaskTrigger -Daily -At '2024-05-01T03:00:00' -DaysInterval 2\n",
+		"$trigger = New-ScheduledTaskTrigger -Weekly -At '2024-05-01T03:00:00' -DaysOfWeek Monday, Friday -WeeksInterval 2\n",
+		"$trigger = New-ScheduledTaskTrigger -AtStartup\n$trigger.Delay = 'PT5M'\n$triggers += $trigger\n",
+		"$trigger = New-ScheduledTaskTrigger -AtLogOn -User 'CONTOSO\\alice'\n$trigger.Delay = 'PT1M'\n$trigger.Id = 'logon'\n$trigger.Enabled = $false\n",
+		"$trigger = New-TaskInstance MSFT_TaskIdleTrigger @{}\n",
+		"$trigger = New-TaskInstance MSFT_TaskRegistrationTrigger @{}\n$trigger.Delay = 'PT30S'\n",
+		"$trigger = New-TaskInstance MSFT_TaskSessionStateChangeTrigger @{StateChange = 8; UserId = 'CONTOSO\\alice'}\n$trigger.Delay = 'PT2M'\n",
+		"$trigger = New-TaskInstance MSFT_TaskEventTrigger @{Subscription = '<QueryList>",
+		"$trigger.StartBoundary = '2024-05-01T00:00:00'\n$trigger.Delay = 'PT10S'\n",
+		"$principal = New-ScheduledTaskPrincipal -UserId 'CONTOSO\\svc-backup' -LogonType S4U -Id 'Author' -RunLevel Highest -ProcessTokenSidType Unrestricted -RequiredPrivilege 'SeBackupPrivilege', 'SeRestorePrivilege'\n$principal.DisplayName = 'Backup service'\n",
+		"$settings = New-ScheduledTaskSettingsSet -Compatibility Win8 -MaintenancePeriod ([System.Xml.XmlConvert]::ToTimeSpan('PT24H')) -MaintenanceDeadline ([System.Xml.XmlConvert]::ToTimeSpan('PT48H')) -MaintenanceExclusive\n",
+		"$settings.CimInstanceProperties['MultipleInstances'].Value = 3\n",
+		"$settings.DeleteExpiredTaskAfter = 'P30D'\n$settings.DisallowStartIfOnBatteries = $false\n$settings.Enabled = $true\n$settings.ExecutionTimeLimit = 'PT0S'\n",
+		"$settings.RestartCount = 3\n$settings.RestartInterval = 'PT10M'\n",
+		"$settings.NetworkSettings.Name = 'Office'\n$settings.DisallowStartOnRemoteAppSession = $true\n$settings.UseUnifiedSchedulingEngine = $true\n$settings.Volatile = $true\n",
+		"$task = New-ScheduledTask -Action $actions -Settings $settings -Trigger $triggers -Principal $principal -Description 'Nightly & weekly ''jobs''\nsecond line'\n$task.Author = 'CONTOSO\\admin'\n$task.Date = '2024-05-01T01:00:00'\n",
+		"\nRegister-ScheduledTask -TaskName $taskName -TaskPath $taskPath -InputObject $task -Force | Out-Null\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script does not contain %q:\n%s", want, script)
+		}
+	}
+	for _, unwanted := range []string{"-Xml", "param(", "$Credential"} {
+		if strings.Contains(script, unwanted) {
+			t.Errorf("script contains %q:\n%s", unwanted, script)
+		}
+	}
+	testPowerShellSyntax(t, script)
+}
+
+func TestExportPowerShellXML(t *testing.T) {
+	def := testFullDefinition()
+	def.Principal.LogonType = TASK_LOGON_PASSWORD
+
+	script, err := ExportPowerShell(`\Nightly`, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"param(\n    [Parameter(Mandatory)]\n    [pscredential]$Credential\n)\n",
+		"$taskPath = '\\'\n$taskName = 'Nightly'\n",
+		"# The ScheduledTasks cmdlets cannot express monthly triggers,\n# so the task is registered from its XML.\n$xml = @'\n<?xml",
+		"\nRegister-ScheduledTask -TaskName $taskName -TaskPath $taskPath -Xml $xml -User $Credential.UserName -Password $Credential.GetNetworkCredential().Password -Force | Out-Null\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script does not contain %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "New-TaskInstance") {
+		t.Errorf("script defines New-TaskInstance without using it:\n%s", script)
+	}
+
+	_, xmlText, _ := strings.Cut(script, "$xml = @'\n")
+	xmlText, _, _ = strings.Cut(xmlText, "'@\n")
+	parsed, err := ParseTaskXML(xmlText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := DiffDefinitions(def, parsed); len(changes) != 0 {
+		t.Errorf("the XML of the script changes %v", changes)
+	}
+	testPowerShellSyntax(t, script)
+
+	reasons := map[string]func(*Definition){
+		"value queries of event triggers": func(def *Definition) {
+			def.Triggers = []Trigger{EventTrigger{TaskTrigger: TaskTrigger{Enabled: true}, ValueQueries: map[string]string{"ID": "Event/System/EventID"}}}
+		},
+		"COM Handler actions": func(def *Definition) {
+			def.AddAction(ComHandlerAction{ClassID: "{F0001111-0000-0000-0000-0000FEEDACDC}"})
+		},
+		"task data":          func(def *Definition) { def.Data = "payload" },
+		"compatibility v2.3": func(def *Definition) { def.Settings.Compatibility = TASK_COMPATIBILITY_V2_3 },
+		"an action context other than the principal": func(def *Definition) { def.Context = "Other" },
+		"time triggers without a start boundary":     func(def *Definition) { def.Triggers = []Trigger{TimeTrigger{}} },
+	}
+	for reason, change := range reasons {
+		def := DefaultDefinition()
+		def.AddAction(ExecAction{Path: "cmd.exe"})
+		change(&def)
+		script, err := ExportPowerShell(`\Nightly`, def)
+		if err != nil {
+			t.Errorf("%s: %v", reason, err)
+		} else if !strings.Contains(script, "cannot express "+reason+",\n") {
+			t.Errorf("script does not give the reason %q:\n%s", reason, script)
+		}
+	}
+}
+
+func TestExportPowerShellErrors(t *testing.T) {
+	def := DefaultDefinition()
+	def.AddAction(ExecAction{Path: "cmd.exe"})
+	for _, path := range []string{"", "Nightly", `\Vendor\`} {
+		if _, err := ExportPowerShell(path, def); err == nil {
+			t.Errorf("exporting to path %q did not fail", path)
+		}
+	}
+
+	if _, err := ExportPowerShell(`\Nightly`, DefaultDefinition()); err == nil {
+		t.Error("exporting a definition without actions did not fail")
+	}
+
+	def.AddTrigger(CustomTrigger{})
+	if _, err := ExportPowerShell(`\Nightly`, def); err == nil {
+		t.Error("exporting a custom trigger did not fail")
+	}
+}
+
+// TestExportPowerShellFields changes every field of a definition, its actions and
+// its triggers in turn and checks that the script changes too, so that fields
+// added to the types cannot be left out of the script unnoticed.
+func TestExportPowerShellFields(t *testing.T) {
+	full := testFullDefinition()
+	repeating := full.Triggers[0].(TimeTrigger).TaskTrigger
+
+	def := full
+	def.Triggers = nil
+	def.Actions = []Action{full.Actions[0]}
+	export := func() string {
+		script, err := ExportPowerShell(`\Vendor\Nightly`, def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return script
+	}
+	changeFields(t, "Definition", reflect.ValueOf(&def).Elem(), export, "Actions", "Triggers", "XMLText")
+
+	for _, action := range []Action{full.Actions[0], ComHandlerAction{ClassID: "{F0001111-0000-0000-0000-0000FEEDACDC}"}} {
+		v := reflect.New(reflect.TypeOf(action)).Elem()
+		v.Set(reflect.ValueOf(action))
+		def.Actions = nil
+		export := func() string {
+			def.Actions = []Action{v.Interface().(Action)}
+			return export()
+		}
+		changeFields(t, v.Type().Name(), v, export)
+	}
+
+	def.Actions = []Action{full.Actions[0]}
+	for _, trigger := range full.Triggers {
+		v := reflect.New(reflect.TypeOf(trigger)).Elem()
+		v.Set(reflect.ValueOf(trigger))
+		v.FieldByName("TaskTrigger").Set(reflect.ValueOf(repeating))
+		export := func() string {
+			def.Triggers = []Trigger{v.Interface().(Trigger)}
+			return export()
+		}
+		changeFields(t, v.Type().Name(), v, export)
+	}
+}
+
+// changeFields changes each field of the struct v in turn, other than those in
+// skip, and reports the fields whose changes do not change the output of export.
+func changeFields(t *testing.T, name string, v reflect.Value, export func() string, skip ...string) {
+	t.Helper()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if slices.Contains(skip, field.Name) {
+			continue
+		}
+		fieldName := name + "." + field.Name
+		fv := v.Field(i)
+		switch fv.Interface().(type) {
+		case time.Time, period.Period:
+		default:
+			if fv.Kind() == reflect.Struct {
+				changeFields(t, fieldName, fv, export)
+				continue
+			}
+		}
+
+		old := reflect.New(fv.Type()).Elem()
+		old.Set(fv)
+		before := export()
+		if !changeValue(fv) {
+			t.Errorf("%s: cannot change a %s", fieldName, fv.Type())
+			continue
+		}
+		if export() == before {
+			t.Errorf("%s is not exported", fieldName)
+		}
+		fv.Set(old)
+	}
+}
+
+// changeValue sets v to a different valid value of its type.
+func changeValue(v reflect.Value) bool {
+	switch x := v.Addr().Interface().(type) {
+	case *time.Time:
+		*x = x.Add(time.Hour)
+	case *period.Period:
+		if *x == period.NewHMS(0, 7, 0) {
+			*x = period.NewHMS(0, 8, 0)
+		} else {
+			*x = period.NewHMS(0, 7, 0)
+		}
+	case *map[string]string:
+		*x = map[string]string{"Changed": "Event/System/Level"}
+	case *[]Privilege:
+		*x = append(*x, SE_DEBUG_NAME)
+	default:
+		switch v.Kind() {
+		case reflect.Bool:
+			v.SetBool(!v.Bool())
+		case reflect.String:
+			v.SetString(v.String() + "x")
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			// stepping down keeps enumerations in range
+			if v.Uint() > 0 {
+				v.SetUint(v.Uint() - 1)
+			} else {
+				v.SetUint(1)
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestPsQuote(t *testing.T) {
+	for s, want := range map[string]string{
+		"":                   "''",
+		`C:\Program Files`:   `'C:\Program Files'`,
+		"it's $HOME":         `'it''s $HOME'`,
+		"‘quoted’ ‚low‛":     "'‘‘quoted’’ ‚‚low‛‛'",
+		"two\nlines`n \"x\"": "'two\nlines`n \"x\"'",
+	} {
+		if got := psQuote(s); got != want {
+			t.Errorf("psQuote(%q) = %s, want %s", s, got, want)
+		}
+	}
+}
+
+// testPowerShellSyntax parses script with PowerShell, if it is installed, and
+// reports its syntax errors.
+func testPowerShellSyntax(t *testing.T, script string) {
+	t.Helper()
+	pwsh, err := exec.LookPath("pwsh")
+	if err != nil {
+		t.Log("pwsh is not installed; the syntax of the script is not checked")
+		return
+	}
+
+	file := filepath.Join(t.TempDir(), "register.ps1")
+	if err := os.WriteFile(file, []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	check := `$errors = $null; [System.Management.Automation.Language.Parser]::ParseFile($args[0], [ref]$null, [ref]$errors) | Out-Null; $errors | ForEach-Object { $_.ToString() }; exit $errors.Count`
+	if out, err := exec.Command(pwsh, "-NoProfile", "-NonInteractive", "-Command", check, file).CombinedOutput(); err != nil {
+		t.Errorf("syntax errors: %v\n%s\n%s", err, out, script)
+	}
+}
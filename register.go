@@ -0,0 +1,186 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RegisterOption configures RegisterTask.
+type RegisterOption func(*registerOptions)
+
+type registerOptions struct {
+	flags      TaskCreationFlags
+	username   string
+	password   string
+	logonType  TaskLogonType
+	sddl       string
+	folderSDDL string
+}
+
+// WithCreationFlags adds flags to the TaskCreationFlags the task is registered with.
+// If neither TASK_CREATE nor TASK_UPDATE is set, TASK_CREATE_OR_UPDATE is used.
+// Passing TASK_VALIDATE_ONLY makes RegisterTask validate the task without
+// registering it; TASK_CREATE and TASK_UPDATE are then ignored.
+func WithCreationFlags(flags TaskCreationFlags) RegisterOption {
+	return func(o *registerOptions) {
+		o.flags |= flags
+	}
+}
+
+// WithDisabled registers the task disabled (TASK_DISABLE).
+func WithDisabled() RegisterOption {
+	return WithCreationFlags(TASK_DISABLE)
+}
+
+// WithoutPrincipalACE does not add the Allow ACE for the context principal to the
+// task's security descriptor (TASK_DONT_ADD_PRINCIPAL_ACE).
+func WithoutPrincipalACE() RegisterOption {
+	return WithCreationFlags(TASK_DONT_ADD_PRINCIPAL_ACE)
+}
+
+// WithIgnoreRegistrationTriggers does not run the task's registration triggers when
+// the task is updated (TASK_IGNORE_REGISTRATION_TRIGGERS).
+func WithIgnoreRegistrationTriggers() RegisterOption {
+	return WithCreationFlags(TASK_IGNORE_REGISTRATION_TRIGGERS)
+}
+
+// WithCredentials registers the task with the given user credentials, which take
+// precedence over the definition's principal.
+func WithCredentials(username, password string) RegisterOption {
+	return func(o *registerOptions) {
+		o.username = username
+		o.password = password
+	}
+}
+
+// WithLogonType overrides the logon type the task is registered with, which
+// otherwise defaults to the LogonType of the definition's principal.
+func WithLogonType(logonType TaskLogonType) RegisterOption {
+	return func(o *registerOptions) {
+		o.logonType = logonType
+	}
+}
+
+// WithSecurityDescriptor registers the task with the given security descriptor, in
+// SDDL form.
+func WithSecurityDescriptor(sddl string) RegisterOption {
+	return func(o *registerOptions) {
+		o.sddl = sddl
+	}
+}
+
+// WithFolderSecurityDescriptor sets the security descriptor, in SDDL form, of the
+// task's folder if RegisterTask has to create it. Existing folders are not changed.
+func WithFolderSecurityDescriptor(sddl string) RegisterOption {
+	return func(o *registerOptions) {
+		o.folderSDDL = sddl
+	}
+}
+
+// RegisterTask registers a task on the connected computer, exposing all of the
+// TaskCreationFlags of RegisterTaskDefinition. By default the task is registered
+// with TASK_CREATE_OR_UPDATE, which updates an existing task in place and so, unlike
+// CreateTask with overwrite set, keeps its run history. The task's folder is created
+// if it does not exist.
+//
+// If the task is only validated (see WithCreationFlags), RegisterTask returns a zero
+// RegisteredTask.
+// https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nf-taskschd-itaskfolder-registertaskdefinition
+func (t *TaskService) RegisterTask(path string, newTaskDef Definition, opts ...RegisterOption) (RegisteredTask, error) {
+	if len(path) == 0 || path[0] != '\\' {
+		return RegisteredTask{}, ErrInvalidPath
+	} else if err := validateDefinition(newTaskDef); err != nil {
+		return RegisteredTask{}, err
+	}
+
+	o := newRegisterOptions(newTaskDef.Principal.LogonType, opts)
+
+	if o.flags&TASK_VALIDATE_ONLY == 0 {
+		if err := t.createParentFolder(path, o.folderSDDL); err != nil {
+			return RegisteredTask{}, err
+		}
+	}
+
+	newTaskObj, err := t.modifyTask(path, newTaskDef, o.username, o.password, o.logonType, o.flags, o.sddl)
+	if err != nil {
+		return RegisteredTask{}, fmt.Errorf("error registering task %s: %w", path, err)
+	}
+	if newTaskObj == nil {
+		return RegisteredTask{}, nil
+	}
+
+	newTask, _, err := parseRegisteredTask(newTaskObj)
+	if err != nil {
+		return RegisteredTask{}, fmt.Errorf("error parsing registered task %s: %w", path, err)
+	}
+
+	return newTask, nil
+}
+
+// RegisterTaskXML registers a task on the connected computer from its XML-formatted
+// definition, such as a file exported from the Task Scheduler, with the same options
+// and defaults as RegisterTask. The XML is parsed with ParseTaskXML to derive the
+// default logon type, but registered as it is.
+func (t *TaskService) RegisterTaskXML(path, xmlText string, opts ...RegisterOption) (RegisteredTask, error) {
+	if len(path) == 0 || path[0] != '\\' {
+		return RegisteredTask{}, ErrInvalidPath
+	}
+	def, err := ParseTaskXML(xmlText)
+	if err != nil {
+		return RegisteredTask{}, err
+	}
+
+	o := newRegisterOptions(def.Principal.LogonType, opts)
+	if o.flags&TASK_VALIDATE_ONLY == 0 {
+		if err := t.createParentFolder(path, o.folderSDDL); err != nil {
+			return RegisteredTask{}, err
+		}
+	}
+
+	newTaskObj, err := t.registerTaskXML(path, xmlText, "", o.username, o.password, o.logonType, o.flags, o.sddl)
+	if err != nil {
+		return RegisteredTask{}, fmt.Errorf("error registering task %s: %w", path, err)
+	}
+	if newTaskObj == nil {
+		return RegisteredTask{}, nil
+	}
+
+	newTask, _, err := parseRegisteredTask(newTaskObj)
+	if err != nil {
+		return RegisteredTask{}, fmt.Errorf("error parsing registered task %s: %w", path, err)
+	}
+
+	return newTask, nil
+}
+
+func newRegisterOptions(logonType TaskLogonType, opts []RegisterOption) registerOptions {
+	o := registerOptions{logonType: logonType}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// TASK_VALIDATE_ONLY cannot be combined with TASK_CREATE or TASK_UPDATE
+	if o.flags&TASK_VALIDATE_ONLY != 0 {
+		o.flags &^= TASK_CREATE_OR_UPDATE
+	} else if o.flags&TASK_CREATE_OR_UPDATE == 0 {
+		o.flags |= TASK_CREATE_OR_UPDATE
+	}
+
+	return o
+}
+
+// createParentFolder creates the folder of the task at path if it does not exist.
+func (t *TaskService) createParentFolder(path, sddl string) error {
+	folderPath := path[:strings.LastIndex(path, `\`)]
+	if folderPath != "" && !t.taskFolderExist(folderPath) {
+		if err := t.CreateFolder(folderPath, sddl); err != nil && !errors.Is(err, os.ErrExist) {
+			return err
+		}
+	}
+
+	return nil
+}
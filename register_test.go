@@ -0,0 +1,77 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"testing"
+)
+
+func TestRegisterTask(t *testing.T) {
+	taskService := setupTaskService(t)
+
+	def := taskService.NewTaskDefinition()
+	def.AddAction(ExecAction{Path: "calc.exe"})
+
+	task, err := taskService.RegisterTask(testTaskPath("Registered"), def, WithDisabled())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Enabled {
+		t.Fatal("expected task to be registered disabled")
+	}
+	task.Release()
+
+	// updating in place
+	def.RegistrationInfo.Description = "updated in place"
+	task, err = taskService.RegisterTask(testTaskPath("Registered"), def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer task.Release()
+	if task.Definition.RegistrationInfo.Description != "updated in place" {
+		t.Fatal("task was not updated")
+	}
+
+	// TASK_CREATE alone must fail when the task already exists
+	if _, err := taskService.RegisterTask(testTaskPath("Registered"), def, WithCreationFlags(TASK_CREATE)); err == nil {
+		t.Fatal("expected TASK_CREATE to fail for an existing task")
+	}
+
+	// validate only
+	validated, err := taskService.RegisterTask(testTaskPath("ValidatedOnly"), def, WithCreationFlags(TASK_VALIDATE_ONLY))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validated.Path != "" || taskService.registeredTaskExist(testTaskPath("ValidatedOnly")) {
+		t.Fatal("validated task should not have been registered")
+	}
+}
+
+func TestRegisterTaskXML(t *testing.T) {
+	taskService := setupTaskService(t)
+
+	source := createTestTask(taskService)
+	defer source.Release()
+
+	task, err := taskService.RegisterTaskXML(testTaskPath("Imported", "Task"), source.Definition.XMLText, WithDisabled())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer task.Release()
+	if task.Enabled {
+		t.Fatal("expected task to be registered disabled")
+	}
+	want := source.Definition
+	want.RegistrationInfo.URI = task.Definition.RegistrationInfo.URI
+	if changes := DiffDefinitions(want, task.Definition); len(changes) != 0 {
+		t.Fatalf("imported definition differs: %v", changes)
+	}
+
+	if _, err := taskService.RegisterTaskXML(testTaskPath("Imported", "Task"), source.Definition.XMLText, WithCreationFlags(TASK_CREATE)); err == nil {
+		t.Fatal("expected TASK_CREATE to fail for an existing task")
+	}
+	if _, err := taskService.RegisterTaskXML(testTaskPath("Imported", "Bad"), "<Task"); err == nil {
+		t.Fatal("expected malformed XML to fail")
+	}
+}
@@ -0,0 +1,1043 @@
+package taskmaster
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rickb777/period"
+)
+
+// SchtasksOptions configures ParseSchtasks and ExportSchtasks.
+type SchtasksOptions struct {
+	Start      time.Time // when the command runs, which /sd and /st default to, in the time zone of the triggers; now if zero
+	DateLayout string    // the layout of /sd and /ed, which follows the regional settings of the computer; "01/02/2006" if empty
+}
+
+func (opts SchtasksOptions) withDefaults() SchtasksOptions {
+	if opts.Start.IsZero() {
+		opts.Start = time.Now()
+	}
+	if opts.DateLayout == "" {
+		opts.DateLayout = "01/02/2006"
+	}
+
+	return opts
+}
+
+// SchtasksCreate is a schtasks /create command converted to a task definition.
+type SchtasksCreate struct {
+	Path       string // the path of the task from /tn, starting with \
+	Definition Definition
+	Password   string   // the password from /rp; "*" if schtasks prompts for it
+	Force      bool     // whether /f replaces an existing task
+	Warnings   []string // the options that were left out
+}
+
+// ParseSchtasks converts a schtasks /create command line to a task definition, the
+// reverse of ExportSchtasks. The command is split into arguments as by
+// CommandLineToArgvW, and may start with schtasks or schtasks.exe. Options are
+// case-insensitive and may start with / or -.
+//
+// /sc and /mo become a trigger: MINUTE and HOURLY a TimeTrigger that repeats
+// indefinitely, DAILY, WEEKLY and MONTHLY the calendar triggers, with /d and /m
+// setting the days and months, and ONCE, ONSTART, ONLOGON, ONIDLE and ONEVENT the
+// triggers they are named after. /st, /sd and /ed set the boundaries of the
+// trigger, with /ed ending at the end of its day, and /ri, /du, /et and /k its
+// repetition. /tr becomes an ExecAction, and /ru, /rp, /it, /np and /rl the
+// principal: a service account runs as such, /it with an interactive token, /np
+// with S4U and other users with a password. Without /ru the task runs as the user
+// registering it.
+//
+// Options that do not apply to the schedule, and the remote options /s, /u and /p,
+// are listed in SchtasksCreate.Warnings. ParseSchtasks fails if the command is not
+// a /create command, an option is unknown, repeated or malformed, or /tn, /tr or
+// /sc is missing.
+func ParseSchtasks(command string, opts SchtasksOptions) (SchtasksCreate, error) {
+	opts = opts.withDefaults()
+
+	args, err := splitCommandLine(command)
+	if err != nil {
+		return SchtasksCreate{}, err
+	}
+	if len(args) > 0 {
+		name := strings.ToLower(args[0][strings.LastIndexAny(args[0], `\/`)+1:])
+		if name == "schtasks" || name == "schtasks.exe" {
+			args = args[1:]
+		}
+	}
+	c, err := parseSchtasksArgs(args)
+	if err != nil {
+		return SchtasksCreate{}, err
+	}
+	c.opts = opts
+
+	if !c.flag("create") {
+		return SchtasksCreate{}, errors.New("not a schtasks /create command")
+	}
+	if _, ok := c.get("xml"); ok {
+		return SchtasksCreate{}, errors.New("/xml is not supported; read the XML file with ReadTaskXML")
+	}
+
+	result := SchtasksCreate{Definition: DefaultDefinition(), Force: c.flag("f")}
+	name, _ := c.get("tn")
+	if name == "" {
+		return SchtasksCreate{}, errors.New("/tn is required")
+	}
+	if !strings.HasPrefix(name, `\`) {
+		name = `\` + name
+	}
+	result.Path = name
+
+	run, _ := c.get("tr")
+	if run == "" {
+		return SchtasksCreate{}, errors.New("/tr is required")
+	}
+	path, arguments := splitSchtasksRun(run)
+	result.Definition.AddAction(ExecAction{Path: path, Args: arguments})
+
+	if err := c.principal(&result); err != nil {
+		return SchtasksCreate{}, err
+	}
+	trigger, err := c.trigger(&result.Definition)
+	if err != nil {
+		return SchtasksCreate{}, err
+	}
+	result.Definition.AddTrigger(trigger)
+	if c.flag("z") {
+		result.Definition.Settings.DeleteExpiredTaskAfter = "PT0S"
+	}
+	if c.flag("v1") {
+		result.Definition.Settings.Compatibility = TASK_COMPATIBILITY_V1
+	}
+
+	for _, remote := range []string{"s", "u", "p"} {
+		if _, ok := c.get(remote); ok {
+			c.warnf("/%s is left out; the task is converted for the local computer", remote)
+		}
+	}
+	c.flag("hresult")
+	for _, name := range c.order {
+		if !c.used[name] {
+			c.warnf("/%s does not apply to /sc %s and is left out", name, strings.ToUpper(c.values["sc"]))
+		}
+	}
+	result.Warnings = c.conversionWarnings
+
+	return result, nil
+}
+
+// schtasksValueOptions are the options of schtasks /create that take a value; /rp
+// and /p may also be given without one.
+var schtasksValueOptions = []string{"s", "u", "p", "ru", "rp", "sc", "mo", "d", "m", "i", "tn", "tr", "st", "ri", "et", "du", "sd", "ed", "ec", "rl", "delay", "xml"}
+
+var schtasksFlagOptions = []string{"create", "k", "it", "np", "z", "f", "v1", "hresult"}
+
+// schtasksArgs are the options of a schtasks command.
+type schtasksArgs struct {
+	conversionWarnings
+	opts   SchtasksOptions
+	values map[string]string
+	order  []string
+	used   map[string]bool
+}
+
+func parseSchtasksArgs(args []string) (*schtasksArgs, error) {
+	c := &schtasksArgs{values: make(map[string]string), used: make(map[string]bool)}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) < 2 || arg[0] != '/' && arg[0] != '-' {
+			return nil, fmt.Errorf("unexpected argument %q", arg)
+		}
+		name := strings.ToLower(arg[1:])
+		if _, ok := c.values[name]; ok {
+			return nil, fmt.Errorf("/%s is given more than once", name)
+		}
+
+		var value string
+		switch {
+		case slices.Contains(schtasksFlagOptions, name):
+		case name == "rp" || name == "p":
+			value = "*"
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "/") {
+				i++
+				value = args[i]
+			}
+		case slices.Contains(schtasksValueOptions, name):
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("/%s needs a value", name)
+			}
+			i++
+			value = args[i]
+		default:
+			return nil, fmt.Errorf("unknown option %s", arg)
+		}
+		c.values[name] = value
+		c.order = append(c.order, name)
+	}
+
+	return c, nil
+}
+
+// get returns the value of an option and marks it as used.
+func (c *schtasksArgs) get(name string) (string, bool) {
+	value, ok := c.values[name]
+	if ok {
+		c.used[name] = true
+	}
+	return value, ok
+}
+
+func (c *schtasksArgs) flag(name string) bool {
+	_, ok := c.get(name)
+	return ok
+}
+
+// number returns the value of an option as a number between low and high, or def
+// if it is not given.
+func (c *schtasksArgs) number(name string, low, high, def int) (int, error) {
+	value, ok := c.get(name)
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < low || n > high {
+		return 0, fmt.Errorf("invalid /%s %q: must be a number from %d to %d", name, value, low, high)
+	}
+
+	return n, nil
+}
+
+func (c *schtasksArgs) principal(result *SchtasksCreate) error {
+	p := &result.Definition.Principal
+	user, hasUser := c.get("ru")
+	password, hasPassword := c.get("rp")
+	interactive, s4u := c.flag("it"), c.flag("np")
+	switch {
+	case hasUser && (user == "" || isServiceAccount(user)):
+		if user == "" {
+			user = "SYSTEM"
+		}
+		p.LogonType = TASK_LOGON_SERVICE_ACCOUNT
+		if interactive || s4u || hasPassword {
+			c.warnf("service accounts have no password and do not run interactively; /it, /np and /rp are left out")
+		}
+	case s4u:
+		p.LogonType = TASK_LOGON_S4U
+	case interactive:
+		p.LogonType = TASK_LOGON_INTERACTIVE_TOKEN
+	case hasUser || hasPassword:
+		p.LogonType = TASK_LOGON_PASSWORD
+		result.Password = "*"
+		if hasPassword {
+			result.Password = password
+		}
+	}
+	p.UserID = user
+
+	if level, ok := c.get("rl"); ok {
+		switch strings.ToUpper(level) {
+		case "HIGHEST":
+			p.RunLevel = TASK_RUNLEVEL_HIGHEST
+		case "LIMITED":
+			p.RunLevel = TASK_RUNLEVEL_LUA
+		default:
+			return fmt.Errorf("invalid /rl %q", level)
+		}
+	}
+
+	return nil
+}
+
+var schtasksWeekdayNames = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+var schtasksMonthNames = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+
+var schtasksWeekNames = []string{"FIRST", "SECOND", "THIRD", "FOURTH"}
+
+func (c *schtasksArgs) trigger(def *Definition) (Trigger, error) {
+	schedule, ok := c.get("sc")
+	if !ok {
+		return nil, errors.New("/sc is required")
+	}
+	modifier, hasModifier := c.values["mo"]
+	modifier = strings.ToUpper(modifier)
+
+	switch strings.ToUpper(schedule) {
+	case "MINUTE", "HOURLY":
+		minutes, err := c.number("mo", 1, 1439, 1)
+		if strings.ToUpper(schedule) == "HOURLY" {
+			minutes, err = c.number("mo", 1, 23, 1)
+			minutes *= 60
+		}
+		if err != nil {
+			return nil, err
+		}
+		tt, err := c.taskTrigger(minutes)
+		tt.RepetitionInterval = minutesPeriod(minutes)
+		return TimeTrigger{TaskTrigger: tt}, err
+	case "DAILY":
+		days, err := c.number("mo", 1, 255, 1)
+		if err != nil {
+			return nil, err
+		}
+		tt, err := c.taskTrigger(0)
+		return DailyTrigger{TaskTrigger: tt, DayInterval: DayInterval(days)}, err
+	case "WEEKLY":
+		weeks, err := c.number("mo", 1, 52, 1)
+		if err != nil {
+			return nil, err
+		}
+		days, err := c.weekdays(Monday)
+		if err != nil {
+			return nil, err
+		}
+		tt, err := c.taskTrigger(0)
+		return WeeklyTrigger{TaskTrigger: tt, DaysOfWeek: days, WeekInterval: WeekInterval(weeks)}, err
+	case "MONTHLY":
+		return c.monthlyTrigger(modifier, hasModifier)
+	case "ONCE":
+		tt, err := c.taskTrigger(0)
+		return TimeTrigger{TaskTrigger: tt}, err
+	case "ONSTART":
+		delay, err := c.delay()
+		return BootTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Delay: delay}, err
+	case "ONLOGON":
+		delay, err := c.delay()
+		return LogonTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Delay: delay}, err
+	case "ONIDLE":
+		if _, ok := c.values["i"]; !ok {
+			return nil, errors.New("/sc ONIDLE needs /i")
+		}
+		minutes, err := c.number("i", 1, 999, 0)
+		if err != nil {
+			return nil, err
+		}
+		def.Settings.IdleSettings.IdleDuration = minutesPeriod(minutes)
+		return IdleTrigger{TaskTrigger: TaskTrigger{Enabled: true}}, nil
+	case "ONEVENT":
+		channel, _ := c.get("ec")
+		if channel == "" {
+			return nil, errors.New("/sc ONEVENT needs /ec")
+		}
+		query, ok := c.get("mo")
+		if !ok {
+			query = "*"
+		}
+		delay, err := c.delay()
+		return EventTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Delay: delay, Subscription: schtasksSubscription(channel, query)}, err
+	default:
+		return nil, fmt.Errorf("invalid /sc %q", schedule)
+	}
+}
+
+func (c *schtasksArgs) monthlyTrigger(modifier string, hasModifier bool) (Trigger, error) {
+	months, hasMonths, err := c.months()
+	if err != nil {
+		return nil, err
+	}
+
+	if week := slices.Index(schtasksWeekNames, modifier); week >= 0 || modifier == "LAST" {
+		c.get("mo")
+		if _, ok := c.values["d"]; !ok {
+			return nil, fmt.Errorf("/mo %s needs /d", modifier)
+		}
+		days, err := c.weekdays(0)
+		if err != nil {
+			return nil, err
+		}
+		tt, err := c.taskTrigger(0)
+		t := MonthlyDOWTrigger{TaskTrigger: tt, DaysOfWeek: days, MonthsOfYear: months, RunOnLastWeekOfMonth: week < 0}
+		if week >= 0 {
+			t.WeeksOfMonth = First << week
+		}
+		return t, err
+	}
+	if modifier == "LASTDAY" {
+		c.get("mo")
+		tt, err := c.taskTrigger(0)
+		return MonthlyTrigger{TaskTrigger: tt, MonthsOfYear: months, RunOnLastDayOfMonth: true}, err
+	}
+
+	interval, err := c.number("mo", 1, 12, 1)
+	if err != nil {
+		return nil, err
+	}
+	if hasMonths && hasModifier {
+		return nil, fmt.Errorf("/m cannot be combined with /mo %s", modifier)
+	}
+	days, err := c.daysOfMonth()
+	if err != nil {
+		return nil, err
+	}
+	tt, err := c.taskTrigger(0)
+	if err != nil {
+		return nil, err
+	}
+	if !hasMonths {
+		months = 0
+		for m := int(tt.StartBoundary.Month()) - 1; m < int(tt.StartBoundary.Month())+11; m += interval {
+			months |= 1 << (m % 12)
+		}
+		if 12%interval != 0 {
+			c.warnf("/mo %d runs in the same months every year rather than every %d months across years", interval, interval)
+		}
+	}
+
+	return MonthlyTrigger{TaskTrigger: tt, DaysOfMonth: days, MonthsOfYear: months}, nil
+}
+
+// taskTrigger returns the boundaries and repetition of a calendar or time trigger
+// from /sd, /st, /ed, /ri, /du, /et and /k. interval is the repetition interval in
+// minutes set by /mo, in which case /ri does not apply.
+func (c *schtasksArgs) taskTrigger(interval int) (TaskTrigger, error) {
+	loc := c.opts.Start.Location()
+	day := c.opts.Start
+	if value, ok := c.get("sd"); ok {
+		d, err := time.ParseInLocation(c.opts.DateLayout, value, loc)
+		if err != nil {
+			return TaskTrigger{}, fmt.Errorf("invalid /sd %q: %w", value, err)
+		}
+		day = d
+	}
+	clock := c.opts.Start
+	if value, ok := c.get("st"); ok {
+		t, err := parseSchtasksTime(value)
+		if err != nil {
+			return TaskTrigger{}, fmt.Errorf("invalid /st %q: %w", value, err)
+		}
+		clock = t
+	}
+	tt := TaskTrigger{Enabled: true, StartBoundary: time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)}
+
+	if value, ok := c.get("ed"); ok {
+		d, err := time.ParseInLocation(c.opts.DateLayout, value, loc)
+		if err != nil {
+			return TaskTrigger{}, fmt.Errorf("invalid /ed %q: %w", value, err)
+		}
+		tt.EndBoundary = time.Date(d.Year(), d.Month(), d.Day(), 23, 59, 59, 0, loc)
+	}
+
+	var duration int
+	end, hasEnd := c.get("et")
+	span, hasSpan := c.get("du")
+	switch {
+	case hasEnd && hasSpan:
+		return TaskTrigger{}, errors.New("/et and /du cannot be combined")
+	case hasEnd:
+		t, err := parseSchtasksTime(end)
+		if err != nil {
+			return TaskTrigger{}, fmt.Errorf("invalid /et %q: %w", end, err)
+		}
+		start := tt.StartBoundary.Hour()*60 + tt.StartBoundary.Minute()
+		if duration = t.Hour()*60 + t.Minute() - start; duration <= 0 {
+			duration += 24 * 60
+		}
+	case hasSpan:
+		d, err := parseSchtasksSpan(span)
+		if err != nil || d == 0 {
+			return TaskTrigger{}, fmt.Errorf("invalid /du %q: must be HHHH:MM", span)
+		}
+		duration = d
+	}
+	if interval == 0 {
+		// schtasks repeats every 10 minutes if only the end of the repetition is given
+		def := 0
+		if duration > 0 {
+			def = 10
+		}
+		n, err := c.number("ri", 1, 599940, def)
+		if err != nil {
+			return TaskTrigger{}, err
+		}
+		interval = n
+		if interval > 0 {
+			tt.RepetitionInterval = minutesPeriod(interval)
+		}
+	}
+	if duration > 0 {
+		tt.RepetitionDuration = minutesPeriod(duration)
+	}
+	tt.StopAtDurationEnd = c.flag("k")
+
+	return tt, nil
+}
+
+// parseSchtasksTime parses a time of day of /st or /et, HH:mm with optional
+// seconds, which schtasks ignores.
+func parseSchtasksTime(s string) (time.Time, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		t, err = time.Parse("15:04:05", s)
+	}
+	return t, err
+}
+
+// parseSchtasksSpan parses a span of /du, HHHH:MM, or /delay, mmmm:ss, returning
+// it in the smaller unit.
+func parseSchtasksSpan(s string) (int, error) {
+	major, minor, ok := strings.Cut(s, ":")
+	m, err1 := strconv.Atoi(major)
+	n, err2 := strconv.Atoi(minor)
+	if !ok || err1 != nil || err2 != nil || m < 0 || m > 9999 || n < 0 || n > 59 || len(minor) != 2 {
+		return 0, fmt.Errorf("invalid span %q", s)
+	}
+
+	return m*60 + n, nil
+}
+
+func (c *schtasksArgs) delay() (period.Period, error) {
+	value, ok := c.get("delay")
+	if !ok {
+		return period.Period{}, nil
+	}
+	s, err := parseSchtasksSpan(value)
+	if err != nil {
+		return period.Period{}, fmt.Errorf("invalid /delay %q: must be mmmm:ss", value)
+	}
+
+	return period.NewHMS(s/3600, s/60%60, s%60), nil
+}
+
+func (c *schtasksArgs) weekdays(def DayOfWeek) (DayOfWeek, error) {
+	value, ok := c.get("d")
+	if !ok {
+		return def, nil
+	}
+	var days DayOfWeek
+	for _, name := range strings.Split(strings.ToUpper(value), ",") {
+		if name == "*" {
+			days |= AllDays
+			continue
+		}
+		i := slices.Index(schtasksWeekdayNames, strings.TrimSpace(name))
+		if i < 0 {
+			return 0, fmt.Errorf("invalid day of the week %q in /d", name)
+		}
+		days |= 1 << i
+	}
+
+	return days, nil
+}
+
+func (c *schtasksArgs) daysOfMonth() (DayOfMonth, error) {
+	value, ok := c.get("d")
+	if !ok {
+		return One, nil
+	}
+	var days DayOfMonth
+	for _, s := range strings.Split(value, ",") {
+		if s == "*" {
+			days |= AllDaysOfMonth
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 1 || n > 31 {
+			return 0, fmt.Errorf("invalid day of the month %q in /d", s)
+		}
+		days |= 1 << (n - 1)
+	}
+
+	return days, nil
+}
+
+func (c *schtasksArgs) months() (Month, bool, error) {
+	value, ok := c.get("m")
+	if !ok {
+		return AllMonths, false, nil
+	}
+	var months Month
+	for _, name := range strings.Split(strings.ToUpper(value), ",") {
+		if name == "*" {
+			months |= AllMonths
+			continue
+		}
+		i := slices.Index(schtasksMonthNames, strings.TrimSpace(name))
+		if i < 0 {
+			return 0, false, fmt.Errorf("invalid month %q in /m", name)
+		}
+		months |= 1 << i
+	}
+
+	return months, true, nil
+}
+
+// schtasksSubscription returns the event query schtasks registers for /ec and /mo.
+func schtasksSubscription(channel, query string) string {
+	var b strings.Builder
+	b.WriteString(`<QueryList><Query Id="0" Path="`)
+	xml.EscapeText(&b, []byte(channel))
+	b.WriteString(`"><Select Path="`)
+	xml.EscapeText(&b, []byte(channel))
+	b.WriteString(`">`)
+	xml.EscapeText(&b, []byte(query))
+	b.WriteString(`</Select></Query></QueryList>`)
+
+	return b.String()
+}
+
+// parseSchtasksSubscription returns the channel and XPath query of an event query
+// with a single selection, which is what schtasks can register.
+func parseSchtasksSubscription(subscription string) (channel, query string, ok bool) {
+	var list struct {
+		Query []struct {
+			Path   string `xml:"Path,attr"`
+			Select []struct {
+				Path  string `xml:"Path,attr"`
+				Query string `xml:",chardata"`
+			}
+			Suppress []string
+		}
+	}
+	if err := xml.Unmarshal([]byte(subscription), &list); err != nil || len(list.Query) != 1 {
+		return "", "", false
+	}
+	q := list.Query[0]
+	if len(q.Select) != 1 || len(q.Suppress) > 0 || q.Select[0].Path != q.Path && q.Path != "" {
+		return "", "", false
+	}
+
+	return q.Select[0].Path, strings.TrimSpace(q.Select[0].Query), true
+}
+
+// splitSchtasksRun splits the command of /tr into the program and its arguments.
+func splitSchtasksRun(run string) (path, args string) {
+	run = strings.TrimSpace(run)
+	if strings.HasPrefix(run, `"`) {
+		if end := strings.IndexByte(run[1:], '"'); end >= 0 {
+			return run[1 : end+1], strings.TrimSpace(run[end+2:])
+		}
+		return run[1:], ""
+	}
+	path, args, _ = strings.Cut(run, " ")
+
+	return path, strings.TrimSpace(args)
+}
+
+// splitCommandLine splits a Windows command line into arguments following the
+// rules of CommandLineToArgvW: arguments are separated by white space unless
+// quoted, 2n backslashes before a quote become n backslashes and 2n+1 a literal
+// quote, and two quotes inside a quoted argument are a literal quote.
+func splitCommandLine(s string) ([]string, error) {
+	var (
+		args           []string
+		arg            strings.Builder
+		inArg, quoted  bool
+		backslashes    int
+		flushBackslash = func() {
+			arg.WriteString(strings.Repeat(`\`, backslashes))
+			backslashes = 0
+		}
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			backslashes++
+			inArg = true
+		case c == '"':
+			arg.WriteString(strings.Repeat(`\`, backslashes/2))
+			odd := backslashes%2 == 1
+			backslashes = 0
+			inArg = true
+			switch {
+			case odd:
+				arg.WriteByte('"')
+			case quoted && i+1 < len(s) && s[i+1] == '"':
+				arg.WriteByte('"')
+				i++
+			default:
+				quoted = !quoted
+			}
+		case strings.IndexByte(" \t\r\n", c) >= 0 && !quoted:
+			flushBackslash()
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			flushBackslash()
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	flushBackslash()
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
+
+// quoteCommandLineArg quotes an argument so that splitCommandLine returns it
+// unchanged.
+func quoteCommandLineArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\r\n\"") {
+		return arg
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	backslashes := 0
+	for i := 0; i < len(arg); i++ {
+		switch c := arg[i]; c {
+		case '\\':
+			backslashes++
+		case '"':
+			b.WriteString(strings.Repeat(`\`, 2*backslashes+1))
+			b.WriteByte('"')
+			backslashes = 0
+		default:
+			b.WriteString(strings.Repeat(`\`, backslashes))
+			b.WriteByte(c)
+			backslashes = 0
+		}
+	}
+	b.WriteString(strings.Repeat(`\`, 2*backslashes))
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// ExportSchtasks returns a schtasks /create command that registers def as path,
+// for installer scripts that cannot use the Task Scheduler API or PowerShell. The
+// command replaces an existing task with /f and never contains a password: tasks
+// that run as a user with a password make schtasks prompt for it.
+//
+// schtasks can only express a task with a single ExecAction without a working
+// directory and a single enabled trigger, with the default settings apart from
+// Compatibility V1, DeleteExpiredTaskAfter PT0S and the idle duration of an idle
+// trigger. Repetitions must be whole minutes, the end boundary must be the end of a
+// day and the principal must be a user or service account without restricted
+// privileges. ExportSchtasks fails for any other definition, naming what schtasks
+// cannot express.
+func ExportSchtasks(path string, def Definition, opts SchtasksOptions) (string, error) {
+	if len(path) == 0 || path[0] != '\\' || strings.HasSuffix(path, `\`) {
+		return "", fmt.Errorf("invalid task path %q", path)
+	}
+	opts = opts.withDefaults()
+	if reason := schtasksUnsupported(def); reason != "" {
+		return "", fmt.Errorf("schtasks cannot express %s", reason)
+	}
+
+	args := []string{"schtasks", "/create", "/tn", path}
+	action := def.Actions[0].(ExecAction)
+	run := action.Path
+	if strings.ContainsAny(run, " \t") {
+		run = `"` + run + `"`
+	}
+	if action.Args != "" {
+		run += " " + action.Args
+	}
+	if len(run) > 261 {
+		return "", errors.New("schtasks cannot express a command longer than 261 characters")
+	}
+	args = append(args, "/tr", run)
+
+	triggerArgs, err := schtasksTriggerArgs(def.Triggers[0], def.Settings.IdleDuration, opts.DateLayout)
+	if err != nil {
+		return "", fmt.Errorf("schtasks cannot express %w", err)
+	}
+	args = append(args, triggerArgs...)
+
+	p := def.Principal
+	switch p.LogonType {
+	case TASK_LOGON_SERVICE_ACCOUNT, TASK_LOGON_PASSWORD:
+		args = append(args, "/ru", p.UserID)
+	case TASK_LOGON_S4U:
+		if p.UserID != "" {
+			args = append(args, "/ru", p.UserID)
+		}
+		args = append(args, "/np")
+	case TASK_LOGON_INTERACTIVE_TOKEN:
+		if p.UserID != "" {
+			args = append(args, "/ru", p.UserID, "/it")
+		}
+	}
+	if p.RunLevel == TASK_RUNLEVEL_HIGHEST {
+		args = append(args, "/rl", "HIGHEST")
+	}
+
+	if def.Settings.DeleteExpiredTaskAfter != "" {
+		args = append(args, "/z")
+	}
+	if def.Settings.Compatibility == TASK_COMPATIBILITY_V1 {
+		args = append(args, "/v1")
+	}
+	args = append(args, "/f")
+
+	for i, arg := range args {
+		args[i] = quoteCommandLineArg(arg)
+	}
+
+	return strings.Join(args, " "), nil
+}
+
+// schtasksUnsupported returns what schtasks cannot express about def apart from its
+// trigger, or "" if it can.
+func schtasksUnsupported(def Definition) string {
+	if len(def.Actions) != 1 {
+		return fmt.Sprintf("%d actions", len(def.Actions))
+	}
+	action, ok := def.Actions[0].(ExecAction)
+	switch {
+	case !ok:
+		return fmt.Sprintf("%s actions", def.Actions[0].GetType())
+	case action.WorkingDir != "":
+		return "a working directory"
+	case len(def.Triggers) != 1:
+		return fmt.Sprintf("%d triggers", len(def.Triggers))
+	case def.Data != "":
+		return "task data"
+	case !def.Settings.Enabled:
+		return "a disabled task"
+	}
+
+	p := def.Principal
+	switch {
+	case p.GroupID != "":
+		return "a group principal"
+	case p.ProcessTokenSidType != TASK_PROCESSTOKENSID_DEFAULT || len(p.RequiredPrivileges) > 0:
+		return "a principal with restricted privileges"
+	case p.LogonType == TASK_LOGON_SERVICE_ACCOUNT && !isServiceAccount(p.UserID):
+		return fmt.Sprintf("the service account %q", p.UserID)
+	case p.LogonType != TASK_LOGON_SERVICE_ACCOUNT && p.UserID != "" && isServiceAccount(p.UserID):
+		return fmt.Sprintf("%s logons of a service account", strings.ToLower(p.LogonType.String()))
+	case p.LogonType == TASK_LOGON_PASSWORD && p.UserID == "":
+		return "a password logon without a user"
+	}
+	switch p.LogonType {
+	case TASK_LOGON_SERVICE_ACCOUNT, TASK_LOGON_PASSWORD, TASK_LOGON_S4U, TASK_LOGON_INTERACTIVE_TOKEN:
+	default:
+		return fmt.Sprintf("%s logons", strings.ToLower(p.LogonType.String()))
+	}
+
+	settings := DefaultDefinition().Settings
+	if def.Settings.Compatibility == TASK_COMPATIBILITY_V1 {
+		settings.Compatibility = TASK_COMPATIBILITY_V1
+	}
+	if def.Settings.DeleteExpiredTaskAfter == "PT0S" {
+		settings.DeleteExpiredTaskAfter = "PT0S"
+	}
+	if def.Triggers[0].GetType() == TASK_TRIGGER_IDLE {
+		settings.IdleDuration = def.Settings.IdleDuration
+	}
+	if diff := DiffDefinitions(Definition{Settings: settings}, Definition{Settings: def.Settings}); len(diff) > 0 {
+		fields := make([]string, len(diff))
+		for i, line := range diff {
+			fields[i], _, _ = strings.Cut(line, ":")
+		}
+		return "settings other than the defaults: " + strings.Join(fields, ", ")
+	}
+
+	return ""
+}
+
+// schtasksTriggerArgs returns the options of schtasks /create for a trigger.
+func schtasksTriggerArgs(trigger Trigger, idle period.Period, layout string) ([]string, error) {
+	tt := taskTriggerOf(trigger)
+	name := strings.ToLower(trigger.GetType().String())
+	switch {
+	case !tt.Enabled:
+		return nil, errors.New("a disabled trigger")
+	case !tt.ExecutionTimeLimit.IsZero():
+		return nil, errors.New("a time limit of a trigger")
+	}
+
+	switch t := trigger.(type) {
+	case TimeTrigger, DailyTrigger, WeeklyTrigger, MonthlyTrigger, MonthlyDOWTrigger:
+		if delay := schtasksRandomDelay(t); !delay.IsZero() {
+			return nil, errors.New("a random delay")
+		}
+		if tt.StartBoundary.IsZero() {
+			return nil, fmt.Errorf("%s triggers without a start boundary", name)
+		}
+	case BootTrigger, LogonTrigger, IdleTrigger, EventTrigger:
+		if tt != (TaskTrigger{Enabled: true, ID: tt.ID}) {
+			return nil, fmt.Errorf("boundaries or repetitions of %s triggers", name)
+		}
+	default:
+		return nil, fmt.Errorf("%s triggers", name)
+	}
+
+	var args []string
+	switch t := trigger.(type) {
+	case TimeTrigger:
+		interval, ok := schtasksMinutes(t.RepetitionInterval)
+		switch {
+		case !ok:
+			return nil, errors.New("a repetition interval that is not whole minutes")
+		case interval > 0 && interval < 24*60 && interval%60 == 0:
+			args = append(args, "/sc", "HOURLY", "/mo", strconv.Itoa(interval/60))
+			tt.RepetitionInterval = period.Period{}
+		case interval > 0 && interval < 24*60:
+			args = append(args, "/sc", "MINUTE", "/mo", strconv.Itoa(interval))
+			tt.RepetitionInterval = period.Period{}
+		default:
+			args = append(args, "/sc", "ONCE")
+		}
+	case DailyTrigger:
+		args = append(args, "/sc", "DAILY")
+		if t.DayInterval > 1 {
+			args = append(args, "/mo", strconv.Itoa(int(t.DayInterval)))
+		}
+	case WeeklyTrigger:
+		if t.DaysOfWeek&AllDays == 0 {
+			return nil, errors.New("weekly triggers without days of the week")
+		}
+		args = append(args, "/sc", "WEEKLY")
+		if t.WeekInterval > 1 {
+			args = append(args, "/mo", strconv.Itoa(int(t.WeekInterval)))
+		}
+		args = append(args, "/d", schtasksNames(uint64(t.DaysOfWeek), schtasksWeekdayNames))
+	case MonthlyTrigger:
+		args = append(args, "/sc", "MONTHLY")
+		switch {
+		case t.RunOnLastDayOfMonth && t.DaysOfMonth != 0:
+			return nil, errors.New("monthly triggers on the last and other days of the month")
+		case t.RunOnLastDayOfMonth:
+			args = append(args, "/mo", "LASTDAY")
+		case t.DaysOfMonth == 0:
+			return nil, errors.New("monthly triggers without days of the month")
+		default:
+			var days []string
+			for _, d := range setValues(uint64(t.DaysOfMonth)) {
+				days = append(days, strconv.Itoa(d+1))
+			}
+			args = append(args, "/d", strings.Join(days, ","))
+		}
+		args = appendSchtasksMonths(args, t.MonthsOfYear)
+	case MonthlyDOWTrigger:
+		week := slices.Index([]Week{First, Second, Third, Fourth}, t.WeeksOfMonth)
+		switch {
+		case t.RunOnLastWeekOfMonth && t.WeeksOfMonth == 0:
+			args = append(args, "/sc", "MONTHLY", "/mo", "LAST")
+		case !t.RunOnLastWeekOfMonth && week >= 0:
+			args = append(args, "/sc", "MONTHLY", "/mo", schtasksWeekNames[week])
+		default:
+			return nil, errors.New("monthly day-of-week triggers on more than one week of the month")
+		}
+		if t.DaysOfWeek&AllDays == 0 {
+			return nil, errors.New("monthly day-of-week triggers without days of the week")
+		}
+		args = append(args, "/d", schtasksNames(uint64(t.DaysOfWeek), schtasksWeekdayNames))
+		args = appendSchtasksMonths(args, t.MonthsOfYear)
+	case BootTrigger:
+		args = append(args, "/sc", "ONSTART")
+		return appendSchtasksDelay(args, t.Delay)
+	case LogonTrigger:
+		if t.UserID != "" {
+			return nil, errors.New("logon triggers of a single user")
+		}
+		args = append(args, "/sc", "ONLOGON")
+		return appendSchtasksDelay(args, t.Delay)
+	case IdleTrigger:
+		minutes, ok := schtasksMinutes(idle)
+		if !ok || minutes < 1 || minutes > 999 {
+			return nil, errors.New("an idle duration that is not 1 to 999 minutes")
+		}
+		return append(args, "/sc", "ONIDLE", "/i", strconv.Itoa(minutes)), nil
+	case EventTrigger:
+		channel, query, ok := parseSchtasksSubscription(t.Subscription)
+		switch {
+		case !ok:
+			return nil, errors.New("event queries with more than one selection")
+		case len(t.ValueQueries) > 0:
+			return nil, errors.New("value queries of event triggers")
+		}
+		args = append(args, "/sc", "ONEVENT", "/ec", channel, "/mo", query)
+		return appendSchtasksDelay(args, t.Delay)
+	}
+
+	start := tt.StartBoundary
+	if start.Second() != 0 {
+		return nil, errors.New("a start boundary that is not a whole minute")
+	}
+	args = append(args, "/sd", start.Format(layout), "/st", start.Format("15:04"))
+	if end := tt.EndBoundary; !end.IsZero() {
+		if end.Hour() != 23 || end.Minute() != 59 || end.Second() != 59 {
+			return nil, errors.New("an end boundary that is not the end of a day")
+		}
+		args = append(args, "/ed", end.Format(layout))
+	}
+
+	interval, ok := schtasksMinutes(tt.RepetitionInterval)
+	duration, ok2 := schtasksMinutes(tt.RepetitionDuration)
+	switch {
+	case !ok || !ok2:
+		return nil, errors.New("a repetition that is not whole minutes")
+	case duration > 9999*60+59:
+		return nil, errors.New("a repetition duration longer than 9999 hours")
+	case interval > 0:
+		args = append(args, "/ri", strconv.Itoa(interval))
+	}
+	if duration > 0 {
+		args = append(args, "/du", fmt.Sprintf("%04d:%02d", duration/60, duration%60))
+	}
+	if tt.StopAtDurationEnd {
+		args = append(args, "/k")
+	}
+
+	return args, nil
+}
+
+func schtasksRandomDelay(t Trigger) period.Period {
+	switch t := t.(type) {
+	case TimeTrigger:
+		return t.RandomDelay
+	case DailyTrigger:
+		return t.RandomDelay
+	case WeeklyTrigger:
+		return t.RandomDelay
+	case MonthlyTrigger:
+		return t.RandomDelay
+	case MonthlyDOWTrigger:
+		return t.RandomDelay
+	default:
+		return period.Period{}
+	}
+}
+
+// schtasksMinutes returns a period in minutes, and whether it is a whole number of
+// them.
+func schtasksMinutes(p period.Period) (int, bool) {
+	d := p.DurationApprox()
+	return int(d / time.Minute), d%time.Minute == 0
+}
+
+func schtasksNames(set uint64, names []string) string {
+	var list []string
+	for _, i := range setValues(set) {
+		if i < len(names) {
+			list = append(list, names[i])
+		}
+	}
+
+	return strings.Join(list, ",")
+}
+
+func appendSchtasksMonths(args []string, months Month) []string {
+	if months&AllMonths == AllMonths {
+		return args
+	}
+	return append(args, "/m", schtasksNames(uint64(months), schtasksMonthNames))
+}
+
+func appendSchtasksDelay(args []string, delay period.Period) ([]string, error) {
+	if delay.IsZero() {
+		return args, nil
+	}
+	d := delay.DurationApprox()
+	if d%time.Second != 0 || d/time.Minute > 9999 {
+		return nil, errors.New("a delay that is not whole seconds under 10000 minutes")
+	}
+
+	return append(args, "/delay", fmt.Sprintf("%04d:%02d", d/time.Minute, d%time.Minute/time.Second)), nil
+}
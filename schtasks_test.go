@@ -0,0 +1,362 @@
+package taskmaster
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/period"
+)
+
+func TestParseSchtasks(t *testing.T) {
+	start := time.Date(2024, 5, 1, 8, 15, 30, 0, time.UTC)
+	command := `C:\Windows\System32\schtasks.exe /Create /SC weekly /D MON,FRI /ST 09:00 /SD 05/06/2024 /ED 12/31/2024 ` +
+		`/RU SYSTEM /RL HIGHEST /TN Vendor\Updater /TR "\"C:\Program Files\Vendor\update.exe\" /quiet" /RI 30 /DU 0002:00 /K /F /Z`
+	result, err := ParseSchtasks(command, SchtasksOptions{Start: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Path != `\Vendor\Updater` || !result.Force || result.Password != "" || len(result.Warnings) > 0 {
+		t.Errorf("result = %q, %v, %q, %q", result.Path, result.Force, result.Password, result.Warnings)
+	}
+
+	def := result.Definition
+	wantActions := []Action{ExecAction{Path: `C:\Program Files\Vendor\update.exe`, Args: "/quiet"}}
+	if !reflect.DeepEqual(def.Actions, wantActions) {
+		t.Errorf("actions = %#v", def.Actions)
+	}
+	wantPrincipal := Principal{LogonType: TASK_LOGON_SERVICE_ACCOUNT, RunLevel: TASK_RUNLEVEL_HIGHEST, UserID: "SYSTEM"}
+	if !reflect.DeepEqual(def.Principal, wantPrincipal) {
+		t.Errorf("principal = %#v", def.Principal)
+	}
+	wantTriggers := []Trigger{WeeklyTrigger{
+		TaskTrigger: TaskTrigger{
+			Enabled:       true,
+			StartBoundary: time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC),
+			EndBoundary:   time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+			RepetitionPattern: RepetitionPattern{
+				RepetitionInterval: period.NewHMS(0, 30, 0),
+				RepetitionDuration: period.NewHMS(2, 0, 0),
+				StopAtDurationEnd:  true,
+			},
+		},
+		DaysOfWeek:   Monday | Friday,
+		WeekInterval: EveryWeek,
+	}}
+	if !reflect.DeepEqual(def.Triggers, wantTriggers) {
+		t.Errorf("triggers = %#v", def.Triggers)
+	}
+	if def.Settings.DeleteExpiredTaskAfter != "PT0S" {
+		t.Errorf("DeleteExpiredTaskAfter = %q", def.Settings.DeleteExpiredTaskAfter)
+	}
+}
+
+func TestParseSchtasksSchedules(t *testing.T) {
+	start := time.Date(2024, 5, 1, 8, 15, 30, 0, time.UTC)
+	at := func(hour, minute int) TaskTrigger {
+		return TaskTrigger{Enabled: true, StartBoundary: time.Date(2024, 5, 1, hour, minute, 0, 0, time.UTC)}
+	}
+	repeating := func(tt TaskTrigger, interval, duration int) TaskTrigger {
+		tt.RepetitionInterval = minutesPeriod(interval)
+		if duration > 0 {
+			tt.RepetitionDuration = minutesPeriod(duration)
+		}
+		return tt
+	}
+
+	tests := []struct {
+		args    string
+		want    Trigger
+		warning string
+	}{
+		{args: "/sc minute /mo 15", want: TimeTrigger{TaskTrigger: repeating(at(8, 15), 15, 0)}},
+		{args: "/sc hourly /mo 2 /st 00:30 /du 0012:00", want: TimeTrigger{TaskTrigger: repeating(at(0, 30), 120, 720)}},
+		{args: "/sc daily /mo 3 /st 22:00 /et 02:00", want: DailyTrigger{TaskTrigger: repeating(at(22, 0), 10, 240), DayInterval: 3}},
+		{args: "/sc weekly /mo 2", want: WeeklyTrigger{TaskTrigger: at(8, 15), DaysOfWeek: Monday, WeekInterval: EveryOtherWeek}},
+		{args: "/sc monthly /st 03:00", want: MonthlyTrigger{TaskTrigger: at(3, 0), DaysOfMonth: One, MonthsOfYear: AllMonths}},
+		{args: "/sc monthly /mo 3 /d 1,15", want: MonthlyTrigger{TaskTrigger: at(8, 15), DaysOfMonth: One | Fifteen, MonthsOfYear: February | May | August | November}},
+		{args: "/sc monthly /mo 5", want: MonthlyTrigger{TaskTrigger: at(8, 15), DaysOfMonth: One, MonthsOfYear: March | May | October}, warning: "every 5 months"},
+		{args: "/sc monthly /mo lastday /m jan,jul", want: MonthlyTrigger{TaskTrigger: at(8, 15), MonthsOfYear: January | July, RunOnLastDayOfMonth: true}},
+		{args: "/sc monthly /mo second /d TUE", want: MonthlyDOWTrigger{TaskTrigger: at(8, 15), DaysOfWeek: Tuesday, MonthsOfYear: AllMonths, WeeksOfMonth: Second}},
+		{args: "/sc monthly /mo last /d FRI /m DEC", want: MonthlyDOWTrigger{TaskTrigger: at(8, 15), DaysOfWeek: Friday, MonthsOfYear: December, RunOnLastWeekOfMonth: true}},
+		{args: "/sc once /st 23:00 /ri 60", want: TimeTrigger{TaskTrigger: repeating(at(23, 0), 60, 0)}},
+		{args: "/sc onstart /delay 0001:30", want: BootTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Delay: period.NewHMS(0, 1, 30)}},
+		{args: "/sc onlogon /st 09:00", want: LogonTrigger{TaskTrigger: TaskTrigger{Enabled: true}}, warning: "/st does not apply to /sc ONLOGON"},
+		{args: "/sc onidle /i 20", want: IdleTrigger{TaskTrigger: TaskTrigger{Enabled: true}}},
+		{
+			args: `/sc onevent /ec System /mo "*[System[EventID=6005]]"`,
+			want: EventTrigger{
+				TaskTrigger:  TaskTrigger{Enabled: true},
+				Subscription: `<QueryList><Query Id="0" Path="System"><Select Path="System">*[System[EventID=6005]]</Select></Query></QueryList>`,
+			},
+		},
+		{args: "/sc daily /s server /u admin /p", want: DailyTrigger{TaskTrigger: at(8, 15), DayInterval: EveryDay}, warning: "/p is left out"},
+	}
+	for _, test := range tests {
+		t.Run(test.args, func(t *testing.T) {
+			result, err := ParseSchtasks("schtasks /create /tn Test /tr test.exe "+test.args, SchtasksOptions{Start: start})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Definition.Triggers) != 1 || !reflect.DeepEqual(result.Definition.Triggers[0], test.want) {
+				t.Errorf("triggers = %#v, want %#v", result.Definition.Triggers, test.want)
+			}
+			if warnings := strings.Join(result.Warnings, "\n"); test.warning == "" && warnings != "" || !strings.Contains(warnings, test.warning) {
+				t.Errorf("warnings = %q, want %q", warnings, test.warning)
+			}
+		})
+	}
+}
+
+func TestParseSchtasksPrincipals(t *testing.T) {
+	tests := []struct {
+		args      string
+		logonType TaskLogonType
+		userID    string
+		password  string
+	}{
+		{args: "", logonType: TASK_LOGON_INTERACTIVE_TOKEN},
+		{args: `/ru ""`, logonType: TASK_LOGON_SERVICE_ACCOUNT, userID: "SYSTEM"},
+		{args: `/ru "NT AUTHORITY\NETWORK SERVICE"`, logonType: TASK_LOGON_SERVICE_ACCOUNT, userID: `NT AUTHORITY\NETWORK SERVICE`},
+		{args: `/ru CORP\svc /rp secret`, logonType: TASK_LOGON_PASSWORD, userID: `CORP\svc`, password: "secret"},
+		{args: `/ru CORP\svc /rp /f`, logonType: TASK_LOGON_PASSWORD, userID: `CORP\svc`, password: "*"},
+		{args: `/ru CORP\svc`, logonType: TASK_LOGON_PASSWORD, userID: `CORP\svc`, password: "*"},
+		{args: `/ru CORP\jane /it`, logonType: TASK_LOGON_INTERACTIVE_TOKEN, userID: `CORP\jane`},
+		{args: `/ru CORP\jane /np`, logonType: TASK_LOGON_S4U, userID: `CORP\jane`},
+	}
+	for _, test := range tests {
+		t.Run(test.args, func(t *testing.T) {
+			result, err := ParseSchtasks("/create /sc onstart /tn Test /tr test.exe "+test.args, SchtasksOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := result.Definition.Principal
+			if p.LogonType != test.logonType || p.UserID != test.userID || result.Password != test.password {
+				t.Errorf("principal = %v %q, password %q", p.LogonType, p.UserID, result.Password)
+			}
+		})
+	}
+}
+
+func TestParseSchtasksErrors(t *testing.T) {
+	tests := map[string]string{
+		"not create":         "schtasks /delete /tn Test",
+		"no name":            "schtasks /create /sc daily /tr test.exe",
+		"no command":         "schtasks /create /sc daily /tn Test",
+		"no schedule":        "schtasks /create /tn Test /tr test.exe",
+		"unknown schedule":   "schtasks /create /sc yearly /tn Test /tr test.exe",
+		"unknown option":     "schtasks /create /sc daily /tn Test /tr test.exe /x",
+		"repeated option":    "schtasks /create /sc daily /tn Test /tr test.exe /sc weekly",
+		"missing value":      "schtasks /create /sc daily /tn Test /tr",
+		"stray argument":     "schtasks /create /sc daily /tn Test /tr test.exe now",
+		"unterminated quote": `schtasks /create /sc daily /tn "Test /tr test.exe`,
+		"invalid modifier":   "schtasks /create /sc minute /mo 1440 /tn Test /tr test.exe",
+		"day interval":       "schtasks /create /sc daily /mo 300 /tn Test /tr test.exe",
+		"invalid day":        "schtasks /create /sc weekly /d MONDAY /tn Test /tr test.exe",
+		"invalid month":      "schtasks /create /sc monthly /m JANUARY /tn Test /tr test.exe",
+		"months and step":    "schtasks /create /sc monthly /mo 2 /m JAN /tn Test /tr test.exe",
+		"week without days":  "schtasks /create /sc monthly /mo first /tn Test /tr test.exe",
+		"invalid date":       "schtasks /create /sc daily /sd 2024-05-01 /tn Test /tr test.exe",
+		"invalid time":       "schtasks /create /sc daily /st 9am /tn Test /tr test.exe",
+		"invalid duration":   "schtasks /create /sc daily /du 2h /tn Test /tr test.exe",
+		"end and duration":   "schtasks /create /sc daily /du 0001:00 /et 10:00 /tn Test /tr test.exe",
+		"idle without /i":    "schtasks /create /sc onidle /tn Test /tr test.exe",
+		"event without /ec":  "schtasks /create /sc onevent /tn Test /tr test.exe",
+		"invalid run level":  "schtasks /create /sc daily /rl admin /tn Test /tr test.exe",
+		"xml":                "schtasks /create /xml task.xml /tn Test",
+	}
+	for name, command := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseSchtasks(command, SchtasksOptions{}); err == nil {
+				t.Error("parsing did not fail")
+			}
+		})
+	}
+}
+
+func TestExportSchtasks(t *testing.T) {
+	def := DefaultDefinition()
+	def.AddAction(ExecAction{Path: `C:\Program Files\Vendor\update.exe`, Args: `/quiet /log "C:\Temp\update log.txt"`})
+	def.AddTrigger(MonthlyDOWTrigger{
+		TaskTrigger:  TaskTrigger{Enabled: true, StartBoundary: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)},
+		DaysOfWeek:   Monday | Friday,
+		MonthsOfYear: January | July,
+		WeeksOfMonth: Second,
+	})
+	def.Principal = Principal{LogonType: TASK_LOGON_SERVICE_ACCOUNT, UserID: "SYSTEM", RunLevel: TASK_RUNLEVEL_HIGHEST}
+
+	command, err := ExportSchtasks(`\Vendor\Updater`, def, SchtasksOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `schtasks /create /tn \Vendor\Updater /tr "\"C:\Program Files\Vendor\update.exe\" /quiet /log \"C:\Temp\update log.txt\"" ` +
+		`/sc MONTHLY /mo SECOND /d MON,FRI /m JAN,JUL /sd 05/01/2024 /st 09:00 /ru SYSTEM /rl HIGHEST /f`
+	if command != want {
+		t.Errorf("command =\n%s\nwant\n%s", command, want)
+	}
+}
+
+func TestExportSchtasksRoundTrip(t *testing.T) {
+	at := TaskTrigger{Enabled: true, StartBoundary: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)}
+	repeating := at
+	repeating.RepetitionPattern = RepetitionPattern{RepetitionInterval: period.NewHMS(0, 45, 0), RepetitionDuration: period.NewHMS(10, 0, 0), StopAtDurationEnd: true}
+	repeating.EndBoundary = time.Date(2025, 1, 31, 23, 59, 59, 0, time.UTC)
+	hourly := at
+	hourly.RepetitionInterval = period.NewHMS(3, 0, 0)
+
+	triggers := []Trigger{
+		TimeTrigger{TaskTrigger: at},
+		TimeTrigger{TaskTrigger: repeating},
+		TimeTrigger{TaskTrigger: hourly},
+		DailyTrigger{TaskTrigger: repeating, DayInterval: 200},
+		WeeklyTrigger{TaskTrigger: at, DaysOfWeek: Saturday | Sunday, WeekInterval: 3},
+		MonthlyTrigger{TaskTrigger: at, DaysOfMonth: One | ThirtyOne, MonthsOfYear: AllMonths},
+		MonthlyTrigger{TaskTrigger: at, MonthsOfYear: March, RunOnLastDayOfMonth: true},
+		MonthlyDOWTrigger{TaskTrigger: at, DaysOfWeek: Sunday, MonthsOfYear: AllMonths, RunOnLastWeekOfMonth: true},
+		BootTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Delay: period.NewHMS(0, 2, 30)},
+		LogonTrigger{TaskTrigger: TaskTrigger{Enabled: true}},
+		IdleTrigger{TaskTrigger: TaskTrigger{Enabled: true}},
+		EventTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Subscription: schtasksSubscription("Microsoft-Windows-Backup", `*[System[(EventID=4 and Level<3)]]`)},
+	}
+	principals := []Principal{
+		{LogonType: TASK_LOGON_INTERACTIVE_TOKEN, RunLevel: TASK_RUNLEVEL_LUA},
+		{LogonType: TASK_LOGON_INTERACTIVE_TOKEN, RunLevel: TASK_RUNLEVEL_HIGHEST, UserID: `CORP\jane`},
+		{LogonType: TASK_LOGON_S4U, RunLevel: TASK_RUNLEVEL_LUA, UserID: `CORP\svc`},
+		{LogonType: TASK_LOGON_PASSWORD, RunLevel: TASK_RUNLEVEL_LUA, UserID: `CORP\svc backup`},
+		{LogonType: TASK_LOGON_SERVICE_ACCOUNT, RunLevel: TASK_RUNLEVEL_LUA, UserID: "LOCAL SERVICE"},
+	}
+
+	for i, trigger := range triggers {
+		def := DefaultDefinition()
+		def.AddAction(ExecAction{Path: `C:\Tools\run.cmd`, Args: `"%TEMP%\a b" \\server\share\`})
+		def.AddTrigger(trigger)
+		def.Principal = principals[i%len(principals)]
+		if i%2 == 0 {
+			def.Settings.DeleteExpiredTaskAfter = "PT0S"
+		}
+		if trigger.GetType() == TASK_TRIGGER_IDLE {
+			def.Settings.IdleDuration = period.NewHMS(0, 25, 0)
+			def.Settings.Compatibility = TASK_COMPATIBILITY_V1
+		}
+
+		t.Run(trigger.GetType().String(), func(t *testing.T) {
+			layout := "2006-01-02"
+			command, err := ExportSchtasks(`\Test`, def, SchtasksOptions{DateLayout: layout})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := ParseSchtasks(command, SchtasksOptions{Start: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), DateLayout: layout})
+			if err != nil {
+				t.Fatalf("%s: %v", command, err)
+			}
+			result.Definition.RegistrationInfo = def.RegistrationInfo
+			if diff := DiffDefinitions(def, result.Definition); len(diff) > 0 || len(result.Warnings) > 0 {
+				t.Errorf("%s:\n%s\n%s", command, strings.Join(diff, "\n"), strings.Join(result.Warnings, "\n"))
+			}
+		})
+	}
+}
+
+func TestExportSchtasksErrors(t *testing.T) {
+	valid := func() Definition {
+		def := DefaultDefinition()
+		def.AddAction(ExecAction{Path: "test.exe"})
+		def.AddTrigger(DailyTrigger{TaskTrigger: TaskTrigger{Enabled: true, StartBoundary: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)}, DayInterval: EveryDay})
+		return def
+	}
+	daily := func(change func(*DailyTrigger)) func(*Definition) {
+		return func(def *Definition) {
+			t := def.Triggers[0].(DailyTrigger)
+			change(&t)
+			def.Triggers[0] = t
+		}
+	}
+
+	tests := map[string]func(*Definition){
+		"two actions": func(def *Definition) { def.AddAction(ExecAction{Path: "other.exe"}) },
+		"com handler": func(def *Definition) {
+			def.Actions[0] = ComHandlerAction{ClassID: "{00000000-0000-0000-0000-000000000000}"}
+		},
+		"working directory": func(def *Definition) { def.Actions[0] = ExecAction{Path: "test.exe", WorkingDir: `C:\Temp`} },
+		"no triggers":       func(def *Definition) { def.Triggers = nil },
+		"disabled":          func(def *Definition) { def.Settings.Enabled = false },
+		"settings":          func(def *Definition) { def.Settings.WakeToRun = true },
+		"group":             func(def *Definition) { def.Principal.GroupID = "Users" },
+		"password logon":    func(def *Definition) { def.Principal.LogonType = TASK_LOGON_PASSWORD },
+		"service logon": func(def *Definition) {
+			def.Principal = Principal{LogonType: TASK_LOGON_SERVICE_ACCOUNT, UserID: "jane"}
+		},
+		"privileges":       func(def *Definition) { def.Principal.RequiredPrivileges = []Privilege{SE_BACKUP_NAME} },
+		"random delay":     daily(func(t *DailyTrigger) { t.RandomDelay = period.NewHMS(0, 5, 0) }),
+		"disabled trigger": daily(func(t *DailyTrigger) { t.Enabled = false }),
+		"seconds":          daily(func(t *DailyTrigger) { t.StartBoundary = t.StartBoundary.Add(time.Second) }),
+		"end boundary":     daily(func(t *DailyTrigger) { t.EndBoundary = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC) }),
+		"interval seconds": daily(func(t *DailyTrigger) { t.RepetitionInterval = period.NewHMS(0, 0, 90) }),
+		"session trigger": func(def *Definition) {
+			def.Triggers[0] = SessionStateChangeTrigger{TaskTrigger: TaskTrigger{Enabled: true}}
+		},
+		"logon user": func(def *Definition) {
+			def.Triggers[0] = LogonTrigger{TaskTrigger: TaskTrigger{Enabled: true}, UserID: "jane"}
+		},
+		"boot boundary": func(def *Definition) {
+			def.Triggers[0] = BootTrigger{TaskTrigger: TaskTrigger{Enabled: true, StartBoundary: time.Now()}}
+		},
+		"several weeks": func(def *Definition) {
+			def.Triggers[0] = MonthlyDOWTrigger{TaskTrigger: def.Triggers[0].(DailyTrigger).TaskTrigger, DaysOfWeek: Monday, WeeksOfMonth: First | Third}
+		},
+		"value queries": func(def *Definition) {
+			def.Triggers[0] = EventTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Subscription: schtasksSubscription("System", "*"), ValueQueries: map[string]string{"id": "Event/System/EventID"}}
+		},
+		"complex event": func(def *Definition) {
+			def.Triggers[0] = EventTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Subscription: "<QueryList></QueryList>"}
+		},
+		"idle duration": func(def *Definition) {
+			def.Triggers[0] = IdleTrigger{TaskTrigger: TaskTrigger{Enabled: true}}
+			def.Settings.IdleDuration = period.NewHMS(20, 0, 0)
+		},
+		"long command":        func(def *Definition) { def.Actions[0] = ExecAction{Path: "test.exe", Args: strings.Repeat("x", 300)} },
+		"newer compatibility": func(def *Definition) { def.Settings.Compatibility = TASK_COMPATIBILITY_V2_4 },
+	}
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			def := valid()
+			change(&def)
+			if _, err := ExportSchtasks(`\Test`, def, SchtasksOptions{}); err == nil {
+				t.Error("exporting did not fail")
+			}
+		})
+	}
+
+	if _, err := ExportSchtasks(`\Test`, valid(), SchtasksOptions{}); err != nil {
+		t.Errorf("exporting a valid definition failed: %v", err)
+	}
+	if _, err := ExportSchtasks(`Test`, valid(), SchtasksOptions{}); err == nil {
+		t.Error("exporting to a relative path did not fail")
+	}
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := map[string][]string{
+		`a b	c`:                {"a", "b", "c"},
+		`"a b" c`:              {"a b", "c"},
+		`a\\b "c\\" d`:         {`a\\b`, `c\`, "d"},
+		`\"a\" "b \"c\""`:      {`"a"`, `b "c"`},
+		`"a ""quoted"" word"`:  {`a "quoted" word`},
+		`"" x`:                 {"", "x"},
+		`C:\Program" "Files\x`: {`C:\Program Files\x`},
+	}
+	for line, want := range tests {
+		got, err := splitCommandLine(line)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("splitCommandLine(%q) = %q, %v, want %q", line, got, err, want)
+		}
+		var quoted []string
+		for _, arg := range want {
+			quoted = append(quoted, quoteCommandLineArg(arg))
+		}
+		if got, _ := splitCommandLine(strings.Join(quoted, " ")); !reflect.DeepEqual(got, want) {
+			t.Errorf("quoting %q gives %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package taskmaster
+
+import (
+	"testing"
+)
+
+func TestParseSecurityDescriptor(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string // expected String() of the parsed descriptor
+		wantErr bool
+	}{
+		{name: "task default", input: "D:(A;;FA;;;BA)(A;;FA;;;SY)(A;;FRFX;;;LS)", want: "D:(A;;FA;;;BA)(A;;FA;;;SY)(A;;FRFX;;;LS)"},
+		{name: "owner group and flags", input: "O:BAG:SYD:PAI(A;OICI;FA;;;S-1-5-21-1-2-3-500)(D;;FW;;;WD)", want: "O:BAG:SYD:PAI(A;OICI;FA;;;S-1-5-21-1-2-3-500)(D;;FW;;;WD)"},
+		{name: "sid owner", input: "O:S-1-5-18G:S-1-5-18D:(A;;FR;;;AU)", want: "O:S-1-5-18G:S-1-5-18D:(A;;FR;;;AU)"},
+		{name: "sacl", input: "D:(A;;FA;;;BA)S:(AU;SAFA;FA;;;WD)", want: "D:(A;;FA;;;BA)S:(AU;SAFA;FA;;;WD)"},
+		{name: "hex rights", input: "D:(A;;0x1200a9;;;AU)", want: "D:(A;;FRFX;;;AU)"},
+		{name: "bit aliases", input: "D:(A;;RCSD;;;AU)", want: "D:(A;;RCSD;;;AU)"},
+		{name: "unaliased rights", input: "D:(A;;0x3;;;AU)", want: "D:(A;;CCDC;;;AU)"},
+		{name: "conditional ace", input: `D:(XA;;FX;;;WD;(@User.Title == "PM"))`, want: `D:(XA;;FX;;;WD;(@User.Title == "PM"))`},
+		{name: "empty dacl", input: "D:", want: "D:"},
+		{name: "null dacl", input: "D:NO_ACCESS_CONTROL", want: "D:NO_ACCESS_CONTROL"},
+		{name: "unknown component", input: "X:BA", wantErr: true},
+		{name: "unknown ace type", input: "D:(Q;;FA;;;BA)", wantErr: true},
+		{name: "unknown right", input: "D:(A;;ZZ;;;BA)", wantErr: true},
+		{name: "short ace", input: "D:(A;;FA;;BA)", wantErr: true},
+		{name: "unterminated ace", input: "D:(A;;FA;;;BA", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSecurityDescriptor(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for %q, got %+v", tt.input, sd)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := sd.String(); got != tt.want {
+				t.Fatalf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSecurityDescriptorFields(t *testing.T) {
+	sd, err := ParseSecurityDescriptor("O:BAG:SYD:P(A;OICI;FA;;;BA)(OA;CIIO;RP;4828cc14-1437-45bc-9b07-ad6f015e5f28;bf967aba-0de6-11d0-a285-00aa003049e2;AU)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sd.Owner != "BA" || sd.Group != "SY" || sd.SACL != nil {
+		t.Fatalf("unexpected header: %+v", sd)
+	}
+	if sd.DACL.Flags != ACLProtected || len(sd.DACL.ACEs) != 2 {
+		t.Fatalf("unexpected DACL: %+v", sd.DACL)
+	}
+
+	ace := sd.DACL.ACEs[0]
+	if ace.Type != ACCESS_ALLOWED_ACE_TYPE || ace.Flags != OBJECT_INHERIT_ACE|CONTAINER_INHERIT_ACE || ace.Rights != FILE_ALL_ACCESS || ace.SID != "BA" {
+		t.Fatalf("unexpected first ACE: %+v", ace)
+	}
+
+	ace = sd.DACL.ACEs[1]
+	if ace.Type != ACCESS_ALLOWED_OBJECT_ACE_TYPE || ace.ObjectGUID != "4828cc14-1437-45bc-9b07-ad6f015e5f28" || ace.InheritObjectGUID != "bf967aba-0de6-11d0-a285-00aa003049e2" {
+		t.Fatalf("unexpected object ACE: %+v", ace)
+	}
+}
+
+func TestSecurityDescriptorRights(t *testing.T) {
+	sd, err := ParseSecurityDescriptor("D:(A;;FA;;;BA)(A;;FRFX;;;AU)(D;;FX;;;S-1-5-11)(A;OICIIO;FA;;;CO)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sd.ExplicitRights("S-1-5-32-544"); got != FILE_ALL_ACCESS {
+		t.Fatalf("administrators: want %s, got %s", FILE_ALL_ACCESS, got)
+	}
+	// execute is denied to authenticated users by SID, so only the read bits it does not share remain
+	if got, want := sd.ExplicitRights("AU"), FILE_GENERIC_READ&^FILE_GENERIC_EXECUTE; got != want {
+		t.Fatalf("authenticated users: want %s, got %s", want, got)
+	}
+	// inherit-only ACEs do not apply to the object itself
+	if got := sd.ExplicitRights("CO"); got != 0 {
+		t.Fatalf("creator owner: want no rights, got %s", got)
+	}
+
+	sd.Grant("SY", FILE_GENERIC_READ)
+	sd.Grant("S-1-5-18", FILE_GENERIC_EXECUTE)
+	if got := sd.ExplicitRights("SY"); got != FILE_GENERIC_READ|FILE_GENERIC_EXECUTE {
+		t.Fatalf("system: want %s, got %s", FILE_GENERIC_READ|FILE_GENERIC_EXECUTE, got)
+	}
+
+	sd.Revoke("BA", FILE_ALL_ACCESS)
+	if got := sd.ExplicitRights("BA"); got != 0 {
+		t.Fatalf("administrators after revoke: want no rights, got %s", got)
+	}
+	if want := "D:(A;;FRFX;;;AU)(D;;FX;;;S-1-5-11)(A;OICIIO;FA;;;CO)(A;;FRFX;;;SY)"; sd.String() != want {
+		t.Fatalf("want %q, got %q", want, sd.String())
+	}
+}
@@ -0,0 +1,86 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"fmt"
+
+	"github.com/go-ole/go-ole/oleutil"
+)
+
+// GetFolderSecurityDescriptor returns the security descriptor of the task folder at
+// path in SDDL form. Use ParseSecurityDescriptor to inspect it. Reading the SACL
+// (SACL_SECURITY_INFORMATION) requires SeSecurityPrivilege.
+// https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nf-taskschd-itaskfolder-getsecuritydescriptor
+func (t *TaskService) GetFolderSecurityDescriptor(path string, info SecurityInformation) (string, error) {
+	if len(path) == 0 || path[0] != '\\' {
+		return "", ErrInvalidPath
+	}
+
+	folder, err := oleutil.CallMethod(t.taskServiceObj, "GetFolder", path)
+	if err != nil {
+		return "", fmt.Errorf("error getting folder %s: %w", path, getTaskSchedulerError(err))
+	}
+	folderObj := folder.ToIDispatch()
+	defer folderObj.Release()
+
+	res, err := oleutil.CallMethod(folderObj, "GetSecurityDescriptor", int(info))
+	if err != nil {
+		return "", fmt.Errorf("error getting security descriptor of folder %s: %w", path, getTaskSchedulerError(err))
+	}
+	defer res.Clear()
+
+	return res.ToString(), nil
+}
+
+// SetFolderSecurityDescriptor sets the security descriptor of the task folder at
+// path. The sddl parameter is a security descriptor in SDDL form, such as the String
+// of a SecurityDescriptor; only the parts it contains are changed.
+// https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nf-taskschd-itaskfolder-setsecuritydescriptor
+func (t *TaskService) SetFolderSecurityDescriptor(path, sddl string) error {
+	if len(path) == 0 || path[0] != '\\' {
+		return ErrInvalidPath
+	}
+
+	folder, err := oleutil.CallMethod(t.taskServiceObj, "GetFolder", path)
+	if err != nil {
+		return fmt.Errorf("error getting folder %s: %w", path, getTaskSchedulerError(err))
+	}
+	folderObj := folder.ToIDispatch()
+	defer folderObj.Release()
+
+	_, err = oleutil.CallMethod(folderObj, "SetSecurityDescriptor", sddl, 0)
+	if err != nil {
+		return fmt.Errorf("error setting security descriptor of folder %s: %w", path, getTaskSchedulerError(err))
+	}
+
+	return nil
+}
+
+// GetSecurityDescriptor returns the security descriptor of the registered task in
+// SDDL form. Use ParseSecurityDescriptor to inspect it. Reading the SACL
+// (SACL_SECURITY_INFORMATION) requires SeSecurityPrivilege.
+// https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nf-taskschd-iregisteredtask-getsecuritydescriptor
+func (r *RegisteredTask) GetSecurityDescriptor(info SecurityInformation) (string, error) {
+	res, err := oleutil.CallMethod(r.taskObj, "GetSecurityDescriptor", int(info))
+	if err != nil {
+		return "", fmt.Errorf("error getting security descriptor of registered task %s: %w", r.Path, getTaskSchedulerError(err))
+	}
+	defer res.Clear()
+
+	return res.ToString(), nil
+}
+
+// SetSecurityDescriptor sets the security descriptor of the registered task. The
+// sddl parameter is a security descriptor in SDDL form, such as the String of a
+// SecurityDescriptor; only the parts it contains are changed.
+// https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nf-taskschd-iregisteredtask-setsecuritydescriptor
+func (r *RegisteredTask) SetSecurityDescriptor(sddl string) error {
+	_, err := oleutil.CallMethod(r.taskObj, "SetSecurityDescriptor", sddl, 0)
+	if err != nil {
+		return fmt.Errorf("error setting security descriptor of registered task %s: %w", r.Path, getTaskSchedulerError(err))
+	}
+
+	return nil
+}
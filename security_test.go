@@ -0,0 +1,64 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"testing"
+)
+
+func TestTaskSecurityDescriptor(t *testing.T) {
+	taskService := setupTaskService(t)
+	testTask := createTestTask(taskService)
+	defer testTask.Release()
+
+	sddl, err := testTask.GetSecurityDescriptor(DACL_SECURITY_INFORMATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := ParseSecurityDescriptor(sddl)
+	if err != nil {
+		t.Fatalf("failed to parse task security descriptor %q: %v", sddl, err)
+	}
+
+	sd.Grant("BU", FILE_GENERIC_READ)
+	if err := testTask.SetSecurityDescriptor(sd.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	sddl, err = testTask.GetSecurityDescriptor(DACL_SECURITY_INFORMATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err = ParseSecurityDescriptor(sddl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sd.ExplicitRights("BU"); got&FILE_GENERIC_READ != FILE_GENERIC_READ {
+		t.Fatalf("expected built-in users to be able to read the task, got %s in %q", got, sddl)
+	}
+}
+
+func TestFolderSecurityDescriptor(t *testing.T) {
+	taskService := setupTaskService(t)
+	createTestTask(taskService)
+
+	sddl, err := taskService.GetFolderSecurityDescriptor(testTaskRoot, OWNER_SECURITY_INFORMATION|DACL_SECURITY_INFORMATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := ParseSecurityDescriptor(sddl)
+	if err != nil {
+		t.Fatalf("failed to parse folder security descriptor %q: %v", sddl, err)
+	}
+	if sd.DACL == nil {
+		t.Fatalf("expected folder security descriptor %q to have a DACL", sddl)
+	}
+
+	if err := taskService.SetFolderSecurityDescriptor(testTaskRoot, SecurityDescriptor{DACL: sd.DACL}.String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := taskService.GetFolderSecurityDescriptor(`bad path`, DACL_SECURITY_INFORMATION); err != ErrInvalidPath {
+		t.Fatalf("want ErrInvalidPath, got %v", err)
+	}
+}
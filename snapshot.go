@@ -0,0 +1,312 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	ole "github.com/go-ole/go-ole"
+	"github.com/go-ole/go-ole/oleutil"
+)
+
+// snapshotManifestName is the name of the manifest file in a snapshot archive.
+const snapshotManifestName = "manifest.json"
+
+// Snapshot is a portable backup of a task folder tree. It can be written to and
+// read from a directory or a zip archive, both of which contain a manifest.json
+// plus one XML file per task under tasks\.
+type Snapshot struct {
+	Created      time.Time      `json:"created"`
+	ComputerName string         `json:"computerName"`
+	Root         string         `json:"root"`    // the folder the snapshot was taken of
+	Folders      []string       `json:"folders"` // the paths of every folder in the snapshot, parents first
+	Tasks        []SnapshotTask `json:"tasks"`
+}
+
+// SnapshotTask is a single task in a Snapshot.
+type SnapshotTask struct {
+	Path      string        `json:"path"`
+	Enabled   bool          `json:"enabled"`
+	UserID    string        `json:"userId,omitempty"`
+	GroupID   string        `json:"groupId,omitempty"`
+	LogonType TaskLogonType `json:"logonType"`
+	RunLevel  TaskRunLevel  `json:"runLevel"`
+	File      string        `json:"file"` // the path of the task's XML file, relative to the archive root
+	XMLText   string        `json:"-"`    // the XML-formatted definition of the task
+}
+
+// RestoreMode specifies what Restore does with tasks that already exist.
+type RestoreMode uint
+
+const (
+	RestoreSkipExisting RestoreMode = iota // leave existing tasks untouched
+	RestoreOverwrite                       // replace existing tasks with the snapshot's definition
+)
+
+// RestoreOptions configures Restore.
+type RestoreOptions struct {
+	Mode       RestoreMode
+	Principals map[string]string // maps a snapshot task's UserID to the UserID it is restored as
+	Passwords  map[string]string // passwords of TASK_LOGON_PASSWORD users, keyed by the (remapped) UserID
+}
+
+// RestoreResult reports the outcome of a Restore.
+type RestoreResult struct {
+	Restored      []string         // tasks that were registered
+	Skipped       []string         // tasks that already existed and were left untouched
+	NeedsPassword []string         // TASK_LOGON_PASSWORD tasks that were not restored because no password was supplied
+	Failed        map[string]error // tasks that could not be registered
+}
+
+// Snapshot takes a snapshot of the folder at path, including all of its subfolders
+// and tasks.
+func (t *TaskService) Snapshot(path string) (Snapshot, error) {
+	folder, err := t.GetTaskFolder(path)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer folder.Release()
+
+	snapshot := Snapshot{
+		Created:      time.Now(),
+		ComputerName: t.connectedComputerName,
+		Root:         path,
+	}
+
+	var walk func(*TaskFolder, string)
+	walk = func(folder *TaskFolder, folderPath string) {
+		snapshot.Folders = append(snapshot.Folders, folderPath)
+		for _, task := range folder.RegisteredTasks {
+			snapshot.Tasks = append(snapshot.Tasks, SnapshotTask{
+				Path:      task.Path,
+				Enabled:   task.Enabled,
+				UserID:    task.Definition.Principal.UserID,
+				GroupID:   task.Definition.Principal.GroupID,
+				LogonType: task.Definition.Principal.LogonType,
+				RunLevel:  task.Definition.Principal.RunLevel,
+				File:      snapshotTaskFile(task.Path),
+				XMLText:   task.Definition.XMLText,
+			})
+		}
+		for _, subFolder := range folder.SubFolders {
+			walk(subFolder, subFolder.Path)
+		}
+	}
+	walk(&folder, path)
+
+	return snapshot, nil
+}
+
+// snapshotTaskFile returns the archive-relative file name of the task at path.
+func snapshotTaskFile(path string) string {
+	return "tasks/" + strings.Trim(strings.ReplaceAll(path, `\`, "/"), "/") + ".xml"
+}
+
+// WriteDir writes the snapshot to the directory dir, creating it if necessary.
+func (s Snapshot) WriteDir(dir string) error {
+	return s.write(func(name string, data []byte) error {
+		fullPath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(fullPath, data, 0o644)
+	})
+}
+
+// WriteZip writes the snapshot to w as a zip archive.
+func (s Snapshot) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	err := s.write(func(name string, data []byte) error {
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(data)
+		return err
+	})
+	if err != nil {
+		zw.Close()
+		return err
+	}
+
+	return zw.Close()
+}
+
+func (s Snapshot) write(writeFile func(name string, data []byte) error) error {
+	manifest, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding snapshot manifest: %w", err)
+	}
+	if err := writeFile(snapshotManifestName, manifest); err != nil {
+		return fmt.Errorf("error writing snapshot manifest: %w", err)
+	}
+
+	for _, task := range s.Tasks {
+		if err := writeFile(task.File, []byte(task.XMLText)); err != nil {
+			return fmt.Errorf("error writing task %s: %w", task.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// ReadSnapshotDir reads a snapshot written by Snapshot.WriteDir.
+func ReadSnapshotDir(dir string) (Snapshot, error) {
+	return readSnapshot(os.DirFS(dir))
+}
+
+// ReadSnapshotZip reads a snapshot written by Snapshot.WriteZip.
+func ReadSnapshotZip(r io.ReaderAt, size int64) (Snapshot, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error opening snapshot archive: %w", err)
+	}
+
+	return readSnapshot(zr)
+}
+
+func readSnapshot(fsys fs.FS) (Snapshot, error) {
+	manifest, err := fs.ReadFile(fsys, snapshotManifestName)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("error reading snapshot manifest: %w", err)
+	}
+
+	var s Snapshot
+	if err := json.Unmarshal(manifest, &s); err != nil {
+		return Snapshot{}, fmt.Errorf("error decoding snapshot manifest: %w", err)
+	}
+
+	for i, task := range s.Tasks {
+		if !fs.ValidPath(task.File) {
+			return Snapshot{}, fmt.Errorf("error reading task %s: invalid file name %q", task.Path, task.File)
+		}
+		xmlText, err := fs.ReadFile(fsys, task.File)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("error reading task %s: %w", task.Path, err)
+		}
+		s.Tasks[i].XMLText = string(xmlText)
+	}
+
+	return s, nil
+}
+
+// Restore recreates the folders and tasks of a snapshot on the connected computer.
+// Tasks that cannot be registered are reported in RestoreResult.Failed rather than
+// aborting the restore. TASK_LOGON_PASSWORD tasks are only restored if a password
+// for their user is supplied in opts.Passwords; otherwise they are reported in
+// RestoreResult.NeedsPassword.
+func (t *TaskService) Restore(s Snapshot, opts RestoreOptions) (RestoreResult, error) {
+	result := RestoreResult{Failed: map[string]error{}}
+
+	folders := append([]string{}, s.Folders...)
+	sort.Strings(folders)
+	for _, folder := range folders {
+		if len(folder) == 0 || folder[0] != '\\' {
+			return result, ErrInvalidPath
+		}
+		if folder == `\` || t.taskFolderExist(folder) {
+			continue
+		}
+		if err := t.CreateFolder(folder, ""); err != nil && !errors.Is(err, os.ErrExist) {
+			return result, err
+		}
+	}
+
+	for _, task := range s.Tasks {
+		if len(task.Path) == 0 || task.Path[0] != '\\' {
+			result.Failed[task.Path] = ErrInvalidPath
+			continue
+		}
+
+		flags := TASK_CREATE
+		if t.registeredTaskExist(task.Path) {
+			if opts.Mode == RestoreSkipExisting {
+				result.Skipped = append(result.Skipped, task.Path)
+				continue
+			}
+			flags = TASK_CREATE_OR_UPDATE
+		}
+		if !task.Enabled {
+			flags |= TASK_DISABLE
+		}
+
+		userID, remapped := task.UserID, ""
+		for from, to := range opts.Principals {
+			if strings.EqualFold(from, task.UserID) {
+				userID, remapped = to, to
+				break
+			}
+		}
+
+		var username, password string
+		if task.LogonType == TASK_LOGON_PASSWORD || task.LogonType == TASK_LOGON_INTERACTIVE_TOKEN_OR_PASSWORD {
+			var ok bool
+			if password, ok = opts.Passwords[userID]; !ok {
+				result.NeedsPassword = append(result.NeedsPassword, task.Path)
+				continue
+			}
+			username = userID
+		}
+
+		taskObj, err := t.registerTaskXML(task.Path, task.XMLText, remapped, username, password, task.LogonType, flags, "")
+		if err != nil {
+			result.Failed[task.Path] = err
+			continue
+		}
+		taskObj.Release()
+		result.Restored = append(result.Restored, task.Path)
+	}
+
+	return result, nil
+}
+
+// registerTaskXML registers the task at path from its XML definition. If userID is
+// not empty, it replaces the UserId of the definition's principal. It returns nil if
+// the task was only validated.
+func (t *TaskService) registerTaskXML(path, xmlText, userID, username, password string, logonType TaskLogonType, flags TaskCreationFlags, sddl string) (*ole.IDispatch, error) {
+	if xmlText == "" {
+		return nil, errors.New("task has no XML definition")
+	}
+
+	res, err := oleutil.CallMethod(t.taskServiceObj, "NewTask", 0)
+	if err != nil {
+		return nil, fmt.Errorf("error creating new task: %w", getTaskSchedulerError(err))
+	}
+	definitionObj := res.ToIDispatch()
+	defer definitionObj.Release()
+
+	h := &oleHelper{}
+	h.put(definitionObj, "XmlText", xmlText)
+	if h.err != nil {
+		return nil, fmt.Errorf("error loading task XML: %w", h.err)
+	}
+	if userID != "" {
+		principalObj := h.getObject(definitionObj, "Principal")
+		if h.err != nil {
+			return nil, h.err
+		}
+		defer principalObj.Release()
+		h.put(principalObj, "UserId", userID)
+		if h.err != nil {
+			return nil, h.err
+		}
+	}
+
+	taskObj, err := oleutil.CallMethod(t.rootFolderObj, "RegisterTaskDefinition", path, definitionObj, int(flags), username, password, int(logonType), sddl)
+	if err != nil {
+		return nil, fmt.Errorf("error registering task: %w", getTaskSchedulerError(err))
+	}
+
+	return taskObj.ToIDispatch(), nil
+}
@@ -0,0 +1,104 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSnapshotArchiveRoundTrip(t *testing.T) {
+	snapshot := Snapshot{
+		ComputerName: "HOST",
+		Root:         `\Vendor`,
+		Folders:      []string{`\Vendor`, `\Vendor\Sub`},
+		Tasks: []SnapshotTask{
+			{Path: `\Vendor\One`, Enabled: true, UserID: "SYSTEM", LogonType: TASK_LOGON_SERVICE_ACCOUNT, File: snapshotTaskFile(`\Vendor\One`), XMLText: "<Task>one</Task>"},
+			{Path: `\Vendor\Sub\Two`, UserID: `HOST\svc`, LogonType: TASK_LOGON_PASSWORD, File: snapshotTaskFile(`\Vendor\Sub\Two`), XMLText: "<Task>two</Task>"},
+		},
+	}
+
+	check := func(t *testing.T, got Snapshot) {
+		t.Helper()
+		if got.ComputerName != snapshot.ComputerName || got.Root != snapshot.Root || len(got.Folders) != 2 {
+			t.Fatalf("manifest did not round-trip: %+v", got)
+		}
+		if len(got.Tasks) != len(snapshot.Tasks) {
+			t.Fatalf("expected %d tasks, got %d", len(snapshot.Tasks), len(got.Tasks))
+		}
+		for i, task := range got.Tasks {
+			if task != snapshot.Tasks[i] {
+				t.Fatalf("task %d did not round-trip: want %+v, got %+v", i, snapshot.Tasks[i], task)
+			}
+		}
+	}
+
+	t.Run("zip", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := snapshot.WriteZip(&buf); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadSnapshotZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, got)
+	})
+
+	t.Run("dir", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := snapshot.WriteDir(dir); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadSnapshotDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(t, got)
+	})
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	taskService := setupTaskService(t)
+	createTestTask(taskService)
+
+	disabledDef := taskService.NewTaskDefinition()
+	disabledDef.AddAction(ExecAction{Path: "calc.exe"})
+	disabledDef.Settings.Enabled = false
+	if _, _, err := taskService.CreateTask(testTaskPath("Nested", "Disabled"), disabledDef, true); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := taskService.Snapshot(testTaskRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Tasks) != 2 {
+		t.Fatalf("expected 2 tasks in snapshot, got %d", len(snapshot.Tasks))
+	}
+
+	// restoring over the live tasks skips them by default
+	result, err := taskService.Restore(snapshot, RestoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Skipped) != 2 || len(result.Restored) != 0 {
+		t.Fatalf("expected 2 skipped tasks, got %+v", result)
+	}
+
+	resetTestFolder(t, taskService)
+
+	result, err = taskService.Restore(snapshot, RestoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Restored) != 2 || len(result.Failed) != 0 {
+		t.Fatalf("expected 2 restored tasks, got %+v", result)
+	}
+	withRegisteredTask(t, taskService, testTaskPath("Nested", "Disabled"), func(task RegisteredTask) {
+		if task.Enabled {
+			t.Fatal("disabled task should have been restored disabled")
+		}
+	})
+}
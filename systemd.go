@@ -0,0 +1,438 @@
+package taskmaster
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rickb777/period"
+)
+
+// SystemdUnits is a task definition converted to a systemd service and the timer
+// that starts it.
+type SystemdUnits struct {
+	Service  string   // the contents of the .service unit
+	Timer    string   // the contents of the .timer unit; empty if no trigger could be converted
+	Warnings []string // what could not be converted exactly
+}
+
+// WriteFiles writes the units to name.service and name.timer in dir. The timer is
+// only written if there is one.
+func (u SystemdUnits) WriteFiles(dir, name string) error {
+	if err := os.WriteFile(filepath.Join(dir, name+".service"), []byte(u.Service), 0o644); err != nil {
+		return err
+	}
+	if u.Timer == "" {
+		return nil
+	}
+
+	return os.WriteFile(filepath.Join(dir, name+".timer"), []byte(u.Timer), 0o644)
+}
+
+// ExportSystemd converts a task definition to a systemd service that runs its
+// ExecActions and a timer that starts the service when its triggers would fire.
+//
+// Calendar triggers become OnCalendar= expressions, including their repetition
+// patterns, and boot triggers OnBootSec=. RandomDelay maps to RandomizedDelaySec=,
+// Settings.TimeLimit to RuntimeMaxSec=, WakeToRun to WakeSystem= and
+// StartWhenAvailable to Persistent=. A single ExecAction runs as a Type=exec
+// service; several run in order as a Type=oneshot service, whose time limit is
+// TimeoutStartSec= instead.
+//
+// Constructs systemd has no equivalent for, such as idle, logon, session state
+// and event triggers, COM handler actions and boundaries of triggers, are left out
+// or approximated and listed in SystemdUnits.Warnings. Paths and arguments are
+// copied as they are, so Windows paths still need to be changed. ExportSystemd
+// fails if the definition has no ExecAction.
+func ExportSystemd(def Definition) (SystemdUnits, error) {
+	var c systemdConverter
+	service, err := c.service(def)
+	if err != nil {
+		return SystemdUnits{}, err
+	}
+
+	return SystemdUnits{Service: service, Timer: c.timer(def), Warnings: c.conversionWarnings}, nil
+}
+
+// systemdConverter converts a definition to systemd units.
+type systemdConverter struct {
+	conversionWarnings
+	unitActive period.Period // the interval of a repetition that never ends
+}
+
+func (c *systemdConverter) service(def Definition) (string, error) {
+	var execs []ExecAction
+	for _, action := range def.Actions {
+		switch a := action.(type) {
+		case ExecAction:
+			execs = append(execs, a)
+		default:
+			c.warnf("%s actions are not supported; action %q is left out", action.GetType(), action.GetID())
+		}
+	}
+	if len(execs) == 0 {
+		return "", errors.New("the definition has no Exec action")
+	}
+
+	var b strings.Builder
+	writeSystemdDescription(&b, def)
+
+	b.WriteString("[Service]\n")
+	limit := "RuntimeMaxSec"
+	if len(execs) == 1 {
+		b.WriteString("Type=exec\n")
+	} else {
+		b.WriteString("Type=oneshot\n")
+		limit = "TimeoutStartSec"
+	}
+	if dir := execs[0].WorkingDir; dir != "" {
+		fmt.Fprintf(&b, "WorkingDirectory=%s\n", strings.ReplaceAll(dir, "%", "%%"))
+	}
+	for _, exec := range execs {
+		if exec.WorkingDir != execs[0].WorkingDir {
+			c.warnf("the actions have different working directories; all of them run in %s", execs[0].WorkingDir)
+		}
+		if strings.Contains(exec.Args, "$(Arg") {
+			c.warnf("$(ArgN) placeholders are not supported; they are passed as they are")
+		}
+		fmt.Fprintf(&b, "ExecStart=%s", systemdQuote(exec.Path))
+		if exec.Args != "" {
+			fmt.Fprintf(&b, " %s", systemdEscape(exec.Args))
+		}
+		b.WriteByte('\n')
+	}
+	if !def.Settings.TimeLimit.IsZero() {
+		fmt.Fprintf(&b, "%s=%s\n", limit, systemdTimespan(def.Settings.TimeLimit))
+	}
+
+	if def.Principal.UserID != "" || def.Principal.GroupID != "" {
+		c.warnf("the task runs as %s; set User= or Group= for the service", strings.Trim(def.Principal.UserID+" "+def.Principal.GroupID, " "))
+	}
+	if def.Settings.MultipleInstances == TASK_INSTANCES_PARALLEL {
+		c.warnf("parallel instances are not supported; systemd does not start a service that is already running")
+	}
+	if !def.Settings.Enabled {
+		c.warnf("the task is disabled; the timer is enabled once it is installed")
+	}
+
+	return b.String(), nil
+}
+
+func writeSystemdDescription(b *strings.Builder, def Definition) {
+	description := def.RegistrationInfo.Description
+	if description == "" {
+		description = def.RegistrationInfo.URI
+	}
+	if description != "" {
+		fmt.Fprintf(b, "[Unit]\nDescription=%s\n\n", strings.Join(strings.Fields(description), " "))
+	}
+}
+
+func (c *systemdConverter) timer(def Definition) string {
+	var directives []string
+	var randomDelay period.Period
+	for _, trigger := range def.Triggers {
+		if !trigger.GetEnabled() {
+			c.warnf("%s trigger %q is disabled and left out", trigger.GetType(), trigger.GetID())
+			continue
+		}
+		if !trigger.GetEndBoundary().IsZero() {
+			c.warnf("EndBoundary is not supported; the timer does not expire")
+		}
+		if !trigger.GetExecutionTimeLimit().IsZero() {
+			c.warnf("the ExecutionTimeLimit of triggers is not supported; only Settings.TimeLimit applies")
+		}
+
+		var delay period.Period
+		switch t := trigger.(type) {
+		case TimeTrigger:
+			delay = t.RandomDelay
+			directives = append(directives, c.onCalendar(t, []string{t.StartBoundary.Format("2006-01-02")}, false)...)
+		case DailyTrigger:
+			delay = t.RandomDelay
+			date := "*-*-*"
+			if t.DayInterval > EveryDay {
+				date = fmt.Sprintf("*-*-01/%d", t.DayInterval)
+				c.warnf("calendars cannot count days across months; the Daily trigger runs every %d days from the first of each month", t.DayInterval)
+			}
+			directives = append(directives, c.onCalendar(t, []string{date}, t.DayInterval <= EveryDay)...)
+		case WeeklyTrigger:
+			delay = t.RandomDelay
+			if t.WeekInterval > EveryWeek {
+				c.warnf("calendars cannot count weeks; the Weekly trigger runs every week")
+			}
+			directives = append(directives, c.onCalendar(t, []string{systemdWeekdays(t.DaysOfWeek) + " *-*-*"}, false)...)
+		case MonthlyTrigger:
+			delay = t.RandomDelay
+			months := systemdMonths(t.MonthsOfYear)
+			var dates []string
+			if t.DaysOfMonth != 0 {
+				dates = append(dates, fmt.Sprintf("*-%s-%s", months, systemdDays(t.DaysOfMonth)))
+			}
+			if t.RunOnLastDayOfMonth {
+				dates = append(dates, fmt.Sprintf("*-%s~01", months))
+			}
+			directives = append(directives, c.onCalendar(t, dates, false)...)
+		case MonthlyDOWTrigger:
+			delay = t.RandomDelay
+			directives = append(directives, c.onCalendar(t, systemdWeeksOfMonth(t), false)...)
+		case BootTrigger:
+			directives = append(directives, "OnBootSec="+systemdTimespan(t.Delay))
+			c.repetition(t, false)
+		case RegistrationTrigger:
+			directives = append(directives, "OnActiveSec="+systemdTimespan(t.Delay))
+			c.warnf("the Registration trigger becomes OnActiveSec=, which also fires whenever the timer is started, such as at boot")
+			c.repetition(t, false)
+		default:
+			c.warnf("%s triggers are not supported; trigger %q is left out", trigger.GetType(), trigger.GetID())
+			continue
+		}
+
+		if !delay.IsZero() {
+			if !randomDelay.IsZero() && delay != randomDelay {
+				c.warnf("a timer has a single RandomizedDelaySec=; the longest RandomDelay of the triggers is used")
+			}
+			if randomDelay.IsZero() || delay.DurationApprox() > randomDelay.DurationApprox() {
+				randomDelay = delay
+			}
+		}
+	}
+	if !c.unitActive.IsZero() {
+		directives = append(directives, "OnUnitActiveSec="+systemdTimespan(c.unitActive))
+	}
+	if len(directives) == 0 {
+		c.warnf("no trigger could be converted; the service can only be started by hand")
+		return ""
+	}
+
+	var b strings.Builder
+	writeSystemdDescription(&b, def)
+	b.WriteString("[Timer]\n")
+	for _, directive := range directives {
+		b.WriteString(directive)
+		b.WriteByte('\n')
+	}
+	if !randomDelay.IsZero() {
+		fmt.Fprintf(&b, "RandomizedDelaySec=%s\n", systemdTimespan(randomDelay))
+	}
+	if def.Settings.StartWhenAvailable {
+		b.WriteString("Persistent=true\n")
+	}
+	if def.Settings.WakeToRun {
+		b.WriteString("WakeSystem=true\n")
+	}
+	b.WriteString("\n[Install]\nWantedBy=timers.target\n")
+
+	return b.String()
+}
+
+// onCalendar returns the OnCalendar= directives of a calendar trigger that fires
+// on dates, in the format of systemd.time, at the times of its repetition pattern.
+func (c *systemdConverter) onCalendar(t Trigger, dates []string, daily bool) []string {
+	var directives []string
+	for _, date := range dates {
+		for _, times := range systemdTimes(c.times(t, daily)) {
+			directives = append(directives, fmt.Sprintf("OnCalendar=%s %s", date, times))
+		}
+	}
+
+	return directives
+}
+
+// times returns the times of day a calendar trigger fires at, in seconds after
+// midnight. Repetitions past midnight only carry over to the next day for daily
+// triggers.
+func (c *systemdConverter) times(t Trigger, daily bool) []int {
+	start := t.GetStartBoundary()
+	first := start.Hour()*3600 + start.Minute()*60 + start.Second()
+	interval := seconds(c.repetition(t, true))
+	if interval == 0 {
+		return []int{first}
+	}
+
+	const day = 24 * 60 * 60
+	duration := seconds(t.GetRepetitionDuration())
+	seen := make(map[int]bool)
+	var times []int
+	for offset := 0; offset < duration && offset < day; offset += interval {
+		at := first + offset
+		if at >= day && !daily {
+			c.warnf("repetitions past midnight are only supported for daily triggers; they are left out")
+			break
+		}
+		if !seen[at%day] {
+			seen[at%day] = true
+			times = append(times, at%day)
+		}
+	}
+	sort.Ints(times)
+
+	return times
+}
+
+// repetition returns the interval of a repetition pattern that ends, which a
+// calendar trigger expands into times. A pattern that never ends, or any pattern
+// of a trigger that is not a calendar, becomes OnUnitActiveSec=.
+func (c *systemdConverter) repetition(t Trigger, calendar bool) period.Period {
+	interval := t.GetRepetitionInterval()
+	if interval.IsZero() {
+		return period.Period{}
+	}
+	if t.GetStopAtDurationEnd() {
+		c.warnf("StopAtDurationEnd is not supported; running instances are not stopped")
+	}
+	if calendar && !t.GetRepetitionDuration().IsZero() {
+		return interval
+	}
+
+	if !calendar && !t.GetRepetitionDuration().IsZero() {
+		c.warnf("the repetition of %s triggers becomes OnUnitActiveSec=, which does not end", t.GetType())
+	}
+	if !c.unitActive.IsZero() && c.unitActive != interval {
+		c.warnf("a timer has a single OnUnitActiveSec=; the repetition interval of the last trigger is used")
+	}
+	c.unitActive = interval
+
+	return period.Period{}
+}
+
+// systemdTimes formats times of day as few time parts of calendar events as
+// possible: the times of each hour are listed together, and hours with the same
+// minutes share a part.
+func systemdTimes(times []int) []string {
+	var parts, hours []string
+	byMinutes := make(map[string]int)
+	for i := 0; i < len(times); {
+		hour := times[i] / 3600
+		var minutes []string
+		second := times[i] % 60
+		j := i
+		for ; j < len(times) && times[j]/3600 == hour && times[j]%60 == second; j++ {
+			minutes = append(minutes, fmt.Sprintf("%02d", times[j]/60%60))
+		}
+		key := fmt.Sprintf("%s:%02d", strings.Join(minutes, ","), second)
+		if k, ok := byMinutes[key]; ok {
+			hours[k] += fmt.Sprintf(",%02d", hour)
+		} else {
+			byMinutes[key] = len(parts)
+			parts = append(parts, key)
+			hours = append(hours, fmt.Sprintf("%02d", hour))
+		}
+		i = j
+	}
+	for i := range parts {
+		parts[i] = hours[i] + ":" + parts[i]
+	}
+
+	return parts
+}
+
+func seconds(p period.Period) int {
+	return int(p.DurationApprox() / time.Second)
+}
+
+// systemdTimespan formats a period as a time span of systemd.time, such as 1h 30min.
+func systemdTimespan(p period.Period) string {
+	d := p.DurationApprox().Round(time.Second)
+	if d <= 0 {
+		return "0"
+	}
+
+	var parts []string
+	for _, unit := range []struct {
+		name string
+		size time.Duration
+	}{{"d", 24 * time.Hour}, {"h", time.Hour}, {"min", time.Minute}, {"s", time.Second}} {
+		if n := d / unit.size; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d%s", n, unit.name))
+			d -= n * unit.size
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+var systemdWeekdayNames = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+func systemdWeekdays(days DayOfWeek) string {
+	var names []string
+	for i, name := range systemdWeekdayNames {
+		if days&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, ",")
+}
+
+func systemdMonths(months Month) string {
+	if months == 0 || months == AllMonths {
+		return "*"
+	}
+
+	var values []string
+	for i := 0; i < 12; i++ {
+		if months&(1<<i) != 0 {
+			values = append(values, fmt.Sprintf("%02d", i+1))
+		}
+	}
+
+	return strings.Join(values, ",")
+}
+
+func systemdDays(days DayOfMonth) string {
+	if days == AllDaysOfMonth {
+		return "*"
+	}
+
+	var values []string
+	for i := 0; i < 31; i++ {
+		if days&(1<<i) != 0 {
+			values = append(values, fmt.Sprintf("%02d", i+1))
+		}
+	}
+
+	return strings.Join(values, ",")
+}
+
+// systemdWeeksOfMonth returns the dates of a monthly day-of-week trigger. The nth
+// week of a month is its days 7(n-1)+1 to 7n, and the last week its last 7 days.
+func systemdWeeksOfMonth(t MonthlyDOWTrigger) []string {
+	weekdays, months := systemdWeekdays(t.DaysOfWeek), systemdMonths(t.MonthsOfYear)
+	var ranges []string
+	for i, week := range []Week{First, Second, Third, Fourth} {
+		if t.WeeksOfMonth&week != 0 {
+			ranges = append(ranges, fmt.Sprintf("%02d..%02d", 7*i+1, 7*i+7))
+		}
+	}
+
+	var dates []string
+	if len(ranges) > 0 {
+		dates = append(dates, fmt.Sprintf("%s *-%s-%s", weekdays, months, strings.Join(ranges, ",")))
+	}
+	if t.WeeksOfMonth&LastWeek != 0 || t.RunOnLastWeekOfMonth {
+		dates = append(dates, fmt.Sprintf("%s *-%s~07/1", weekdays, months))
+	}
+
+	return dates
+}
+
+// systemdEscape escapes the specifiers, variables and backslashes of a command
+// line, so that systemd passes it on as it is written.
+func systemdEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", "%%", "$", "$$").Replace(s)
+}
+
+// systemdQuote escapes a path and quotes it if it contains whitespace or quotes.
+func systemdQuote(s string) string {
+	s = systemdEscape(s)
+	if !strings.ContainsAny(s, " \t\"'") {
+		return s
+	}
+
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,164 @@
+package taskmaster
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/period"
+)
+
+func TestExportSystemd(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2024, 5, 1, hour, minute, 0, 0, time.UTC) }
+
+	def := DefaultDefinition()
+	def.RegistrationInfo.Description = "Nightly\nbackup"
+	def.Settings.StartWhenAvailable = true
+	def.Settings.WakeToRun = true
+	def.AddAction(ExecAction{Path: "/opt/backup/bin/backup", Args: `--target "/mnt/backup 1" --tag %date%`, WorkingDir: "/var/lib/backup"})
+	def.AddAction(ComHandlerAction{ID: "notify", ClassID: "{F0001111-0000-0000-0000-0000FEEDACDC}"})
+	def.AddTrigger(DailyTrigger{
+		TaskTrigger: TaskTrigger{
+			Enabled:       true,
+			StartBoundary: at(22, 30),
+			RepetitionPattern: RepetitionPattern{
+				RepetitionInterval: period.NewHMS(1, 0, 0),
+				RepetitionDuration: period.NewHMS(4, 0, 0),
+			},
+		},
+		DayInterval: EveryDay,
+		RandomDelay: period.NewHMS(0, 10, 0),
+	})
+	def.AddTrigger(WeeklyTrigger{
+		TaskTrigger:  TaskTrigger{Enabled: true, StartBoundary: at(9, 0)},
+		DaysOfWeek:   Monday | Friday,
+		WeekInterval: EveryWeek,
+	})
+	def.AddTrigger(MonthlyTrigger{
+		TaskTrigger:         TaskTrigger{Enabled: true, StartBoundary: at(3, 0)},
+		DaysOfMonth:         One | Fifteen,
+		MonthsOfYear:        January | July,
+		RunOnLastDayOfMonth: true,
+	})
+	def.AddTrigger(MonthlyDOWTrigger{
+		TaskTrigger:  TaskTrigger{Enabled: true, StartBoundary: at(4, 0)},
+		DaysOfWeek:   Sunday,
+		MonthsOfYear: AllMonths,
+		WeeksOfMonth: First | LastWeek,
+	})
+	def.AddTrigger(BootTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Delay: period.NewHMS(0, 5, 0)})
+	def.AddTrigger(TimeTrigger{TaskTrigger: TaskTrigger{Enabled: true, StartBoundary: at(12, 0)}})
+	def.AddTrigger(IdleTrigger{TaskTrigger: TaskTrigger{Enabled: true, ID: "idle"}})
+	def.AddTrigger(EventTrigger{TaskTrigger: TaskTrigger{Enabled: true, ID: "event"}, Subscription: "<QueryList/>"})
+
+	units, err := ExportSystemd(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantService := `[Unit]
+Description=Nightly backup
+
+[Service]
+Type=exec
+WorkingDirectory=/var/lib/backup
+ExecStart=/opt/backup/bin/backup --target "/mnt/backup 1" --tag %%date%%
+RuntimeMaxSec=3d
+`
+	if units.Service != wantService {
+		t.Errorf("service:\n%s\nwant:\n%s", units.Service, wantService)
+	}
+
+	wantTimer := `[Unit]
+Description=Nightly backup
+
+[Timer]
+OnCalendar=*-*-* 00,01,22,23:30:00
+OnCalendar=Mon,Fri *-*-* 09:00:00
+OnCalendar=*-01,07-01,15 03:00:00
+OnCalendar=*-01,07~01 03:00:00
+OnCalendar=Sun *-*-01..07 04:00:00
+OnCalendar=Sun *-*~07/1 04:00:00
+OnBootSec=5min
+OnCalendar=2024-05-01 12:00:00
+RandomizedDelaySec=10min
+Persistent=true
+WakeSystem=true
+
+[Install]
+WantedBy=timers.target
+`
+	if units.Timer != wantTimer {
+		t.Errorf("timer:\n%s\nwant:\n%s", units.Timer, wantTimer)
+	}
+
+	warnings := strings.Join(units.Warnings, "\n")
+	for _, want := range []string{`COM Handler actions are not supported; action "notify"`, `Idle triggers are not supported; trigger "idle"`, `Event triggers are not supported; trigger "event"`} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("warnings do not contain %q:\n%s", want, warnings)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := units.WriteFiles(dir, "backup"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "backup.timer")); err != nil || string(data) != wantTimer {
+		t.Errorf("backup.timer = %q, %v", data, err)
+	}
+}
+
+func TestExportSystemdRepetition(t *testing.T) {
+	def := DefaultDefinition()
+	def.Settings.TimeLimit = period.NewHMS(1, 30, 0)
+	def.AddAction(ExecAction{Path: "/usr/bin/first"})
+	def.AddAction(ExecAction{Path: `C:\Program Files\second.exe`})
+	def.AddTrigger(WeeklyTrigger{
+		TaskTrigger: TaskTrigger{
+			Enabled:       true,
+			StartBoundary: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+			RepetitionPattern: RepetitionPattern{
+				RepetitionInterval: period.NewHMS(0, 20, 0),
+				RepetitionDuration: period.NewHMS(1, 30, 0),
+			},
+		},
+		DaysOfWeek:   Saturday,
+		WeekInterval: EveryOtherWeek,
+	})
+	def.AddTrigger(LogonTrigger{TaskTrigger: TaskTrigger{Enabled: true}})
+	def.AddTrigger(RegistrationTrigger{TaskTrigger: TaskTrigger{
+		Enabled:           true,
+		RepetitionPattern: RepetitionPattern{RepetitionInterval: period.NewHMS(0, 5, 0)},
+	}})
+
+	units, err := ExportSystemd(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Type=oneshot\n", "ExecStart=/usr/bin/first\n", `ExecStart="C:\\Program Files\\second.exe"` + "\n", "TimeoutStartSec=1h 30min\n"} {
+		if !strings.Contains(units.Service, want) {
+			t.Errorf("service does not contain %q:\n%s", want, units.Service)
+		}
+	}
+	for _, want := range []string{"OnCalendar=Sat *-*-* 08:00,20,40:00\nOnCalendar=Sat *-*-* 09:00,20:00\n", "OnActiveSec=0\n", "OnUnitActiveSec=5min\n"} {
+		if !strings.Contains(units.Timer, want) {
+			t.Errorf("timer does not contain %q:\n%s", want, units.Timer)
+		}
+	}
+	warnings := strings.Join(units.Warnings, "\n")
+	for _, want := range []string{"runs every week", "Logon triggers are not supported", "OnActiveSec="} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("warnings do not contain %q:\n%s", want, warnings)
+		}
+	}
+
+	if !strings.HasPrefix(units.Service, "[Service]\n") {
+		t.Errorf("service without a description:\n%s", units.Service)
+	}
+
+	if _, err := ExportSystemd(DefaultDefinition()); err == nil {
+		t.Error("exporting a definition without actions did not fail")
+	}
+}
@@ -0,0 +1,718 @@
+package taskmaster
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rickb777/period"
+)
+
+// SystemdImportOptions configures ImportSystemd.
+type SystemdImportOptions struct {
+	Start time.Time // the day calendar triggers start on, in the time zone of the triggers; today if zero
+}
+
+// SystemdImport is a systemd service and timer converted to a task definition.
+type SystemdImport struct {
+	Definition Definition
+	Warnings   []string // the fidelity report: what was approximated or left out
+}
+
+// ImportSystemd converts the contents of a systemd .service unit and the .timer
+// unit that starts it to a task definition, the reverse of ExportSystemd. timer
+// may be empty, in which case the definition has no triggers.
+//
+// ExecStart= lines become ExecActions, and RuntimeMaxSec=, or TimeoutStartSec= for
+// Type=oneshot services, becomes Settings.TimeLimit; without one, the task has no
+// time limit, as in systemd. OnCalendar= expressions, including weekday lists,
+// ranges, steps and the last days of a month, become calendar triggers that repeat
+// where the times are evenly spaced. OnBootSec= and OnStartupSec= become
+// BootTriggers, OnUnitActiveSec= a repetition that never ends, Persistent=
+// StartWhenAvailable, WakeSystem= WakeToRun, and RandomizedDelaySec= the RandomDelay
+// of the calendar triggers.
+//
+// Everything that is approximated or left out is listed in SystemdImport.Warnings.
+// ImportSystemd fails if a unit is malformed, the service has no ExecStart= or the
+// timer needs more triggers than a task can have.
+func ImportSystemd(service, timer string, opts SystemdImportOptions) (SystemdImport, error) {
+	if opts.Start.IsZero() {
+		opts.Start = time.Now()
+	}
+
+	imp := systemdImporter{opts: opts, def: DefaultDefinition()}
+	imp.def.Settings.DontStartOnBatteries = false
+	imp.def.Settings.StopIfGoingOnBatteries = false
+	imp.def.Settings.TimeLimit = period.Period{}
+
+	entries, err := parseSystemdUnit(service)
+	if err != nil {
+		return SystemdImport{}, fmt.Errorf("error parsing service: %w", err)
+	}
+	if err := imp.service(entries); err != nil {
+		return SystemdImport{}, fmt.Errorf("error converting service: %w", err)
+	}
+
+	if timer == "" {
+		imp.warnf("there is no timer; the task can only be started by hand")
+	} else {
+		if entries, err = parseSystemdUnit(timer); err != nil {
+			return SystemdImport{}, fmt.Errorf("error parsing timer: %w", err)
+		}
+		if err := imp.timer(entries); err != nil {
+			return SystemdImport{}, fmt.Errorf("error converting timer: %w", err)
+		}
+	}
+
+	return SystemdImport{Definition: imp.def, Warnings: imp.conversionWarnings}, nil
+}
+
+// systemdImporter converts systemd units to a definition.
+type systemdImporter struct {
+	conversionWarnings
+	opts SystemdImportOptions
+	def  Definition
+}
+
+// systemdEntry is a setting of a unit file.
+type systemdEntry struct {
+	section, key, value string
+}
+
+// parseSystemdUnit parses a unit file into its settings, in order. Lines ending in
+// a backslash are continued on the next line.
+func parseSystemdUnit(text string) ([]systemdEntry, error) {
+	var entries []systemdEntry
+	section := ""
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		number := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		for strings.HasSuffix(line, `\`) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + " " + strings.TrimSpace(lines[i])
+		}
+
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated section header %s", number, line)
+			}
+			section = line[1 : len(line)-1]
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: %q is not a setting", number, line)
+		} else if section == "" {
+			return nil, fmt.Errorf("line %d: %s is outside of a section", number, strings.TrimSpace(key))
+		}
+		entries = append(entries, systemdEntry{section, strings.TrimSpace(key), strings.TrimSpace(value)})
+	}
+
+	return entries, nil
+}
+
+func (imp *systemdImporter) service(entries []systemdEntry) error {
+	var execs []string
+	var workingDir, serviceType, runtimeMax, timeoutStart string
+	for _, e := range entries {
+		switch e.section + "." + e.key {
+		case "Unit.Description":
+			imp.def.RegistrationInfo.Description = e.value
+		case "Unit.Documentation":
+			imp.def.RegistrationInfo.Documentation = e.value
+		case "Service.ExecStart":
+			if e.value == "" {
+				execs = nil // an empty assignment resets the list
+			} else {
+				execs = append(execs, e.value)
+			}
+		case "Service.WorkingDirectory":
+			workingDir = e.value
+		case "Service.Type":
+			serviceType = e.value
+		case "Service.RuntimeMaxSec":
+			runtimeMax = e.value
+		case "Service.TimeoutStartSec", "Service.TimeoutSec":
+			timeoutStart = e.value
+		case "Service.User", "Service.Group":
+			imp.warnf("the service runs as %s=%s; the task runs as its principal", e.key, e.value)
+		default:
+			imp.warnUnsupported(e)
+		}
+	}
+	if len(execs) == 0 {
+		return errors.New("the service has no ExecStart=")
+	}
+
+	workingDir = strings.TrimPrefix(workingDir, "-")
+	if strings.HasPrefix(workingDir, "~") {
+		imp.warnf("WorkingDirectory=%s is not supported; the task runs in the default directory", workingDir)
+		workingDir = ""
+	}
+	for _, exec := range execs {
+		action, err := imp.execAction(exec)
+		if err != nil {
+			return fmt.Errorf("invalid ExecStart=%s: %w", exec, err)
+		}
+		action.WorkingDir = imp.unescape(workingDir, false)
+		imp.def.AddAction(action)
+	}
+
+	limit := runtimeMax
+	if serviceType == "oneshot" {
+		limit = timeoutStart
+	}
+	if limit != "" {
+		timeLimit, err := parseSystemdTimespan(limit)
+		if err != nil {
+			return err
+		}
+		imp.def.Settings.TimeLimit = timeLimit
+	}
+
+	return nil
+}
+
+// execAction converts a command line of ExecStart= to an ExecAction.
+func (imp *systemdImporter) execAction(command string) (ExecAction, error) {
+	for command != "" && strings.ContainsRune("-@:+!", rune(command[0])) {
+		if command[0] != '-' {
+			imp.warnf("the ExecStart= prefix %c is not supported and is left out", command[0])
+		}
+		command = command[1:]
+	}
+
+	path, args, err := cutSystemdWord(command)
+	if err != nil {
+		return ExecAction{}, err
+	}
+
+	return ExecAction{Path: imp.unescape(path, false), Args: imp.unescape(strings.TrimSpace(args), true)}, nil
+}
+
+// cutSystemdWord returns the first word of a command line, unquoted, and the rest
+// of the line.
+func cutSystemdWord(s string) (word, rest string, err error) {
+	var b strings.Builder
+	var quote byte
+	i := 0
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		quote = s[0]
+		i++
+	}
+	for ; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case quote != 0 && c == quote:
+			return b.String(), s[i+1:], nil
+		case quote == 0 && (c == ' ' || c == '\t'):
+			return b.String(), s[i:], nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if quote != 0 {
+		return "", "", errors.New("unterminated quote")
+	} else if b.Len() == 0 {
+		return "", "", errors.New("empty command")
+	}
+
+	return b.String(), "", nil
+}
+
+// unescape undoes the escaping of systemdEscape: doubled % and $, and doubled
+// backslashes if backslashes is true. Specifiers and variables are kept as they
+// are, with a warning.
+func (imp *systemdImporter) unescape(s string, backslashes bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c == '%' || c == '$' || (c == '\\' && backslashes)) && i+1 < len(s) && s[i+1] == c {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		switch c {
+		case '%':
+			imp.warnf("specifiers such as %s are not supported and are kept as they are", s[i:min(i+2, len(s))])
+		case '$':
+			imp.warnf("environment variables are not expanded; $ references are kept as they are")
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+func (imp *systemdImporter) warnUnsupported(e systemdEntry) {
+	if e.section != "Install" {
+		imp.warnf("%s= in [%s] is not supported and is left out", e.key, e.section)
+	}
+}
+
+func (imp *systemdImporter) timer(entries []systemdEntry) error {
+	var calendars, boots, actives []string
+	var randomDelay, unitActive period.Period
+	for _, e := range entries {
+		var err error
+		switch e.section + "." + e.key {
+		case "Unit.Description":
+			if imp.def.RegistrationInfo.Description == "" {
+				imp.def.RegistrationInfo.Description = e.value
+			}
+		case "Unit.Documentation", "Timer.Unit", "Timer.AccuracySec":
+			// the service is named by ImportSystemd's caller, and the Task
+			// Scheduler is as accurate as it can be
+		case "Timer.OnCalendar":
+			calendars = appendSystemdList(calendars, e.value)
+		case "Timer.OnBootSec", "Timer.OnStartupSec":
+			boots = appendSystemdList(boots, e.value)
+		case "Timer.OnActiveSec":
+			actives = appendSystemdList(actives, e.value)
+		case "Timer.OnUnitActiveSec", "Timer.OnUnitInactiveSec":
+			if e.key == "OnUnitInactiveSec" {
+				imp.warnf("OnUnitInactiveSec= counts from when the service stops; the task repeats from when it starts")
+			}
+			unitActive, err = parseSystemdTimespan(e.value)
+		case "Timer.Persistent":
+			imp.def.Settings.StartWhenAvailable, err = parseSystemdBool(e.value)
+		case "Timer.WakeSystem":
+			imp.def.Settings.WakeToRun, err = parseSystemdBool(e.value)
+		case "Timer.RandomizedDelaySec":
+			randomDelay, err = parseSystemdTimespan(e.value)
+		default:
+			imp.warnUnsupported(e)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s=%s: %w", e.key, e.value, err)
+		}
+	}
+
+	var triggers []Trigger
+	for _, expr := range calendars {
+		calendarTriggers, err := imp.calendarTriggers(expr)
+		if err != nil {
+			return fmt.Errorf("invalid OnCalendar=%s: %w", expr, err)
+		}
+		triggers = append(triggers, calendarTriggers...)
+	}
+	for _, boot := range boots {
+		delay, err := parseSystemdTimespan(boot)
+		if err != nil {
+			return fmt.Errorf("invalid OnBootSec=%s: %w", boot, err)
+		}
+		triggers = append(triggers, BootTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Delay: delay})
+		if !randomDelay.IsZero() {
+			imp.warnf("boot triggers have no random delay; RandomizedDelaySec= only applies to calendar triggers")
+		}
+	}
+	for _, active := range actives {
+		delay, err := parseSystemdTimespan(active)
+		if err != nil {
+			return fmt.Errorf("invalid OnActiveSec=%s: %w", active, err)
+		}
+		triggers = append(triggers, RegistrationTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Delay: delay})
+		imp.warnf("OnActiveSec= becomes a Registration trigger, which fires when the task is registered rather than whenever the timer starts")
+	}
+
+	if !unitActive.IsZero() {
+		if len(triggers) == 0 {
+			imp.warnf("OnUnitActiveSec= without another trigger only repeats once the service has been started; the task repeats from boot")
+			triggers = append(triggers, BootTrigger{TaskTrigger: TaskTrigger{Enabled: true}})
+		}
+		for i, trigger := range triggers {
+			taskTrigger := taskTriggerOf(trigger)
+			if !taskTrigger.RepetitionInterval.IsZero() {
+				imp.warnf("OnUnitActiveSec= replaces the repetition of triggers that already repeat")
+			}
+			taskTrigger.RepetitionInterval = unitActive
+			taskTrigger.RepetitionDuration = period.Period{}
+			triggers[i] = withTaskTrigger(trigger, taskTrigger)
+		}
+	}
+
+	if len(triggers) > maxTriggers {
+		return fmt.Errorf("the timer needs %d triggers, more than the %d a task can have", len(triggers), maxTriggers)
+	}
+	for _, trigger := range triggers {
+		imp.def.AddTrigger(withRandomDelay(trigger, randomDelay))
+	}
+
+	return nil
+}
+
+// appendSystemdList appends a value of a list setting; an empty value resets it.
+func appendSystemdList(list []string, value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	return append(list, value)
+}
+
+func parseSystemdBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "1", "yes", "y", "true", "t", "on":
+		return true, nil
+	case "0", "no", "n", "false", "f", "off":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid boolean %q", s)
+	}
+}
+
+var systemdTimespanUnits = map[string]time.Duration{
+	"us": time.Microsecond, "usec": time.Microsecond,
+	"ms": time.Millisecond, "msec": time.Millisecond,
+	"": time.Second, "s": time.Second, "sec": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+	"M": 2629800 * time.Second, "month": 2629800 * time.Second, "months": 2629800 * time.Second,
+	"y": 31557600 * time.Second, "year": 31557600 * time.Second, "years": 31557600 * time.Second,
+}
+
+// parseSystemdTimespan parses a time span of systemd.time, such as 1h 30min or 90.
+// infinity is the zero period, which means no limit to the Task Scheduler.
+func parseSystemdTimespan(s string) (period.Period, error) {
+	if s == "infinity" {
+		return period.Period{}, nil
+	}
+
+	var total time.Duration
+	rest := strings.TrimSpace(s)
+	if rest == "" {
+		return period.Period{}, errors.New("empty time span")
+	}
+	for rest != "" {
+		number := strings.TrimLeft(rest, "0123456789.")
+		value, err := strconv.ParseFloat(rest[:len(rest)-len(number)], 64)
+		if err != nil {
+			return period.Period{}, fmt.Errorf("invalid time span %q", s)
+		}
+		// the unit may be separated from its number, as in 2 h
+		number = strings.TrimLeft(number, " \t")
+		unit := strings.TrimLeft(number, "abcdefghijklmnopqrstuvwxyzM")
+		size, ok := systemdTimespanUnits[number[:len(number)-len(unit)]]
+		if !ok {
+			return period.Period{}, fmt.Errorf("invalid time span %q", s)
+		}
+		total += time.Duration(value * float64(size))
+		rest = strings.TrimSpace(unit)
+	}
+
+	return period.NewOf(total.Round(time.Second)).Normalise(true), nil
+}
+
+// systemdCalendarShortcuts are the calendar events of the shorthands of
+// systemd.time.
+var systemdCalendarShortcuts = map[string]string{
+	"minutely":     "*-*-* *:*:00",
+	"hourly":       "*-*-* *:00:00",
+	"daily":        "*-*-* 00:00:00",
+	"weekly":       "Mon *-*-* 00:00:00",
+	"monthly":      "*-*-01 00:00:00",
+	"quarterly":    "*-01,04,07,10-01 00:00:00",
+	"semiannually": "*-01,07-01 00:00:00",
+	"yearly":       "*-01-01 00:00:00",
+	"annually":     "*-01-01 00:00:00",
+}
+
+// calendarTriggers converts a calendar event of OnCalendar= to triggers. Unlike
+// cron, a calendar event matches the days that match both its weekdays and its
+// date.
+func (imp *systemdImporter) calendarTriggers(expr string) ([]Trigger, error) {
+	spec := expr
+	if shortcut, ok := systemdCalendarShortcuts[strings.ToLower(expr)]; ok {
+		spec = shortcut
+	}
+
+	fields := strings.Fields(spec)
+	weekdays, date, clock := AllDays, "*-*-*", "00:00:00"
+	if len(fields) > 0 && isASCIILetter(fields[0][0]) {
+		var err error
+		if weekdays, err = parseSystemdWeekdays(fields[0]); err != nil {
+			return nil, err
+		}
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && !strings.Contains(fields[0], ":") {
+		date, fields = fields[0], fields[1:]
+	}
+	if len(fields) > 0 && strings.Contains(fields[0], ":") {
+		clock, fields = fields[0], fields[1:]
+	}
+	if len(fields) > 0 {
+		imp.warnf("time zones are not supported; OnCalendar=%s uses the time zone of the Task Scheduler", expr)
+	}
+
+	last := strings.Contains(date, "~")
+	dateParts := strings.Split(strings.Replace(date, "~", "-", 1), "-")
+	if len(dateParts) == 2 {
+		dateParts = append([]string{"*"}, dateParts...)
+	} else if len(dateParts) != 3 {
+		return nil, fmt.Errorf("invalid date %q", date)
+	}
+	clockParts := strings.Split(clock, ":")
+	if len(clockParts) == 2 {
+		clockParts = append(clockParts, "00")
+	} else if len(clockParts) != 3 {
+		return nil, fmt.Errorf("invalid time %q", clock)
+	}
+	if seconds, fraction, ok := strings.Cut(clockParts[2], "."); ok {
+		if strings.Trim(fraction, "0") != "" {
+			imp.warnf("fractions of seconds are not supported; OnCalendar=%s runs at whole seconds", expr)
+		}
+		clockParts[2] = seconds
+	}
+
+	months, err := parseCalendarComponent(dateParts[1], 1, 12, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid month: %w", err)
+	}
+	days, err := parseCalendarComponent(dateParts[2], 1, 31, last)
+	if err != nil {
+		return nil, fmt.Errorf("invalid day: %w", err)
+	}
+	hours, err := parseCalendarComponent(clockParts[0], 0, 23, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hour: %w", err)
+	}
+	minutes, err := parseCalendarComponent(clockParts[1], 0, 59, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid minute: %w", err)
+	}
+	seconds, err := parseCalendarComponent(clockParts[2], 0, 59, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid second: %w", err)
+	}
+	second := setValues(seconds)[0]
+	if len(setValues(seconds)) > 1 {
+		imp.warnf("OnCalendar=%s runs at several seconds of a minute; the task runs at the first", expr)
+	}
+
+	months >>= 1
+	days >>= 1
+	times := cronTimes(minutes, hours)
+	if dateParts[0] != "*" {
+		// a single date becomes time triggers on that date
+		year, err := strconv.Atoi(dateParts[0])
+		monthValues, dayValues := setValues(months), setValues(days)
+		if err == nil && len(monthValues) == 1 && len(dayValues) == 1 && weekdays == AllDays && !last {
+			day := time.Date(year, time.Month(monthValues[0]+1), dayValues[0]+1, 0, 0, 0, 0, imp.opts.Start.Location())
+			var triggers []Trigger
+			for _, t := range times {
+				triggers = append(triggers, TimeTrigger{TaskTrigger: t.taskTrigger(day, second)})
+			}
+			return triggers, nil
+		}
+		imp.warnf("years are only supported in single dates; OnCalendar=%s runs every year", expr)
+	}
+
+	var pattern Trigger
+	allDays, allWeekdays := days == uint64(AllDaysOfMonth), weekdays == AllDays
+	switch {
+	case last && days == 1 && allWeekdays:
+		pattern = MonthlyTrigger{MonthsOfYear: Month(months), RunOnLastDayOfMonth: true}
+	case last && days == 1<<7-1 && !allWeekdays:
+		pattern = MonthlyDOWTrigger{DaysOfWeek: weekdays, MonthsOfYear: Month(months), RunOnLastWeekOfMonth: true}
+	case last:
+		imp.warnf("days counted from the end of the month are only supported for the last day and, with weekdays, the last week; OnCalendar=%s is left out", expr)
+		return nil, nil
+	case allDays && allWeekdays:
+		pattern = cronDailyPattern(Month(months))
+	case allDays:
+		pattern = cronWeeklyPattern(weekdays, Month(months))
+	case allWeekdays:
+		pattern = MonthlyTrigger{DaysOfMonth: DayOfMonth(days), MonthsOfYear: Month(months)}
+	default:
+		weeks, exact := weeksOfDays(DayOfMonth(days))
+		if !exact {
+			imp.warnf("weekdays can only be combined with whole weeks of the month; OnCalendar=%s runs on its weekdays in every week that contains one of its days", expr)
+		}
+		pattern = MonthlyDOWTrigger{DaysOfWeek: weekdays, MonthsOfYear: Month(months), WeeksOfMonth: weeks}
+	}
+
+	var triggers []Trigger
+	for _, t := range times {
+		triggers = append(triggers, withTaskTrigger(pattern, t.taskTrigger(imp.opts.Start, second)))
+	}
+
+	return triggers, nil
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// parseSystemdWeekdays parses a list of weekdays, such as Mon..Fri,Sun.
+func parseSystemdWeekdays(s string) (DayOfWeek, error) {
+	var weekdays DayOfWeek
+	for _, item := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(item, "..")
+		if !isRange {
+			from, to, isRange = strings.Cut(item, "-")
+		}
+		low, err := systemdWeekday(from)
+		if err != nil {
+			return 0, err
+		}
+		high := low
+		if isRange {
+			if high, err = systemdWeekday(to); err != nil {
+				return 0, err
+			}
+		}
+		// weeks start on Monday, so Sat..Sun is a range but Sun..Sat is not
+		if (high+6)%7 < (low+6)%7 {
+			return 0, fmt.Errorf("weekday range %q is reversed", item)
+		}
+		for day := low; ; day = (day + 1) % 7 {
+			weekdays |= 1 << day
+			if day == high {
+				break
+			}
+		}
+	}
+
+	return weekdays, nil
+}
+
+func systemdWeekday(s string) (int, error) {
+	for i, name := range systemdWeekdayNames {
+		if strings.EqualFold(s, name) || strings.EqualFold(s, time.Weekday(i).String()) {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid weekday %q", s)
+}
+
+// parseCalendarComponent returns the values of a date or time component as a bit
+// set: a list of values, ranges such as 1..5 and repetitions such as 0/15 or
+// 1..10/2. With fromEnd, a repetition counts towards the last day of the month,
+// as days after ~ do.
+func parseCalendarComponent(s string, low, high int, fromEnd bool) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(s, ",") {
+		rangeText, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid repetition %q", item)
+			}
+		}
+
+		from, to := low, high
+		if rangeText != "*" {
+			fromText, toText, isRange := strings.Cut(rangeText, "..")
+			var err error
+			if from, err = calendarValue(fromText, low, high); err != nil {
+				return 0, err
+			}
+			to = from
+			if isRange {
+				if to, err = calendarValue(toText, low, high); err != nil {
+					return 0, err
+				}
+			} else if hasStep && fromEnd {
+				// ~07/1 counts down from the 7th last day to the last one
+				for v := from; v >= low; v -= step {
+					set |= 1 << v
+				}
+				continue
+			} else if hasStep {
+				to = high
+			}
+		}
+		if to < from {
+			return 0, fmt.Errorf("range %q is reversed", rangeText)
+		}
+		for v := from; v <= to; v += step {
+			set |= 1 << v
+		}
+	}
+
+	return set, nil
+}
+
+func calendarValue(s string, low, high int) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	} else if v < low || v > high {
+		return 0, fmt.Errorf("%d is out of range %d..%d", v, low, high)
+	}
+
+	return v, nil
+}
+
+// weeksOfDays returns the weeks of the month that contain days, and whether the
+// days are exactly those weeks. Days 29 to 31 are in the last week, which is never
+// exact, as it depends on the length of the month.
+func weeksOfDays(days DayOfMonth) (Week, bool) {
+	var weeks Week
+	var covered DayOfMonth
+	for i, week := range []Week{First, Second, Third, Fourth} {
+		block := DayOfMonth(1<<7-1) << (7 * i)
+		if days&block != 0 {
+			weeks |= week
+			covered |= block
+		}
+	}
+	if days>>28 != 0 {
+		return weeks | LastWeek, false
+	}
+
+	return weeks, covered == days
+}
+
+// taskTriggerOf returns the TaskTrigger of a trigger.
+func taskTriggerOf(t Trigger) TaskTrigger {
+	return TaskTrigger{
+		Enabled:            t.GetEnabled(),
+		EndBoundary:        t.GetEndBoundary(),
+		ExecutionTimeLimit: t.GetExecutionTimeLimit(),
+		ID:                 t.GetID(),
+		RepetitionPattern: RepetitionPattern{
+			RepetitionDuration: t.GetRepetitionDuration(),
+			RepetitionInterval: t.GetRepetitionInterval(),
+			StopAtDurationEnd:  t.GetStopAtDurationEnd(),
+		},
+		StartBoundary: t.GetStartBoundary(),
+	}
+}
+
+// withRandomDelay returns a calendar trigger with its RandomDelay set; other
+// triggers are returned as they are.
+func withRandomDelay(trigger Trigger, delay period.Period) Trigger {
+	switch t := trigger.(type) {
+	case TimeTrigger:
+		t.RandomDelay = delay
+		return t
+	case DailyTrigger:
+		t.RandomDelay = delay
+		return t
+	case WeeklyTrigger:
+		t.RandomDelay = delay
+		return t
+	case MonthlyTrigger:
+		t.RandomDelay = delay
+		return t
+	case MonthlyDOWTrigger:
+		t.RandomDelay = delay
+		return t
+	default:
+		return trigger
+	}
+}
@@ -0,0 +1,218 @@
+package taskmaster
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rickb777/period"
+)
+
+const testSystemdService = `[Unit]
+Description=Nightly backup
+Documentation=https://example.com/backup
+
+[Service]
+Type=oneshot
+User=backup
+Environment=TARGET=/mnt/backup
+WorkingDirectory=-/var/lib/backup
+ExecStart=/bin/true
+ExecStart=
+ExecStart=-"/opt/backup/bin/backup tool" --tag 100%%\
+	--dir C:\\Backups
+ExecStart=!/usr/bin/sync
+TimeoutStartSec=1h 30min
+
+[Install]
+WantedBy=multi-user.target
+`
+
+const testSystemdTimer = `# runs the backup
+[Unit]
+Description=Run the nightly backup
+
+[Timer]
+OnCalendar=hourly
+OnCalendar=
+OnCalendar=Mon..Fri *-*-* 02:30
+OnBootSec=5min
+OnUnitActiveSec=6h
+Persistent=yes
+WakeSystem=true
+RandomizedDelaySec=10m
+AccuracySec=1min
+RemainAfterElapse=no
+
+[Install]
+WantedBy=timers.target
+`
+
+func TestImportSystemd(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	result, err := ImportSystemd(testSystemdService, testSystemdTimer, SystemdImportOptions{Start: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := result.Definition
+
+	if def.RegistrationInfo.Description != "Nightly backup" || def.RegistrationInfo.Documentation != "https://example.com/backup" {
+		t.Errorf("registration info = %#v", def.RegistrationInfo)
+	}
+	wantActions := []Action{
+		ExecAction{Path: "/opt/backup/bin/backup tool", Args: `--tag 100% --dir C:\Backups`, WorkingDir: "/var/lib/backup"},
+		ExecAction{Path: "/usr/bin/sync", WorkingDir: "/var/lib/backup"},
+	}
+	if !reflect.DeepEqual(def.Actions, wantActions) {
+		t.Errorf("actions = %#v", def.Actions)
+	}
+	if def.Settings.TimeLimit != period.NewHMS(1, 30, 0) || !def.Settings.StartWhenAvailable || !def.Settings.WakeToRun {
+		t.Errorf("settings = %#v", def.Settings)
+	}
+
+	repeating := func(tt TaskTrigger) TaskTrigger {
+		tt.RepetitionInterval = period.NewHMS(6, 0, 0)
+		return tt
+	}
+	wantTriggers := []Trigger{
+		WeeklyTrigger{
+			TaskTrigger:  repeating(TaskTrigger{Enabled: true, StartBoundary: time.Date(2024, 5, 1, 2, 30, 0, 0, time.UTC)}),
+			DaysOfWeek:   Monday | Tuesday | Wednesday | Thursday | Friday,
+			WeekInterval: EveryWeek,
+			RandomDelay:  period.NewHMS(0, 10, 0),
+		},
+		BootTrigger{TaskTrigger: repeating(TaskTrigger{Enabled: true}), Delay: period.NewHMS(0, 5, 0)},
+	}
+	if !reflect.DeepEqual(def.Triggers, wantTriggers) {
+		t.Errorf("triggers = %#v", def.Triggers)
+	}
+
+	warnings := strings.Join(result.Warnings, "\n")
+	for _, want := range []string{"User=backup", "Environment= in [Service]", "prefix !", "RemainAfterElapse= in [Timer]", "boot triggers have no random delay"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("warnings do not contain %q:\n%s", want, warnings)
+		}
+	}
+	for _, unwanted := range []string{"WantedBy", "AccuracySec"} {
+		if strings.Contains(warnings, unwanted) {
+			t.Errorf("warnings contain %q:\n%s", unwanted, warnings)
+		}
+	}
+}
+
+func TestImportSystemdCalendars(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour, minute, second int) TaskTrigger {
+		return TaskTrigger{Enabled: true, StartBoundary: time.Date(2024, 5, 1, hour, minute, second, 0, time.UTC)}
+	}
+
+	tests := []struct {
+		calendar string
+		want     []Trigger
+		warning  string
+	}{
+		{calendar: "daily", want: []Trigger{DailyTrigger{TaskTrigger: at(0, 0, 0), DayInterval: EveryDay}}},
+		{calendar: "quarterly", want: []Trigger{MonthlyTrigger{TaskTrigger: at(0, 0, 0), DaysOfMonth: One, MonthsOfYear: January | April | July | October}}},
+		{calendar: "*-*-01,15 03:30:15", want: []Trigger{MonthlyTrigger{TaskTrigger: at(3, 30, 15), DaysOfMonth: One | Fifteen, MonthsOfYear: AllMonths}}},
+		{calendar: "Sat,Sun *-01,07-* 08:00", want: []Trigger{MonthlyDOWTrigger{TaskTrigger: at(8, 0, 0), DaysOfWeek: Saturday | Sunday, MonthsOfYear: January | July, WeeksOfMonth: AllWeeks}}},
+		{calendar: "*-*~01 23:00", want: []Trigger{MonthlyTrigger{TaskTrigger: at(23, 0, 0), MonthsOfYear: AllMonths, RunOnLastDayOfMonth: true}}},
+		{calendar: "Fri *-*~07/1 17:00", want: []Trigger{MonthlyDOWTrigger{TaskTrigger: at(17, 0, 0), DaysOfWeek: Friday, MonthsOfYear: AllMonths, RunOnLastWeekOfMonth: true}}},
+		{calendar: "Mon *-*-01..07,15..21 04:00", want: []Trigger{MonthlyDOWTrigger{TaskTrigger: at(4, 0, 0), DaysOfWeek: Monday, MonthsOfYear: AllMonths, WeeksOfMonth: First | Third}}},
+		{calendar: "2024-12-24 18:00", want: []Trigger{TimeTrigger{TaskTrigger: TaskTrigger{Enabled: true, StartBoundary: time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC)}}}},
+		{calendar: "*:0/15", want: []Trigger{DailyTrigger{
+			TaskTrigger: TaskTrigger{
+				Enabled:           true,
+				StartBoundary:     start,
+				RepetitionPattern: RepetitionPattern{RepetitionInterval: period.NewHMS(0, 15, 0), RepetitionDuration: period.NewHMS(23, 46, 0)},
+			},
+			DayInterval: EveryDay,
+		}}},
+		{calendar: "Sat..Sun 9,17:00", want: []Trigger{WeeklyTrigger{
+			TaskTrigger: TaskTrigger{
+				Enabled:           true,
+				StartBoundary:     at(9, 0, 0).StartBoundary,
+				RepetitionPattern: RepetitionPattern{RepetitionInterval: period.NewHMS(8, 0, 0), RepetitionDuration: period.NewHMS(8, 1, 0)},
+			},
+			DaysOfWeek:   Saturday | Sunday,
+			WeekInterval: EveryWeek,
+		}}},
+		{
+			calendar: "Tue *-*-10 12:00",
+			want:     []Trigger{MonthlyDOWTrigger{TaskTrigger: at(12, 0, 0), DaysOfWeek: Tuesday, MonthsOfYear: AllMonths, WeeksOfMonth: Second}},
+			warning:  "whole weeks of the month",
+		},
+		{calendar: "*-*~03", warning: "is left out"},
+		{
+			calendar: "Mon 09:00 Europe/Berlin",
+			want:     []Trigger{WeeklyTrigger{TaskTrigger: at(9, 0, 0), DaysOfWeek: Monday, WeekInterval: EveryWeek}},
+			warning:  "time zones are not supported",
+		},
+		{
+			calendar: "2025..2026-01-01",
+			want:     []Trigger{MonthlyTrigger{TaskTrigger: at(0, 0, 0), DaysOfMonth: One, MonthsOfYear: January}},
+			warning:  "runs every year",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.calendar, func(t *testing.T) {
+			imp := systemdImporter{opts: SystemdImportOptions{Start: start}}
+			triggers, err := imp.calendarTriggers(test.calendar)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(triggers, test.want) {
+				t.Errorf("triggers = %#v, want %#v", triggers, test.want)
+			}
+			if warnings := strings.Join(imp.conversionWarnings, "\n"); test.warning == "" && warnings != "" || !strings.Contains(warnings, test.warning) {
+				t.Errorf("warnings = %q, want %q", warnings, test.warning)
+			}
+		})
+	}
+}
+
+func TestImportSystemdErrors(t *testing.T) {
+	service := "[Service]\nExecStart=/bin/true\n"
+	tests := map[string]struct{ service, timer string }{
+		"no ExecStart":        {"[Service]\nType=oneshot\n", ""},
+		"unterminated quote":  {"[Service]\nExecStart=\"/bin/true\n", ""},
+		"outside of section":  {"ExecStart=/bin/true\n", ""},
+		"not a setting":       {"[Service]\nExecStart\n", ""},
+		"invalid month":       {service, "[Timer]\nOnCalendar=*-13-01\n"},
+		"reversed weekdays":   {service, "[Timer]\nOnCalendar=Fri..Mon\n"},
+		"invalid hour":        {service, "[Timer]\nOnCalendar=*-*-* 25:00\n"},
+		"invalid time span":   {service, "[Timer]\nOnBootSec=5 fortnights\n"},
+		"invalid boolean":     {service, "[Timer]\nPersistent=sometimes\n"},
+		"too many triggers":   {service, "[Timer]\nOnCalendar=*-*-* 1,2,4,8:1,2,4,8,16,32:00\nOnCalendar=Mon *-*-* 1,2,4,8:1,2,4,8,16,32:00\nOnCalendar=Tue *-*-* 1,2,4,8:1,2,4,8,16,32:00\n"},
+		"invalid RuntimeMax":  {"[Service]\nExecStart=/bin/true\nRuntimeMaxSec=soon\n", ""},
+		"unterminated header": {"[Service\nExecStart=/bin/true\n", ""},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ImportSystemd(test.service, test.timer, SystemdImportOptions{}); err == nil {
+				t.Error("importing did not fail")
+			}
+		})
+	}
+}
+
+func TestParseSystemdTimespan(t *testing.T) {
+	tests := map[string]period.Period{
+		"90":         period.NewHMS(0, 1, 30),
+		"5min":       period.NewHMS(0, 5, 0),
+		"1h 30min":   period.NewHMS(1, 30, 0),
+		"1h30m":      period.NewHMS(1, 30, 0),
+		"2d":         period.NewHMS(48, 0, 0),
+		"1.5h":       period.NewHMS(1, 30, 0),
+		"infinity":   {},
+		"500ms 1sec": period.NewHMS(0, 0, 2),
+		"2 h":        period.NewHMS(2, 0, 0),
+		"5 min":      period.NewHMS(0, 5, 0),
+		"1 h 30 min": period.NewHMS(1, 30, 0),
+	}
+	for s, want := range tests {
+		if got, err := parseSystemdTimespan(s); err != nil || got != want {
+			t.Errorf("parseSystemdTimespan(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+}
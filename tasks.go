@@ -11,14 +11,6 @@ import (
 	"github.com/go-ole/go-ole/oleutil"
 )
 
-func (d *Definition) AddAction(action Action) {
-	d.Actions = append(d.Actions, action)
-}
-
-func (d *Definition) AddTrigger(trigger Trigger) {
-	d.Triggers = append(d.Triggers, trigger)
-}
-
 // Refresh refreshes all of the local instance variables of the running task.
 // https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nf-taskschd-irunningtask-refresh
 func (r RunningTask) Refresh() error {
@@ -122,6 +114,19 @@ func (r *RegisteredTask) Stop() error {
 	return nil
 }
 
+// SetEnabled enables or disables the registered task.
+// https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nf-taskschd-iregisteredtask-put_enabled
+func (r *RegisteredTask) SetEnabled(enabled bool) error {
+	_, err := oleutil.PutProperty(r.taskObj, "Enabled", enabled)
+	if err != nil {
+		return fmt.Errorf("error setting enabled of registered task %s: %w", r.Path, getTaskSchedulerError(err))
+	}
+	r.Enabled = enabled
+	r.Definition.Settings.Enabled = enabled
+
+	return nil
+}
+
 // Release frees the registered task COM object. Must be called before
 // program termination to avoid memory leaks.
 func (r *RegisteredTask) Release() {
@@ -131,9 +136,6 @@ func (r *RegisteredTask) Release() {
 	}
 }
 
-// RunningTaskCollection is a collection of running tasks.
-type RunningTaskCollection []RunningTask
-
 // Stop kills and frees all the running tasks COM objects in the
 // collection. If an error is encountered while stopping a running
 // task, Stop returns the error without attempting to stop any
@@ -156,9 +158,6 @@ func (r RunningTaskCollection) Release() {
 	}
 }
 
-// RegisteredTaskCollection is a collection of registered tasks.
-type RegisteredTaskCollection []RegisteredTask
-
 // Release frees all the registered task COM objects in the collection.
 // Must be called before program termination to avoid memory leaks.
 func (r RegisteredTaskCollection) Release() {
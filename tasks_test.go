@@ -4,6 +4,8 @@
 package taskmaster
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 )
@@ -139,3 +141,82 @@ func TestGetRunningTasksServiceWide(t *testing.T) {
 	}
 	_ = testTask.Stop()
 }
+
+func TestWaitRunningTask(t *testing.T) {
+	taskService := setupTaskService(t)
+
+	def := taskService.NewTaskDefinition()
+	def.AddAction(ExecAction{Path: "cmd.exe", Args: "/c ping -n 2 127.0.0.1 >nul & exit 3"})
+	def.Settings.MultipleInstances = TASK_INSTANCES_QUEUE
+	task, _, err := taskService.CreateTask(testTaskPath("WaitTask"), def, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer task.Release()
+
+	first, err := task.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Release()
+	// queued behind the first instance
+	second, err := task.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for i, instance := range []RunningTask{first, second} {
+		result, err := task.Wait(ctx, instance)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Completed.IsZero() || result.Duration <= 0 {
+			t.Fatalf("expected a completed run, got %+v", result)
+		}
+		// the result of the first instance may already be overwritten by the second
+		if i == 1 && result.Result != 3 {
+			t.Fatalf("expected result 3, got %d (%s)", result.Result, result.Result)
+		}
+	}
+
+	running, err := task.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer running.Release()
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := task.Wait(ctx, running); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestSetEnabledRegisteredTask(t *testing.T) {
+	taskService := setupTaskService(t)
+	testTask := createTestTask(taskService)
+	defer testTask.Release()
+
+	if err := testTask.SetEnabled(false); err != nil {
+		t.Fatal(err)
+	}
+	if testTask.Enabled || testTask.Definition.Settings.Enabled {
+		t.Fatal("expected the task to be disabled")
+	}
+	withRegisteredTask(t, taskService, testTask.Path, func(task RegisteredTask) {
+		if task.Enabled {
+			t.Fatal("expected the registered task to be disabled")
+		}
+	})
+
+	if err := testTask.SetEnabled(true); err != nil {
+		t.Fatal(err)
+	}
+	withRegisteredTask(t, taskService, testTask.Path, func(task RegisteredTask) {
+		if !task.Enabled {
+			t.Fatal("expected the registered task to be enabled")
+		}
+	})
+}
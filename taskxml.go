@@ -0,0 +1,1137 @@
+package taskmaster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/rickb777/period"
+)
+
+// The types below mirror the Task Scheduler XML schema closely enough to decode
+// a task definition. Elements that may be omitted are pointers so their schema
+// defaults can be told apart from explicit values.
+// https://docs.microsoft.com/en-us/windows/desktop/taskschd/task-scheduler-schema
+
+type xmlTask struct {
+	XMLName          xml.Name            `xml:"Task"`
+	Version          string              `xml:"version,attr"`
+	RegistrationInfo xmlRegistrationInfo `xml:"RegistrationInfo"`
+	Triggers         xmlTriggers         `xml:"Triggers"`
+	Principals       []xmlPrincipal      `xml:"Principals>Principal"`
+	Settings         xmlSettings         `xml:"Settings"`
+	Actions          xmlActions          `xml:"Actions"`
+	Data             string              `xml:"Data"`
+}
+
+type xmlRegistrationInfo struct {
+	Author             string `xml:"Author"`
+	Date               string `xml:"Date"`
+	Description        string `xml:"Description"`
+	Documentation      string `xml:"Documentation"`
+	SecurityDescriptor string `xml:"SecurityDescriptor"`
+	Source             string `xml:"Source"`
+	URI                string `xml:"URI"`
+	Version            string `xml:"Version"`
+}
+
+type xmlTriggers struct {
+	Triggers []xmlTrigger `xml:",any"`
+}
+
+type xmlTrigger struct {
+	XMLName            xml.Name
+	ID                 string         `xml:"id,attr"`
+	Enabled            *bool          `xml:"Enabled"`
+	StartBoundary      string         `xml:"StartBoundary"`
+	EndBoundary        string         `xml:"EndBoundary"`
+	ExecutionTimeLimit string         `xml:"ExecutionTimeLimit"`
+	Repetition         *xmlRepetition `xml:"Repetition"`
+	Delay              string         `xml:"Delay"`
+	RandomDelay        string         `xml:"RandomDelay"`
+	UserID             string         `xml:"UserId"`
+	StateChange        string         `xml:"StateChange"`
+	Subscription       string         `xml:"Subscription"`
+	ValueQueries       []xmlValue     `xml:"ValueQueries>Value"`
+
+	ScheduleByDay            *xmlScheduleByDay            `xml:"ScheduleByDay"`
+	ScheduleByWeek           *xmlScheduleByWeek           `xml:"ScheduleByWeek"`
+	ScheduleByMonth          *xmlScheduleByMonth          `xml:"ScheduleByMonth"`
+	ScheduleByMonthDayOfWeek *xmlScheduleByMonthDayOfWeek `xml:"ScheduleByMonthDayOfWeek"`
+}
+
+type xmlRepetition struct {
+	Interval          string `xml:"Interval"`
+	Duration          string `xml:"Duration"`
+	StopAtDurationEnd bool   `xml:"StopAtDurationEnd"`
+}
+
+type xmlValue struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlScheduleByDay struct {
+	DaysInterval uint8 `xml:"DaysInterval"`
+}
+
+type xmlScheduleByWeek struct {
+	WeeksInterval uint8       `xml:"WeeksInterval"`
+	DaysOfWeek    xmlElements `xml:"DaysOfWeek"`
+}
+
+type xmlScheduleByMonth struct {
+	DaysOfMonth []string    `xml:"DaysOfMonth>Day"`
+	Months      xmlElements `xml:"Months"`
+}
+
+type xmlScheduleByMonthDayOfWeek struct {
+	Weeks      []string    `xml:"Weeks>Week"`
+	DaysOfWeek xmlElements `xml:"DaysOfWeek"`
+	Months     xmlElements `xml:"Months"`
+}
+
+// xmlElements collects the names of empty child elements, such as <Monday />.
+type xmlElements struct {
+	Elements []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+func (e xmlElements) names() []string {
+	names := make([]string, len(e.Elements))
+	for i, element := range e.Elements {
+		names[i] = element.XMLName.Local
+	}
+
+	return names
+}
+
+type xmlPrincipal struct {
+	ID                  string   `xml:"id,attr"`
+	UserID              string   `xml:"UserId"`
+	GroupID             string   `xml:"GroupId"`
+	DisplayName         string   `xml:"DisplayName"`
+	LogonType           string   `xml:"LogonType"`
+	RunLevel            string   `xml:"RunLevel"`
+	ProcessTokenSidType string   `xml:"ProcessTokenSidType"`
+	RequiredPrivileges  []string `xml:"RequiredPrivileges>Privilege"`
+}
+
+type xmlSettings struct {
+	AllowStartOnDemand              *bool                   `xml:"AllowStartOnDemand"`
+	AllowHardTerminate              *bool                   `xml:"AllowHardTerminate"`
+	DeleteExpiredTaskAfter          string                  `xml:"DeleteExpiredTaskAfter"`
+	DisallowStartIfOnBatteries      *bool                   `xml:"DisallowStartIfOnBatteries"`
+	Enabled                         *bool                   `xml:"Enabled"`
+	ExecutionTimeLimit              *string                 `xml:"ExecutionTimeLimit"`
+	Hidden                          bool                    `xml:"Hidden"`
+	IdleSettings                    xmlIdleSettings         `xml:"IdleSettings"`
+	MultipleInstancesPolicy         string                  `xml:"MultipleInstancesPolicy"`
+	NetworkSettings                 xmlNetworkSettings      `xml:"NetworkSettings"`
+	Priority                        *uint                   `xml:"Priority"`
+	RestartOnFailure                xmlRestartOnFailure     `xml:"RestartOnFailure"`
+	RunOnlyIfIdle                   bool                    `xml:"RunOnlyIfIdle"`
+	RunOnlyIfNetworkAvailable       bool                    `xml:"RunOnlyIfNetworkAvailable"`
+	StartWhenAvailable              bool                    `xml:"StartWhenAvailable"`
+	StopIfGoingOnBatteries          *bool                   `xml:"StopIfGoingOnBatteries"`
+	WakeToRun                       bool                    `xml:"WakeToRun"`
+	DisallowStartOnRemoteAppSession bool                    `xml:"DisallowStartOnRemoteAppSession"`
+	UseUnifiedSchedulingEngine      bool                    `xml:"UseUnifiedSchedulingEngine"`
+	Volatile                        bool                    `xml:"Volatile"`
+	MaintenanceSettings             *xmlMaintenanceSettings `xml:"MaintenanceSettings"`
+}
+
+type xmlNetworkSettings struct {
+	ID   string `xml:"Id"`
+	Name string `xml:"Name"`
+}
+
+type xmlIdleSettings struct {
+	Duration      *string `xml:"Duration"`
+	WaitTimeout   *string `xml:"WaitTimeout"`
+	StopOnIdleEnd *bool   `xml:"StopOnIdleEnd"`
+	RestartOnIdle bool    `xml:"RestartOnIdle"`
+}
+
+type xmlRestartOnFailure struct {
+	Interval string `xml:"Interval"`
+	Count    uint   `xml:"Count"`
+}
+
+type xmlMaintenanceSettings struct {
+	Period    string `xml:"Period"`
+	Deadline  string `xml:"Deadline"`
+	Exclusive bool   `xml:"Exclusive"`
+}
+
+type xmlActions struct {
+	Context string      `xml:"Context,attr"`
+	Actions []xmlAction `xml:",any"`
+}
+
+type xmlAction struct {
+	XMLName          xml.Name
+	ID               string `xml:"id,attr"`
+	Command          string `xml:"Command"`
+	Arguments        string `xml:"Arguments"`
+	WorkingDirectory string `xml:"WorkingDirectory"`
+	ClassID          string `xml:"ClassId"`
+	Data             string `xml:"Data"`
+}
+
+// ParseTaskXML parses the XML-formatted definition of a task, such as
+// Definition.XMLText or a file exported from the Task Scheduler, without
+// connecting to the Task Scheduler service. Elements that are omitted get the
+// defaults of the Task Scheduler schema. The returned Definition's XMLText is set
+// to xmlText.
+//
+// Only the actions and triggers that taskmaster has types for are supported; a
+// definition with an e-mail or message box action returns an error. Triggers the
+// schema does not describe, such as WNF state change triggers, are returned as a
+// CustomTrigger.
+func ParseTaskXML(xmlText string) (Definition, error) {
+	var task xmlTask
+	decoder := xml.NewDecoder(strings.NewReader(xmlText))
+	// the text is already decoded, whatever the declaration says
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&task); err != nil {
+		return Definition{}, fmt.Errorf("error parsing task XML: %w", err)
+	}
+
+	def, err := task.definition()
+	if err != nil {
+		return Definition{}, fmt.Errorf("error parsing task XML: %w", err)
+	}
+	def.XMLText = xmlText
+
+	return def, nil
+}
+
+// ReadTaskXML reads and parses the XML-formatted definition of a task, as
+// ParseTaskXML does. Files exported from the Task Scheduler are encoded in UTF-16
+// with a byte order mark; they are decoded to UTF-8 first.
+func ReadTaskXML(r io.Reader) (Definition, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Definition{}, fmt.Errorf("error reading task XML: %w", err)
+	}
+
+	return ParseTaskXML(decodeTaskXML(data))
+}
+
+// decodeTaskXML returns the text of XML data that is encoded in UTF-8, or in
+// UTF-16 with a byte order mark.
+func decodeTaskXML(data []byte) string {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		order = binary.BigEndian
+	default:
+		return string(bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF}))
+	}
+
+	data = data[2:]
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+
+	return string(utf16.Decode(units))
+}
+
+func (x xmlTask) definition() (Definition, error) {
+	var def Definition
+	var err error
+
+	if def.Settings.Compatibility, err = xmlCompatibility(x.Version); err != nil {
+		return Definition{}, err
+	}
+
+	info := x.RegistrationInfo
+	def.RegistrationInfo = RegistrationInfo{
+		Author:             info.Author,
+		Description:        info.Description,
+		Documentation:      info.Documentation,
+		SecurityDescriptor: info.SecurityDescriptor,
+		Source:             info.Source,
+		URI:                info.URI,
+		Version:            info.Version,
+	}
+	if def.RegistrationInfo.Date, err = TaskDateToTime(info.Date); err != nil {
+		return Definition{}, fmt.Errorf("error parsing RegistrationInfo.Date field: %w", err)
+	}
+
+	for _, trigger := range x.Triggers.Triggers {
+		taskTrigger, err := trigger.trigger()
+		if err != nil {
+			return Definition{}, fmt.Errorf("error parsing %s: %w", trigger.XMLName.Local, err)
+		}
+		def.AddTrigger(taskTrigger)
+	}
+
+	def.Context = x.Actions.Context
+	for _, action := range x.Actions.Actions {
+		switch action.XMLName.Local {
+		case "Exec":
+			def.AddAction(ExecAction{
+				ID:         action.ID,
+				Path:       action.Command,
+				Args:       action.Arguments,
+				WorkingDir: action.WorkingDirectory,
+			})
+		case "ComHandler":
+			def.AddAction(ComHandlerAction{
+				ID:      action.ID,
+				ClassID: action.ClassID,
+				Data:    action.Data,
+			})
+		default:
+			return Definition{}, fmt.Errorf("unsupported action type %s", action.XMLName.Local)
+		}
+	}
+
+	if def.Principal, err = x.principal(); err != nil {
+		return Definition{}, err
+	}
+	if def.Settings, err = x.Settings.settings(def.Settings.Compatibility); err != nil {
+		return Definition{}, err
+	}
+	def.Data = x.Data
+
+	return def, nil
+}
+
+// xmlCompatibility maps the version attribute of a task to the compatibility it
+// requires.
+func xmlCompatibility(version string) (TaskCompatibility, error) {
+	switch version {
+	case "1.0":
+		return TASK_COMPATIBILITY_AT, nil
+	case "1.1":
+		return TASK_COMPATIBILITY_V1, nil
+	case "", "1.2":
+		return TASK_COMPATIBILITY_V2, nil
+	case "1.3":
+		return TASK_COMPATIBILITY_V2_1, nil
+	case "1.4":
+		return TASK_COMPATIBILITY_V2_2, nil
+	case "1.5":
+		return TASK_COMPATIBILITY_V2_3, nil
+	case "1.6":
+		return TASK_COMPATIBILITY_V2_4, nil
+	default:
+		return 0, fmt.Errorf("unsupported task version %q", version)
+	}
+}
+
+// principal returns the principal the actions run as, which is the principal
+// named by the Context of the actions, or else the only principal.
+func (x xmlTask) principal() (Principal, error) {
+	var xp xmlPrincipal
+	for _, p := range x.Principals {
+		if p.ID == x.Actions.Context || len(x.Principals) == 1 {
+			xp = p
+			break
+		}
+	}
+
+	principal := Principal{
+		Name:    xp.DisplayName,
+		GroupID: xp.GroupID,
+		ID:      xp.ID,
+		UserID:  xp.UserID,
+	}
+
+	switch xp.LogonType {
+	case "":
+		// the schema leaves the logon type of groups and service accounts implicit
+		if xp.GroupID != "" {
+			principal.LogonType = TASK_LOGON_GROUP
+		} else if isServiceAccount(xp.UserID) {
+			principal.LogonType = TASK_LOGON_SERVICE_ACCOUNT
+		}
+	case "S4U":
+		principal.LogonType = TASK_LOGON_S4U
+	case "Password":
+		principal.LogonType = TASK_LOGON_PASSWORD
+	case "InteractiveToken":
+		principal.LogonType = TASK_LOGON_INTERACTIVE_TOKEN
+	case "InteractiveTokenOrPassword":
+		principal.LogonType = TASK_LOGON_INTERACTIVE_TOKEN_OR_PASSWORD
+	case "Group":
+		principal.LogonType = TASK_LOGON_GROUP
+	case "ServiceAccount":
+		principal.LogonType = TASK_LOGON_SERVICE_ACCOUNT
+	default:
+		return Principal{}, fmt.Errorf("error parsing Principal.LogonType field: unknown logon type %q", xp.LogonType)
+	}
+
+	switch xp.RunLevel {
+	case "", "LeastPrivilege":
+		principal.RunLevel = TASK_RUNLEVEL_LUA
+	case "HighestAvailable":
+		principal.RunLevel = TASK_RUNLEVEL_HIGHEST
+	default:
+		return Principal{}, fmt.Errorf("error parsing Principal.RunLevel field: unknown run level %q", xp.RunLevel)
+	}
+
+	switch xp.ProcessTokenSidType {
+	case "", "Default":
+		principal.ProcessTokenSidType = TASK_PROCESSTOKENSID_DEFAULT
+	case "None":
+		principal.ProcessTokenSidType = TASK_PROCESSTOKENSID_NONE
+	case "Unrestricted":
+		principal.ProcessTokenSidType = TASK_PROCESSTOKENSID_UNRESTRICTED
+	default:
+		return Principal{}, fmt.Errorf("error parsing Principal.ProcessTokenSidType field: unknown SID type %q", xp.ProcessTokenSidType)
+	}
+
+	for _, privilege := range xp.RequiredPrivileges {
+		principal.RequiredPrivileges = append(principal.RequiredPrivileges, Privilege(privilege))
+	}
+
+	return principal, nil
+}
+
+// isServiceAccount reports whether userID is one of the accounts that tasks run
+// as with TASK_LOGON_SERVICE_ACCOUNT.
+func isServiceAccount(userID string) bool {
+	switch strings.TrimPrefix(strings.ToUpper(userID), `NT AUTHORITY\`) {
+	case "S-1-5-18", "S-1-5-19", "S-1-5-20", "SYSTEM", "LOCAL SERVICE", "LOCALSERVICE", "NETWORK SERVICE", "NETWORKSERVICE":
+		return true
+	default:
+		return false
+	}
+}
+
+func (x xmlSettings) settings(compatibility TaskCompatibility) (TaskSettings, error) {
+	settings := TaskSettings{
+		AllowDemandStart:                xmlBool(x.AllowStartOnDemand, true),
+		AllowHardTerminate:              xmlBool(x.AllowHardTerminate, true),
+		Compatibility:                   compatibility,
+		DeleteExpiredTaskAfter:          x.DeleteExpiredTaskAfter,
+		DontStartOnBatteries:            xmlBool(x.DisallowStartIfOnBatteries, true),
+		Enabled:                         xmlBool(x.Enabled, true),
+		Hidden:                          x.Hidden,
+		NetworkSettings:                 NetworkSettings{ID: x.NetworkSettings.ID, Name: x.NetworkSettings.Name},
+		Priority:                        7,
+		RestartCount:                    x.RestartOnFailure.Count,
+		RunOnlyIfIdle:                   x.RunOnlyIfIdle,
+		RunOnlyIfNetworkAvailable:       x.RunOnlyIfNetworkAvailable,
+		StartWhenAvailable:              x.StartWhenAvailable,
+		StopIfGoingOnBatteries:          xmlBool(x.StopIfGoingOnBatteries, true),
+		WakeToRun:                       x.WakeToRun,
+		DisallowStartOnRemoteAppSession: x.DisallowStartOnRemoteAppSession,
+		UseUnifiedSchedulingEngine:      x.UseUnifiedSchedulingEngine,
+		Volatile:                        x.Volatile,
+	}
+	settings.IdleSettings.RestartOnIdle = x.IdleSettings.RestartOnIdle
+	settings.IdleSettings.StopOnIdleEnd = xmlBool(x.IdleSettings.StopOnIdleEnd, true)
+	if x.Priority != nil {
+		settings.Priority = *x.Priority
+	}
+
+	var err error
+	if settings.TimeLimit, err = xmlPeriod(x.ExecutionTimeLimit, "PT72H"); err != nil {
+		return TaskSettings{}, fmt.Errorf("error parsing Settings.ExecutionTimeLimit field: %w", err)
+	}
+	if settings.IdleSettings.IdleDuration, err = xmlPeriod(x.IdleSettings.Duration, "PT10M"); err != nil {
+		return TaskSettings{}, fmt.Errorf("error parsing IdleSettings.Duration field: %w", err)
+	}
+	if settings.IdleSettings.WaitTimeout, err = xmlPeriod(x.IdleSettings.WaitTimeout, "PT1H"); err != nil {
+		return TaskSettings{}, fmt.Errorf("error parsing IdleSettings.WaitTimeout field: %w", err)
+	}
+	if settings.RestartInterval, err = StringToPeriod(x.RestartOnFailure.Interval); err != nil {
+		return TaskSettings{}, fmt.Errorf("error parsing RestartOnFailure.Interval field: %w", err)
+	}
+
+	switch x.MultipleInstancesPolicy {
+	case "", "IgnoreNew":
+		settings.MultipleInstances = TASK_INSTANCES_IGNORE_NEW
+	case "Parallel":
+		settings.MultipleInstances = TASK_INSTANCES_PARALLEL
+	case "Queue":
+		settings.MultipleInstances = TASK_INSTANCES_QUEUE
+	case "StopExisting":
+		settings.MultipleInstances = TASK_INSTANCES_STOP_EXISTING
+	default:
+		return TaskSettings{}, fmt.Errorf("error parsing Settings.MultipleInstancesPolicy field: unknown policy %q", x.MultipleInstancesPolicy)
+	}
+
+	if m := x.MaintenanceSettings; m != nil {
+		settings.MaintenanceSettings.Exclusive = m.Exclusive
+		if settings.MaintenanceSettings.Period, err = StringToPeriod(m.Period); err != nil {
+			return TaskSettings{}, fmt.Errorf("error parsing MaintenanceSettings.Period field: %w", err)
+		}
+		if settings.MaintenanceSettings.Deadline, err = StringToPeriod(m.Deadline); err != nil {
+			return TaskSettings{}, fmt.Errorf("error parsing MaintenanceSettings.Deadline field: %w", err)
+		}
+	}
+
+	return settings, nil
+}
+
+func (x xmlTrigger) trigger() (Trigger, error) {
+	taskTrigger := TaskTrigger{
+		Enabled: xmlBool(x.Enabled, true),
+		ID:      x.ID,
+	}
+
+	var err error
+	if taskTrigger.StartBoundary, err = TaskDateToTime(x.StartBoundary); err != nil {
+		return nil, fmt.Errorf("error parsing StartBoundary field: %w", err)
+	}
+	if taskTrigger.EndBoundary, err = TaskDateToTime(x.EndBoundary); err != nil {
+		return nil, fmt.Errorf("error parsing EndBoundary field: %w", err)
+	}
+	if taskTrigger.ExecutionTimeLimit, err = StringToPeriod(x.ExecutionTimeLimit); err != nil {
+		return nil, fmt.Errorf("error parsing ExecutionTimeLimit field: %w", err)
+	}
+	if x.Repetition != nil {
+		taskTrigger.StopAtDurationEnd = x.Repetition.StopAtDurationEnd
+		if taskTrigger.RepetitionInterval, err = StringToPeriod(x.Repetition.Interval); err != nil {
+			return nil, fmt.Errorf("error parsing Repetition.Interval field: %w", err)
+		}
+		if taskTrigger.RepetitionDuration, err = StringToPeriod(x.Repetition.Duration); err != nil {
+			return nil, fmt.Errorf("error parsing Repetition.Duration field: %w", err)
+		}
+	}
+
+	delay, err := StringToPeriod(x.Delay)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Delay field: %w", err)
+	}
+	randomDelay, err := StringToPeriod(x.RandomDelay)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing RandomDelay field: %w", err)
+	}
+
+	switch x.XMLName.Local {
+	case "BootTrigger":
+		return BootTrigger{TaskTrigger: taskTrigger, Delay: delay}, nil
+	case "IdleTrigger":
+		return IdleTrigger{TaskTrigger: taskTrigger}, nil
+	case "LogonTrigger":
+		return LogonTrigger{TaskTrigger: taskTrigger, Delay: delay, UserID: x.UserID}, nil
+	case "RegistrationTrigger":
+		return RegistrationTrigger{TaskTrigger: taskTrigger, Delay: delay}, nil
+	case "TimeTrigger":
+		return TimeTrigger{TaskTrigger: taskTrigger, RandomDelay: randomDelay}, nil
+	case "EventTrigger":
+		eventTrigger := EventTrigger{TaskTrigger: taskTrigger, Delay: delay, Subscription: x.Subscription}
+		if len(x.ValueQueries) > 0 {
+			eventTrigger.ValueQueries = make(map[string]string, len(x.ValueQueries))
+			for _, query := range x.ValueQueries {
+				eventTrigger.ValueQueries[query.Name] = query.Value
+			}
+		}
+		return eventTrigger, nil
+	case "SessionStateChangeTrigger":
+		stateChange, err := xmlSessionStateChange(x.StateChange)
+		if err != nil {
+			return nil, err
+		}
+		return SessionStateChangeTrigger{TaskTrigger: taskTrigger, Delay: delay, StateChange: stateChange, UserId: x.UserID}, nil
+	case "CalendarTrigger":
+		return x.calendarTrigger(taskTrigger, randomDelay)
+	default:
+		return CustomTrigger{TaskTrigger: taskTrigger}, nil
+	}
+}
+
+func (x xmlTrigger) calendarTrigger(taskTrigger TaskTrigger, randomDelay period.Period) (Trigger, error) {
+	switch {
+	case x.ScheduleByDay != nil:
+		return DailyTrigger{TaskTrigger: taskTrigger, DayInterval: DayInterval(x.ScheduleByDay.DaysInterval), RandomDelay: randomDelay}, nil
+	case x.ScheduleByWeek != nil:
+		daysOfWeek, err := xmlDaysOfWeek(x.ScheduleByWeek.DaysOfWeek)
+		if err != nil {
+			return nil, err
+		}
+		return WeeklyTrigger{TaskTrigger: taskTrigger, DaysOfWeek: daysOfWeek, RandomDelay: randomDelay, WeekInterval: WeekInterval(x.ScheduleByWeek.WeeksInterval)}, nil
+	case x.ScheduleByMonth != nil:
+		monthlyTrigger := MonthlyTrigger{TaskTrigger: taskTrigger, RandomDelay: randomDelay}
+		for _, day := range x.ScheduleByMonth.DaysOfMonth {
+			if day == "Last" {
+				monthlyTrigger.RunOnLastDayOfMonth = true
+				continue
+			}
+			n, err := strconv.Atoi(day)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing DaysOfMonth field: %w", err)
+			}
+			dayOfMonth, err := IntToDayOfMonth(n)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing DaysOfMonth field: %w", err)
+			}
+			monthlyTrigger.DaysOfMonth |= dayOfMonth
+		}
+		var err error
+		if monthlyTrigger.MonthsOfYear, err = xmlMonths(x.ScheduleByMonth.Months); err != nil {
+			return nil, err
+		}
+		return monthlyTrigger, nil
+	case x.ScheduleByMonthDayOfWeek != nil:
+		schedule := x.ScheduleByMonthDayOfWeek
+		monthlyDOWTrigger := MonthlyDOWTrigger{TaskTrigger: taskTrigger, RandomDelay: randomDelay}
+		for _, week := range schedule.Weeks {
+			switch week {
+			case "1":
+				monthlyDOWTrigger.WeeksOfMonth |= First
+			case "2":
+				monthlyDOWTrigger.WeeksOfMonth |= Second
+			case "3":
+				monthlyDOWTrigger.WeeksOfMonth |= Third
+			case "4":
+				monthlyDOWTrigger.WeeksOfMonth |= Fourth
+			case "Last":
+				monthlyDOWTrigger.RunOnLastWeekOfMonth = true
+			default:
+				return nil, fmt.Errorf("error parsing Weeks field: unknown week %q", week)
+			}
+		}
+		var err error
+		if monthlyDOWTrigger.DaysOfWeek, err = xmlDaysOfWeek(schedule.DaysOfWeek); err != nil {
+			return nil, err
+		}
+		if monthlyDOWTrigger.MonthsOfYear, err = xmlMonths(schedule.Months); err != nil {
+			return nil, err
+		}
+		return monthlyDOWTrigger, nil
+	default:
+		// a calendar trigger without a schedule runs once
+		return TimeTrigger{TaskTrigger: taskTrigger, RandomDelay: randomDelay}, nil
+	}
+}
+
+var xmlDayNames = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+
+var xmlMonthNames = []string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+
+func xmlDaysOfWeek(e xmlElements) (DayOfWeek, error) {
+	var days DayOfWeek
+	for _, name := range e.names() {
+		i := slices.Index(xmlDayNames, name)
+		if i < 0 {
+			return 0, fmt.Errorf("error parsing DaysOfWeek field: unknown day %q", name)
+		}
+		days |= 1 << i
+	}
+
+	return days, nil
+}
+
+func xmlMonths(e xmlElements) (Month, error) {
+	var months Month
+	for _, name := range e.names() {
+		i := slices.Index(xmlMonthNames, name)
+		if i < 0 {
+			return 0, fmt.Errorf("error parsing Months field: unknown month %q", name)
+		}
+		months |= 1 << i
+	}
+
+	return months, nil
+}
+
+func xmlSessionStateChange(s string) (TaskSessionStateChangeType, error) {
+	switch s {
+	case "ConsoleConnect":
+		return TASK_CONSOLE_CONNECT, nil
+	case "ConsoleDisconnect":
+		return TASK_CONSOLE_DISCONNECT, nil
+	case "RemoteConnect":
+		return TASK_REMOTE_CONNECT, nil
+	case "RemoteDisconnect":
+		return TASK_REMOTE_DISCONNECT, nil
+	case "SessionLock":
+		return TASK_SESSION_LOCK, nil
+	case "SessionUnlock":
+		return TASK_SESSION_UNLOCK, nil
+	default:
+		return 0, fmt.Errorf("error parsing StateChange field: unknown state change %q", s)
+	}
+}
+
+// xmlBool returns the value of an optional boolean element, or def if it is
+// omitted.
+func xmlBool(b *bool, def bool) bool {
+	if b == nil {
+		return def
+	}
+
+	return *b
+}
+
+// xmlPeriod returns the value of an optional duration element, or def if it is
+// omitted.
+func xmlPeriod(s *string, def string) (period.Period, error) {
+	if s == nil {
+		return period.MustParse(def), nil
+	}
+
+	return StringToPeriod(*s)
+}
+
+const taskXMLNamespace = "http://schemas.microsoft.com/windows/2004/02/mit/task"
+
+// taskXML returns the XML-formatted definition of a task, laid out the way the
+// Task Scheduler exports it, so that ParseTaskXML returns def again. Elements
+// that were added after version 1.2 of the schema are only written when they are
+// set, so that tasks compatible with older versions stay valid. A CustomTrigger
+// cannot be written, as its schedule is unknown.
+func taskXML(def Definition) (string, error) {
+	w := &xmlWriter{}
+	w.WriteString(`<?xml version="1.0" encoding="UTF-16"?>` + "\n")
+	if err := w.task(def, "xmlns", taskXMLNamespace); err != nil {
+		return "", err
+	}
+
+	return w.String(), nil
+}
+
+// task writes the Task element of a definition, with attrs after its version.
+func (w *xmlWriter) task(def Definition, attrs ...string) error {
+	version, err := xmlTaskVersion(def.Settings.Compatibility)
+	if err != nil {
+		return err
+	}
+
+	w.open("Task", append([]string{"version", version}, attrs...)...)
+
+	info := def.RegistrationInfo
+	w.open("RegistrationInfo")
+	w.element("Date", TimeToTaskDate(info.Date))
+	w.element("Author", info.Author)
+	w.element("Version", info.Version)
+	w.element("Description", info.Description)
+	w.element("URI", info.URI)
+	w.element("Source", info.Source)
+	w.element("Documentation", info.Documentation)
+	w.element("SecurityDescriptor", info.SecurityDescriptor)
+	w.close("RegistrationInfo")
+
+	w.open("Triggers")
+	for _, trigger := range def.Triggers {
+		if err := w.trigger(trigger); err != nil {
+			return err
+		}
+	}
+	w.close("Triggers")
+
+	if err := w.principal(def.Principal); err != nil {
+		return err
+	}
+	if err := w.settings(def.Settings); err != nil {
+		return err
+	}
+
+	w.open("Actions", "Context", def.Context)
+	for _, action := range def.Actions {
+		switch action := action.(type) {
+		case ExecAction:
+			w.open("Exec", "id", action.ID)
+			w.element("Command", action.Path)
+			w.element("Arguments", action.Args)
+			w.element("WorkingDirectory", action.WorkingDir)
+			w.close("Exec")
+		case ComHandlerAction:
+			w.open("ComHandler", "id", action.ID)
+			w.element("ClassId", action.ClassID)
+			w.element("Data", action.Data)
+			w.close("ComHandler")
+		default:
+			return fmt.Errorf("%s actions cannot be written as XML", action.GetType())
+		}
+	}
+	w.close("Actions")
+	w.element("Data", def.Data)
+	w.close("Task")
+
+	return nil
+}
+
+// xmlLogonType returns the name of a logon type in the schema; "" for
+// TASK_LOGON_NONE.
+func xmlLogonType(t TaskLogonType) (string, error) {
+	switch t {
+	case TASK_LOGON_NONE:
+		return "", nil
+	case TASK_LOGON_PASSWORD:
+		return "Password", nil
+	case TASK_LOGON_S4U:
+		return "S4U", nil
+	case TASK_LOGON_INTERACTIVE_TOKEN:
+		return "InteractiveToken", nil
+	case TASK_LOGON_GROUP:
+		return "Group", nil
+	case TASK_LOGON_SERVICE_ACCOUNT:
+		return "ServiceAccount", nil
+	case TASK_LOGON_INTERACTIVE_TOKEN_OR_PASSWORD:
+		return "InteractiveTokenOrPassword", nil
+	default:
+		return "", fmt.Errorf("unknown logon type %d", t)
+	}
+}
+
+// xmlWriter writes indented XML. The elements of a task are written one by one
+// rather than marshalled from the xmlTask types, as the order the Task Scheduler
+// expects them in differs between triggers.
+type xmlWriter struct {
+	strings.Builder
+	depth int
+	// unsetBoundary is written for the zero start and end boundaries of time
+	// triggers, such as the variable GPP immediate tasks run at
+	unsetBoundary string
+}
+
+// start writes the indentation and start tag of an element, without its closing
+// bracket. Attributes are name and value pairs; those with empty values are
+// omitted.
+func (w *xmlWriter) start(name string, attrs []string) {
+	w.WriteString(strings.Repeat("  ", w.depth))
+	w.WriteString("<" + name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] != "" {
+			w.WriteString(" " + attrs[i] + `="`)
+			xml.EscapeText(w, []byte(attrs[i+1]))
+			w.WriteString(`"`)
+		}
+	}
+}
+
+func (w *xmlWriter) open(name string, attrs ...string) {
+	w.start(name, attrs)
+	w.WriteString(">\n")
+	w.depth++
+}
+
+func (w *xmlWriter) close(name string) {
+	w.depth--
+	w.WriteString(strings.Repeat("  ", w.depth) + "</" + name + ">\n")
+}
+
+// element writes an element with text. It is omitted if text is empty.
+func (w *xmlWriter) element(name, text string, attrs ...string) {
+	if text == "" {
+		return
+	}
+	w.start(name, attrs)
+	w.WriteString(">")
+	xml.EscapeText(w, []byte(text))
+	w.WriteString("</" + name + ">\n")
+}
+
+func (w *xmlWriter) boundary(trigger Trigger, t time.Time) string {
+	if _, ok := trigger.(TimeTrigger); ok && t.IsZero() {
+		return w.unsetBoundary
+	}
+	return TimeToTaskDate(t)
+}
+
+func (w *xmlWriter) empty(name string) {
+	w.start(name, nil)
+	w.WriteString(" />\n")
+}
+
+// names writes an element with an empty element for each bit that is set in
+// set, named after names, such as <DaysOfWeek><Monday /></DaysOfWeek>.
+func (w *xmlWriter) names(name string, names []string, set uint64) {
+	w.open(name)
+	for _, i := range setValues(set) {
+		w.empty(names[i])
+	}
+	w.close(name)
+}
+
+func (w *xmlWriter) trigger(trigger Trigger) error {
+	var name string
+	switch trigger.(type) {
+	case BootTrigger:
+		name = "BootTrigger"
+	case DailyTrigger, WeeklyTrigger, MonthlyTrigger, MonthlyDOWTrigger:
+		name = "CalendarTrigger"
+	case EventTrigger:
+		name = "EventTrigger"
+	case IdleTrigger:
+		name = "IdleTrigger"
+	case LogonTrigger:
+		name = "LogonTrigger"
+	case RegistrationTrigger:
+		name = "RegistrationTrigger"
+	case SessionStateChangeTrigger:
+		name = "SessionStateChangeTrigger"
+	case TimeTrigger:
+		name = "TimeTrigger"
+	default:
+		return fmt.Errorf("%s triggers cannot be written as XML", trigger.GetType())
+	}
+
+	w.open(name, "id", trigger.GetID())
+	if interval := trigger.GetRepetitionInterval(); !interval.IsZero() {
+		w.open("Repetition")
+		w.element("Interval", interval.String())
+		w.element("Duration", PeriodToString(trigger.GetRepetitionDuration()))
+		w.element("StopAtDurationEnd", strconv.FormatBool(trigger.GetStopAtDurationEnd()))
+		w.close("Repetition")
+	}
+	w.element("StartBoundary", w.boundary(trigger, trigger.GetStartBoundary()))
+	w.element("EndBoundary", w.boundary(trigger, trigger.GetEndBoundary()))
+	w.element("ExecutionTimeLimit", PeriodToString(trigger.GetExecutionTimeLimit()))
+	w.element("Enabled", strconv.FormatBool(trigger.GetEnabled()))
+
+	switch t := trigger.(type) {
+	case BootTrigger:
+		w.element("Delay", PeriodToString(t.Delay))
+	case RegistrationTrigger:
+		w.element("Delay", PeriodToString(t.Delay))
+	case LogonTrigger:
+		w.element("UserId", t.UserID)
+		w.element("Delay", PeriodToString(t.Delay))
+	case SessionStateChangeTrigger:
+		stateChange := xmlStateChangeName(t.StateChange)
+		if stateChange == "" {
+			return fmt.Errorf("unknown session state change %d", t.StateChange)
+		}
+		w.element("StateChange", stateChange)
+		w.element("UserId", t.UserId)
+		w.element("Delay", PeriodToString(t.Delay))
+	case EventTrigger:
+		w.element("Subscription", t.Subscription)
+		w.element("Delay", PeriodToString(t.Delay))
+		if len(t.ValueQueries) > 0 {
+			names := make([]string, 0, len(t.ValueQueries))
+			for name := range t.ValueQueries {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			w.open("ValueQueries")
+			for _, name := range names {
+				w.element("Value", t.ValueQueries[name], "name", name)
+			}
+			w.close("ValueQueries")
+		}
+	case TimeTrigger:
+		w.element("RandomDelay", PeriodToString(t.RandomDelay))
+	case DailyTrigger:
+		w.element("RandomDelay", PeriodToString(t.RandomDelay))
+		w.open("ScheduleByDay")
+		w.element("DaysInterval", strconv.Itoa(int(t.DayInterval)))
+		w.close("ScheduleByDay")
+	case WeeklyTrigger:
+		w.element("RandomDelay", PeriodToString(t.RandomDelay))
+		w.open("ScheduleByWeek")
+		w.names("DaysOfWeek", xmlDayNames, uint64(t.DaysOfWeek&AllDays))
+		w.element("WeeksInterval", strconv.Itoa(int(t.WeekInterval)))
+		w.close("ScheduleByWeek")
+	case MonthlyTrigger:
+		w.element("RandomDelay", PeriodToString(t.RandomDelay))
+		w.open("ScheduleByMonth")
+		w.open("DaysOfMonth")
+		for _, day := range setValues(uint64(t.DaysOfMonth & AllDaysOfMonth)) {
+			w.element("Day", strconv.Itoa(day+1))
+		}
+		if t.RunOnLastDayOfMonth {
+			w.element("Day", "Last")
+		}
+		w.close("DaysOfMonth")
+		w.names("Months", xmlMonthNames, uint64(t.MonthsOfYear&AllMonths))
+		w.close("ScheduleByMonth")
+	case MonthlyDOWTrigger:
+		w.element("RandomDelay", PeriodToString(t.RandomDelay))
+		w.open("ScheduleByMonthDayOfWeek")
+		w.open("Weeks")
+		for _, week := range setValues(uint64(t.WeeksOfMonth & AllWeeks)) {
+			if week < 4 {
+				w.element("Week", strconv.Itoa(week+1))
+			}
+		}
+		if t.RunOnLastWeekOfMonth || t.WeeksOfMonth&LastWeek != 0 {
+			w.element("Week", "Last")
+		}
+		w.close("Weeks")
+		w.names("DaysOfWeek", xmlDayNames, uint64(t.DaysOfWeek&AllDays))
+		w.names("Months", xmlMonthNames, uint64(t.MonthsOfYear&AllMonths))
+		w.close("ScheduleByMonthDayOfWeek")
+	}
+	w.close(name)
+
+	return nil
+}
+
+func (w *xmlWriter) principal(p Principal) error {
+	logonType, err := xmlLogonType(p.LogonType)
+	if err != nil {
+		return err
+	}
+
+	w.open("Principals")
+	w.open("Principal", "id", p.ID)
+	w.element("UserId", p.UserID)
+	w.element("GroupId", p.GroupID)
+	w.element("DisplayName", p.Name)
+	w.element("LogonType", logonType)
+	switch p.RunLevel {
+	case TASK_RUNLEVEL_LUA:
+		w.element("RunLevel", "LeastPrivilege")
+	case TASK_RUNLEVEL_HIGHEST:
+		w.element("RunLevel", "HighestAvailable")
+	default:
+		return fmt.Errorf("unknown run level %d", p.RunLevel)
+	}
+	switch p.ProcessTokenSidType {
+	case TASK_PROCESSTOKENSID_DEFAULT:
+	case TASK_PROCESSTOKENSID_NONE:
+		w.element("ProcessTokenSidType", "None")
+	case TASK_PROCESSTOKENSID_UNRESTRICTED:
+		w.element("ProcessTokenSidType", "Unrestricted")
+	default:
+		return fmt.Errorf("unknown process token SID type %d", p.ProcessTokenSidType)
+	}
+	if len(p.RequiredPrivileges) > 0 {
+		w.open("RequiredPrivileges")
+		for _, privilege := range p.RequiredPrivileges {
+			w.element("Privilege", string(privilege))
+		}
+		w.close("RequiredPrivileges")
+	}
+	w.close("Principal")
+	w.close("Principals")
+
+	return nil
+}
+
+func (w *xmlWriter) settings(s TaskSettings) error {
+	var policy string
+	switch s.MultipleInstances {
+	case TASK_INSTANCES_PARALLEL:
+		policy = "Parallel"
+	case TASK_INSTANCES_QUEUE:
+		policy = "Queue"
+	case TASK_INSTANCES_IGNORE_NEW:
+		policy = "IgnoreNew"
+	case TASK_INSTANCES_STOP_EXISTING:
+		policy = "StopExisting"
+	default:
+		return fmt.Errorf("unknown multiple instances policy %d", s.MultipleInstances)
+	}
+
+	w.open("Settings")
+	w.element("MultipleInstancesPolicy", policy)
+	w.element("DisallowStartIfOnBatteries", strconv.FormatBool(s.DontStartOnBatteries))
+	w.element("StopIfGoingOnBatteries", strconv.FormatBool(s.StopIfGoingOnBatteries))
+	w.element("AllowHardTerminate", strconv.FormatBool(s.AllowHardTerminate))
+	w.element("StartWhenAvailable", strconv.FormatBool(s.StartWhenAvailable))
+	w.element("RunOnlyIfNetworkAvailable", strconv.FormatBool(s.RunOnlyIfNetworkAvailable))
+	w.open("IdleSettings")
+	w.element("Duration", xmlDuration(s.IdleSettings.IdleDuration))
+	w.element("WaitTimeout", xmlDuration(s.IdleSettings.WaitTimeout))
+	w.element("StopOnIdleEnd", strconv.FormatBool(s.IdleSettings.StopOnIdleEnd))
+	w.element("RestartOnIdle", strconv.FormatBool(s.IdleSettings.RestartOnIdle))
+	w.close("IdleSettings")
+	w.element("AllowStartOnDemand", strconv.FormatBool(s.AllowDemandStart))
+	w.element("Enabled", strconv.FormatBool(s.Enabled))
+	w.element("Hidden", strconv.FormatBool(s.Hidden))
+	w.element("RunOnlyIfIdle", strconv.FormatBool(s.RunOnlyIfIdle))
+	if s.DisallowStartOnRemoteAppSession {
+		w.element("DisallowStartOnRemoteAppSession", "true")
+	}
+	if s.UseUnifiedSchedulingEngine {
+		w.element("UseUnifiedSchedulingEngine", "true")
+	}
+	w.element("WakeToRun", strconv.FormatBool(s.WakeToRun))
+	w.element("ExecutionTimeLimit", xmlDuration(s.TimeLimit))
+	w.element("DeleteExpiredTaskAfter", s.DeleteExpiredTaskAfter)
+	w.element("Priority", strconv.FormatUint(uint64(s.Priority), 10))
+	if s.RestartCount > 0 || !s.RestartInterval.IsZero() {
+		w.open("RestartOnFailure")
+		w.element("Interval", PeriodToString(s.RestartInterval))
+		w.element("Count", strconv.FormatUint(uint64(s.RestartCount), 10))
+		w.close("RestartOnFailure")
+	}
+	if s.NetworkSettings != (NetworkSettings{}) {
+		w.open("NetworkSettings")
+		w.element("Id", s.NetworkSettings.ID)
+		w.element("Name", s.NetworkSettings.Name)
+		w.close("NetworkSettings")
+	}
+	if m := s.MaintenanceSettings; m != (MaintenanceSettings{}) {
+		w.open("MaintenanceSettings")
+		w.element("Period", PeriodToString(m.Period))
+		w.element("Deadline", PeriodToString(m.Deadline))
+		w.element("Exclusive", strconv.FormatBool(m.Exclusive))
+		w.close("MaintenanceSettings")
+	}
+	if s.Volatile {
+		w.element("Volatile", "true")
+	}
+	w.close("Settings")
+
+	return nil
+}
+
+// xmlTaskVersion maps the compatibility of a task to its version attribute; it
+// is the inverse of xmlCompatibility.
+func xmlTaskVersion(compatibility TaskCompatibility) (string, error) {
+	switch compatibility {
+	case TASK_COMPATIBILITY_AT:
+		return "1.0", nil
+	case TASK_COMPATIBILITY_V1:
+		return "1.1", nil
+	case TASK_COMPATIBILITY_V2:
+		return "1.2", nil
+	case TASK_COMPATIBILITY_V2_1:
+		return "1.3", nil
+	case TASK_COMPATIBILITY_V2_2:
+		return "1.4", nil
+	case TASK_COMPATIBILITY_V2_3:
+		return "1.5", nil
+	case TASK_COMPATIBILITY_V2_4:
+		return "1.6", nil
+	default:
+		return "", fmt.Errorf("unknown compatibility %d", compatibility)
+	}
+}
+
+// xmlStateChangeName is the inverse of xmlSessionStateChange. It returns "" for
+// unknown state changes.
+func xmlStateChangeName(s TaskSessionStateChangeType) string {
+	switch s {
+	case TASK_CONSOLE_CONNECT:
+		return "ConsoleConnect"
+	case TASK_CONSOLE_DISCONNECT:
+		return "ConsoleDisconnect"
+	case TASK_REMOTE_CONNECT:
+		return "RemoteConnect"
+	case TASK_REMOTE_DISCONNECT:
+		return "RemoteDisconnect"
+	case TASK_SESSION_LOCK:
+		return "SessionLock"
+	case TASK_SESSION_UNLOCK:
+		return "SessionUnlock"
+	default:
+		return ""
+	}
+}
+
+// xmlDuration formats a duration element whose schema default is not zero, such
+// as ExecutionTimeLimit, so that a zero duration is written rather than omitted.
+func xmlDuration(p period.Period) string {
+	if p.IsZero() {
+		return "PT0S"
+	}
+
+	return p.String()
+}
@@ -0,0 +1,413 @@
+package taskmaster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/rickb777/period"
+)
+
+const testTaskXML = `<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.3" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <RegistrationInfo>
+    <Date>2024-01-02T15:04:05</Date>
+    <Author>CONTOSO\admin</Author>
+    <Description>Nightly &amp; weekly jobs</Description>
+    <URI>\Vendor\Nightly</URI>
+  </RegistrationInfo>
+  <Triggers>
+    <CalendarTrigger id="daily">
+      <StartBoundary>2024-01-02T03:00:00</StartBoundary>
+      <Enabled>true</Enabled>
+      <Repetition>
+        <Interval>PT1H</Interval>
+        <Duration>PT6H</Duration>
+      </Repetition>
+      <ScheduleByDay>
+        <DaysInterval>2</DaysInterval>
+      </ScheduleByDay>
+    </CalendarTrigger>
+    <CalendarTrigger>
+      <StartBoundary>2024-01-02T03:00:00+02:00</StartBoundary>
+      <Enabled>false</Enabled>
+      <ScheduleByWeek>
+        <DaysOfWeek>
+          <Monday />
+          <Friday />
+        </DaysOfWeek>
+        <WeeksInterval>1</WeeksInterval>
+      </ScheduleByWeek>
+    </CalendarTrigger>
+    <CalendarTrigger>
+      <StartBoundary>2024-01-02T03:00:00</StartBoundary>
+      <ScheduleByMonth>
+        <DaysOfMonth>
+          <Day>1</Day>
+          <Day>15</Day>
+          <Day>Last</Day>
+        </DaysOfMonth>
+        <Months>
+          <January />
+          <July />
+        </Months>
+      </ScheduleByMonth>
+    </CalendarTrigger>
+    <CalendarTrigger>
+      <StartBoundary>2024-01-02T03:00:00</StartBoundary>
+      <ScheduleByMonthDayOfWeek>
+        <Weeks>
+          <Week>2</Week>
+          <Week>Last</Week>
+        </Weeks>
+        <DaysOfWeek>
+          <Sunday />
+        </DaysOfWeek>
+        <Months>
+          <December />
+        </Months>
+      </ScheduleByMonthDayOfWeek>
+    </CalendarTrigger>
+    <BootTrigger>
+      <Delay>PT5M</Delay>
+    </BootTrigger>
+    <LogonTrigger>
+      <UserId>CONTOSO\user</UserId>
+    </LogonTrigger>
+    <EventTrigger>
+      <Subscription>&lt;QueryList&gt;&lt;/QueryList&gt;</Subscription>
+      <ValueQueries>
+        <Value name="id">Event/System/EventID</Value>
+      </ValueQueries>
+    </EventTrigger>
+    <SessionStateChangeTrigger>
+      <StateChange>SessionLock</StateChange>
+    </SessionStateChangeTrigger>
+    <WnfStateChangeTrigger>
+      <StateName>7508BCA3380C960C</StateName>
+    </WnfStateChangeTrigger>
+  </Triggers>
+  <Principals>
+    <Principal id="Author">
+      <UserId>S-1-5-18</UserId>
+      <RunLevel>HighestAvailable</RunLevel>
+      <ProcessTokenSidType>Unrestricted</ProcessTokenSidType>
+      <RequiredPrivileges>
+        <Privilege>SeBackupPrivilege</Privilege>
+      </RequiredPrivileges>
+    </Principal>
+  </Principals>
+  <Settings>
+    <MultipleInstancesPolicy>Parallel</MultipleInstancesPolicy>
+    <DisallowStartIfOnBatteries>false</DisallowStartIfOnBatteries>
+    <ExecutionTimeLimit>PT2H</ExecutionTimeLimit>
+    <IdleSettings>
+      <StopOnIdleEnd>false</StopOnIdleEnd>
+    </IdleSettings>
+    <Priority>4</Priority>
+    <RestartOnFailure>
+      <Interval>PT1M</Interval>
+      <Count>3</Count>
+    </RestartOnFailure>
+    <MaintenanceSettings>
+      <Period>P1D</Period>
+      <Exclusive>true</Exclusive>
+    </MaintenanceSettings>
+  </Settings>
+  <Actions Context="Author">
+    <Exec id="run">
+      <Command>C:\Vendor\nightly.exe</Command>
+      <Arguments>--all</Arguments>
+      <WorkingDirectory>C:\Vendor</WorkingDirectory>
+    </Exec>
+    <ComHandler>
+      <ClassId>{00000000-0000-0000-0000-000000000001}</ClassId>
+      <Data>payload</Data>
+    </ComHandler>
+  </Actions>
+  <Data>custom data</Data>
+</Task>
+`
+
+func TestParseTaskXML(t *testing.T) {
+	def, err := ParseTaskXML(testTaskXML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if def.XMLText != testTaskXML {
+		t.Error("XMLText was not set")
+	}
+	if def.Data != "custom data" || def.Context != "Author" {
+		t.Errorf("unexpected Data %q or Context %q", def.Data, def.Context)
+	}
+
+	info := def.RegistrationInfo
+	if info.Author != `CONTOSO\admin` || info.Description != "Nightly & weekly jobs" || info.URI != `\Vendor\Nightly` {
+		t.Errorf("unexpected registration info %+v", info)
+	}
+	if !info.Date.Equal(time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected registration date %v", info.Date)
+	}
+
+	principal := def.Principal
+	if principal.UserID != "S-1-5-18" || principal.LogonType != TASK_LOGON_SERVICE_ACCOUNT || principal.RunLevel != TASK_RUNLEVEL_HIGHEST {
+		t.Errorf("unexpected principal %+v", principal)
+	}
+	if principal.ProcessTokenSidType != TASK_PROCESSTOKENSID_UNRESTRICTED || len(principal.RequiredPrivileges) != 1 || principal.RequiredPrivileges[0] != SE_BACKUP_NAME {
+		t.Errorf("unexpected principal %+v", principal)
+	}
+
+	settings := def.Settings
+	if settings.Compatibility != TASK_COMPATIBILITY_V2_1 {
+		t.Errorf("want compatibility %s, got %s", TASK_COMPATIBILITY_V2_1, settings.Compatibility)
+	}
+	if !settings.Enabled || !settings.AllowDemandStart || settings.DontStartOnBatteries || !settings.StopIfGoingOnBatteries {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+	if settings.MultipleInstances != TASK_INSTANCES_PARALLEL || settings.Priority != 4 || settings.RestartCount != 3 {
+		t.Errorf("unexpected settings %+v", settings)
+	}
+	if settings.TimeLimit != period.NewHMS(2, 0, 0) || settings.RestartInterval != period.NewHMS(0, 1, 0) {
+		t.Errorf("unexpected time limit %s or restart interval %s", settings.TimeLimit, settings.RestartInterval)
+	}
+	if settings.IdleSettings.StopOnIdleEnd || settings.IdleSettings.IdleDuration != period.NewHMS(0, 10, 0) || settings.IdleSettings.WaitTimeout != period.NewHMS(1, 0, 0) {
+		t.Errorf("unexpected idle settings %+v", settings.IdleSettings)
+	}
+	if settings.MaintenanceSettings.Period != period.NewYMD(0, 0, 1) || !settings.MaintenanceSettings.Exclusive {
+		t.Errorf("unexpected maintenance settings %+v", settings.MaintenanceSettings)
+	}
+
+	if len(def.Actions) != 2 {
+		t.Fatalf("want 2 actions, got %d", len(def.Actions))
+	}
+	wantExec := ExecAction{ID: "run", Path: `C:\Vendor\nightly.exe`, Args: "--all", WorkingDir: `C:\Vendor`}
+	if def.Actions[0] != wantExec {
+		t.Errorf("want action %+v, got %+v", wantExec, def.Actions[0])
+	}
+	wantCOM := ComHandlerAction{ClassID: "{00000000-0000-0000-0000-000000000001}", Data: "payload"}
+	if def.Actions[1] != wantCOM {
+		t.Errorf("want action %+v, got %+v", wantCOM, def.Actions[1])
+	}
+
+	wantTypes := []TaskTriggerType{
+		TASK_TRIGGER_DAILY, TASK_TRIGGER_WEEKLY, TASK_TRIGGER_MONTHLY, TASK_TRIGGER_MONTHLYDOW, TASK_TRIGGER_BOOT,
+		TASK_TRIGGER_LOGON, TASK_TRIGGER_EVENT, TASK_TRIGGER_SESSION_STATE_CHANGE, TASK_TRIGGER_CUSTOM_TRIGGER_01,
+	}
+	if len(def.Triggers) != len(wantTypes) {
+		t.Fatalf("want %d triggers, got %d", len(wantTypes), len(def.Triggers))
+	}
+	for i, trigger := range def.Triggers {
+		if trigger.GetType() != wantTypes[i] {
+			t.Errorf("trigger %d: want type %s, got %s", i, wantTypes[i], trigger.GetType())
+		}
+	}
+
+	daily := def.Triggers[0].(DailyTrigger)
+	if daily.ID != "daily" || !daily.Enabled || daily.DayInterval != EveryOtherDay || daily.RepetitionInterval != period.NewHMS(1, 0, 0) || daily.RepetitionDuration != period.NewHMS(6, 0, 0) {
+		t.Errorf("unexpected daily trigger %+v", daily)
+	}
+	weekly := def.Triggers[1].(WeeklyTrigger)
+	if weekly.Enabled || weekly.DaysOfWeek != Monday|Friday || weekly.WeekInterval != EveryWeek {
+		t.Errorf("unexpected weekly trigger %+v", weekly)
+	}
+	if !weekly.StartBoundary.Equal(time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected weekly start boundary %v", weekly.StartBoundary)
+	}
+	monthly := def.Triggers[2].(MonthlyTrigger)
+	if monthly.DaysOfMonth != One|Fifteen || !monthly.RunOnLastDayOfMonth || monthly.MonthsOfYear != January|July {
+		t.Errorf("unexpected monthly trigger %+v", monthly)
+	}
+	monthlyDOW := def.Triggers[3].(MonthlyDOWTrigger)
+	if monthlyDOW.WeeksOfMonth != Second || !monthlyDOW.RunOnLastWeekOfMonth || monthlyDOW.DaysOfWeek != Sunday || monthlyDOW.MonthsOfYear != December {
+		t.Errorf("unexpected monthly day of week trigger %+v", monthlyDOW)
+	}
+	if boot := def.Triggers[4].(BootTrigger); boot.Delay != period.NewHMS(0, 5, 0) {
+		t.Errorf("unexpected boot trigger %+v", boot)
+	}
+	if logon := def.Triggers[5].(LogonTrigger); logon.UserID != `CONTOSO\user` {
+		t.Errorf("unexpected logon trigger %+v", logon)
+	}
+	event := def.Triggers[6].(EventTrigger)
+	if event.Subscription != "<QueryList></QueryList>" || event.ValueQueries["id"] != "Event/System/EventID" {
+		t.Errorf("unexpected event trigger %+v", event)
+	}
+	if session := def.Triggers[7].(SessionStateChangeTrigger); session.StateChange != TASK_SESSION_LOCK {
+		t.Errorf("unexpected session state change trigger %+v", session)
+	}
+}
+
+func TestParseTaskXMLDefaults(t *testing.T) {
+	def, err := ParseTaskXML(`<Task xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task"><Actions><Exec><Command>cmd.exe</Command></Exec></Actions></Task>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := DefaultDefinition()
+	want.RegistrationInfo.Date = time.Time{}
+	want.Principal.LogonType = TASK_LOGON_NONE
+	want.AddAction(ExecAction{Path: "cmd.exe"})
+	want.XMLText = def.XMLText
+	if changes := DiffDefinitions(want, def); len(changes) != 0 {
+		t.Errorf("want the default definition, got changes %v", changes)
+	}
+	if !def.Settings.Enabled {
+		t.Error("want the task enabled by default")
+	}
+}
+
+func TestParseTaskXMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+	}{
+		{name: "malformed", xml: `<Task>`},
+		{name: "unknown version", xml: `<Task version="9.9"></Task>`},
+		{name: "e-mail action", xml: `<Task><Actions><SendEmail /></Actions></Task>`},
+		{name: "bad logon type", xml: `<Task><Principals><Principal><LogonType>Magic</LogonType></Principal></Principals></Task>`},
+		{name: "bad duration", xml: `<Task><Settings><ExecutionTimeLimit>2 hours</ExecutionTimeLimit></Settings></Task>`},
+		{name: "bad day of week", xml: `<Task><Triggers><CalendarTrigger><ScheduleByWeek><DaysOfWeek><Someday /></DaysOfWeek></ScheduleByWeek></CalendarTrigger></Triggers></Task>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseTaskXML(tt.xml); err == nil {
+				t.Error("want an error, got none")
+			}
+		})
+	}
+}
+
+func TestReadTaskXMLUTF16(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xFE})
+	for _, unit := range utf16.Encode([]rune(testTaskXML)) {
+		binary.Write(&buf, binary.LittleEndian, unit)
+	}
+
+	def, err := ReadTaskXML(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.RegistrationInfo.URI != `\Vendor\Nightly` || !strings.HasPrefix(def.XMLText, "<?xml") {
+		t.Errorf("unexpected definition %+v", def.RegistrationInfo)
+	}
+}
+
+// testFullDefinition returns a definition with a trigger of every type and most
+// fields set to something other than their defaults.
+func testFullDefinition() Definition {
+	at := func(hour int) time.Time { return time.Date(2024, 5, 1, hour, 0, 0, 0, time.UTC) }
+	repeating := TaskTrigger{
+		Enabled:            true,
+		StartBoundary:      at(3),
+		EndBoundary:        at(23),
+		ExecutionTimeLimit: period.NewHMS(2, 0, 0),
+		ID:                 "repeating",
+		RepetitionPattern: RepetitionPattern{
+			RepetitionDuration: period.NewHMS(6, 0, 0),
+			RepetitionInterval: period.NewHMS(0, 30, 0),
+			StopAtDurationEnd:  true,
+		},
+	}
+
+	def := DefaultDefinition()
+	def.RegistrationInfo = RegistrationInfo{
+		Author:             `CONTOSO\admin`,
+		Date:               at(1),
+		Description:        "Nightly & weekly 'jobs'\nsecond line",
+		Documentation:      "https://example.com/jobs",
+		SecurityDescriptor: "D:(A;;FA;;;BA)",
+		Source:             "taskmaster",
+		URI:                `\Vendor\Nightly`,
+		Version:            "1.2.3",
+	}
+	def.Principal = Principal{
+		Name:                "Backup service",
+		ID:                  "Author",
+		LogonType:           TASK_LOGON_S4U,
+		RunLevel:            TASK_RUNLEVEL_HIGHEST,
+		UserID:              `CONTOSO\svc-backup`,
+		ProcessTokenSidType: TASK_PROCESSTOKENSID_UNRESTRICTED,
+		RequiredPrivileges:  []Privilege{SE_BACKUP_NAME, SE_RESTORE_NAME},
+	}
+	def.Context = "Author"
+	def.Settings.Compatibility = TASK_COMPATIBILITY_V2_2
+	def.Settings.DeleteExpiredTaskAfter = "P30D"
+	def.Settings.DontStartOnBatteries = false
+	def.Settings.TimeLimit = period.Period{}
+	def.Settings.MultipleInstances = TASK_INSTANCES_STOP_EXISTING
+	def.Settings.IdleSettings = IdleSettings{IdleDuration: period.NewHMS(0, 5, 0), RestartOnIdle: true, WaitTimeout: period.NewHMS(2, 0, 0)}
+	def.Settings.NetworkSettings = NetworkSettings{ID: "{F0001111-0000-0000-0000-0000FEEDACDC}", Name: "Office"}
+	def.Settings.Priority = 5
+	def.Settings.RestartCount = 3
+	def.Settings.RestartInterval = period.NewHMS(0, 10, 0)
+	def.Settings.StartWhenAvailable = true
+	def.Settings.WakeToRun = true
+	def.Settings.DisallowStartOnRemoteAppSession = true
+	def.Settings.UseUnifiedSchedulingEngine = true
+	def.Settings.Volatile = true
+	def.Settings.MaintenanceSettings = MaintenanceSettings{Period: period.NewHMS(24, 0, 0), Deadline: period.NewHMS(48, 0, 0), Exclusive: true}
+
+	def.AddAction(ExecAction{ID: "backup", Path: `C:\Tools\backup.exe`, Args: `--target "D:\Backups" --tag 100%`, WorkingDir: `C:\Tools`})
+	def.AddTrigger(TimeTrigger{TaskTrigger: repeating, RandomDelay: period.NewHMS(0, 15, 0)})
+	def.AddTrigger(DailyTrigger{TaskTrigger: repeating, DayInterval: EveryOtherDay, RandomDelay: period.NewHMS(0, 5, 0)})
+	def.AddTrigger(WeeklyTrigger{TaskTrigger: repeating, DaysOfWeek: Monday | Friday, WeekInterval: EveryOtherWeek, RandomDelay: period.NewHMS(0, 5, 0)})
+	def.AddTrigger(MonthlyTrigger{TaskTrigger: repeating, DaysOfMonth: One | Fifteen, MonthsOfYear: January | July, RunOnLastDayOfMonth: true, RandomDelay: period.NewHMS(0, 5, 0)})
+	def.AddTrigger(MonthlyDOWTrigger{TaskTrigger: repeating, DaysOfWeek: Sunday, MonthsOfYear: AllMonths, WeeksOfMonth: First | Third, RunOnLastWeekOfMonth: true})
+	def.AddTrigger(BootTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Delay: period.NewHMS(0, 5, 0)})
+	def.AddTrigger(LogonTrigger{TaskTrigger: TaskTrigger{Enabled: false, ID: "logon"}, Delay: period.NewHMS(0, 1, 0), UserID: `CONTOSO\alice`})
+	def.AddTrigger(IdleTrigger{TaskTrigger: TaskTrigger{Enabled: true}})
+	def.AddTrigger(RegistrationTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Delay: period.NewHMS(0, 0, 30)})
+	def.AddTrigger(SessionStateChangeTrigger{TaskTrigger: TaskTrigger{Enabled: true}, Delay: period.NewHMS(0, 2, 0), StateChange: TASK_SESSION_UNLOCK, UserId: `CONTOSO\alice`})
+	def.AddTrigger(EventTrigger{
+		TaskTrigger:  TaskTrigger{Enabled: true, StartBoundary: at(0)},
+		Delay:        period.NewHMS(0, 0, 10),
+		Subscription: `<QueryList><Query Id="0" Path="System"><Select Path="System">*[System[EventID=41]]</Select></Query></QueryList>`,
+		ValueQueries: map[string]string{"Source": "Event/System/Provider/@Name", "ID": "Event/System/EventID"},
+	})
+
+	return def
+}
+
+func TestTaskXMLRoundTrip(t *testing.T) {
+	def := testFullDefinition()
+	def.AddAction(ComHandlerAction{ID: "notify", ClassID: "{F0001111-0000-0000-0000-0000FEEDACDC}", Data: "<data />"})
+	def.Data = "payload & more"
+
+	xmlText, err := taskXML(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseTaskXML(xmlText)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, xmlText)
+	}
+	def.XMLText = xmlText
+	if changes := DiffDefinitions(def, parsed); len(changes) != 0 {
+		t.Errorf("round trip changed %v\n%s", changes, xmlText)
+	}
+	if !strings.HasPrefix(xmlText, `<?xml version="1.0" encoding="UTF-16"?>`+"\n"+`<Task version="1.4" xmlns=`) {
+		t.Errorf("unexpected XML header:\n%s", xmlText)
+	}
+
+	// elements added after version 1.2 of the schema are left out when unset
+	def = DefaultDefinition()
+	def.AddAction(ExecAction{Path: "cmd.exe"})
+	if xmlText, err = taskXML(def); err != nil {
+		t.Fatal(err)
+	}
+	for _, element := range []string{"<Volatile>", "<UseUnifiedSchedulingEngine>", "<MaintenanceSettings>", "<ProcessTokenSidType>"} {
+		if strings.Contains(xmlText, element) {
+			t.Errorf("XML of a version 1.2 task contains %s:\n%s", element, xmlText)
+		}
+	}
+
+	def.AddTrigger(CustomTrigger{})
+	if _, err := taskXML(def); err == nil {
+		t.Error("writing a custom trigger did not fail")
+	}
+}
@@ -1,6 +1,3 @@
-//go:build windows
-// +build windows
-
 package taskmaster
 
 import (
@@ -408,6 +405,117 @@ func (t TaskLogonType) String() string {
 	}
 }
 
+// TaskProcessTokenSidType specifies the type of process security identifier (SID)
+// that is used when the task runs. Its zero value is TASK_PROCESSTOKENSID_DEFAULT,
+// so unlike the other enumerations its values do not match the numbering of
+// TASK_PROCESSTOKENSID_TYPE.
+// https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/ne-taskschd-task_processtokensid_type
+type TaskProcessTokenSidType uint
+
+const (
+	TASK_PROCESSTOKENSID_DEFAULT      TaskProcessTokenSidType = iota // the task runs with the default SID type of its principal
+	TASK_PROCESSTOKENSID_NONE                                        // no changes will be made to the process token groups list
+	TASK_PROCESSTOKENSID_UNRESTRICTED                                // a task SID that is derived from the task name will be added to the process token groups list, and the token default discretionary access control list (DACL) will be modified to allow only the task SID and local system full control and the account SID read control
+)
+
+// the TASK_PROCESSTOKENSID_TYPE values used by IPrincipal2
+const (
+	comProcessTokenSidNone         = 0
+	comProcessTokenSidUnrestricted = 1
+	comProcessTokenSidDefault      = 2
+)
+
+func (t TaskProcessTokenSidType) String() string {
+	switch t {
+	case TASK_PROCESSTOKENSID_DEFAULT:
+		return "Default"
+	case TASK_PROCESSTOKENSID_NONE:
+		return "None"
+	case TASK_PROCESSTOKENSID_UNRESTRICTED:
+		return "Unrestricted"
+	default:
+		return ""
+	}
+}
+
+func (t TaskProcessTokenSidType) comValue() int {
+	switch t {
+	case TASK_PROCESSTOKENSID_NONE:
+		return comProcessTokenSidNone
+	case TASK_PROCESSTOKENSID_UNRESTRICTED:
+		return comProcessTokenSidUnrestricted
+	default:
+		return comProcessTokenSidDefault
+	}
+}
+
+func processTokenSidTypeFromCOM(v int64) TaskProcessTokenSidType {
+	switch v {
+	case comProcessTokenSidNone:
+		return TASK_PROCESSTOKENSID_NONE
+	case comProcessTokenSidUnrestricted:
+		return TASK_PROCESSTOKENSID_UNRESTRICTED
+	default:
+		return TASK_PROCESSTOKENSID_DEFAULT
+	}
+}
+
+// Privilege is the name of a user right that a task can be restricted to with
+// Principal.RequiredPrivileges.
+// https://docs.microsoft.com/en-us/windows/win32/secauthz/privilege-constants
+type Privilege string
+
+const (
+	SE_ASSIGNPRIMARYTOKEN_NAME     Privilege = "SeAssignPrimaryTokenPrivilege"
+	SE_AUDIT_NAME                  Privilege = "SeAuditPrivilege"
+	SE_BACKUP_NAME                 Privilege = "SeBackupPrivilege"
+	SE_CHANGE_NOTIFY_NAME          Privilege = "SeChangeNotifyPrivilege"
+	SE_CREATE_GLOBAL_NAME          Privilege = "SeCreateGlobalPrivilege"
+	SE_CREATE_PAGEFILE_NAME        Privilege = "SeCreatePagefilePrivilege"
+	SE_CREATE_PERMANENT_NAME       Privilege = "SeCreatePermanentPrivilege"
+	SE_CREATE_SYMBOLIC_LINK_NAME   Privilege = "SeCreateSymbolicLinkPrivilege"
+	SE_CREATE_TOKEN_NAME           Privilege = "SeCreateTokenPrivilege"
+	SE_DEBUG_NAME                  Privilege = "SeDebugPrivilege"
+	SE_ENABLE_DELEGATION_NAME      Privilege = "SeEnableDelegationPrivilege"
+	SE_IMPERSONATE_NAME            Privilege = "SeImpersonatePrivilege"
+	SE_INC_BASE_PRIORITY_NAME      Privilege = "SeIncreaseBasePriorityPrivilege"
+	SE_INCREASE_QUOTA_NAME         Privilege = "SeIncreaseQuotaPrivilege"
+	SE_INC_WORKING_SET_NAME        Privilege = "SeIncreaseWorkingSetPrivilege"
+	SE_LOAD_DRIVER_NAME            Privilege = "SeLoadDriverPrivilege"
+	SE_LOCK_MEMORY_NAME            Privilege = "SeLockMemoryPrivilege"
+	SE_MACHINE_ACCOUNT_NAME        Privilege = "SeMachineAccountPrivilege"
+	SE_MANAGE_VOLUME_NAME          Privilege = "SeManageVolumePrivilege"
+	SE_PROF_SINGLE_PROCESS_NAME    Privilege = "SeProfileSingleProcessPrivilege"
+	SE_RELABEL_NAME                Privilege = "SeRelabelPrivilege"
+	SE_REMOTE_SHUTDOWN_NAME        Privilege = "SeRemoteShutdownPrivilege"
+	SE_RESTORE_NAME                Privilege = "SeRestorePrivilege"
+	SE_SECURITY_NAME               Privilege = "SeSecurityPrivilege"
+	SE_SHUTDOWN_NAME               Privilege = "SeShutdownPrivilege"
+	SE_SYNC_AGENT_NAME             Privilege = "SeSyncAgentPrivilege"
+	SE_SYSTEM_ENVIRONMENT_NAME     Privilege = "SeSystemEnvironmentPrivilege"
+	SE_SYSTEM_PROFILE_NAME         Privilege = "SeSystemProfilePrivilege"
+	SE_SYSTEMTIME_NAME             Privilege = "SeSystemtimePrivilege"
+	SE_TAKE_OWNERSHIP_NAME         Privilege = "SeTakeOwnershipPrivilege"
+	SE_TCB_NAME                    Privilege = "SeTcbPrivilege"
+	SE_TIME_ZONE_NAME              Privilege = "SeTimeZonePrivilege"
+	SE_TRUSTED_CREDMAN_ACCESS_NAME Privilege = "SeTrustedCredManAccessPrivilege"
+	SE_UNDOCK_NAME                 Privilege = "SeUndockPrivilege"
+	SE_UNSOLICITED_INPUT_NAME      Privilege = "SeUnsolicitedInputPrivilege"
+)
+
+// knownPrivileges are the privileges the task scheduler schema accepts in RequiredPrivileges.
+var knownPrivileges = map[Privilege]struct{}{
+	SE_ASSIGNPRIMARYTOKEN_NAME: {}, SE_AUDIT_NAME: {}, SE_BACKUP_NAME: {}, SE_CHANGE_NOTIFY_NAME: {},
+	SE_CREATE_GLOBAL_NAME: {}, SE_CREATE_PAGEFILE_NAME: {}, SE_CREATE_PERMANENT_NAME: {}, SE_CREATE_SYMBOLIC_LINK_NAME: {},
+	SE_CREATE_TOKEN_NAME: {}, SE_DEBUG_NAME: {}, SE_ENABLE_DELEGATION_NAME: {}, SE_IMPERSONATE_NAME: {},
+	SE_INC_BASE_PRIORITY_NAME: {}, SE_INCREASE_QUOTA_NAME: {}, SE_INC_WORKING_SET_NAME: {}, SE_LOAD_DRIVER_NAME: {},
+	SE_LOCK_MEMORY_NAME: {}, SE_MACHINE_ACCOUNT_NAME: {}, SE_MANAGE_VOLUME_NAME: {}, SE_PROF_SINGLE_PROCESS_NAME: {},
+	SE_RELABEL_NAME: {}, SE_REMOTE_SHUTDOWN_NAME: {}, SE_RESTORE_NAME: {}, SE_SECURITY_NAME: {},
+	SE_SHUTDOWN_NAME: {}, SE_SYNC_AGENT_NAME: {}, SE_SYSTEM_ENVIRONMENT_NAME: {}, SE_SYSTEM_PROFILE_NAME: {},
+	SE_SYSTEMTIME_NAME: {}, SE_TAKE_OWNERSHIP_NAME: {}, SE_TCB_NAME: {}, SE_TIME_ZONE_NAME: {},
+	SE_TRUSTED_CREDMAN_ACCESS_NAME: {}, SE_UNDOCK_NAME: {}, SE_UNSOLICITED_INPUT_NAME: {},
+}
+
 // TaskRunFlags specifies how a task will be executed.
 // https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/ne-taskschd-task_run_flags
 type TaskRunFlags uint
@@ -611,6 +719,11 @@ type TaskService struct {
 	connectedDomain       string
 	connectedComputerName string
 	connectedUser         string
+	// the credentials given to ConnectWithOptions, which are also used to read
+	// the event log of a remote computer
+	loginDomain   string
+	loginUser     string
+	loginPassword string
 }
 
 type TaskFolder struct {
@@ -650,6 +763,26 @@ type RegisteredTask struct {
 	LastTaskResult TaskResult // the results that were returned the last time the registered task was run
 }
 
+// TaskSummary holds the properties of a registered task that can be read without
+// parsing its definition. Use TaskService.GetTaskDefinition to fetch the definition
+// of a summarized task.
+type TaskSummary struct {
+	Name           string     // the name of the registered task
+	Path           string     // the path to where the registered task is stored
+	Enabled        bool       // whether the registered task is enabled
+	State          TaskState  // the operational state of the registered task
+	MissedRuns     uint       // the number of times the registered task has missed a scheduled run
+	NextRunTime    time.Time  // the time when the registered task is next scheduled to run
+	LastRunTime    time.Time  // the time the registered task was last run
+	LastTaskResult TaskResult // the results that were returned the last time the registered task was run
+}
+
+// RunningTaskCollection is a collection of running tasks.
+type RunningTaskCollection []RunningTask
+
+// RegisteredTaskCollection is a collection of registered tasks.
+type RegisteredTaskCollection []RegisteredTask
+
 // Definition defines all the components of a task, such as the task settings, triggers, actions, and registration information
 // https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nn-taskschd-itaskdefinition
 type Definition struct {
@@ -691,6 +824,7 @@ type ComHandlerAction struct {
 
 // Principal provides security credentials that define the security context for the tasks that are associated with it.
 // https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nn-taskschd-iprincipal
+// https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nn-taskschd-iprincipal2
 type Principal struct {
 	Name      string        // the name of the principal
 	GroupID   string        // the identifier of the user group that is required to run the tasks
@@ -698,6 +832,9 @@ type Principal struct {
 	LogonType TaskLogonType // the security logon method that is required to run the tasks
 	RunLevel  TaskRunLevel  // the identifier that is used to specify the privilege level that is required to run the tasks
 	UserID    string        // the user identifier that is required to run the tasks
+
+	ProcessTokenSidType TaskProcessTokenSidType // the task SID type that is used when the task runs. Requires TASK_COMPATIBILITY_V2_1 or above unless it is TASK_PROCESSTOKENSID_DEFAULT
+	RequiredPrivileges  []Privilege             // the user rights the task runs with; when empty the task gets all privileges of its principal. Requires TASK_COMPATIBILITY_V2_1 or above
 }
 
 // RegistrationInfo provides the administrative information that can be used to describe the task
@@ -715,6 +852,7 @@ type RegistrationInfo struct {
 
 // TaskSettings provides the settings that the Task Scheduler service uses to perform the task
 // https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nn-taskschd-itasksettings
+// https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nn-taskschd-itasksettings3
 type TaskSettings struct {
 	AllowDemandStart       bool              // indicates that the task can be started by using either the Run command or the Context menu
 	AllowHardTerminate     bool              // indicates that the task may be terminated by the Task Scheduler service using TerminateProcess
@@ -735,6 +873,20 @@ type TaskSettings struct {
 	StartWhenAvailable        bool          // indicates that the Task Scheduler can start the task at any time after its scheduled time has passed
 	StopIfGoingOnBatteries    bool          // indicates that the task will be stopped if the computer is going onto batteries
 	WakeToRun                 bool          // indicates that the Task Scheduler will wake the computer when it is time to run the task, and keep the computer awake until the task is completed
+
+	DisallowStartOnRemoteAppSession bool                // indicates that the task will not be started if triggered to run in a Remote Applications Integrated Locally (RAIL) session
+	UseUnifiedSchedulingEngine      bool                // indicates that the Unified Scheduling Engine will be used to run the task
+	Volatile                        bool                // indicates that the task will be disabled when it is not used by its owning service; requires TASK_COMPATIBILITY_V2_2 or above
+	MaintenanceSettings             MaintenanceSettings // the settings for running the task during automatic maintenance; requires TASK_COMPATIBILITY_V2_2 or above
+}
+
+// MaintenanceSettings specifies how the Task Scheduler performs a task during
+// automatic maintenance. A zero Period means the task is not a maintenance task.
+// https://docs.microsoft.com/en-us/windows/desktop/api/taskschd/nn-taskschd-imaintenancesettings
+type MaintenanceSettings struct {
+	Period    period.Period // the amount of time the task needs to be started during automatic maintenance once; at least one day
+	Deadline  period.Period // the amount of time after which the Task Scheduler attempts to run the task during emergency automatic maintenance, if it did not complete during regular maintenance; not less than Period
+	Exclusive bool          // indicates that the task should be started during automatic maintenance in exclusive mode, with no other maintenance tasks running
 }
 
 // IdleSettings specifies how the Task Scheduler performs tasks when the computer is in an idle condition.
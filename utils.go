@@ -1,10 +1,8 @@
-//go:build windows
-// +build windows
-
 package taskmaster
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
@@ -69,3 +67,16 @@ func PeriodToString(p period.Period) string {
 
 	return s
 }
+
+// conversionWarnings collects the warnings of a conversion between task formats, without duplicates.
+type conversionWarnings []string
+
+func (w *conversionWarnings) warnf(format string, args ...any) {
+	warning := fmt.Sprintf(format, args...)
+	for _, existing := range *w {
+		if existing == warning {
+			return
+		}
+	}
+	*w = append(*w, warning)
+}
@@ -5,6 +5,7 @@ package taskmaster
 
 import (
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -24,6 +25,59 @@ func validateDefinition(def Definition) error {
 	if def.Principal.UserID != "" && def.Principal.GroupID != "" {
 		return ErrInvalidPrincipal
 	}
+	if err = validatePrincipal2(def.Principal, def.Settings.Compatibility); err != nil {
+		return err
+	}
+	if err = validateSettings3(def.Settings); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validatePrincipal2 validates the IPrincipal2 properties of a principal, which only
+// Task Scheduler 2.1 (Windows 7) and above understand.
+func validatePrincipal2(principal Principal, compatibility TaskCompatibility) error {
+	if principal.ProcessTokenSidType > TASK_PROCESSTOKENSID_UNRESTRICTED {
+		return errors.New("invalid principal: invalid ProcessTokenSidType")
+	}
+	for _, privilege := range principal.RequiredPrivileges {
+		if _, ok := knownPrivileges[privilege]; !ok {
+			return fmt.Errorf("invalid principal: unknown required privilege %q", privilege)
+		}
+	}
+
+	if (principal.ProcessTokenSidType != TASK_PROCESSTOKENSID_DEFAULT || len(principal.RequiredPrivileges) > 0) && compatibility < TASK_COMPATIBILITY_V2_1 {
+		return errors.New("invalid principal: ProcessTokenSidType and RequiredPrivileges require TASK_COMPATIBILITY_V2_1 or above")
+	}
+
+	return nil
+}
+
+// validateSettings3 validates the ITaskSettings3 properties of the settings, which
+// only Task Scheduler 2.2 (Windows 8) and above understand.
+func validateSettings3(settings TaskSettings) error {
+	if (settings.Volatile || settings.MaintenanceSettings != MaintenanceSettings{}) && settings.Compatibility < TASK_COMPATIBILITY_V2_2 {
+		return errors.New("invalid settings: Volatile and MaintenanceSettings require TASK_COMPATIBILITY_V2_2 or above")
+	}
+
+	return validateMaintenanceSettings(settings.MaintenanceSettings)
+}
+
+func validateMaintenanceSettings(m MaintenanceSettings) error {
+	if m.Period.IsZero() {
+		if !m.Deadline.IsZero() || m.Exclusive {
+			return errors.New("invalid MaintenanceSettings: Period is required")
+		}
+		return nil
+	}
+
+	// Task Scheduler rejects these with an opaque "out of range" error
+	if m.Period.DurationApprox() < 24*time.Hour {
+		return errors.New("invalid MaintenanceSettings: Period must be at least 1 day")
+	} else if !m.Deadline.IsZero() && m.Deadline.DurationApprox() < m.Period.DurationApprox() {
+		return errors.New("invalid MaintenanceSettings: Deadline must not be less than Period")
+	}
 
 	return nil
 }
@@ -76,16 +130,16 @@ func validateTriggers(triggers []Trigger) error {
 				return errors.New("invalid MonthlyDOWTrigger: MonthsOfYear is required")
 			} else if t.MonthsOfYear > AllMonths {
 				return errors.New("invalid MonthlyDOWTrigger: invalid MonthsOfYear")
-			} else if t.WeeksOfMonth == 0 {
-				return errors.New("invalid MonthlyDOWTrigger: WeeksOfMonth is required")
+			} else if t.WeeksOfMonth == 0 && !t.RunOnLastWeekOfMonth {
+				return errors.New("invalid MonthlyDOWTrigger: WeeksOfMonth or RunOnLastWeekOfMonth is required")
 			} else if t.WeeksOfMonth > AllWeeks {
 				return errors.New("invalid MonthlyDOWTrigger: invalid WeeksOfMonth")
 			}
 		case MonthlyTrigger:
 			if t.GetStartBoundary().IsZero() {
 				return errors.New("invalid MonthlyTrigger: StartBoundary is required")
-			} else if t.DaysOfMonth == 0 {
-				return errors.New("invalid MonthlyTrigger: DaysOfMonth is required")
+			} else if t.DaysOfMonth == 0 && !t.RunOnLastDayOfMonth {
+				return errors.New("invalid MonthlyTrigger: DaysOfMonth or RunOnLastDayOfMonth is required")
 			} else if t.DaysOfMonth > AllDaysOfMonth {
 				return errors.New("invalid MonthlyTrigger: invalid DaysOfMonth")
 			} else if t.MonthsOfYear == 0 {
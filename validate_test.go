@@ -67,7 +67,11 @@ func TestValidateTriggers(t *testing.T) {
 		{name: "weekly ok", triggers: []Trigger{WeeklyTrigger{DaysOfWeek: Monday, WeekInterval: EveryWeek, TaskTrigger: withStart}}},
 		{name: "weekly missing days", triggers: []Trigger{WeeklyTrigger{WeekInterval: EveryWeek, TaskTrigger: withStart}}, wantErr: true},
 		{name: "monthly ok", triggers: []Trigger{MonthlyTrigger{DaysOfMonth: One, MonthsOfYear: January, TaskTrigger: withStart}}},
+		{name: "monthly last day ok", triggers: []Trigger{MonthlyTrigger{RunOnLastDayOfMonth: true, MonthsOfYear: January, TaskTrigger: withStart}}},
+		{name: "monthly missing days", triggers: []Trigger{MonthlyTrigger{MonthsOfYear: January, TaskTrigger: withStart}}, wantErr: true},
 		{name: "monthly dow ok", triggers: []Trigger{MonthlyDOWTrigger{DaysOfWeek: Monday, WeeksOfMonth: First, MonthsOfYear: January, TaskTrigger: withStart}}},
+		{name: "monthly dow last week ok", triggers: []Trigger{MonthlyDOWTrigger{DaysOfWeek: Monday, RunOnLastWeekOfMonth: true, MonthsOfYear: January, TaskTrigger: withStart}}},
+		{name: "monthly dow missing weeks", triggers: []Trigger{MonthlyDOWTrigger{DaysOfWeek: Monday, MonthsOfYear: January, TaskTrigger: withStart}}, wantErr: true},
 		{name: "time ok", triggers: []Trigger{TimeTrigger{TaskTrigger: withStart}}},
 		{name: "time missing start boundary", triggers: []Trigger{TimeTrigger{}}, wantErr: true},
 		{name: "sub-minute repetition interval", triggers: []Trigger{BootTrigger{TaskTrigger: TaskTrigger{RepetitionPattern: RepetitionPattern{RepetitionInterval: period.NewHMS(0, 0, 30)}}}}, wantErr: true},
@@ -105,6 +109,60 @@ func TestValidateDefinition(t *testing.T) {
 		}
 	})
 
+	t.Run("Principal2 properties", func(t *testing.T) {
+		tests := []struct {
+			name          string
+			principal     Principal
+			compatibility TaskCompatibility
+			wantErr       bool
+		}{
+			{name: "defaults on V2", principal: Principal{}, compatibility: TASK_COMPATIBILITY_V2},
+			{name: "unrestricted on V2_1", principal: Principal{ProcessTokenSidType: TASK_PROCESSTOKENSID_UNRESTRICTED}, compatibility: TASK_COMPATIBILITY_V2_1},
+			{name: "privileges on V2_4", principal: Principal{RequiredPrivileges: []Privilege{SE_BACKUP_NAME, SE_CHANGE_NOTIFY_NAME}}, compatibility: TASK_COMPATIBILITY_V2_4},
+			{name: "none on V2", principal: Principal{ProcessTokenSidType: TASK_PROCESSTOKENSID_NONE}, compatibility: TASK_COMPATIBILITY_V2, wantErr: true},
+			{name: "privileges on V2", principal: Principal{RequiredPrivileges: []Privilege{SE_BACKUP_NAME}}, compatibility: TASK_COMPATIBILITY_V2, wantErr: true},
+			{name: "unknown privilege", principal: Principal{RequiredPrivileges: []Privilege{"SeMadeUpPrivilege"}}, compatibility: TASK_COMPATIBILITY_V2_1, wantErr: true},
+			{name: "invalid sid type", principal: Principal{ProcessTokenSidType: 99}, compatibility: TASK_COMPATIBILITY_V2_1, wantErr: true},
+		}
+		for _, tt := range tests {
+			def := Definition{Actions: []Action{ExecAction{Path: "cmd.exe"}}, Principal: tt.principal}
+			def.Settings.Compatibility = tt.compatibility
+			if err := validateDefinition(def); (err != nil) != tt.wantErr {
+				t.Fatalf("%s: wantErr=%v, got err=%v", tt.name, tt.wantErr, err)
+			}
+		}
+	})
+
+	t.Run("Settings3 properties", func(t *testing.T) {
+		tests := []struct {
+			name          string
+			m             MaintenanceSettings
+			volatile      bool
+			compatibility TaskCompatibility
+			wantErr       bool
+		}{
+			{name: "not a maintenance task", m: MaintenanceSettings{}, compatibility: TASK_COMPATIBILITY_V2},
+			{name: "period only", m: MaintenanceSettings{Period: period.NewYMD(0, 0, 1)}, compatibility: TASK_COMPATIBILITY_V2_2},
+			{name: "deadline after period", m: MaintenanceSettings{Period: period.NewYMD(0, 0, 1), Deadline: period.NewYMD(0, 0, 7), Exclusive: true}, compatibility: TASK_COMPATIBILITY_V2_2},
+			{name: "deadline equals period", m: MaintenanceSettings{Period: period.NewYMD(0, 0, 2), Deadline: period.NewHMS(48, 0, 0)}, compatibility: TASK_COMPATIBILITY_V2_4},
+			{name: "volatile on V2_2", volatile: true, compatibility: TASK_COMPATIBILITY_V2_2},
+			{name: "period under a day", m: MaintenanceSettings{Period: period.NewHMS(12, 0, 0)}, compatibility: TASK_COMPATIBILITY_V2_2, wantErr: true},
+			{name: "deadline before period", m: MaintenanceSettings{Period: period.NewYMD(0, 0, 7), Deadline: period.NewYMD(0, 0, 1)}, compatibility: TASK_COMPATIBILITY_V2_2, wantErr: true},
+			{name: "deadline without period", m: MaintenanceSettings{Deadline: period.NewYMD(0, 0, 1)}, compatibility: TASK_COMPATIBILITY_V2_2, wantErr: true},
+			{name: "maintenance on V2_1", m: MaintenanceSettings{Period: period.NewYMD(0, 0, 1)}, compatibility: TASK_COMPATIBILITY_V2_1, wantErr: true},
+			{name: "volatile on V2", volatile: true, compatibility: TASK_COMPATIBILITY_V2, wantErr: true},
+		}
+		for _, tt := range tests {
+			def := Definition{Actions: []Action{ExecAction{Path: "cmd.exe"}}}
+			def.Settings.MaintenanceSettings = tt.m
+			def.Settings.Volatile = tt.volatile
+			def.Settings.Compatibility = tt.compatibility
+			if err := validateDefinition(def); (err != nil) != tt.wantErr {
+				t.Fatalf("%s: wantErr=%v, got err=%v", tt.name, tt.wantErr, err)
+			}
+		}
+	})
+
 	t.Run("valid definition", func(t *testing.T) {
 		def := Definition{Actions: []Action{ExecAction{Path: "cmd.exe"}}}
 		if err := validateDefinition(def); err != nil {
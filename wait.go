@@ -0,0 +1,119 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// waitPollInterval is how often Wait checks whether a running task has completed.
+const waitPollInterval = 250 * time.Millisecond
+
+// RunResult is the outcome of a run of a task, as observed by Wait.
+type RunResult struct {
+	InstanceGUID string        // the GUID identifier of the run
+	Result       TaskResult    // the result of the run, such as the exit code of its action
+	Started      time.Time     // when the run was first seen running; queued time is excluded
+	Completed    time.Time     // when the run was first seen completed, or zero if it did not complete
+	Duration     time.Duration // how long the run took, accurate to the polling interval
+	EnginePID    uint          // the process ID of the engine (process) the run ran under
+}
+
+// Wait blocks until the running instance of the task completes, or until ctx is
+// done. Use context.WithTimeout to wait for a limited time. Instances that are
+// queued because of TASK_INSTANCES_QUEUE are waited on until they have run.
+//
+// The instance is polled rather than signalled, so the times of the returned
+// RunResult are accurate to a fraction of a second. The Result is the registered
+// task's LastTaskResult once the instance completed; if other instances of the
+// task run at the same time, it may belong to one of them.
+//
+// If ctx is done before the instance completes, Wait returns what it observed so
+// far along with the context's error. The instance is not stopped.
+func (r *RegisteredTask) Wait(ctx context.Context, instance RunningTask) (RunResult, error) {
+	result := RunResult{
+		InstanceGUID: instance.InstanceGUID,
+		EnginePID:    instance.EnginePID,
+	}
+	if instance.State == TASK_STATE_RUNNING {
+		result.Started = time.Now()
+	}
+
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		state, enginePID, found, err := r.instanceState(instance.InstanceGUID)
+		if err != nil {
+			return result, err
+		}
+		now := time.Now()
+
+		if !found {
+			if result.Started.IsZero() {
+				// the instance went from queued to completed between two polls
+				result.Started = now
+			}
+			result.Completed = now
+			result.Duration = result.Completed.Sub(result.Started)
+
+			lastTaskResult, err := r.lastTaskResult()
+			if err != nil {
+				return result, err
+			}
+			result.Result = lastTaskResult
+			r.LastTaskResult = lastTaskResult
+
+			return result, nil
+		}
+
+		if state == TASK_STATE_RUNNING && result.Started.IsZero() {
+			result.Started = now
+		}
+		if enginePID != 0 {
+			result.EnginePID = enginePID
+		}
+
+		select {
+		case <-ctx.Done():
+			if !result.Started.IsZero() {
+				result.Duration = time.Since(result.Started)
+			}
+			return result, fmt.Errorf("error waiting for running task %s: %w", r.Path, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// instanceState returns the state and engine PID of the running instance of the
+// task with the given GUID, and whether the instance is still queued or running.
+// Instances that complete while they are being read count as completed.
+func (r *RegisteredTask) instanceState(instanceGUID string) (TaskState, uint, bool, error) {
+	instances, err := r.GetInstances()
+	if err != nil {
+		return TASK_STATE_UNKNOWN, 0, false, err
+	}
+	defer instances.Release()
+
+	for _, instance := range instances {
+		if strings.EqualFold(instance.InstanceGUID, instanceGUID) {
+			return instance.State, instance.EnginePID, true, nil
+		}
+	}
+
+	return TASK_STATE_UNKNOWN, 0, false, nil
+}
+
+func (r *RegisteredTask) lastTaskResult() (TaskResult, error) {
+	h := &oleHelper{}
+	lastTaskResult := TaskResult(h.getInt(r.taskObj, "LastTaskResult"))
+	if h.err != nil {
+		return 0, fmt.Errorf("error getting last result of registered task %s: %w", r.Path, h.err)
+	}
+
+	return lastTaskResult, nil
+}
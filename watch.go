@@ -0,0 +1,252 @@
+package taskmaster
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// WatchEventType specifies what changed about a task in a WatchEvent.
+type WatchEventType uint
+
+const (
+	TaskCreated           WatchEventType = iota // the task was registered
+	TaskDeleted                                 // the task was deleted
+	TaskDefinitionChanged                       // the definition of the task changed; WatchEvent.Changes lists how
+	TaskEnabled                                 // the task was enabled
+	TaskDisabled                                // the task was disabled
+	TaskStateChanged                            // the state of the task changed, such as from ready to running
+	TaskLastResultChanged                       // the last result of the task changed
+	WatchFailed                                 // the folder could not be polled; WatchEvent.Err holds the error
+)
+
+func (t WatchEventType) String() string {
+	switch t {
+	case TaskCreated:
+		return "Created"
+	case TaskDeleted:
+		return "Deleted"
+	case TaskDefinitionChanged:
+		return "Definition Changed"
+	case TaskEnabled:
+		return "Enabled"
+	case TaskDisabled:
+		return "Disabled"
+	case TaskStateChanged:
+		return "State Changed"
+	case TaskLastResultChanged:
+		return "Last Result Changed"
+	case WatchFailed:
+		return "Watch Failed"
+	default:
+		return ""
+	}
+}
+
+// WatchEvent is a change to a task that a watcher detected.
+type WatchEvent struct {
+	Type    WatchEventType
+	Path    string          // the path of the task, empty for WatchFailed
+	Time    time.Time       // when the change was detected
+	Old     TaskFingerprint // the task before the change, zero for TaskCreated
+	New     TaskFingerprint // the task after the change, zero for TaskDeleted
+	Changes []string        // for TaskDefinitionChanged, the changed fields of the definition, such as "Settings.Priority: 7 -> 4"
+	Err     error           // for WatchFailed, why polling failed
+}
+
+// TaskFingerprint is the part of a registered task a watcher compares between polls.
+type TaskFingerprint struct {
+	Path           string
+	DefinitionHash string // a hash of the definition, excluding Settings.Enabled and XMLText
+	Enabled        bool
+	State          TaskState
+	LastTaskResult TaskResult
+	Definition     Definition
+}
+
+// FingerprintTask returns the fingerprint of a registered task.
+func FingerprintTask(task RegisteredTask) TaskFingerprint {
+	def := task.Definition
+	def.XMLText = ""
+	def.Settings.Enabled = false
+
+	return TaskFingerprint{
+		Path:           task.Path,
+		DefinitionHash: hashDefinition(def),
+		Enabled:        task.Enabled,
+		State:          task.State,
+		LastTaskResult: task.LastTaskResult,
+		Definition:     task.Definition,
+	}
+}
+
+// DiffFingerprints compares two polls of a folder, keyed by task path, and returns
+// the events that turn old into new. Events are ordered by task path.
+func DiffFingerprints(old, new map[string]TaskFingerprint, now time.Time) []WatchEvent {
+	paths := make([]string, 0, len(old)+len(new))
+	for path := range old {
+		paths = append(paths, path)
+	}
+	for path := range new {
+		if _, ok := old[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var events []WatchEvent
+	for _, path := range paths {
+		before, existed := old[path]
+		after, exists := new[path]
+		event := WatchEvent{Path: path, Time: now, Old: before, New: after}
+
+		switch {
+		case !existed:
+			event.Type = TaskCreated
+			events = append(events, event)
+			continue
+		case !exists:
+			event.Type = TaskDeleted
+			events = append(events, event)
+			continue
+		}
+
+		if before.DefinitionHash != after.DefinitionHash {
+			changed := event
+			changed.Type = TaskDefinitionChanged
+			changed.Changes = DiffDefinitions(before.Definition, after.Definition)
+			events = append(events, changed)
+		}
+		if before.Enabled != after.Enabled {
+			toggled := event
+			toggled.Type = TaskDisabled
+			if after.Enabled {
+				toggled.Type = TaskEnabled
+			}
+			events = append(events, toggled)
+		}
+		if before.State != after.State {
+			stateChanged := event
+			stateChanged.Type = TaskStateChanged
+			events = append(events, stateChanged)
+		}
+		if before.LastTaskResult != after.LastTaskResult {
+			resultChanged := event
+			resultChanged.Type = TaskLastResultChanged
+			events = append(events, resultChanged)
+		}
+	}
+
+	return events
+}
+
+// DiffDefinitions returns the fields that differ between two definitions, one per
+// line in the form "Field.Path: old -> new". Settings.Enabled and XMLText are not
+// compared.
+func DiffDefinitions(old, new Definition) []string {
+	old.XMLText, new.XMLText = "", ""
+	old.Settings.Enabled, new.Settings.Enabled = false, false
+
+	var changes []string
+	diffValues("", reflect.ValueOf(old), reflect.ValueOf(new), &changes)
+	return changes
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func diffValues(path string, a, b reflect.Value, changes *[]string) {
+	report := func() {
+		*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, formatDiffValue(a), formatDiffValue(b)))
+	}
+
+	if !a.IsValid() || !b.IsValid() || a.Type() != b.Type() {
+		if a.IsValid() != b.IsValid() || (a.IsValid() && !reflect.DeepEqual(a.Interface(), b.Interface())) {
+			report()
+		}
+		return
+	}
+
+	switch a.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				report()
+			}
+			return
+		}
+		diffValues(path, a.Elem(), b.Elem(), changes)
+	case reflect.Struct:
+		// compare time and other packages' types as a whole; their fields are not meaningful on their own
+		if a.Type() == timeType {
+			if !a.Interface().(time.Time).Equal(b.Interface().(time.Time)) {
+				report()
+			}
+			return
+		} else if a.Type().PkgPath() != reflect.TypeOf(Definition{}).PkgPath() {
+			if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+				report()
+			}
+			return
+		}
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fieldPath := field.Name
+			if path != "" {
+				fieldPath = path + "." + field.Name
+			}
+			diffValues(fieldPath, a.Field(i), b.Field(i), changes)
+		}
+	case reflect.Slice:
+		for i := 0; i < a.Len() || i < b.Len(); i++ {
+			var ai, bi reflect.Value
+			if i < a.Len() {
+				ai = a.Index(i)
+			}
+			if i < b.Len() {
+				bi = b.Index(i)
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), ai, bi, changes)
+		}
+	default:
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			report()
+		}
+	}
+}
+
+func formatDiffValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return "<none>"
+	}
+	if v.Kind() == reflect.String {
+		return fmt.Sprintf("%q", v.String())
+	}
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct && v.Type() != timeType {
+		if _, ok := v.Interface().(fmt.Stringer); !ok {
+			return fmt.Sprintf("%+v", v.Interface())
+		}
+	}
+
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+// nextWatchBackoff returns how long a watcher waits after a failed poll, doubling
+// the previous wait from interval up to max.
+func nextWatchBackoff(previous, interval, max time.Duration) time.Duration {
+	next := previous * 2
+	if next < interval {
+		next = interval
+	}
+	if next > max {
+		next = max
+	}
+
+	return next
+}
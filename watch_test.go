@@ -0,0 +1,101 @@
+package taskmaster
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiffFingerprints(t *testing.T) {
+	def := Definition{Actions: []Action{ExecAction{Path: "cmd.exe"}}}
+	def.Settings.Priority = 7
+	unchanged := FingerprintTask(RegisteredTask{Path: `\Unchanged`, Enabled: true, Definition: def})
+	before := FingerprintTask(RegisteredTask{Path: `\Changed`, Enabled: true, State: TASK_STATE_READY, Definition: def})
+	deleted := FingerprintTask(RegisteredTask{Path: `\Deleted`, Definition: def})
+
+	changedDef := def
+	changedDef.Actions = []Action{ExecAction{Path: "powershell.exe"}}
+	changedDef.Settings.Priority = 4
+	changedDef.Settings.Enabled = true // follows Enabled, so it is not part of the definition diff
+	after := FingerprintTask(RegisteredTask{Path: `\Changed`, Enabled: false, State: TASK_STATE_DISABLED, LastTaskResult: 1, Definition: changedDef})
+	created := FingerprintTask(RegisteredTask{Path: `\Created`, Definition: def})
+
+	old := map[string]TaskFingerprint{unchanged.Path: unchanged, before.Path: before, deleted.Path: deleted}
+	new := map[string]TaskFingerprint{unchanged.Path: unchanged, after.Path: after, created.Path: created}
+
+	now := time.Now()
+	events := DiffFingerprints(old, new, now)
+
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Path+" "+event.Type.String())
+		if !event.Time.Equal(now) {
+			t.Fatalf("expected event time %s, got %s", now, event.Time)
+		}
+	}
+	want := []string{
+		`\Changed Definition Changed`,
+		`\Changed Disabled`,
+		`\Changed State Changed`,
+		`\Changed Last Result Changed`,
+		`\Created Created`,
+		`\Deleted Deleted`,
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("want events %q, got %q", want, got)
+	}
+
+	wantChanges := []string{
+		`Actions[0].Path: "cmd.exe" -> "powershell.exe"`,
+		`Settings.Priority: 7 -> 4`,
+	}
+	if !slices.Equal(events[0].Changes, wantChanges) {
+		t.Fatalf("want changes %q, got %q", wantChanges, events[0].Changes)
+	}
+
+	if events := DiffFingerprints(old, old, now); len(events) != 0 {
+		t.Fatalf("expected no events for identical polls, got %+v", events)
+	}
+}
+
+func TestDiffDefinitions(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	old := Definition{
+		Triggers: []Trigger{DailyTrigger{TaskTrigger: TaskTrigger{StartBoundary: start}, DayInterval: EveryDay}},
+	}
+	new := Definition{
+		Actions:  []Action{ExecAction{Path: "cmd.exe"}},
+		Triggers: []Trigger{BootTrigger{TaskTrigger: TaskTrigger{StartBoundary: start.In(time.FixedZone("", 3600))}}},
+	}
+
+	changes := DiffDefinitions(old, new)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %q", changes)
+	}
+	if changes[0] != `Actions[0]: <none> -> {ID: Path:cmd.exe Args: WorkingDir:}` {
+		t.Fatalf("unexpected added action change %q", changes[0])
+	}
+	if got := changes[1]; got[:len("Triggers[0]: ")] != "Triggers[0]: " {
+		t.Fatalf("unexpected trigger change %q", got)
+	}
+
+	// the same instant in another time zone is not a change
+	new.Actions = nil
+	new.Triggers = []Trigger{DailyTrigger{TaskTrigger: TaskTrigger{StartBoundary: start.In(time.FixedZone("", 3600))}, DayInterval: EveryDay}}
+	if changes := DiffDefinitions(old, new); len(changes) != 0 {
+		t.Fatalf("expected no changes, got %q", changes)
+	}
+}
+
+func TestNextWatchBackoff(t *testing.T) {
+	wait := time.Minute
+	var got []time.Duration
+	for i := 0; i < 5; i++ {
+		wait = nextWatchBackoff(wait, time.Minute, 10*time.Minute)
+		got = append(got, wait)
+	}
+	want := []time.Duration{2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}
+	if !slices.Equal(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+}
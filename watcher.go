@@ -0,0 +1,142 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"context"
+	"time"
+)
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	Interval   time.Duration // how often the folder is polled; one minute if zero
+	MaxBackoff time.Duration // the longest wait between polls after failures; ten times Interval if zero
+
+	// the Task Scheduler service to connect to, as in ConnectWithOptions
+	ServerName string
+	Domain     string
+	Username   string
+	Password   string
+}
+
+// Watch polls the folder at path and all of its subfolders for changes to tasks,
+// and sends a WatchEvent on the returned channel for every change it detects. The
+// tasks present when Watch is called are the baseline and produce no events.
+//
+// Watch connects to the Task Scheduler service on its own goroutine, so it does not
+// share a TaskService with the caller. If a poll fails, for example because the
+// computer is unreachable, a WatchFailed event is sent, the connection is dropped,
+// and polling is retried with exponential backoff up to MaxBackoff. Changes made in
+// the meantime are reported by the first successful poll.
+//
+// The channel is closed once ctx is done. Watch returns an error without starting
+// to watch if the baseline cannot be taken.
+func Watch(ctx context.Context, path string, opts WatchOptions) (<-chan WatchEvent, error) {
+	if len(path) == 0 || path[0] != '\\' {
+		return nil, ErrInvalidPath
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 10 * opts.Interval
+	}
+
+	events := make(chan WatchEvent, 64)
+	baseline := make(chan error, 1)
+	go func() {
+		defer close(events)
+
+		w := watcher{path: path, opts: opts}
+		defer w.disconnect()
+
+		previous, err := w.poll()
+		baseline <- err
+		if err != nil {
+			return
+		}
+
+		wait := opts.Interval
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			current, err := w.poll()
+			if err != nil {
+				w.disconnect()
+				wait = nextWatchBackoff(wait, opts.Interval, opts.MaxBackoff)
+				if !sendWatchEvent(ctx, events, WatchEvent{Type: WatchFailed, Time: time.Now(), Err: err}) {
+					return
+				}
+			} else {
+				wait = opts.Interval
+				for _, event := range DiffFingerprints(previous, current, time.Now()) {
+					if !sendWatchEvent(ctx, events, event) {
+						return
+					}
+				}
+				previous = current
+			}
+			timer.Reset(wait)
+		}
+	}()
+
+	if err := <-baseline; err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func sendWatchEvent(ctx context.Context, events chan<- WatchEvent, event WatchEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// watcher holds the connection of a Watch goroutine.
+type watcher struct {
+	path    string
+	opts    WatchOptions
+	service *TaskService
+}
+
+// poll connects if needed and fingerprints every task in the watched folder tree.
+func (w *watcher) poll() (map[string]TaskFingerprint, error) {
+	if w.service == nil {
+		service, err := ConnectWithOptions(w.opts.ServerName, w.opts.Domain, w.opts.Username, w.opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		w.service = &service
+	}
+
+	folder, err := w.service.GetTaskFolder(w.path)
+	if err != nil {
+		return nil, err
+	}
+	defer folder.Release()
+
+	fingerprints := make(map[string]TaskFingerprint)
+	walkTaskFolder(&folder, func(task RegisteredTask) {
+		fingerprints[task.Path] = FingerprintTask(task)
+	})
+
+	return fingerprints, nil
+}
+
+func (w *watcher) disconnect() {
+	if w.service != nil {
+		w.service.Disconnect()
+		w.service = nil
+	}
+}
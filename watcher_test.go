@@ -0,0 +1,45 @@
+//go:build windows
+// +build windows
+
+package taskmaster
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	taskService := setupTaskService(t)
+	createTestTask(taskService)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	events, err := Watch(ctx, testTaskRoot, WatchOptions{Interval: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := taskService.DeleteTask(testTaskPath("TestTask")); err != nil {
+		t.Fatal(err)
+	}
+
+	for event := range events {
+		if event.Type == WatchFailed {
+			t.Fatal(event.Err)
+		}
+		if event.Type == TaskDeleted && event.Path == testTaskPath("TestTask") {
+			cancel()
+			for range events {
+			}
+			return
+		}
+	}
+	t.Fatal("expected a TaskDeleted event before the watch timed out")
+}
+
+func TestWatchInvalidPath(t *testing.T) {
+	if _, err := Watch(context.Background(), "bad path", WatchOptions{}); err != ErrInvalidPath {
+		t.Fatalf("want ErrInvalidPath, got %v", err)
+	}
+}